@@ -2,9 +2,7 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 )
 
 // BookPrecision represents the precision level for order book data
@@ -23,39 +21,19 @@ const (
 // / GetRawFundingBookWithContext
 func (c *Client) GetRawFundingBookWithContext(ctx context.Context, symbol string) ([]RawFundingBook, error) {
 	endpoint := fmt.Sprintf("%s/v2/book/%s/R0", c.BaseURL, symbol)
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var bitfinexError BitfinexError
-		bitfinexError.StatusCode = resp.StatusCode
-		return nil, &bitfinexError
-	}
-
 	var rawData [][]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawData); err != nil {
+	if err := c.getJSON(ctx, endpoint, &rawData); err != nil {
 		return nil, err
 	}
 
 	// Convert raw data to RawFundingBook
 	rawFundingBook := make([]RawFundingBook, len(rawData))
 	for i, data := range rawData {
-		if len(data) >= 4 {
-			rawFundingBook[i] = RawFundingBook{
-				OfferID: int(data[0].(float64)),
-				Period:  int(data[1].(float64)),
-				Rate:    data[2].(float64),
-				Amount:  data[3].(float64),
-			}
+		book, err := parseRawFundingBookRow(data)
+		if err != nil {
+			return nil, fmt.Errorf("raw funding book row %d: %v", i, err)
 		}
+		rawFundingBook[i] = book
 	}
 
 	return rawFundingBook, nil
@@ -63,41 +41,81 @@ func (c *Client) GetRawFundingBookWithContext(ctx context.Context, symbol string
 
 // GetFundingBookWithContext 使用上下文獲取資金訂單簿
 func (c *Client) GetFundingBookWithContext(ctx context.Context, symbol string, precision BookPrecision) ([]FundingBook, error) {
-	endpoint := fmt.Sprintf("%s/v2/book/%s/%s", c.BaseURL, symbol, precision)
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var bitfinexError BitfinexError
-		bitfinexError.StatusCode = resp.StatusCode
-		return nil, &bitfinexError
+	// Raw books have a different row shape without a count
+	if precision == PrecisionRaw {
+		return nil, fmt.Errorf("precision %s returns raw funding book rows, use GetRawFundingBookWithContext", precision)
 	}
 
+	endpoint := fmt.Sprintf("%s/v2/book/%s/%s", c.BaseURL, symbol, precision)
 	var rawData [][]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawData); err != nil {
+	if err := c.getJSON(ctx, endpoint, &rawData); err != nil {
 		return nil, err
 	}
 
 	// Convert raw data to FundingBook
 	fundingBook := make([]FundingBook, len(rawData))
 	for i, data := range rawData {
-		if len(data) >= 4 {
-			fundingBook[i] = FundingBook{
-				Rate:   data[0].(float64),
-				Period: int(data[1].(float64)),
-				Count:  int(data[2].(float64)),
-				Amount: data[3].(float64),
-			}
+		book, err := parseFundingBookRow(data)
+		if err != nil {
+			return nil, fmt.Errorf("aggregated funding book row %d: %v", i, err)
 		}
+		fundingBook[i] = book
 	}
 
 	return fundingBook, nil
 }
+
+// parseFundingBookRow parses an aggregated (P0-P4) funding book row: [RATE, PERIOD, COUNT, AMOUNT]
+func parseFundingBookRow(data []interface{}) (FundingBook, error) {
+	if len(data) != 4 {
+		return FundingBook{}, fmt.Errorf("expected 4 fields [RATE, PERIOD, COUNT, AMOUNT], got %d", len(data))
+	}
+
+	var book FundingBook
+	var err error
+	if book.Rate, err = numberAt(data, 0, "RATE"); err != nil {
+		return FundingBook{}, err
+	}
+	period, err := numberAt(data, 1, "PERIOD")
+	if err != nil {
+		return FundingBook{}, err
+	}
+	count, err := numberAt(data, 2, "COUNT")
+	if err != nil {
+		return FundingBook{}, err
+	}
+	if book.Amount, err = numberAt(data, 3, "AMOUNT"); err != nil {
+		return FundingBook{}, err
+	}
+
+	book.Period = int(period)
+	book.Count = int(count)
+	return book, nil
+}
+
+// parseRawFundingBookRow parses a raw (R0) funding book row: [OFFER_ID, PERIOD, RATE, AMOUNT]
+func parseRawFundingBookRow(data []interface{}) (RawFundingBook, error) {
+	if len(data) != 4 {
+		return RawFundingBook{}, fmt.Errorf("expected 4 fields [OFFER_ID, PERIOD, RATE, AMOUNT], got %d", len(data))
+	}
+
+	var book RawFundingBook
+	offerID, err := numberAt(data, 0, "OFFER_ID")
+	if err != nil {
+		return RawFundingBook{}, err
+	}
+	period, err := numberAt(data, 1, "PERIOD")
+	if err != nil {
+		return RawFundingBook{}, err
+	}
+	if book.Rate, err = numberAt(data, 2, "RATE"); err != nil {
+		return RawFundingBook{}, err
+	}
+	if book.Amount, err = numberAt(data, 3, "AMOUNT"); err != nil {
+		return RawFundingBook{}, err
+	}
+
+	book.OfferID = int(offerID)
+	book.Period = int(period)
+	return book, nil
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// decodeRow decodes a JSON array as returned in book responses
+func decodeRow(t *testing.T, body string) []interface{} {
+	t.Helper()
+
+	var row []interface{}
+	if err := json.Unmarshal([]byte(body), &row); err != nil {
+		t.Fatalf("failed to decode test data: %v", err)
+	}
+	return row
+}
+
+func TestParseFundingBookRow(t *testing.T) {
+	book, err := parseFundingBookRow(decodeRow(t, `[0.0002,30,12,-5000.5]`))
+	if err != nil {
+		t.Fatalf("parseFundingBookRow: %v", err)
+	}
+	if want := (FundingBook{Rate: 0.0002, Period: 30, Count: 12, Amount: -5000.5}); book != want {
+		t.Errorf("parsed %+v, want %+v", book, want)
+	}
+
+	raw, err := parseRawFundingBookRow(decodeRow(t, `[123456789,2,0.0001,250]`))
+	if err != nil {
+		t.Fatalf("parseRawFundingBookRow: %v", err)
+	}
+	if want := (RawFundingBook{OfferID: 123456789, Period: 2, Rate: 0.0001, Amount: 250}); raw != want {
+		t.Errorf("parsed %+v, want %+v", raw, want)
+	}
+}
+
+func TestParseFundingBookRowMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		body    string
+		wantErr string
+	}{
+		{`[0.0002,30,12]`, "expected 4 fields [RATE, PERIOD, COUNT, AMOUNT], got 3"},
+		{`[0.0002,30,12,100,1]`, "got 5"},
+		{`[0.0002,30,null,100]`, "field COUNT at index 2 is <nil>, not a number"},
+		{`["0.0002",30,12,100]`, "field RATE at index 0 is string, not a number"},
+	} {
+		_, err := parseFundingBookRow(decodeRow(t, tc.body))
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("parseFundingBookRow(%s) error = %v, want %q", tc.body, err, tc.wantErr)
+		}
+	}
+
+	if _, err := parseRawFundingBookRow(decodeRow(t, `[123,2,0.0001]`)); err == nil || !strings.Contains(err.Error(), "[OFFER_ID, PERIOD, RATE, AMOUNT]") {
+		t.Errorf("parseRawFundingBookRow error = %v, want the raw row shape", err)
+	}
+}
+
+func TestGetFundingBookReportsMalformedRow(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[[0.0002,30,12,100],[0.0003,30,"x",100]]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	_, err := c.GetFundingBookWithContext(context.Background(), "fUSD", PrecisionP0)
+	if err == nil || !strings.Contains(err.Error(), "aggregated funding book row 1") {
+		t.Errorf("error = %v, want the malformed aggregated row reported", err)
+	}
+
+	if _, err := c.GetFundingBookWithContext(context.Background(), "fUSD", PrecisionRaw); err == nil {
+		t.Error("R0 precision accepted by GetFundingBookWithContext, want an error")
+	}
+}
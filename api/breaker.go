@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a request is rejected because its endpoint has failed too often
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitState represents the state of a single endpoint's circuit
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // Requests pass through
+	circuitOpen                         // Requests fail fast until the cooldown has elapsed
+	circuitHalfOpen                     // A single probe request is allowed through
+)
+
+// circuit tracks failures for a single endpoint
+type circuit struct {
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// CircuitBreaker stops sending requests to an endpoint after consecutive failures.
+// Once Threshold consecutive failures are recorded the circuit opens and requests fail
+// with ErrCircuitOpen; after Cooldown a single probe is allowed, closing the circuit on
+// success or re-opening it on failure.
+type CircuitBreaker struct {
+	Threshold int           // Consecutive failures before the circuit opens
+	Cooldown  time.Duration // Time the circuit stays open before probing
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// NewCircuitBreaker creates a new circuit breaker
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// getCircuit returns the circuit for the endpoint, creating it if needed; callers must hold mu
+func (b *CircuitBreaker) getCircuit(endpoint string) *circuit {
+	if b.circuits == nil {
+		b.circuits = make(map[string]*circuit)
+	}
+	c, ok := b.circuits[endpoint]
+	if !ok {
+		c = &circuit{}
+		b.circuits[endpoint] = c
+	}
+	return c
+}
+
+// Allow reports whether a request to the endpoint may be sent, returning ErrCircuitOpen if not
+func (b *CircuitBreaker) Allow(endpoint string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.getCircuit(endpoint)
+	switch c.state {
+	case circuitOpen:
+		if time.Since(c.openedAt) < b.Cooldown {
+			return ErrCircuitOpen
+		}
+		// Cooldown elapsed, let this request through as a probe
+		c.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// A probe is already in flight
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// RecordSuccess closes the endpoint's circuit and resets its failure count
+func (b *CircuitBreaker) RecordSuccess(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.getCircuit(endpoint)
+	c.state = circuitClosed
+	c.failures = 0
+}
+
+// RecordFailure counts a failure, opening the circuit once the threshold is reached or a probe fails
+func (b *CircuitBreaker) RecordFailure(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.getCircuit(endpoint)
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= b.Threshold {
+		c.state = circuitOpen
+		c.openedAt = time.Now()
+	}
+}
+
+// release returns a half-open circuit to open without counting a failure, so the next
+// request after the cooldown can probe again (used when the probe was cancelled by the caller)
+func (b *CircuitBreaker) release(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.getCircuit(endpoint)
+	if c.state == circuitHalfOpen {
+		c.state = circuitOpen
+	}
+}
+
+// IsOpen reports whether requests to the endpoint are currently being rejected
+func (b *CircuitBreaker) IsOpen(endpoint string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.getCircuit(endpoint)
+	return c.state == circuitHalfOpen || (c.state == circuitOpen && time.Since(c.openedAt) < b.Cooldown)
+}
+
+// do waits for the client's rate limiter and sends the request through its circuit breaker, if configured.
+// Transport errors, rate limiting and server errors count as breaker failures.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(req.Context(), endpointFamily(req.URL.Path)); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Breaker == nil {
+		return c.HTTPClient.Do(req)
+	}
+
+	endpoint := req.URL.Path
+	if err := c.Breaker.Allow(endpoint); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	switch {
+	case err != nil && errors.Is(err, context.Canceled):
+		c.Breaker.release(endpoint)
+	case err != nil:
+		c.Breaker.RecordFailure(endpoint)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		c.Breaker.RecordFailure(endpoint)
+	default:
+		c.Breaker.RecordSuccess(endpoint)
+	}
+
+	return resp, err
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	b := NewCircuitBreaker(2, 20*time.Millisecond)
+	const endpoint = "/v2/funding/stats/fUSD/hist"
+
+	// Closed: failures below the threshold still let requests through
+	b.RecordFailure(endpoint)
+	if err := b.Allow(endpoint); err != nil {
+		t.Fatalf("Allow after 1 failure = %v, want nil", err)
+	}
+
+	// Open: the threshold is reached and requests fail fast
+	b.RecordFailure(endpoint)
+	if err := b.Allow(endpoint); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow after 2 failures = %v, want ErrCircuitOpen", err)
+	}
+	if !b.IsOpen(endpoint) {
+		t.Fatal("IsOpen = false after reaching the threshold")
+	}
+	if err := b.Allow("/v2/other"); err != nil {
+		t.Fatalf("other endpoint Allow = %v, want nil", err)
+	}
+
+	// Half-open: after the cooldown a single probe is allowed
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(endpoint); err != nil {
+		t.Fatalf("probe Allow = %v, want nil", err)
+	}
+	if err := b.Allow(endpoint); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second Allow while probing = %v, want ErrCircuitOpen", err)
+	}
+
+	// A failed probe opens the circuit again
+	b.RecordFailure(endpoint)
+	if err := b.Allow(endpoint); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow after a failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// Closed: a successful probe closes the circuit
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(endpoint); err != nil {
+		t.Fatalf("probe Allow = %v, want nil", err)
+	}
+	b.RecordSuccess(endpoint)
+	if err := b.Allow(endpoint); err != nil {
+		t.Fatalf("Allow after a successful probe = %v, want nil", err)
+	}
+	if b.IsOpen(endpoint) {
+		t.Fatal("IsOpen = true after a successful probe")
+	}
+}
+
+func TestClientFailsFastWhileCircuitOpen(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	c.Breaker = NewCircuitBreaker(2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetPlatformStatus(); err == nil {
+			t.Fatalf("request %d succeeded against a failing server", i+1)
+		}
+	}
+	if _, err := c.GetPlatformStatus(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("request after 2 failures = %v, want ErrCircuitOpen", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("server received %d requests, want 2", got)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// CandleTimeframes are the candle timeframes accepted by Bitfinex
+var CandleTimeframes = []string{"1m", "5m", "15m", "30m", "1h", "3h", "6h", "12h", "1D", "1W", "14D", "1M"}
+
+// UnsupportedTimeframeError is returned for a candle timeframe that is not one of CandleTimeframes
+type UnsupportedTimeframeError struct {
+	Timeframe string
+}
+
+func (e UnsupportedTimeframeError) Error() string {
+	return fmt.Sprintf("unsupported candle timeframe %q, must be one of %v", e.Timeframe, CandleTimeframes)
+}
+
+// Funding candle periods: a single offer period in days, or 0 for the aggregate of all of them
+const (
+	MinFundingCandlePeriod = 2
+	MaxFundingCandlePeriod = 30
+)
+
+// fundingCandleKey builds the candle key of a funding symbol, e.g. trade:1h:fUSD:p30 for period 30
+// or trade:1h:fUSD:a30:p2:p30 for the aggregate (period 0)
+func fundingCandleKey(timeframe, symbol string, period int) (string, error) {
+	supported := false
+	for _, tf := range CandleTimeframes {
+		if tf == timeframe {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return "", UnsupportedTimeframeError{Timeframe: timeframe}
+	}
+
+	if period == 0 {
+		return fmt.Sprintf("trade:%s:%s:a%d:p%d:p%d", timeframe, symbol, MaxFundingCandlePeriod, MinFundingCandlePeriod, MaxFundingCandlePeriod), nil
+	}
+	if period < MinFundingCandlePeriod || period > MaxFundingCandlePeriod {
+		return "", fmt.Errorf("invalid funding candle period %d, must be 0 or between %d and %d", period, MinFundingCandlePeriod, MaxFundingCandlePeriod)
+	}
+	return fmt.Sprintf("trade:%s:%s:p%d", timeframe, symbol, period), nil
+}
+
+// GetFundingCandles retrieves funding rate candles (maintains backward compatibility)
+func (c *Client) GetFundingCandles(symbol, timeframe string, period int, start, end int64, limit int) ([]FundingCandle, error) {
+	return c.GetFundingCandlesWithContext(context.Background(), symbol, timeframe, period, start, end, limit)
+}
+
+// GetFundingCandlesWithContext retrieves the funding rate candles of symbol for offers of period days, or for
+// the aggregate of periods 2 to 30 when period is 0, newest first, using context. 0 leaves start or end open.
+// An unsupported timeframe returns an UnsupportedTimeframeError without sending a request.
+func (c *Client) GetFundingCandlesWithContext(ctx context.Context, symbol, timeframe string, period int, start, end int64, limit int) ([]FundingCandle, error) {
+	key, err := fundingCandleKey(timeframe, symbol, period)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if start > 0 {
+		query.Set("start", strconv.FormatInt(start, 10))
+	}
+	if end > 0 {
+		query.Set("end", strconv.FormatInt(end, 10))
+	}
+
+	endpoint := fmt.Sprintf("%s/v2/candles/%s/hist", c.BaseURL, key)
+	if len(query) > 0 {
+		endpoint = fmt.Sprintf("%s?%s", endpoint, query.Encode())
+	}
+
+	var rawData [][]interface{}
+	if err := c.getJSON(ctx, endpoint, &rawData); err != nil {
+		return nil, err
+	}
+
+	candles := make([]FundingCandle, len(rawData))
+	for i, data := range rawData {
+		candle, err := parseFundingCandleRow(data)
+		if err != nil {
+			return nil, fmt.Errorf("funding candle row %d: %v", i, err)
+		}
+		candles[i] = candle
+	}
+
+	return candles, nil
+}
+
+// parseFundingCandleRow parses a candle row: [MTS, OPEN, CLOSE, HIGH, LOW, VOLUME]
+func parseFundingCandleRow(data []interface{}) (FundingCandle, error) {
+	if len(data) != 6 {
+		return FundingCandle{}, fmt.Errorf("expected 6 fields [MTS, OPEN, CLOSE, HIGH, LOW, VOLUME], got %d", len(data))
+	}
+
+	var candle FundingCandle
+	mts, err := numberAt(data, 0, "MTS")
+	if err != nil {
+		return FundingCandle{}, err
+	}
+	if candle.Open, err = numberAt(data, 1, "OPEN"); err != nil {
+		return FundingCandle{}, err
+	}
+	if candle.Close, err = numberAt(data, 2, "CLOSE"); err != nil {
+		return FundingCandle{}, err
+	}
+	if candle.High, err = numberAt(data, 3, "HIGH"); err != nil {
+		return FundingCandle{}, err
+	}
+	if candle.Low, err = numberAt(data, 4, "LOW"); err != nil {
+		return FundingCandle{}, err
+	}
+	if candle.Volume, err = numberAt(data, 5, "VOLUME"); err != nil {
+		return FundingCandle{}, err
+	}
+
+	candle.MTS = int64(mts)
+	return candle, nil
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFundingCandlesUnsupportedTimeframe(t *testing.T) {
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	_, err := c.GetFundingCandles("fUSD", "2h", 30, 0, 0, 10)
+
+	var unsupported UnsupportedTimeframeError
+	if !errors.As(err, &unsupported) || unsupported.Timeframe != "2h" {
+		t.Fatalf("GetFundingCandles with 2h = %v, want an UnsupportedTimeframeError for 2h", err)
+	}
+	if requested {
+		t.Error("a request was sent for an unsupported timeframe")
+	}
+}
+
+func TestFundingCandlesPaths(t *testing.T) {
+	var path, query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		w.Write([]byte(`[[1700000000000,0.0002,0.0003,0.0004,0.0001,1500.5]]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	for _, tc := range []struct {
+		period int
+		want   string
+	}{
+		{30, "/v2/candles/trade:1h:fUSD:p30/hist"},
+		{0, "/v2/candles/trade:1h:fUSD:a30:p2:p30/hist"},
+	} {
+		candles, err := c.GetFundingCandles("fUSD", "1h", tc.period, 1000, 2000, 10)
+		if err != nil {
+			t.Fatalf("period %d: GetFundingCandles: %v", tc.period, err)
+		}
+		if path != tc.want {
+			t.Errorf("period %d: path = %s, want %s", tc.period, path, tc.want)
+		}
+		if query != "end=2000&limit=10&start=1000" {
+			t.Errorf("period %d: query = %s, want end=2000&limit=10&start=1000", tc.period, query)
+		}
+
+		want := FundingCandle{MTS: 1700000000000, Open: 0.0002, Close: 0.0003, High: 0.0004, Low: 0.0001, Volume: 1500.5}
+		if len(candles) != 1 || candles[0] != want {
+			t.Errorf("period %d: candles = %+v, want [%+v]", tc.period, candles, want)
+		}
+	}
+
+	if _, err := c.GetFundingCandles("fUSD", "1h", 1, 0, 0, 10); err == nil {
+		t.Error("GetFundingCandles with period 1 succeeded, want an error")
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import "fmt"
+
+// numberAt returns data[index] as a float64, or an error naming the field if it is missing or not a number
+func numberAt(data []interface{}, index int, name string) (float64, error) {
+	if index < 0 || index >= len(data) {
+		return 0, fmt.Errorf("missing field %s at index %d", name, index)
+	}
+	value, ok := data[index].(float64)
+	if !ok {
+		return 0, fmt.Errorf("field %s at index %d is %T, not a number", name, index, data[index])
+	}
+	return value, nil
+}
+
+// fieldReader reads numeric fields from a Bitfinex response array, recording the
+// names of fields that are null, missing or not numbers
+type fieldReader struct {
+	data    []interface{}
+	missing []string
+}
+
+// float returns the field at index as a float64, or 0 if it is unavailable
+func (r *fieldReader) float(index int, name string) float64 {
+	if index >= len(r.data) {
+		r.missing = append(r.missing, name)
+		return 0
+	}
+	value, ok := r.data[index].(float64)
+	if !ok {
+		r.missing = append(r.missing, name)
+		return 0
+	}
+	return value
+}
+
+// int returns the field at index as an int, or 0 if it is unavailable
+func (r *fieldReader) int(index int, name string) int {
+	return int(r.float(index, name))
+}
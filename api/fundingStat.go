@@ -2,76 +2,57 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"log"
 	"net/url"
 	"strconv"
 )
 
-// GetFundingStats retrieves funding statistics data for the specified symbol (maintains backward compatibility)
-func (c *Client) GetFundingStats(symbol string, limit int) ([]FundingStats, error) {
-	// Call the version that supports context, using background context
-	return c.GetFundingStatsWithContext(context.Background(), symbol, limit)
-}
-
-// GetFundingStatsWithContext retrieves funding statistics data for the specified symbol using context
-func (c *Client) GetFundingStatsWithContext(ctx context.Context, symbol string, limit int) ([]FundingStats, error) {
-	endpoint := fmt.Sprintf("%s/v2/funding/stats/%s/hist?limit=%d", c.BaseURL, symbol, limit)
-
-	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Execute request
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+// Offer periods in days a funding stats key can select, 0 selects the stats over all periods
+const (
+	MinFundingStatsPeriod = 2
+	MaxFundingStatsPeriod = 120
+)
 
-	if resp.StatusCode != http.StatusOK {
-		var bitfinexError BitfinexError
-		bitfinexError.StatusCode = resp.StatusCode
-		return nil, &bitfinexError
+// fundingStatsKey builds the funding stats key of a symbol, e.g. fUSD for period 0 or fUSD:p30 for period 30
+func fundingStatsKey(symbol string, period int) (string, error) {
+	if period == 0 {
+		return symbol, nil
 	}
-
-	var rawData [][]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawData); err != nil {
-		return nil, err
+	if period < MinFundingStatsPeriod || period > MaxFundingStatsPeriod {
+		return "", fmt.Errorf("invalid funding stats period %d, must be 0 or between %d and %d", period, MinFundingStatsPeriod, MaxFundingStatsPeriod)
 	}
+	return fmt.Sprintf("%s:p%d", symbol, period), nil
+}
 
-	// Convert raw data to FundingStats
-	fundingStats := make([]FundingStats, len(rawData))
-	for i, data := range rawData {
-		if len(data) >= 12 {
-			fundingStats[i] = FundingStats{
-				MTS:                   int64(data[0].(float64)),
-				FRR:                   data[3].(float64),
-				AveragePeriod:         data[4].(float64),
-				FundingAmount:         data[7].(float64),
-				FundingAmountUsed:     data[8].(float64),
-				FundingBelowThreshold: data[11].(float64),
-			}
-		}
-	}
+// GetFundingStats retrieves funding statistics data over all periods for the specified symbol (maintains backward compatibility)
+func (c *Client) GetFundingStats(symbol string, limit int) ([]FundingStats, error) {
+	// Call the version that supports context, using background context
+	return c.GetFundingStatsWithContext(context.Background(), symbol, limit, 0)
+}
 
-	return fundingStats, nil
+// GetFundingStatsWithContext retrieves funding statistics data for the specified symbol using context.
+// period selects the stats of offers of that many days, 0 the stats over all periods; it is set on the returned rows.
+func (c *Client) GetFundingStatsWithContext(ctx context.Context, symbol string, limit, period int) ([]FundingStats, error) {
+	return c.GetFundingStatsWithTimeRangeWithContext(ctx, symbol, 0, 0, limit, period)
 }
 
-// GetFundingStatsWithTimeRange retrieves funding statistics data for the specified time range (maintains backward compatibility)
+// GetFundingStatsWithTimeRange retrieves funding statistics data over all periods for the specified time range (maintains backward compatibility)
 func (c *Client) GetFundingStatsWithTimeRange(symbol string, start, end int64, limit int) ([]FundingStats, error) {
 	// Call the version that supports context, using background context
-	return c.GetFundingStatsWithTimeRangeWithContext(context.Background(), symbol, start, end, limit)
+	return c.GetFundingStatsWithTimeRangeWithContext(context.Background(), symbol, start, end, limit, 0)
 }
 
-// GetFundingStatsWithTimeRangeWithContext retrieves funding statistics data for the specified time range using context
-func (c *Client) GetFundingStatsWithTimeRangeWithContext(ctx context.Context, symbol string, start, end int64, limit int) ([]FundingStats, error) {
+// GetFundingStatsWithTimeRangeWithContext retrieves funding statistics data for the specified time range and
+// period (0 for the stats over all periods) using context
+func (c *Client) GetFundingStatsWithTimeRangeWithContext(ctx context.Context, symbol string, start, end int64, limit, period int) ([]FundingStats, error) {
+	key, err := fundingStatsKey(symbol, period)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build base URL
-	baseEndpoint := fmt.Sprintf("%s/v2/funding/stats/%s/hist", c.BaseURL, symbol)
+	baseEndpoint := fmt.Sprintf("%s/v2/funding/stats/%s/hist", c.BaseURL, key)
 
 	// Build query parameters
 	query := url.Values{}
@@ -91,47 +72,69 @@ func (c *Client) GetFundingStatsWithTimeRangeWithContext(ctx context.Context, sy
 		endpoint = fmt.Sprintf("%s?%s", baseEndpoint, query.Encode())
 	}
 
-	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
-	if err != nil {
+	var rawData [][]interface{}
+	if err := c.getJSON(ctx, endpoint, &rawData); err != nil {
 		return nil, err
 	}
 
-	// Execute request
-	resp, err := c.HTTPClient.Do(req)
+	stats, err := parseFundingStats(rawData)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		var bitfinexError BitfinexError
-		bitfinexError.StatusCode = resp.StatusCode
-		bitfinexError.Message = string(body)
-		return nil, &bitfinexError
+	for i := range stats {
+		stats[i].Period = period
 	}
+	return stats, nil
+}
 
-	var rawData [][]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawData); err != nil {
-		return nil, err
-	}
+// GetFundingStatsHistoryWithContext retrieves all funding statistics of a period (0 for all periods) between
+// start and end (MTS, inclusive; 0 leaves a bound open), newest first, paging through the history endpoint using context
+func (c *Client) GetFundingStatsHistoryWithContext(ctx context.Context, symbol string, start, end int64, period int) ([]FundingStats, error) {
+	return PageHistory(ctx, func(start, end int64, limit int) ([]FundingStats, error) {
+		return c.GetFundingStatsWithTimeRangeWithContext(ctx, symbol, start, end, limit, period)
+	}, func(stats FundingStats) int64 { return stats.MTS }, start, end, FundingStatsPageLimit, SortDescending)
+}
 
-	// Convert raw data to FundingStats
+// parseFundingStats converts the rows of a funding stats response to FundingStats, skipping and logging
+// malformed rows so one bad row does not lose the rest of the response
+func parseFundingStats(rawData [][]interface{}) ([]FundingStats, error) {
 	fundingStats := make([]FundingStats, 0, len(rawData))
-	for _, data := range rawData {
-		if len(data) >= 12 {
-			stat := FundingStats{
-				MTS:                   int64(data[0].(float64)),
-				FRR:                   data[3].(float64),
-				AveragePeriod:         data[4].(float64),
-				FundingAmount:         data[7].(float64),
-				FundingAmountUsed:     data[8].(float64),
-				FundingBelowThreshold: data[11].(float64),
-			}
-			fundingStats = append(fundingStats, stat)
+	for i, data := range rawData {
+		stat, err := parseFundingStatsRow(data)
+		if err != nil {
+			log.Printf("Skipping funding stats row %d: %v", i, err)
+			continue
 		}
+		fundingStats = append(fundingStats, stat)
 	}
 
 	return fundingStats, nil
 }
+
+// parseFundingStatsRow parses a funding stats row: [MTS, _, _, FRR, AVG_PERIOD, _, _, FUNDING_AMOUNT,
+// FUNDING_AMOUNT_USED, _, _, FUNDING_BELOW_THRESHOLD]. Null values are left at zero, a null FRR (e.g. in
+// low-liquidity windows) also sets FRRMissing; a short row or a row without a numeric MTS is rejected.
+func parseFundingStatsRow(data []interface{}) (FundingStats, error) {
+	if len(data) < 12 {
+		return FundingStats{}, fmt.Errorf("expected at least 12 fields, got %d", len(data))
+	}
+
+	mts, err := numberAt(data, 0, "MTS")
+	if err != nil {
+		return FundingStats{}, err
+	}
+
+	fields := &fieldReader{data: data}
+	frr := fields.float(3, "FRR")
+	frrMissing := len(fields.missing) > 0
+	return FundingStats{
+		MTS:                   int64(mts),
+		FRR:                   frr,
+		FRRRaw:                frr,
+		FRRMissing:            frrMissing,
+		AveragePeriod:         fields.float(4, "AVG_PERIOD"),
+		FundingAmount:         fields.float(7, "FUNDING_AMOUNT"),
+		FundingAmountUsed:     fields.float(8, "FUNDING_AMOUNT_USED"),
+		FundingBelowThreshold: fields.float(11, "FUNDING_BELOW_THRESHOLD"),
+	}, nil
+}
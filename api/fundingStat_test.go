@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseFundingStatsNullFRR(t *testing.T) {
+	body := `[[1700000000000,null,null,null,30.5,null,null,1000,400,null,null,25]]`
+	var rawData [][]interface{}
+	if err := json.Unmarshal([]byte(body), &rawData); err != nil {
+		t.Fatalf("failed to decode test data: %v", err)
+	}
+
+	stats, err := parseFundingStats(rawData)
+	if err != nil {
+		t.Fatalf("parseFundingStats: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d stats, want 1", len(stats))
+	}
+
+	got := stats[0]
+	if !got.FRRMissing {
+		t.Error("FRRMissing = false for a null FRR")
+	}
+	if got.MTS != 1700000000000 || got.FRR != 0 || got.AveragePeriod != 30.5 ||
+		got.FundingAmount != 1000 || got.FundingAmountUsed != 400 || got.FundingBelowThreshold != 25 {
+		t.Errorf("parsed %+v, want the null FRR left at zero and the other fields kept", got)
+	}
+}
+
+func TestParseFundingStatsSkipsMalformedRows(t *testing.T) {
+	body := `[
+		[1700000003000,null,null,0.0003,30,null,null,1000,400,null,null,25],
+		[1700000002000,null,null,0.0002],
+		["now",null,null,0.0002,30,null,null,1000,400,null,null,25],
+		[null,null,null,0.0002,30,null,null,1000,400,null,null,25],
+		[1700000001000,null,null,0.0001,30,null,null,1000,400,null,null,25]
+	]`
+	var rawData [][]interface{}
+	if err := json.Unmarshal([]byte(body), &rawData); err != nil {
+		t.Fatalf("failed to decode test data: %v", err)
+	}
+
+	stats, err := parseFundingStats(rawData)
+	if err != nil {
+		t.Fatalf("parseFundingStats: %v", err)
+	}
+	if len(stats) != 2 || stats[0].MTS != 1700000003000 || stats[1].MTS != 1700000001000 {
+		t.Fatalf("parsed %+v, want only the two well-formed rows", stats)
+	}
+	if stats[0].FRRMissing || stats[1].FRRMissing {
+		t.Error("FRRMissing set for rows with an FRR")
+	}
+}
+
+func TestGetFundingStatsForPeriod(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`[[1700000000000,null,null,0.0000005,30.5,null,null,1000,400,null,null,25]]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	for _, tc := range []struct {
+		period int
+		path   string
+	}{
+		{0, "/v2/funding/stats/fUSD/hist"},
+		{30, "/v2/funding/stats/fUSD:p30/hist"},
+	} {
+		stats, err := c.GetFundingStatsWithContext(context.Background(), "fUSD", 1, tc.period)
+		if err != nil {
+			t.Fatalf("period %d: GetFundingStatsWithContext: %v", tc.period, err)
+		}
+		if got := paths[len(paths)-1]; got != tc.path {
+			t.Errorf("period %d: path = %s, want %s", tc.period, got, tc.path)
+		}
+		if len(stats) != 1 || stats[0].Period != tc.period {
+			t.Errorf("period %d: stats = %+v, want one row with Period %d", tc.period, stats, tc.period)
+		}
+	}
+
+	if _, err := c.GetFundingStatsWithContext(context.Background(), "fUSD", 1, 1); err == nil {
+		t.Error("period 1 succeeded, want an error")
+	}
+	if len(paths) != 2 {
+		t.Errorf("%d requests sent, want none for the invalid period", len(paths)-2)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// NonceGenerator produces nonces for authenticated requests.
+// Bitfinex rejects a request whose nonce is not greater than the previous one for the same API key.
+type NonceGenerator interface {
+	GetNonce() string
+}
+
+// defaultNonceGenerator is used by clients that were created without a nonce generator
+var defaultNonceGenerator = NewEpochNonceGenerator()
+
+// EpochNonceGenerator generates strictly increasing nonces based on the current time in microseconds.
+// It is safe for concurrent use; a burst within the same microsecond still yields distinct values.
+type EpochNonceGenerator struct {
+	nonce uint64
+}
+
+// NewEpochNonceGenerator creates a nonce generator seeded from the current time
+func NewEpochNonceGenerator() *EpochNonceGenerator {
+	return &EpochNonceGenerator{
+		nonce: uint64(time.Now().UnixMicro()),
+	}
+}
+
+// GetNonce returns the next nonce, which is never lower than the current time in microseconds
+func (g *EpochNonceGenerator) GetNonce() string {
+	for {
+		last := atomic.LoadUint64(&g.nonce)
+		next := last + 1
+		if now := uint64(time.Now().UnixMicro()); now > next {
+			next = now
+		}
+		if atomic.CompareAndSwapUint64(&g.nonce, last, next) {
+			return strconv.FormatUint(next, 10)
+		}
+	}
+}
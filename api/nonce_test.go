@@ -0,0 +1,50 @@
+package api
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestEpochNonceGeneratorConcurrentNoncesAreUnique(t *testing.T) {
+	g := NewEpochNonceGenerator()
+
+	const workers, perWorker = 8, 500
+	nonces := make([][]int64, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				n, err := strconv.ParseInt(g.GetNonce(), 10, 64)
+				if err != nil {
+					t.Errorf("nonce is not an integer: %v", err)
+					return
+				}
+				nonces[w] = append(nonces[w], n)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var all []int64
+	for _, own := range nonces {
+		// Each caller sees strictly increasing nonces
+		for i := 1; i < len(own); i++ {
+			if own[i] <= own[i-1] {
+				t.Fatalf("nonce %d after %d is not increasing", own[i], own[i-1])
+			}
+		}
+		all = append(all, own...)
+	}
+
+	// and no nonce is handed out twice across callers
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	for i := 1; i < len(all); i++ {
+		if all[i] == all[i-1] {
+			t.Fatalf("nonce %d generated twice", all[i])
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// Maximum number of rows per request of the Bitfinex history endpoints, page sizes for PageHistory
+const (
+	FundingStatsPageLimit  = 250
+	FundingTradesPageLimit = 10000
+)
+
+// PageHistory collects every row between start and end (MTS, inclusive; 0 leaves a bound open) from a
+// Bitfinex history endpoint, requesting pageSize rows at a time. sort is the order fetch returns rows in,
+// SortDescending (or 0) for newest first or SortAscending for oldest first. Newest first it pages backward
+// by moving end to the oldest MTS of each page, as given by keyOf, until a page is not full or reaches start;
+// oldest first it pages forward by moving start to the newest MTS until a page is not full or reaches end.
+//
+// The boundary millisecond of a page is fetched again by the next page so rows sharing it are not lost;
+// rows are deduplicated by value. Only when a whole page shares one millisecond does paging skip past it.
+// Rows are returned in the fetch order. When a fetch fails, the rows collected so far are returned with the error.
+func PageHistory[T comparable](ctx context.Context, fetch func(start, end int64, limit int) ([]T, error), keyOf func(T) int64, start, end int64, pageSize, sort int) ([]T, error) {
+	if sort != 0 && sort != SortAscending && sort != SortDescending {
+		return nil, fmt.Errorf("invalid sort %d, must be %d, %d or 0", sort, SortAscending, SortDescending)
+	}
+	ascending := sort == SortAscending
+
+	var rows []T
+	seen := make(map[T]bool)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return rows, err
+		}
+
+		page, err := fetch(start, end, pageSize)
+		if err != nil {
+			return rows, err
+		}
+		if len(page) == 0 {
+			return rows, nil
+		}
+
+		// boundary is the MTS the next page continues from: the oldest of a newest first page,
+		// the newest of an oldest first one
+		boundary := keyOf(page[0])
+		added := 0
+		for _, row := range page {
+			key := keyOf(row)
+			if (ascending && key > boundary) || (!ascending && key < boundary) {
+				boundary = key
+			}
+			if seen[row] || (start > 0 && key < start) || (end > 0 && key > end) {
+				continue
+			}
+			seen[row] = true
+			rows = append(rows, row)
+			added++
+		}
+
+		if len(page) < pageSize {
+			return rows, nil
+		}
+
+		// A full page of rows already seen can only come from a single millisecond holding more rows
+		// than a page; skip past it rather than fetching it forever
+		if ascending {
+			if end > 0 && boundary >= end {
+				return rows, nil
+			}
+			if added == 0 || boundary == start {
+				boundary++
+			}
+			start = boundary
+			continue
+		}
+
+		if start > 0 && boundary <= start {
+			return rows, nil
+		}
+		if added == 0 || boundary == end {
+			boundary--
+		}
+		if boundary <= 0 {
+			return rows, nil
+		}
+		end = boundary
+	}
+}
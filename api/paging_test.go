@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type pagedRow struct {
+	ID  int
+	MTS int64
+}
+
+// fetchRows serves rows like a Bitfinex history endpoint sorted in the order of rows: the first limit rows
+// with MTS between start and end (0 leaves a bound open)
+func fetchRows(rows []pagedRow, calls *int) func(start, end int64, limit int) ([]pagedRow, error) {
+	return func(start, end int64, limit int) ([]pagedRow, error) {
+		*calls++
+		var page []pagedRow
+		for _, row := range rows {
+			if (start > 0 && row.MTS < start) || (end > 0 && row.MTS > end) {
+				continue
+			}
+			if len(page) == limit {
+				break
+			}
+			page = append(page, row)
+		}
+		return page, nil
+	}
+}
+
+func TestPageHistoryCollectsEveryPage(t *testing.T) {
+	// Rows 4 and 5 share a millisecond that falls on a page boundary
+	rows := []pagedRow{{7, 700}, {6, 600}, {5, 500}, {4, 500}, {3, 300}, {2, 200}, {1, 100}}
+	calls := 0
+
+	got, err := PageHistory(context.Background(), fetchRows(rows, &calls), func(r pagedRow) int64 { return r.MTS }, 0, 0, 3, SortDescending)
+	if err != nil {
+		t.Fatalf("PageHistory: %v", err)
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("got %d rows, want %d: %v", len(got), len(rows), got)
+	}
+	for i := range rows {
+		if got[i] != rows[i] {
+			t.Fatalf("row %d = %v, want %v", i, got[i], rows[i])
+		}
+	}
+	if calls < 3 {
+		t.Errorf("fetched %d pages, want at least 3", calls)
+	}
+}
+
+func TestPageHistoryStopsAtStart(t *testing.T) {
+	rows := []pagedRow{{5, 500}, {4, 400}, {3, 300}, {2, 200}, {1, 100}}
+	calls := 0
+
+	got, err := PageHistory(context.Background(), fetchRows(rows, &calls), func(r pagedRow) int64 { return r.MTS }, 300, 0, 2, SortDescending)
+	if err != nil {
+		t.Fatalf("PageHistory: %v", err)
+	}
+	if len(got) != 3 || got[len(got)-1].MTS != 300 {
+		t.Fatalf("got %v, want the rows from 500 down to 300", got)
+	}
+}
+
+func TestPageHistoryReturnsRowsBeforeError(t *testing.T) {
+	fail := errors.New("unavailable")
+	calls := 0
+	fetch := func(start, end int64, limit int) ([]pagedRow, error) {
+		calls++
+		if calls > 1 {
+			return nil, fail
+		}
+		return []pagedRow{{3, 300}, {2, 200}}, nil
+	}
+
+	got, err := PageHistory(context.Background(), fetch, func(r pagedRow) int64 { return r.MTS }, 0, 0, 2, SortDescending)
+	if !errors.Is(err, fail) {
+		t.Fatalf("err = %v, want %v", err, fail)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %v, want the first page", got)
+	}
+}
+
+func TestPageHistoryAscending(t *testing.T) {
+	// Rows 3 and 4 share a millisecond that falls on a page boundary
+	rows := []pagedRow{{1, 100}, {2, 200}, {3, 300}, {4, 300}, {5, 500}, {6, 600}, {7, 700}}
+	calls := 0
+
+	got, err := PageHistory(context.Background(), fetchRows(rows, &calls), func(r pagedRow) int64 { return r.MTS }, 0, 600, 3, SortAscending)
+	if err != nil {
+		t.Fatalf("PageHistory: %v", err)
+	}
+	want := rows[:6]
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("row %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPageHistoryAscendingSkipsFullMillisecond(t *testing.T) {
+	// More rows share a millisecond than fit in a page
+	rows := []pagedRow{{1, 100}, {2, 100}, {3, 100}, {4, 200}}
+	calls := 0
+
+	got, err := PageHistory(context.Background(), fetchRows(rows, &calls), func(r pagedRow) int64 { return r.MTS }, 0, 0, 2, SortAscending)
+	if err != nil {
+		t.Fatalf("PageHistory: %v", err)
+	}
+	if len(got) != 3 || got[len(got)-1] != rows[3] {
+		t.Fatalf("got %v, want the first page and the row after the full millisecond", got)
+	}
+	if calls > 4 {
+		t.Errorf("fetched %d pages, paging did not move past the full millisecond", calls)
+	}
+}
+
+func TestPageHistoryRejectsInvalidSort(t *testing.T) {
+	calls := 0
+	if _, err := PageHistory(context.Background(), fetchRows(nil, &calls), func(r pagedRow) int64 { return r.MTS }, 0, 0, 2, 2); err == nil {
+		t.Fatal("expected an error for sort 2")
+	}
+}
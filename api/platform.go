@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// PlatformStatus is the operating state of the Bitfinex platform
+type PlatformStatus int
+
+const (
+	// PlatformMaintenance means Bitfinex is in maintenance and requests are expected to fail
+	PlatformMaintenance PlatformStatus = 0
+	// PlatformOperative means Bitfinex is operating normally
+	PlatformOperative PlatformStatus = 1
+)
+
+// GetPlatformStatus retrieves the operating state of the Bitfinex platform (maintains backward compatibility)
+func (c *Client) GetPlatformStatus() (PlatformStatus, error) {
+	return c.GetPlatformStatusWithContext(context.Background())
+}
+
+// GetPlatformStatusWithContext retrieves the operating state of the Bitfinex platform using context
+func (c *Client) GetPlatformStatusWithContext(ctx context.Context) (PlatformStatus, error) {
+	endpoint := fmt.Sprintf("%s/v2/platform/status", c.BaseURL)
+	var rawData []interface{}
+	if err := c.getJSON(ctx, endpoint, &rawData); err != nil {
+		return PlatformMaintenance, err
+	}
+
+	if len(rawData) == 0 {
+		return PlatformMaintenance, fmt.Errorf("invalid response format for platform status")
+	}
+	status, ok := rawData[0].(float64)
+	if !ok {
+		return PlatformMaintenance, fmt.Errorf("invalid platform status value: %v", rawData[0])
+	}
+
+	return PlatformStatus(status), nil
+}
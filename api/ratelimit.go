@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default limits of clients created by NewClient, below the roughly 90 requests per minute Bitfinex
+// allows public REST endpoints
+const (
+	DefaultRequestsPerMinute = 80
+	DefaultRateBurst         = 5
+)
+
+// bucket is a token bucket for one partition of a RateLimiter
+type bucket struct {
+	tokens float64 // May go negative while waiters hold reservations
+	last   time.Time
+}
+
+// RateLimiter spaces out requests with token buckets. When Partitioned, each endpoint family
+// (book, ticker, stats, ...) gets its own bucket, so bursty book polling cannot use up the budget
+// of ticker refreshes; otherwise all requests share one bucket.
+type RateLimiter struct {
+	PerMinute   int  // Sustained requests per minute per bucket
+	Burst       int  // Requests allowed at once before spacing starts
+	Partitioned bool // One bucket per endpoint family instead of a single shared bucket
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewRateLimiter creates a rate limiter allowing perMinute requests per minute with bursts of burst
+func NewRateLimiter(perMinute, burst int, partitioned bool) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		PerMinute:   perMinute,
+		Burst:       burst,
+		Partitioned: partitioned,
+		buckets:     make(map[string]*bucket),
+	}
+}
+
+// Wait blocks until a request of the endpoint family may be sent, or returns the context's error
+func (l *RateLimiter) Wait(ctx context.Context, family string) error {
+	if l.PerMinute <= 0 {
+		return nil
+	}
+	if !l.Partitioned {
+		family = ""
+	}
+
+	delay := l.reserve(family)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel(family)
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the family's bucket and returns how long to wait until it is available
+func (l *RateLimiter) reserve(family string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	now := time.Now()
+	b, ok := l.buckets[family]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[family] = b
+	}
+
+	perSecond := float64(l.PerMinute) / 60
+	b.tokens += now.Sub(b.last).Seconds() * perSecond
+	if b.tokens > float64(l.Burst) {
+		b.tokens = float64(l.Burst)
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / perSecond * float64(time.Second))
+}
+
+// cancel returns the token of a reservation whose request was abandoned
+func (l *RateLimiter) cancel(family string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[family]; ok {
+		b.tokens++
+	}
+}
+
+// endpointFamily returns the family of a Bitfinex API path, e.g. "book" for /v2/book/fUSD/P0
+// and "stats" for /v2/funding/stats/fUSD/hist
+func endpointFamily(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 0 && segments[0] == "v2" {
+		segments = segments[1:]
+	}
+	if len(segments) > 1 && (segments[0] == "funding" || segments[0] == "auth") {
+		return segments[0] + "/" + segments[1]
+	}
+	if len(segments) > 0 {
+		return segments[0]
+	}
+	return ""
+}
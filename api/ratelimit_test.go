@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPartitionedLimiterIsolatesEndpointFamilies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		partitioned bool
+		statsBlocks bool
+	}{
+		{partitioned: true, statsBlocks: false},
+		{partitioned: false, statsBlocks: true},
+	} {
+		// One request per minute without bursts: the first book request uses up the book budget
+		c := NewClient(WithBaseURL(srv.URL), WithRateLimit(1, 1, tt.partitioned))
+		if _, err := c.GetFundingBookWithContext(context.Background(), "fUSD", PrecisionP0); err != nil {
+			t.Fatalf("partitioned %v: first book request: %v", tt.partitioned, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, err := c.GetFundingBookWithContext(ctx, "fUSD", PrecisionP0)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("partitioned %v: saturated book request error = %v, want DeadlineExceeded", tt.partitioned, err)
+		}
+
+		// Stats requests have their own budget only when partitioned
+		ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, err = c.GetFundingStatsWithContext(ctx, "fUSD", 1, 0)
+		cancel()
+		if blocked := errors.Is(err, context.DeadlineExceeded); blocked != tt.statsBlocks {
+			t.Errorf("partitioned %v: stats request error = %v, want blocked %v", tt.partitioned, err, tt.statsBlocks)
+		}
+		if !tt.statsBlocks && err != nil {
+			t.Errorf("partitioned %v: stats request: %v", tt.partitioned, err)
+		}
+	}
+}
+
+func TestEndpointFamily(t *testing.T) {
+	for path, want := range map[string]string{
+		"/v2/book/fUSD/P0":            "book",
+		"/v2/book/fUSD/R0":            "book",
+		"/v2/ticker/fUSD":             "ticker",
+		"/v2/funding/stats/fUSD/hist": "funding/stats",
+		"/v2/auth/r/wallets":          "auth/r",
+		"/v2/platform/status":         "platform",
+	} {
+		if got := endpointFamily(path); got != want {
+			t.Errorf("endpointFamily(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
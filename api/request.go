@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/hex"
@@ -10,19 +11,86 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func NewClient() *Client {
-	return &Client{
+// DefaultHTTPTimeout bounds each request of a Client created by NewClient, so a hung connection cannot
+// block its caller forever. Deadlines of individual requests still come from the context they are given.
+const DefaultHTTPTimeout = 30 * time.Second
+
+// NewClient creates a Bitfinex REST client. Requests are limited to DefaultRequestsPerMinute per endpoint
+// family and time out after DefaultHTTPTimeout unless an option changes it.
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
 		APIKey:     "your_api_key",
 		APISecret:  "your_api_secret",
-		HTTPClient: &http.Client{},
+		HTTPClient: &http.Client{Timeout: DefaultHTTPTimeout},
 		BaseURL:    "https://api.bitfinex.com",
+		Nonce:      NewEpochNonceGenerator(),
+		Breaker:    NewCircuitBreaker(5, 30*time.Second),
+		Limiter:    NewRateLimiter(DefaultRequestsPerMinute, DefaultRateBurst, true),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ClientOption configures a Client created by NewClient
+type ClientOption func(*Client)
+
+// WithBaseURL sends requests to baseURL instead of the production Bitfinex API, e.g. an httptest server
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient sends requests through httpClient, e.g. one with a timeout or a custom transport
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithTimeout bounds each request to timeout, 0 disables the bound. It applies to a copy of the HTTP client,
+// so a client passed to WithHTTPClient is left unchanged.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		httpClient := *c.HTTPClient
+		httpClient.Timeout = timeout
+		c.HTTPClient = &httpClient
+	}
+}
+
+// WithCredentials signs authenticated requests with the API key and secret
+func WithCredentials(key, secret string) ClientOption {
+	return func(c *Client) {
+		c.APIKey = key
+		c.APISecret = secret
+	}
+}
+
+// WithRateLimit limits the client to perMinute requests per minute with bursts of burst, per endpoint family
+// when partitioned. A non-positive perMinute disables limiting.
+func WithRateLimit(perMinute, burst int, partitioned bool) ClientOption {
+	return func(c *Client) {
+		if perMinute <= 0 {
+			c.Limiter = nil
+			return
+		}
+		c.Limiter = NewRateLimiter(perMinute, burst, partitioned)
 	}
 }
 
 func (c *Client) SendRequest(method, path string, body interface{}) ([]byte, error) {
+	return c.SendRequestWithContext(context.Background(), method, path, body)
+}
+
+// SendRequestWithContext sends a signed request using context; waiting for the rate limiter ends with
+// the context's error when it is canceled
+func (c *Client) SendRequestWithContext(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
 	// Serialize request body
 	var bodyStr string
 	if body != nil {
@@ -34,7 +102,11 @@ func (c *Client) SendRequest(method, path string, body interface{}) ([]byte, err
 	}
 
 	// Generate nonce
-	nonce := strconv.FormatInt(time.Now().UnixNano()/1000000, 10)
+	nonceGenerator := c.Nonce
+	if nonceGenerator == nil {
+		nonceGenerator = defaultNonceGenerator
+	}
+	nonce := nonceGenerator.GetNonce()
 
 	// Create signature payload
 	signaturePayload := "/api/" + path + nonce + bodyStr
@@ -46,7 +118,7 @@ func (c *Client) SendRequest(method, path string, body interface{}) ([]byte, err
 
 	// Create request
 	url := c.BaseURL + "/" + path
-	req, err := http.NewRequest(method, url, bytes.NewBufferString(bodyStr))
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBufferString(bodyStr))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -58,8 +130,11 @@ func (c *Client) SendRequest(method, path string, body interface{}) ([]byte, err
 	req.Header.Set("bfx-signature", signature)
 
 	// Send request
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -81,12 +156,7 @@ func (c *Client) SendRequest(method, path string, body interface{}) ([]byte, err
 		}
 
 		if err == nil && len(errorResp) >= 3 {
-			if code, ok := errorResp[1].(string); ok {
-				bfxErr.ErrorCode = code
-			}
-			if msg, ok := errorResp[2].(string); ok {
-				bfxErr.Message = msg
-			}
+			fillErrorFields(&bfxErr, errorResp)
 		} else {
 			bfxErr.Message = "Failed to parse error response"
 		}
@@ -97,6 +167,102 @@ func (c *Client) SendRequest(method, path string, body interface{}) ([]byte, err
 	return respBody, nil
 }
 
+// fillErrorFields copies the code and message of a Bitfinex ["error", code, message] array into bfxErr.
+// Codes are usually numbers, older endpoints send them as strings.
+func fillErrorFields(bfxErr *BitfinexError, errorResp []interface{}) {
+	switch code := errorResp[1].(type) {
+	case string:
+		bfxErr.ErrorCode = code
+	case float64:
+		bfxErr.ErrorCode = strconv.FormatFloat(code, 'f', -1, 64)
+	}
+	if msg, ok := errorResp[2].(string); ok {
+		bfxErr.Message = msg
+	}
+}
+
+// getBody performs a public GET of endpoint and returns the body of a 200 response. Concurrent GETs of the
+// same endpoint, including its query, share one upstream request so they count once against the rate limit.
+// Each caller stops waiting when its own ctx ends; the shared request keeps the values of the ctx of the
+// caller that started it but not its cancellation, so one caller giving up does not fail the others, and
+// is bounded by the HTTP client's timeout instead (DefaultHTTPTimeout when it has none). Authenticated
+// requests go through SendRequest and are never shared.
+func (c *Client) getBody(ctx context.Context, endpoint string) ([]byte, error) {
+	results := c.flight.DoChan(endpoint, func() (interface{}, error) {
+		timeout := c.HTTPClient.Timeout
+		if timeout <= 0 {
+			timeout = DefaultHTTPTimeout
+		}
+		sharedCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(sharedCtx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading response: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			bfxErr := BitfinexError{
+				StatusCode: resp.StatusCode,
+				RawBody:    string(body),
+			}
+			var errorResp []interface{}
+			if err := json.Unmarshal(body, &errorResp); err == nil && len(errorResp) >= 3 {
+				fillErrorFields(&bfxErr, errorResp)
+			}
+			return nil, &bfxErr
+		}
+
+		return body, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.([]byte), nil
+	}
+}
+
+// getJSON performs a public GET of endpoint and decodes the response into v. Bitfinex sometimes reports
+// soft errors as an ["error", code, message] array with status 200, which is returned as a *BitfinexError
+// instead of being decoded as data.
+func (c *Client) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	body, err := c.getBody(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	// Only bodies starting like an error array are parsed twice, books and stats are decoded once
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte(`["error"`)) {
+		var errorResp []interface{}
+		if err := json.Unmarshal(body, &errorResp); err == nil && len(errorResp) >= 3 {
+			bfxErr := BitfinexError{
+				StatusCode: http.StatusOK,
+				RawBody:    string(body),
+			}
+			fillErrorFields(&bfxErr, errorResp)
+			return &bfxErr
+		}
+	}
+
+	return json.Unmarshal(body, v)
+}
+
 func (e BitfinexError) Error() string {
 	return fmt.Sprintf("Bitfinex API Error [%s]: %s (Status Code: %d)",
 		e.ErrorCode, e.Message, e.StatusCode)
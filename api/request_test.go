@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSharedGetSurvivesFirstCallerCancel(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Write([]byte(`[1]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	endpoint := srv.URL + "/v2/shared"
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := c.getBody(firstCtx, endpoint)
+		firstErr <- err
+	}()
+	for atomic.LoadInt32(&requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	secondBody := make(chan []byte, 1)
+	secondErr := make(chan error, 1)
+	go func() {
+		body, err := c.getBody(context.Background(), endpoint)
+		secondBody <- body
+		secondErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // Let the second caller join the shared request
+
+	cancelFirst()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("first caller error = %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if err := <-secondErr; err != nil {
+		t.Fatalf("second caller failed after the first one canceled: %v", err)
+	}
+	if body := <-secondBody; string(body) != "[1]" {
+		t.Errorf("second caller body = %q, want [1]", body)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("upstream received %d requests, want 1 shared request", got)
+	}
+}
+
+func TestCanceledContextUnblocksRequest(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-unblock:
+		}
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.GetFundingStatsWithContext(ctx, "fUSD", 1, 0)
+		errs <- err
+	}()
+
+	// Shutdown cancels the shared context while the request is blocked
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("GetFundingStatsWithContext after cancel = %v, want context.Canceled", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("GetFundingStatsWithContext did not return after cancel")
+	}
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	c := NewClient()
+	if c.BaseURL != "https://api.bitfinex.com" {
+		t.Errorf("BaseURL = %s, want https://api.bitfinex.com", c.BaseURL)
+	}
+	if c.APIKey != "your_api_key" || c.APISecret != "your_api_secret" {
+		t.Errorf("credentials = %s/%s, want the placeholders", c.APIKey, c.APISecret)
+	}
+	if c.HTTPClient == nil || c.Nonce == nil || c.Breaker == nil || c.Limiter == nil {
+		t.Errorf("NewClient left a default unset: %+v", c)
+	}
+}
+
+func TestNewClientOptions(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`[[1700000000000,null,0.0002,10,20,0,0,0,0,0,0,0,0,0,0,0]]`))
+	}))
+	defer srv.Close()
+
+	httpClient := &http.Client{Timeout: time.Second}
+	c := NewClient(WithBaseURL(srv.URL+"/"), WithHTTPClient(httpClient), WithCredentials("key", "secret"), WithRateLimit(0, 0, false))
+	if c.HTTPClient != httpClient {
+		t.Error("WithHTTPClient did not set the HTTP client")
+	}
+	if c.APIKey != "key" || c.APISecret != "secret" {
+		t.Errorf("credentials = %s/%s, want key/secret", c.APIKey, c.APISecret)
+	}
+	if c.Limiter != nil {
+		t.Error("WithRateLimit(0, ...) left a limiter")
+	}
+
+	if _, err := c.GetFundingStats("fUSD", 1); err != nil {
+		t.Fatalf("GetFundingStats against the test server: %v", err)
+	}
+	if path != "/v2/funding/stats/fUSD/hist" {
+		t.Errorf("request path = %s, want /v2/funding/stats/fUSD/hist", path)
+	}
+}
+
+func TestDefaultClientHasTimeout(t *testing.T) {
+	if got := NewClient().HTTPClient.Timeout; got != DefaultHTTPTimeout {
+		t.Errorf("default HTTP client timeout = %s, want %s", got, DefaultHTTPTimeout)
+	}
+
+	httpClient := &http.Client{}
+	c := NewClient(WithHTTPClient(httpClient), WithTimeout(time.Second))
+	if c.HTTPClient.Timeout != time.Second {
+		t.Errorf("WithTimeout did not set the timeout, got %s", c.HTTPClient.Timeout)
+	}
+	if httpClient.Timeout != 0 {
+		t.Error("WithTimeout changed the client passed to WithHTTPClient")
+	}
+}
+
+func TestRequestTimesOutOnHungServer(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c := NewClient(WithBaseURL(srv.URL), WithTimeout(100*time.Millisecond), WithRateLimit(0, 0, false))
+	start := time.Now()
+	if _, err := c.GetFundingStats("fUSD", 1); err == nil {
+		t.Fatal("GetFundingStats succeeded against a hung server")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GetFundingStats returned after %s, want about the 100ms timeout", elapsed)
+	}
+}
+
+func TestErrorArrayWithStatus200ReturnsBitfinexError(t *testing.T) {
+	body := `["error", 10020, "symbol: invalid"]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Bitfinex sometimes sends soft errors with status 200
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+
+	calls := map[string]func() error{
+		"funding book": func() error {
+			_, err := c.GetFundingBookWithContext(context.Background(), "fXYZ", PrecisionP0)
+			return err
+		},
+		"raw funding book": func() error {
+			_, err := c.GetRawFundingBookWithContext(context.Background(), "fXYZ")
+			return err
+		},
+		"funding stats": func() error {
+			_, err := c.GetFundingStatsWithContext(context.Background(), "fXYZ", 1, 0)
+			return err
+		},
+	}
+	for name, call := range calls {
+		err := call()
+		var bfxErr *BitfinexError
+		if !errors.As(err, &bfxErr) {
+			t.Errorf("%s error = %v, want a BitfinexError", name, err)
+			continue
+		}
+		if bfxErr.StatusCode != http.StatusOK || bfxErr.ErrorCode != "10020" || bfxErr.Message != "symbol: invalid" || bfxErr.RawBody != body {
+			t.Errorf("%s error = %+v, want code 10020 and the message of the 200 response", name, bfxErr)
+		}
+	}
+}
@@ -2,9 +2,7 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"strings"
 )
 
@@ -16,25 +14,8 @@ func (c *Client) GetTradingTicker(symbol string) (*TradingTicker, error) {
 // GetTradingTickerWithContext retrieves market data for a trading pair using context
 func (c *Client) GetTradingTickerWithContext(ctx context.Context, symbol string) (*TradingTicker, error) {
 	endpoint := fmt.Sprintf("%s/v2/ticker/%s", c.BaseURL, symbol)
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var bitfinexError BitfinexError
-		bitfinexError.StatusCode = resp.StatusCode
-		return nil, &bitfinexError
-	}
-
 	var rawData []interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawData); err != nil {
+	if err := c.getJSON(ctx, endpoint, &rawData); err != nil {
 		return nil, err
 	}
 
@@ -68,52 +49,43 @@ func (c *Client) GetFundingTicker(symbol string) (*FundingTicker, error) {
 // GetFundingTickerWithContext retrieves market data for a funding currency using context
 func (c *Client) GetFundingTickerWithContext(ctx context.Context, symbol string) (*FundingTicker, error) {
 	endpoint := fmt.Sprintf("%s/v2/ticker/%s", c.BaseURL, symbol)
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var bitfinexError BitfinexError
-		bitfinexError.StatusCode = resp.StatusCode
-		return nil, &bitfinexError
-	}
-
 	var rawData []interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawData); err != nil {
+	if err := c.getJSON(ctx, endpoint, &rawData); err != nil {
 		return nil, err
 	}
 
-	// Check if there is enough data
-	if len(rawData) < 16 {
+	// Newly listed currencies may return fewer fields, so only an empty response is rejected
+	if len(rawData) == 0 {
 		return nil, fmt.Errorf("invalid response format for funding ticker")
 	}
 
-	// Convert to FundingTicker
+	return parseFundingTicker(rawData), nil
+}
+
+// parseFundingTicker converts a funding ticker array, as returned by the REST and WebSocket APIs,
+// to a FundingTicker. Null fields (e.g. bid/ask in illiquid markets) and missing trailing fields
+// are left at zero and listed in Missing.
+func parseFundingTicker(rawData []interface{}) *FundingTicker {
+	fields := &fieldReader{data: rawData}
 	ticker := &FundingTicker{
-		FRR:                rawData[0].(float64),
-		Bid:                rawData[1].(float64),
-		BidPeriod:          int(rawData[2].(float64)),
-		BidSize:            rawData[3].(float64),
-		Ask:                rawData[4].(float64),
-		AskPeriod:          int(rawData[5].(float64)),
-		AskSize:            rawData[6].(float64),
-		DailyChange:        rawData[7].(float64),
-		DailyChangePercent: rawData[8].(float64),
-		LastPrice:          rawData[9].(float64),
-		Volume:             rawData[10].(float64),
-		High:               rawData[11].(float64),
-		Low:                rawData[12].(float64),
-		FRRAmountAvailable: rawData[15].(float64),
+		FRR:                fields.float(0, "frr"),
+		Bid:                fields.float(1, "bid"),
+		BidPeriod:          fields.int(2, "bid_period"),
+		BidSize:            fields.float(3, "bid_size"),
+		Ask:                fields.float(4, "ask"),
+		AskPeriod:          fields.int(5, "ask_period"),
+		AskSize:            fields.float(6, "ask_size"),
+		DailyChange:        fields.float(7, "daily_change"),
+		DailyChangePercent: fields.float(8, "daily_change_perc"),
+		LastPrice:          fields.float(9, "last_price"),
+		Volume:             fields.float(10, "volume"),
+		High:               fields.float(11, "high"),
+		Low:                fields.float(12, "low"),
+		FRRAmountAvailable: fields.float(15, "frr_amount_available"),
 	}
+	ticker.Missing = fields.missing
 
-	return ticker, nil
+	return ticker
 }
 
 // GetTicker is a convenience function that determines the appropriate ticker type based on symbol prefix (maintains backward compatibility)
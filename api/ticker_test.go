@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetFundingTickerTruncatedArray(t *testing.T) {
+	// A newly listed currency reporting only FRR, bid and ask fields, with a null ask size
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[0.0001,0.0002,30,1000,0.0003,2,null,0.00001]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	ticker, err := c.GetFundingTickerWithContext(context.Background(), "fNEW")
+	if err != nil {
+		t.Fatalf("GetFundingTickerWithContext: %v", err)
+	}
+
+	if ticker.FRR != 0.0001 || ticker.Bid != 0.0002 || ticker.BidPeriod != 30 || ticker.BidSize != 1000 ||
+		ticker.Ask != 0.0003 || ticker.AskPeriod != 2 || ticker.DailyChange != 0.00001 {
+		t.Errorf("parsed %+v, want the fields present in the response", ticker)
+	}
+	if ticker.AskSize != 0 || ticker.FRRAmountAvailable != 0 {
+		t.Errorf("parsed %+v, want null and missing fields left at zero", ticker)
+	}
+	want := []string{"ask_size", "daily_change_perc", "last_price", "volume", "high", "low", "frr_amount_available"}
+	if !reflect.DeepEqual(ticker.Missing, want) {
+		t.Errorf("Missing = %v, want %v", ticker.Missing, want)
+	}
+}
+
+func TestGetFundingTickerRejectsEmptyArray(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	if _, err := c.GetFundingTickerWithContext(context.Background(), "fNEW"); err == nil {
+		t.Error("empty ticker accepted, want an error")
+	}
+}
+
+func TestParseFundingTickerNullBidAsk(t *testing.T) {
+	// An illiquid market without bids or asks, as returned by the REST and WebSocket APIs
+	body := `[0.0001,null,null,null,null,null,null,0,0,0.00012,1500,0.00013,0.00011,null,null,25000]`
+	var rawData []interface{}
+	if err := json.Unmarshal([]byte(body), &rawData); err != nil {
+		t.Fatalf("failed to decode test data: %v", err)
+	}
+
+	ticker := parseFundingTicker(rawData)
+
+	if ticker.Bid != 0 || ticker.BidPeriod != 0 || ticker.BidSize != 0 || ticker.Ask != 0 || ticker.AskPeriod != 0 || ticker.AskSize != 0 {
+		t.Errorf("parsed %+v, want null bid and ask fields left at zero", ticker)
+	}
+	if ticker.FRR != 0.0001 || ticker.LastPrice != 0.00012 || ticker.Volume != 1500 || ticker.FRRAmountAvailable != 25000 {
+		t.Errorf("parsed %+v, want the other fields kept", ticker)
+	}
+	want := []string{"bid", "bid_period", "bid_size", "ask", "ask_period", "ask_size"}
+	if !reflect.DeepEqual(ticker.Missing, want) {
+		t.Errorf("Missing = %v, want %v", ticker.Missing, want)
+	}
+}
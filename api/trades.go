@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// GetFundingTradesWithTimeRange retrieves public funding trades for the specified time range (maintains backward compatibility)
+func (c *Client) GetFundingTradesWithTimeRange(symbol string, start, end int64, limit int) ([]FundingTrade, error) {
+	return c.GetFundingTradesWithTimeRangeWithContext(context.Background(), symbol, start, end, limit)
+}
+
+// GetFundingTradesWithTimeRangeWithContext retrieves public funding trades for the specified time range,
+// newest first, using context. 0 leaves start or end open.
+func (c *Client) GetFundingTradesWithTimeRangeWithContext(ctx context.Context, symbol string, start, end int64, limit int) ([]FundingTrade, error) {
+	return c.GetFundingTradesWithContext(ctx, symbol, start, end, limit, 0)
+}
+
+// Sort orders of the trades history endpoint
+const (
+	SortDescending = -1 // Newest first, the Bitfinex default
+	SortAscending  = 1  // Oldest first, for paging forward from a known trade
+)
+
+// GetFundingTrades retrieves public funding trades in the given sort order (maintains backward compatibility)
+func (c *Client) GetFundingTrades(symbol string, start, end int64, limit, sort int) ([]FundingTrade, error) {
+	return c.GetFundingTradesWithContext(context.Background(), symbol, start, end, limit, sort)
+}
+
+// GetFundingTradesWithContext retrieves public funding trades between start and end (MTS, inclusive; 0 leaves
+// a bound open) using context. sort is SortAscending for oldest first, SortDescending or 0 for newest first.
+func (c *Client) GetFundingTradesWithContext(ctx context.Context, symbol string, start, end int64, limit, sort int) ([]FundingTrade, error) {
+	if sort != 0 && sort != SortAscending && sort != SortDescending {
+		return nil, fmt.Errorf("invalid sort %d, must be %d, %d or 0", sort, SortAscending, SortDescending)
+	}
+
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if start > 0 {
+		query.Set("start", strconv.FormatInt(start, 10))
+	}
+	if end > 0 {
+		query.Set("end", strconv.FormatInt(end, 10))
+	}
+	if sort != 0 {
+		query.Set("sort", strconv.Itoa(sort))
+	}
+
+	endpoint := fmt.Sprintf("%s/v2/trades/%s/hist", c.BaseURL, symbol)
+	if len(query) > 0 {
+		endpoint = fmt.Sprintf("%s?%s", endpoint, query.Encode())
+	}
+
+	var rawData [][]interface{}
+	if err := c.getJSON(ctx, endpoint, &rawData); err != nil {
+		return nil, err
+	}
+
+	// Funding trades are [ID, MTS, AMOUNT, RATE, PERIOD]
+	trades := make([]FundingTrade, 0, len(rawData))
+	for _, data := range rawData {
+		reader := fieldReader{data: data}
+		trade := FundingTrade{
+			ID:     int64(reader.float(0, "id")),
+			MTS:    int64(reader.float(1, "mts")),
+			Amount: reader.float(2, "amount"),
+			Rate:   reader.float(3, "rate"),
+			Period: reader.int(4, "period"),
+		}
+		if len(reader.missing) > 0 {
+			return nil, fmt.Errorf("invalid funding trade %v: missing %v", data, reader.missing)
+		}
+		trades = append(trades, trade)
+	}
+
+	return trades, nil
+}
+
+// GetFundingTradesHistoryWithContext retrieves all public funding trades between start and end (MTS,
+// inclusive; 0 leaves a bound open) in the given sort order, paging through the history endpoint using context
+func (c *Client) GetFundingTradesHistoryWithContext(ctx context.Context, symbol string, start, end int64, sort int) ([]FundingTrade, error) {
+	return PageHistory(ctx, func(start, end int64, limit int) ([]FundingTrade, error) {
+		return c.GetFundingTradesWithContext(ctx, symbol, start, end, limit, sort)
+	}, func(trade FundingTrade) int64 { return trade.MTS }, start, end, FundingTradesPageLimit, sort)
+}
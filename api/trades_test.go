@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetFundingTradesAscending(t *testing.T) {
+	var path, query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		w.Write([]byte(`[[101,1700000000000,-500,0.0002,2],[102,1700000001000,250.5,0.00021,30]]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithRateLimit(0, 0, false))
+	trades, err := c.GetFundingTrades("fUSD", 1700000000000, 0, 100, SortAscending)
+	if err != nil {
+		t.Fatalf("GetFundingTrades: %v", err)
+	}
+
+	if path != "/v2/trades/fUSD/hist" {
+		t.Errorf("path = %s, want /v2/trades/fUSD/hist", path)
+	}
+	if query != "limit=100&sort=1&start=1700000000000" {
+		t.Errorf("query = %s, want limit=100&sort=1&start=1700000000000", query)
+	}
+
+	want := []FundingTrade{
+		{ID: 101, MTS: 1700000000000, Amount: -500, Rate: 0.0002, Period: 2},
+		{ID: 102, MTS: 1700000001000, Amount: 250.5, Rate: 0.00021, Period: 30},
+	}
+	if len(trades) != len(want) {
+		t.Fatalf("got %d trades, want %d", len(trades), len(want))
+	}
+	for i := range want {
+		if trades[i] != want[i] {
+			t.Errorf("trade %d = %+v, want %+v", i, trades[i], want[i])
+		}
+	}
+}
+
+func TestGetFundingTradesRejectsInvalidSort(t *testing.T) {
+	c := NewClient(WithBaseURL("http://127.0.0.1:0"), WithRateLimit(0, 0, false))
+	if _, err := c.GetFundingTrades("fUSD", 0, 0, 10, 2); err == nil {
+		t.Fatal("GetFundingTrades with sort 2 succeeded, want an error")
+	}
+}
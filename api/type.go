@@ -1,12 +1,21 @@
 package api
 
-import "net/http"
+import (
+	"net/http"
+
+	"golang.org/x/sync/singleflight"
+)
 
 type Client struct {
 	APIKey     string
 	APISecret  string
 	HTTPClient *http.Client
 	BaseURL    string
+	Nonce      NonceGenerator  // Nonce source for authenticated requests; share one generator between clients using the same key
+	Breaker    *CircuitBreaker // Fails fast on endpoints that keep failing, nil disables
+	Limiter    *RateLimiter    // Spaces out requests, nil disables
+
+	flight singleflight.Group // Shares concurrent identical public GETs
 }
 
 type BitfinexError struct {
@@ -19,7 +28,11 @@ type BitfinexError struct {
 // FundingStats represents funding statistics for a given currency
 type FundingStats struct {
 	MTS                   int64   `json:"mts"`
-	FRR                   float64 `json:"frr"`
+	FRR                   float64 `json:"frr"`                   // Unscaled FRR as returned by Bitfinex, 1/365th of the daily FRR
+	FRRRaw                float64 `json:"frr_raw"`               // Same unscaled value as FRR, kept for clients reading frr_raw
+	FRRAPR                float64 `json:"frr_apr"`               // FRR as an annual rate (rates.StatsFRRToAPR); set when read from the database
+	FRRMissing            bool    `json:"frr_missing,omitempty"` // FRR was null, e.g. in low-liquidity windows; FRR is left at zero and stored as NULL
+	Period                int     `json:"period"`                // Offer period in days the stats are keyed by, 0 for the stats over all periods
 	AveragePeriod         float64 `json:"avg_period"`
 	FundingAmount         float64 `json:"funding_amount"`
 	FundingAmountUsed     float64 `json:"funding_amount_used"`
@@ -56,6 +69,16 @@ type RawFundingBook struct {
 	Amount  float64 `json:"amount"` // > 0 for asks, < 0 for bids
 }
 
+// FundingCandle represents one candle of funding trade rates
+type FundingCandle struct {
+	MTS    int64   `json:"mts"`
+	Open   float64 `json:"open"`  // Rate of the first trade in the candle
+	Close  float64 `json:"close"` // Rate of the last trade in the candle
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Volume float64 `json:"volume"` // Amount traded in the candle
+}
+
 // TradingTicker represents the ticker data for a trading pair
 type TradingTicker struct {
 	Bid                 float64 `json:"bid"`                   // Price of last highest bid
@@ -72,18 +95,19 @@ type TradingTicker struct {
 
 // FundingTicker represents the ticker data for a funding currency
 type FundingTicker struct {
-	FRR                float64 `json:"frr"`                  // Flash Return Rate - average of all fixed rate funding over the last hour
-	Bid                float64 `json:"bid"`                  // Price of last highest bid
-	BidPeriod          int     `json:"bid_period"`           // Bid period covered in days
-	BidSize            float64 `json:"bid_size"`             // Sum of the 25 highest bid sizes
-	Ask                float64 `json:"ask"`                  // Price of last lowest ask
-	AskPeriod          int     `json:"ask_period"`           // Ask period covered in days
-	AskSize            float64 `json:"ask_size"`             // Sum of the 25 lowest ask sizes
-	DailyChange        float64 `json:"daily_change"`         // Amount that the last price has changed since yesterday
-	DailyChangePercent float64 `json:"daily_change_perc"`    // Relative price change since yesterday (*100 for percentage change)
-	LastPrice          float64 `json:"last_price"`           // Price of the last trade
-	Volume             float64 `json:"volume"`               // Daily volume
-	High               float64 `json:"high"`                 // Daily high
-	Low                float64 `json:"low"`                  // Daily low
-	FRRAmountAvailable float64 `json:"frr_amount_available"` // The amount of funding that is available at the Flash Return Rate
+	FRR                float64  `json:"frr"`                  // Flash Return Rate - average of all fixed rate funding over the last hour
+	Bid                float64  `json:"bid"`                  // Price of last highest bid
+	BidPeriod          int      `json:"bid_period"`           // Bid period covered in days
+	BidSize            float64  `json:"bid_size"`             // Sum of the 25 highest bid sizes
+	Ask                float64  `json:"ask"`                  // Price of last lowest ask
+	AskPeriod          int      `json:"ask_period"`           // Ask period covered in days
+	AskSize            float64  `json:"ask_size"`             // Sum of the 25 lowest ask sizes
+	DailyChange        float64  `json:"daily_change"`         // Amount that the last price has changed since yesterday
+	DailyChangePercent float64  `json:"daily_change_perc"`    // Relative price change since yesterday (*100 for percentage change)
+	LastPrice          float64  `json:"last_price"`           // Price of the last trade
+	Volume             float64  `json:"volume"`               // Daily volume
+	High               float64  `json:"high"`                 // Daily high
+	Low                float64  `json:"low"`                  // Daily low
+	FRRAmountAvailable float64  `json:"frr_amount_available"` // The amount of funding that is available at the Flash Return Rate
+	Missing            []string `json:"missing,omitempty"`    // Fields that were null or absent in the response and left at zero
 }
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -14,6 +16,9 @@ const (
 	bitfinexWSURL = "wss://api-pub.bitfinex.com/ws/2"
 	maxRetries    = 5
 	retryDelay    = 5 * time.Second
+
+	// confFlagSeqAll makes Bitfinex append a sequence number to every frame
+	confFlagSeqAll = 65536
 )
 
 type FundingTrade struct {
@@ -28,6 +33,8 @@ type SubscribeMessage struct {
 	Event   string `json:"event"`
 	Channel string `json:"channel"`
 	Symbol  string `json:"symbol"`
+	Prec    string `json:"prec,omitempty"` // Book precision, book channel only
+	Len     string `json:"len,omitempty"`  // Number of price levels, book channel only
 }
 
 type SubscribedResponse struct {
@@ -36,27 +43,81 @@ type SubscribedResponse struct {
 	ChanID   int    `json:"chanId"`
 	Symbol   string `json:"symbol"`
 	Currency string `json:"currency"`
+	Msg      string `json:"msg"`  // Set on error events
+	Code     int    `json:"code"` // Set on error events
+}
+
+// ConfMessage configures connection flags such as sequencing
+type ConfMessage struct {
+	Event string `json:"event"`
+	Flags int    `json:"flags"`
+}
+
+type UnsubscribeMessage struct {
+	Event  string `json:"event"`
+	ChanID int    `json:"chanId"`
+}
+
+// subscribeResult carries the outcome of a subscription acknowledgement to a waiting Subscribe call
+type subscribeResult struct {
+	chanID int
+	err    error
 }
 
 type WebSocketClient struct {
-	conn       *websocket.Conn
-	mu         sync.Mutex
-	subscribed bool
-	stopChan   chan struct{}
-	reconnect  bool
+	conn          *websocket.Conn
+	mu            sync.Mutex
+	subscriptions map[wsSubscription]bool // Channels to (re-)subscribe to
+	channels      map[int]string          // Channel ID to symbol, filled from subscription acks
+	channelNames  map[int]string          // Channel ID to channel name (trades, ticker, book)
+	tickerHandler func(symbol string, ticker FundingTicker) error
+	bookHandler   func(symbol string, books []FundingBook, snapshot bool) error
+	pending       map[string]chan subscribeResult
+	stopChan      chan struct{}
+	ctx           context.Context // Context of the latest ConnectWithContext, bounding reconnection attempts
+	reconnect     bool
+	lastSeq       int64 // Last sequence number seen on the connection, 0 before the first frame
+	droppedFrames int64 // Frames missing from sequence gaps, accessed atomically
+
+	URL              string        // WebSocket endpoint, defaults to the public Bitfinex API
+	MaxRetries       int           // Connection attempts per Connect call
+	RetryDelay       time.Duration // Delay between connection attempts
+	ResubscribeOnGap bool          // Resubscribe to every channel when a sequence gap shows dropped frames
 }
 
 func NewWebSocketClient() *WebSocketClient {
 	return &WebSocketClient{
-		stopChan:  make(chan struct{}),
-		reconnect: true,
+		subscriptions: make(map[wsSubscription]bool),
+		channels:      make(map[int]string),
+		channelNames:  make(map[int]string),
+		pending:       make(map[string]chan subscribeResult),
+		stopChan:      make(chan struct{}),
+		reconnect:     true,
+		URL:           bitfinexWSURL,
+		MaxRetries:    maxRetries,
+		RetryDelay:    retryDelay,
 	}
 }
 
+// SetReconnect enables or disables automatic reconnection after read errors
+func (wsc *WebSocketClient) SetReconnect(reconnect bool) {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+
+	wsc.reconnect = reconnect
+}
+
 func (wsc *WebSocketClient) Connect() error {
+	return wsc.ConnectWithContext(context.Background())
+}
+
+// ConnectWithContext connects to Bitfinex using context. Dialing and waiting between attempts end with the
+// context's error once it is canceled, and the context also bounds later automatic reconnection attempts.
+func (wsc *WebSocketClient) ConnectWithContext(ctx context.Context) error {
 	wsc.mu.Lock()
 	defer wsc.mu.Unlock()
 
+	wsc.ctx = ctx
 	if wsc.conn != nil {
 		return nil
 	}
@@ -66,22 +127,130 @@ func (wsc *WebSocketClient) Connect() error {
 	}
 
 	var err error
-	for i := 0; i < maxRetries; i++ {
-		wsc.conn, _, err = dialer.Dial(bitfinexWSURL, nil)
+	for i := 0; i < wsc.MaxRetries; i++ {
+		wsc.conn, _, err = dialer.DialContext(ctx, wsc.URL, nil)
 		if err == nil {
 			log.Printf("Successfully connected to Bitfinex WebSocket")
-			return nil
+			return wsc.enableSequencing()
 		}
-		log.Printf("Failed to connect to Bitfinex (attempt %d/%d): %v", i+1, maxRetries, err)
-		if i < maxRetries-1 {
-			time.Sleep(retryDelay)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Failed to connect to Bitfinex (attempt %d/%d): %v", i+1, wsc.MaxRetries, err)
+		if i < wsc.MaxRetries-1 {
+			timer := time.NewTimer(wsc.RetryDelay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
 		}
 	}
 
-	return fmt.Errorf("failed to connect to Bitfinex after %d attempts: %v", maxRetries, err)
+	return fmt.Errorf("failed to connect to Bitfinex after %d attempts: %v", wsc.MaxRetries, err)
+}
+
+// enableSequencing asks Bitfinex to append sequence numbers to frames; the caller must hold wsc.mu
+func (wsc *WebSocketClient) enableSequencing() error {
+	msg, err := json.Marshal(ConfMessage{
+		Event: "conf",
+		Flags: confFlagSeqAll,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal conf message: %v", err)
+	}
+
+	if err := wsc.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		return fmt.Errorf("failed to send conf message: %v", err)
+	}
+
+	wsc.lastSeq = 0 // Sequence numbers restart with each connection
+	return nil
+}
+
+// DroppedFrames returns the number of frames detected as missing from sequence gaps
+func (wsc *WebSocketClient) DroppedFrames() int64 {
+	return atomic.LoadInt64(&wsc.droppedFrames)
+}
+
+// checkSequence records the sequence number of a frame and returns how many frames were skipped since
+// the previous one. Bitfinex numbers the frames of all channels of a connection in one sequence, so the
+// first frame after connecting only sets the baseline.
+func (wsc *WebSocketClient) checkSequence(seq int64) int64 {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+
+	last := wsc.lastSeq
+	wsc.lastSeq = seq
+	if last == 0 || seq <= last+1 {
+		return 0
+	}
+
+	missed := seq - last - 1
+	atomic.AddInt64(&wsc.droppedFrames, missed)
+	log.Printf("WebSocket sequence gap: expected %d, got %d (%d frames dropped)", last+1, seq, missed)
+	return missed
+}
+
+// frameSequence returns the sequence number Bitfinex appends as the last element of a channel frame
+func frameSequence(data []interface{}) (int64, bool) {
+	// Frames without sequencing end with the channel ID, event type or payload instead
+	if len(data) < 3 {
+		return 0, false
+	}
+	seq, ok := data[len(data)-1].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int64(seq), true
+}
+
+// resubscribe unsubscribes from a channel and subscribes to its symbol again, e.g. after dropped frames
+func (wsc *WebSocketClient) resubscribe(chanID int) {
+	wsc.mu.Lock()
+	symbol, ok := wsc.channels[chanID]
+	channel := wsc.channelNames[chanID]
+	wsc.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if err := wsc.Unsubscribe(chanID); err != nil {
+		log.Printf("Failed to unsubscribe from channel %d: %v", chanID, err)
+		return
+	}
+	if err := wsc.SubscribeToChannel(channel, symbol); err != nil {
+		log.Printf("Failed to re-subscribe to %s: %v", symbol, err)
+	}
+}
+
+// resubscribeAll resubscribes to every subscribed channel; a gap in the connection's sequence does not
+// show which channel the dropped frames belonged to
+func (wsc *WebSocketClient) resubscribeAll() {
+	wsc.mu.Lock()
+	chanIDs := make([]int, 0, len(wsc.channels))
+	for chanID := range wsc.channels {
+		chanIDs = append(chanIDs, chanID)
+	}
+	wsc.mu.Unlock()
+
+	for _, chanID := range chanIDs {
+		wsc.resubscribe(chanID)
+	}
 }
 
 func (wsc *WebSocketClient) SubscribeToFundingTrades(symbol string) error {
+	return wsc.SubscribeToChannel(ChannelTrades, symbol)
+}
+
+// SubscribeToChannel subscribes to a trades, ticker or book channel for symbol. Book channels
+// stream the P0 aggregated funding book.
+func (wsc *WebSocketClient) SubscribeToChannel(channel, symbol string) error {
+	if !IsWSChannel(channel) {
+		return fmt.Errorf("unsupported WebSocket channel: %s", channel)
+	}
+
 	wsc.mu.Lock()
 	defer wsc.mu.Unlock()
 
@@ -91,9 +260,13 @@ func (wsc *WebSocketClient) SubscribeToFundingTrades(symbol string) error {
 
 	subscribeMsg := SubscribeMessage{
 		Event:   "subscribe",
-		Channel: "trades",
+		Channel: channel,
 		Symbol:  symbol,
 	}
+	if channel == ChannelBook {
+		subscribeMsg.Prec = string(PrecisionP0)
+		subscribeMsg.Len = wsBookLength
+	}
 
 	msg, err := json.Marshal(subscribeMsg)
 	if err != nil {
@@ -105,11 +278,77 @@ func (wsc *WebSocketClient) SubscribeToFundingTrades(symbol string) error {
 		return fmt.Errorf("failed to send subscribe message: %v", err)
 	}
 
-	wsc.subscribed = true
+	wsc.subscriptions[wsSubscription{channel: channel, symbol: symbol}] = true
+	return nil
+}
+
+// Subscribe subscribes to funding trades for symbol and waits for the acknowledgement, returning the
+// channel ID. The acknowledgement is read by the loop started with HandleFundingTrades, which must be running.
+func (wsc *WebSocketClient) Subscribe(ctx context.Context, symbol string) (int, error) {
+	result := make(chan subscribeResult, 1)
+	wsc.mu.Lock()
+	wsc.pending[symbol] = result
+	wsc.mu.Unlock()
+
+	removePending := func() {
+		wsc.mu.Lock()
+		if wsc.pending[symbol] == result {
+			delete(wsc.pending, symbol)
+		}
+		wsc.mu.Unlock()
+	}
+
+	if err := wsc.SubscribeToFundingTrades(symbol); err != nil {
+		removePending()
+		return 0, err
+	}
+
+	select {
+	case r := <-result:
+		return r.chanID, r.err
+	case <-ctx.Done():
+		removePending()
+		return 0, ctx.Err()
+	}
+}
+
+// Unsubscribe unsubscribes from the channel and stops re-subscribing to its symbol on reconnect
+func (wsc *WebSocketClient) Unsubscribe(chanID int) error {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+
+	if wsc.conn == nil {
+		return fmt.Errorf("not connected to Bitfinex")
+	}
+
+	msg, err := json.Marshal(UnsubscribeMessage{
+		Event:  "unsubscribe",
+		ChanID: chanID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal unsubscribe message: %v", err)
+	}
+
+	if err := wsc.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		return fmt.Errorf("failed to send unsubscribe message: %v", err)
+	}
+
+	if symbol, ok := wsc.channels[chanID]; ok {
+		delete(wsc.subscriptions, wsSubscription{channel: wsc.channelNames[chanID], symbol: symbol})
+		delete(wsc.channels, chanID)
+		delete(wsc.channelNames, chanID)
+	}
 	return nil
 }
 
 func (wsc *WebSocketClient) HandleFundingTrades(handler func(trade FundingTrade, msgType string) error) {
+	wsc.HandleFundingTradesWithSymbol(func(symbol string, trade FundingTrade, msgType string) error {
+		return handler(trade, msgType)
+	})
+}
+
+// HandleFundingTradesWithSymbol handles funding trades, passing the symbol of the channel each trade arrived on
+func (wsc *WebSocketClient) HandleFundingTradesWithSymbol(handler func(symbol string, trade FundingTrade, msgType string) error) {
 	go func() {
 		for {
 			select {
@@ -117,7 +356,10 @@ func (wsc *WebSocketClient) HandleFundingTrades(handler func(trade FundingTrade,
 				return
 			default:
 				if err := wsc.readAndHandleMessages(handler); err != nil {
-					if wsc.reconnect {
+					wsc.mu.Lock()
+					reconnect := wsc.reconnect
+					wsc.mu.Unlock()
+					if reconnect {
 						log.Printf("WebSocket error, attempting to reconnect: %v", err)
 						wsc.reconnectWebSocket()
 					} else {
@@ -130,7 +372,7 @@ func (wsc *WebSocketClient) HandleFundingTrades(handler func(trade FundingTrade,
 	}()
 }
 
-func (wsc *WebSocketClient) readAndHandleMessages(handler func(trade FundingTrade, msgType string) error) error {
+func (wsc *WebSocketClient) readAndHandleMessages(handler func(symbol string, trade FundingTrade, msgType string) error) error {
 	wsc.mu.Lock()
 	if wsc.conn == nil {
 		wsc.mu.Unlock()
@@ -143,10 +385,10 @@ func (wsc *WebSocketClient) readAndHandleMessages(handler func(trade FundingTrad
 		return fmt.Errorf("error reading message: %v", err)
 	}
 
-	// First check if it's a subscription response
+	// First check if it's an event such as a subscription response
 	var subResp SubscribedResponse
-	if err := json.Unmarshal(message, &subResp); err == nil && subResp.Event == "subscribed" {
-		log.Printf("Successfully subscribed to channel %d for %s", subResp.ChanID, subResp.Symbol)
+	if err := json.Unmarshal(message, &subResp); err == nil && subResp.Event != "" {
+		wsc.handleEvent(subResp)
 		return nil
 	}
 
@@ -157,6 +399,30 @@ func (wsc *WebSocketClient) readAndHandleMessages(handler func(trade FundingTrad
 		return nil
 	}
 
+	if _, ok := data[0].(float64); ok {
+		if seq, ok := frameSequence(data); ok {
+			if missed := wsc.checkSequence(seq); missed > 0 && wsc.ResubscribeOnGap {
+				wsc.resubscribeAll()
+			}
+		}
+	}
+
+	if chanID, ok := data[0].(float64); ok && len(data) >= 2 {
+		wsc.mu.Lock()
+		channel := wsc.channelNames[int(chanID)]
+		symbol := wsc.channels[int(chanID)]
+		wsc.mu.Unlock()
+
+		switch channel {
+		case ChannelTicker:
+			wsc.handleTickerFrame(symbol, data)
+			return nil
+		case ChannelBook:
+			wsc.handleBookFrame(symbol, data)
+			return nil
+		}
+	}
+
 	if len(data) < 3 {
 		return nil
 	}
@@ -172,7 +438,11 @@ func (wsc *WebSocketClient) readAndHandleMessages(handler func(trade FundingTrad
 					Rate:   tradeData[3].(float64),
 					Period: int(tradeData[4].(float64)),
 				}
-				if err := handler(trade, msgType); err != nil {
+				chanID, _ := data[0].(float64)
+				wsc.mu.Lock()
+				symbol := wsc.channels[int(chanID)]
+				wsc.mu.Unlock()
+				if err := handler(symbol, trade, msgType); err != nil {
 					log.Printf("Error handling trade: %v", err)
 				}
 			}
@@ -182,26 +452,78 @@ func (wsc *WebSocketClient) readAndHandleMessages(handler func(trade FundingTrad
 	return nil
 }
 
+// handleEvent processes subscription events, resolving any Subscribe call waiting on the symbol
+func (wsc *WebSocketClient) handleEvent(event SubscribedResponse) {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+
+	switch event.Event {
+	case "subscribed":
+		wsc.channels[event.ChanID] = event.Symbol
+		wsc.channelNames[event.ChanID] = event.Channel
+		log.Printf("Successfully subscribed to %s channel %d for %s", event.Channel, event.ChanID, event.Symbol)
+		// Subscribe waits for funding trade subscriptions only
+		if event.Channel != ChannelTrades {
+			return
+		}
+		if result, ok := wsc.pending[event.Symbol]; ok {
+			result <- subscribeResult{chanID: event.ChanID}
+			delete(wsc.pending, event.Symbol)
+		}
+	case "unsubscribed":
+		log.Printf("Successfully unsubscribed from channel %d", event.ChanID)
+	case "error":
+		log.Printf("Bitfinex WebSocket error %d: %s", event.Code, event.Msg)
+		if result, ok := wsc.pending[event.Symbol]; ok {
+			result <- subscribeResult{err: fmt.Errorf("subscription to %s failed: %s (code %d)", event.Symbol, event.Msg, event.Code)}
+			delete(wsc.pending, event.Symbol)
+		}
+	}
+}
+
 func (wsc *WebSocketClient) reconnectWebSocket() {
 	wsc.mu.Lock()
 	if wsc.conn != nil {
 		wsc.conn.Close()
 		wsc.conn = nil
 	}
+	wsc.channels = make(map[int]string)
+	wsc.channelNames = make(map[int]string)
+	subscriptions := make([]wsSubscription, 0, len(wsc.subscriptions))
+	for subscription := range wsc.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	ctx := wsc.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	wsc.mu.Unlock()
 
 	for {
-		if err := wsc.Connect(); err != nil {
+		select {
+		case <-wsc.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if err := wsc.ConnectWithContext(ctx); err != nil {
 			log.Printf("Failed to reconnect: %v", err)
-			time.Sleep(retryDelay)
+			select {
+			case <-time.After(wsc.RetryDelay):
+			case <-wsc.stopChan:
+				return
+			case <-ctx.Done():
+				return
+			}
 			continue
 		}
 
-		// Re-subscribe if needed
-		if wsc.subscribed {
-			if err := wsc.SubscribeToFundingTrades("fUSD"); err != nil {
-				log.Printf("Failed to re-subscribe: %v", err)
-				continue
+		// Re-subscribe to every previously subscribed channel
+		for _, subscription := range subscriptions {
+			if err := wsc.SubscribeToChannel(subscription.channel, subscription.symbol); err != nil {
+				log.Printf("Failed to re-subscribe to %s %s: %v", subscription.symbol, subscription.channel, err)
 			}
 		}
 
@@ -214,7 +536,12 @@ func (wsc *WebSocketClient) Close() {
 	defer wsc.mu.Unlock()
 
 	wsc.reconnect = false
-	close(wsc.stopChan)
+	select {
+	case <-wsc.stopChan:
+		// Already closed
+	default:
+		close(wsc.stopChan)
+	}
 	if wsc.conn != nil {
 		wsc.conn.Close()
 		wsc.conn = nil
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsFrame is a client frame received by a mock Bitfinex WebSocket server
+type wsFrame struct {
+	conn  int // Connection number, starting at 1
+	event SubscribedResponse
+	raw   string
+}
+
+// newMockWSServer starts a mock Bitfinex WebSocket server passing every subscribe and unsubscribe frame it
+// receives to frames. Subscriptions are acknowledged with channel IDs starting at 42; the first connection
+// is dropped after its first acknowledgement when dropFirst is set.
+func newMockWSServer(t *testing.T, frames chan<- wsFrame, dropFirst bool) *WebSocketClient {
+	t.Helper()
+
+	var conns, chanIDs int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		conn := int(atomic.AddInt32(&conns, 1))
+
+		for {
+			_, message, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var event SubscribedResponse
+			if err := json.Unmarshal(message, &event); err != nil || (event.Event != "subscribe" && event.Event != "unsubscribe") {
+				continue
+			}
+			frames <- wsFrame{conn: conn, event: event, raw: string(message)}
+
+			if event.Event == "subscribe" {
+				chanID := 41 + int(atomic.AddInt32(&chanIDs, 1))
+				ws.WriteJSON(SubscribedResponse{Event: "subscribed", Channel: event.Channel, ChanID: chanID, Symbol: event.Symbol})
+				if dropFirst && conn == 1 {
+					return
+				}
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	wsc := NewWebSocketClient()
+	wsc.URL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	wsc.RetryDelay = 10 * time.Millisecond
+	return wsc
+}
+
+// nextFrame returns the next frame received by a mock server, failing the test after a timeout
+func nextFrame(t *testing.T, frames <-chan wsFrame) wsFrame {
+	t.Helper()
+
+	select {
+	case frame := <-frames:
+		return frame
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a WebSocket frame")
+		return wsFrame{}
+	}
+}
+
+func TestCheckSequenceCountsPerConnection(t *testing.T) {
+	wsc := NewWebSocketClient()
+
+	// Frames of two channels share one sequence, so interleaving them is not a gap
+	frames := [][]interface{}{
+		{float64(10), "hb", float64(1)},
+		{float64(20), "hb", float64(2)},
+		{float64(10), "fte", []interface{}{}, float64(3)},
+		{float64(20), "hb", float64(4)},
+	}
+	for _, frame := range frames {
+		seq, ok := frameSequence(frame)
+		if !ok {
+			t.Fatalf("frameSequence(%v) found no sequence", frame)
+		}
+		if missed := wsc.checkSequence(seq); missed != 0 {
+			t.Fatalf("checkSequence(%d) reported %d dropped frames on interleaved channels", seq, missed)
+		}
+	}
+
+	if missed := wsc.checkSequence(7); missed != 2 {
+		t.Errorf("checkSequence(7) after 4 = %d, want 2", missed)
+	}
+	if got := wsc.DroppedFrames(); got != 2 {
+		t.Errorf("DroppedFrames() = %d, want 2", got)
+	}
+}
+
+func TestCheckSequenceFirstFrameSetsBaseline(t *testing.T) {
+	wsc := NewWebSocketClient()
+	if missed := wsc.checkSequence(500); missed != 0 {
+		t.Errorf("first checkSequence(500) = %d, want 0", missed)
+	}
+
+	// A reconnect restarts the sequence
+	wsc.lastSeq = 0
+	if missed := wsc.checkSequence(1); missed != 0 {
+		t.Errorf("checkSequence(1) after reconnect = %d, want 0", missed)
+	}
+	if missed := wsc.checkSequence(3); missed != 1 {
+		t.Errorf("checkSequence(3) after 1 = %d, want 1", missed)
+	}
+}
+
+func TestSubscribeReturnsChannelIDAndUnsubscribeSendsFrame(t *testing.T) {
+	frames := make(chan wsFrame, 8)
+	wsc := newMockWSServer(t, frames, false)
+	wsc.SetReconnect(false)
+	if err := wsc.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer wsc.Close()
+	wsc.HandleFundingTrades(func(trade FundingTrade, msgType string) error { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chanID, err := wsc.Subscribe(ctx, "fUSD")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if chanID != 42 {
+		t.Errorf("Subscribe returned channel %d, want the acknowledged 42", chanID)
+	}
+	if frame := nextFrame(t, frames); frame.event.Event != "subscribe" || frame.event.Channel != ChannelTrades || frame.event.Symbol != "fUSD" {
+		t.Errorf("subscribe frame = %s, want a trades subscription for fUSD", frame.raw)
+	}
+
+	if err := wsc.Unsubscribe(chanID); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if frame := nextFrame(t, frames); frame.raw != `{"event":"unsubscribe","chanId":42}` {
+		t.Errorf("unsubscribe frame = %s, want the unsubscribe event for channel 42", frame.raw)
+	}
+}
+
+func TestReconnectResubscribes(t *testing.T) {
+	frames := make(chan wsFrame, 8)
+	wsc := newMockWSServer(t, frames, true)
+	if err := wsc.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer wsc.Close()
+	wsc.HandleFundingTrades(func(trade FundingTrade, msgType string) error { return nil })
+
+	if err := wsc.SubscribeToFundingTrades("fUSD"); err != nil {
+		t.Fatalf("SubscribeToFundingTrades: %v", err)
+	}
+	if frame := nextFrame(t, frames); frame.conn != 1 || frame.event.Symbol != "fUSD" {
+		t.Fatalf("first frame = %s on connection %d, want the fUSD subscription on connection 1", frame.raw, frame.conn)
+	}
+
+	// The server drops the first connection; the client reconnects and subscribes again
+	frame := nextFrame(t, frames)
+	if frame.conn != 2 || frame.event.Event != "subscribe" || frame.event.Channel != ChannelTrades || frame.event.Symbol != "fUSD" {
+		t.Errorf("frame after the drop = %s on connection %d, want the fUSD trades subscription on connection 2", frame.raw, frame.conn)
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"log"
+)
+
+// WebSocket channels that can be subscribed to per symbol
+const (
+	ChannelTrades = "trades"
+	ChannelTicker = "ticker"
+	ChannelBook   = "book"
+)
+
+// wsBookLength is the number of price levels per side streamed by book channels
+const wsBookLength = "25"
+
+// wsSubscription identifies a channel subscription for a symbol
+type wsSubscription struct {
+	channel string
+	symbol  string
+}
+
+// IsWSChannel reports whether channel is a supported WebSocket channel
+func IsWSChannel(channel string) bool {
+	switch channel {
+	case ChannelTrades, ChannelTicker, ChannelBook:
+		return true
+	}
+	return false
+}
+
+// HandleFundingTickers sets the handler for frames of subscribed ticker channels. Frames are read
+// by the loop started with HandleFundingTrades, which must be running.
+func (wsc *WebSocketClient) HandleFundingTickers(handler func(symbol string, ticker FundingTicker) error) {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+
+	wsc.tickerHandler = handler
+}
+
+// HandleFundingBook sets the handler for frames of subscribed book channels. The first frame after
+// subscribing is a snapshot of the book, later frames are updates of single price levels; an update
+// with a count of 0 removes the level. Frames are read by the loop started with HandleFundingTrades,
+// which must be running.
+func (wsc *WebSocketClient) HandleFundingBook(handler func(symbol string, books []FundingBook, snapshot bool) error) {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+
+	wsc.bookHandler = handler
+}
+
+// handleTickerFrame passes a ticker frame, [CHAN_ID, [FRR, BID, ...], SEQ], to the ticker handler
+func (wsc *WebSocketClient) handleTickerFrame(symbol string, data []interface{}) {
+	fields, ok := data[1].([]interface{})
+	if !ok {
+		// Heartbeat
+		return
+	}
+
+	wsc.mu.Lock()
+	handler := wsc.tickerHandler
+	wsc.mu.Unlock()
+	if handler == nil {
+		return
+	}
+
+	if err := handler(symbol, *parseFundingTicker(fields)); err != nil {
+		log.Printf("Error handling ticker: %v", err)
+	}
+}
+
+// handleBookFrame passes a book frame to the book handler. Snapshots carry a list of rows,
+// [CHAN_ID, [[RATE, PERIOD, COUNT, AMOUNT], ...], SEQ], updates a single row.
+func (wsc *WebSocketClient) handleBookFrame(symbol string, data []interface{}) {
+	rows, ok := data[1].([]interface{})
+	if !ok {
+		// Heartbeat
+		return
+	}
+
+	wsc.mu.Lock()
+	handler := wsc.bookHandler
+	wsc.mu.Unlock()
+	if handler == nil {
+		return
+	}
+
+	books, snapshot, err := parseBookFrame(rows)
+	if err != nil {
+		log.Printf("Error parsing book frame for %s: %v", symbol, err)
+		return
+	}
+	if err := handler(symbol, books, snapshot); err != nil {
+		log.Printf("Error handling book: %v", err)
+	}
+}
+
+// parseBookFrame parses the payload of a book frame, reporting whether it is a snapshot
+func parseBookFrame(rows []interface{}) ([]FundingBook, bool, error) {
+	if len(rows) > 0 {
+		if _, nested := rows[0].([]interface{}); !nested {
+			book, err := parseFundingBookRow(rows)
+			if err != nil {
+				return nil, false, err
+			}
+			return []FundingBook{book}, false, nil
+		}
+	}
+
+	books := make([]FundingBook, 0, len(rows))
+	for i, row := range rows {
+		fields, ok := row.([]interface{})
+		if !ok {
+			return nil, true, fmt.Errorf("snapshot row %d is not an array", i)
+		}
+		book, err := parseFundingBookRow(fields)
+		if err != nil {
+			return nil, true, fmt.Errorf("snapshot row %d: %v", i, err)
+		}
+		books = append(books, book)
+	}
+	return books, true, nil
+}
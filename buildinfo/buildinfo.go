@@ -0,0 +1,36 @@
+// Package buildinfo holds version information injected at build time, e.g.
+//
+//	go build -ldflags "-X github.com/gary0122g/BitfinexFundingData/buildinfo.Version=v1.2.0 \
+//		-X github.com/gary0122g/BitfinexFundingData/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/gary0122g/BitfinexFundingData/buildinfo.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import "fmt"
+
+// Set via -ldflags -X; unset values keep these defaults
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+	}
+}
+
+// String formats the build information for display
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", i.Version, i.Commit, i.BuildDate)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+// minCollectionInterval is the shortest allowed polling interval, keeping each task well
+// within Bitfinex's public REST rate limits (roughly 10-90 requests per minute per endpoint)
+const minCollectionInterval = 15 * time.Second
+
+// collectionIntervals holds how often each kind of data is collected for a currency
+type collectionIntervals struct {
+	Stats          time.Duration // Funding statistics
+	Ticker         time.Duration // Funding ticker
+	RawBook        time.Duration // Raw (R0) funding book
+	AggregatedBook time.Duration // Aggregated (P0) funding book
+}
+
+// validate checks that every interval is at least minCollectionInterval
+func (i collectionIntervals) validate() error {
+	for name, interval := range map[string]time.Duration{
+		"stats":           i.Stats,
+		"ticker":          i.Ticker,
+		"raw-book":        i.RawBook,
+		"aggregated-book": i.AggregatedBook,
+	} {
+		if interval < minCollectionInterval {
+			return fmt.Errorf("%s interval %s is below the minimum of %s", name, interval, minCollectionInterval)
+		}
+	}
+	return nil
+}
+
+// merge returns i with zero fields replaced by the values from defaults
+func (i collectionIntervals) merge(defaults collectionIntervals) collectionIntervals {
+	if i.Stats == 0 {
+		i.Stats = defaults.Stats
+	}
+	if i.Ticker == 0 {
+		i.Ticker = defaults.Ticker
+	}
+	if i.RawBook == 0 {
+		i.RawBook = defaults.RawBook
+	}
+	if i.AggregatedBook == 0 {
+		i.AggregatedBook = defaults.AggregatedBook
+	}
+	return i
+}
+
+// collectionConfig holds the currencies to collect and their collection intervals
+type collectionConfig struct {
+	Currencies []string
+	Defaults   collectionIntervals
+	Overrides  map[string]collectionIntervals // Per-currency overrides, zero fields use Defaults
+
+	BookPrecisions     []api.BookPrecision            // Aggregated book precisions collected each cycle
+	PrecisionOverrides map[string][]api.BookPrecision // Per-currency replacements for BookPrecisions
+
+	StatsPeriods []int // Offer periods whose funding stats are collected besides the stats over all periods
+}
+
+// intervalsFor returns the effective intervals for a currency
+func (c collectionConfig) intervalsFor(currency string) collectionIntervals {
+	return c.Overrides[currency].merge(c.Defaults)
+}
+
+// precisionsFor returns the aggregated book precisions collected for a currency
+func (c collectionConfig) precisionsFor(currency string) []api.BookPrecision {
+	if precisions, ok := c.PrecisionOverrides[currency]; ok {
+		return precisions
+	}
+	return c.BookPrecisions
+}
+
+// statsPeriods returns the funding stats periods collected for every currency, 0 (all periods) first
+func (c collectionConfig) statsPeriods() []int {
+	return append([]int{0}, c.StatsPeriods...)
+}
+
+// validate checks the effective intervals of every configured currency
+func (c collectionConfig) validate() error {
+	if len(c.Currencies) == 0 {
+		return fmt.Errorf("no currencies configured")
+	}
+	for currency := range c.Overrides {
+		if !containsString(c.Currencies, currency) {
+			return fmt.Errorf("interval override for unconfigured currency %s", currency)
+		}
+	}
+	for currency := range c.PrecisionOverrides {
+		if !containsString(c.Currencies, currency) {
+			return fmt.Errorf("book precision override for unconfigured currency %s", currency)
+		}
+	}
+	for _, currency := range c.Currencies {
+		if err := c.intervalsFor(currency).validate(); err != nil {
+			return fmt.Errorf("invalid intervals for %s: %v", currency, err)
+		}
+		if len(c.precisionsFor(currency)) == 0 {
+			return fmt.Errorf("no book precisions configured for %s", currency)
+		}
+	}
+	return nil
+}
+
+// parseCurrencies parses a comma-separated currency list, adding the "f" prefix where missing
+func parseCurrencies(value string) []string {
+	var currencies []string
+	for _, currency := range strings.Split(value, ",") {
+		currency = strings.TrimSpace(currency)
+		if currency == "" {
+			continue
+		}
+		if !strings.HasPrefix(currency, "f") {
+			currency = "f" + currency
+		}
+		currencies = append(currencies, currency)
+	}
+	return currencies
+}
+
+// parseIntervalOverrides parses per-currency interval overrides of the form
+// "fUSD.ticker=30s,fUSD.raw-book=2m,fUST.stats=2h"
+func parseIntervalOverrides(value string) (map[string]collectionIntervals, error) {
+	overrides := make(map[string]collectionIntervals)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, durationStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid interval override %q, expected currency.kind=duration", entry)
+		}
+		currency, kind, ok := strings.Cut(key, ".")
+		if !ok {
+			return nil, fmt.Errorf("invalid interval override %q, expected currency.kind=duration", entry)
+		}
+		if !strings.HasPrefix(currency, "f") {
+			currency = "f" + currency
+		}
+		interval, err := time.ParseDuration(durationStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration in interval override %q: %v", entry, err)
+		}
+
+		intervals := overrides[currency]
+		switch kind {
+		case "stats":
+			intervals.Stats = interval
+		case "ticker":
+			intervals.Ticker = interval
+		case "raw-book":
+			intervals.RawBook = interval
+		case "aggregated-book":
+			intervals.AggregatedBook = interval
+		default:
+			return nil, fmt.Errorf("unknown interval kind %q in %q, expected stats, ticker, raw-book or aggregated-book", kind, entry)
+		}
+		overrides[currency] = intervals
+	}
+	return overrides, nil
+}
+
+// parseBookPrecisions parses a list of aggregated book precisions separated by sep, e.g. "P0,P1"
+func parseBookPrecisions(value, sep string) ([]api.BookPrecision, error) {
+	var precisions []api.BookPrecision
+	for _, precision := range strings.Split(value, sep) {
+		precision = strings.ToUpper(strings.TrimSpace(precision))
+		if precision == "" {
+			continue
+		}
+
+		switch api.BookPrecision(precision) {
+		case api.PrecisionP0, api.PrecisionP1, api.PrecisionP2, api.PrecisionP3, api.PrecisionP4:
+		default:
+			return nil, fmt.Errorf("invalid book precision %q, expected P0 to P4", precision)
+		}
+
+		if !containsPrecision(precisions, api.BookPrecision(precision)) {
+			precisions = append(precisions, api.BookPrecision(precision))
+		}
+	}
+	return precisions, nil
+}
+
+// parseStatsPeriods parses a comma-separated list of funding stats periods in days, e.g. "2,30,120"
+func parseStatsPeriods(value string) ([]int, error) {
+	var periods []int
+	for _, periodStr := range strings.Split(value, ",") {
+		periodStr = strings.TrimSpace(periodStr)
+		if periodStr == "" {
+			continue
+		}
+
+		period, err := strconv.Atoi(periodStr)
+		if err != nil || period < api.MinFundingStatsPeriod || period > api.MaxFundingStatsPeriod {
+			return nil, fmt.Errorf("invalid funding stats period %q, expected %d to %d days", periodStr, api.MinFundingStatsPeriod, api.MaxFundingStatsPeriod)
+		}
+
+		if !containsInt(periods, period) {
+			periods = append(periods, period)
+		}
+	}
+	return periods, nil
+}
+
+// parsePrecisionOverrides parses per-currency book precisions of the form "fUSD=P0|P1|P2,fUST=P1"
+func parsePrecisionOverrides(value string) (map[string][]api.BookPrecision, error) {
+	overrides := make(map[string][]api.BookPrecision)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		currency, precisionsStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid book precision override %q, expected currency=P0|P1", entry)
+		}
+		if !strings.HasPrefix(currency, "f") {
+			currency = "f" + currency
+		}
+
+		precisions, err := parseBookPrecisions(precisionsStr, "|")
+		if err != nil {
+			return nil, fmt.Errorf("invalid book precision override %q: %v", entry, err)
+		}
+		overrides[currency] = precisions
+	}
+	return overrides, nil
+}
+
+// parseWSChannels parses per-currency WebSocket channels of the form "fUSD=trades|ticker|book,fUST=trades"
+func parseWSChannels(value string) (map[string][]string, error) {
+	channels := make(map[string][]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		currency, channelsStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid WebSocket channels %q, expected currency=trades|ticker|book", entry)
+		}
+		currency = strings.TrimSpace(currency)
+		if !strings.HasPrefix(currency, "f") {
+			currency = "f" + currency
+		}
+
+		var currencyChannels []string
+		for _, channel := range strings.Split(channelsStr, "|") {
+			channel = strings.ToLower(strings.TrimSpace(channel))
+			if channel == "" {
+				continue
+			}
+			if !api.IsWSChannel(channel) {
+				return nil, fmt.Errorf("invalid WebSocket channel %q for %s, expected trades, ticker or book", channel, currency)
+			}
+			if !containsString(currencyChannels, channel) {
+				currencyChannels = append(currencyChannels, channel)
+			}
+		}
+		channels[currency] = currencyChannels
+	}
+	return channels, nil
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containsPrecision reports whether precisions contains precision
+func containsPrecision(precisions []api.BookPrecision, precision api.BookPrecision) bool {
+	for _, p := range precisions {
+		if p == precision {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt reports whether values contains value
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,632 @@
+// Package dbtest provides an in-memory db.Storage for testing code that collects or reads data
+// without a SQLite database.
+package dbtest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+var _ db.Storage = (*MockStorage)(nil)
+
+// Call is a recorded call of a MockStorage method
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// stamped is a stored row together with the time it was saved, standing in for the timestamp
+// column the database fills in on insert
+type stamped[T any] struct {
+	mts int64
+	row T
+}
+
+// MockStorage is an in-memory db.Storage that records every call. Rows are kept per currency or
+// symbol; rows without a timestamp of their own are stamped with Now when saved, so the latest book
+// is the rows of the latest save time like in the database. Errors set with SetError are returned
+// instead of running the method. It is safe for concurrent use.
+type MockStorage struct {
+	// Now returns the save time of rows without a timestamp; time.Now when nil
+	Now func() time.Time
+
+	mu     sync.Mutex
+	calls  []Call
+	errs   map[string]error
+	lastID int64
+
+	fundingStats    map[string][]api.FundingStats
+	tradingBooks    map[string][]stamped[api.TradingBook]
+	fundingBooks    map[string][]stamped[api.FundingBook]
+	rawTradingBooks map[string][]stamped[api.RawTradingBook]
+	rawFundingBooks map[string][]stamped[api.RawFundingBook]
+	tradingTickers  map[string][]stamped[api.TradingTicker]
+	fundingTickers  map[string][]stamped[api.FundingTicker]
+	wsTrades        map[string][]api.FundingTrade
+	wsTradeIDs      map[string]map[int64]bool
+}
+
+// NewMockStorage creates an empty MockStorage
+func NewMockStorage() *MockStorage {
+	return &MockStorage{
+		errs:            make(map[string]error),
+		fundingStats:    make(map[string][]api.FundingStats),
+		tradingBooks:    make(map[string][]stamped[api.TradingBook]),
+		fundingBooks:    make(map[string][]stamped[api.FundingBook]),
+		rawTradingBooks: make(map[string][]stamped[api.RawTradingBook]),
+		rawFundingBooks: make(map[string][]stamped[api.RawFundingBook]),
+		tradingTickers:  make(map[string][]stamped[api.TradingTicker]),
+		fundingTickers:  make(map[string][]stamped[api.FundingTicker]),
+		wsTrades:        make(map[string][]api.FundingTrade),
+		wsTradeIDs:      make(map[string]map[int64]bool),
+	}
+}
+
+// SetError makes the named method, e.g. "SaveFundingStats", return err until it is reset with a nil error
+func (m *MockStorage) SetError(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		delete(m.errs, method)
+		return
+	}
+	m.errs[method] = err
+}
+
+// Calls returns the recorded calls in call order
+func (m *MockStorage) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Call(nil), m.calls...)
+}
+
+// CallCount returns how often the named method was called, including calls that returned an error
+func (m *MockStorage) CallCount(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, call := range m.calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+// Reset forgets recorded calls and stored rows; errors set with SetError are kept
+func (m *MockStorage) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	empty := NewMockStorage()
+	m.calls = nil
+	m.lastID = 0
+	m.fundingStats = empty.fundingStats
+	m.tradingBooks = empty.tradingBooks
+	m.fundingBooks = empty.fundingBooks
+	m.rawTradingBooks = empty.rawTradingBooks
+	m.rawFundingBooks = empty.rawFundingBooks
+	m.tradingTickers = empty.tradingTickers
+	m.fundingTickers = empty.fundingTickers
+	m.wsTrades = empty.wsTrades
+	m.wsTradeIDs = empty.wsTradeIDs
+}
+
+// record records a call and returns the error configured for the method; m.mu must be held
+func (m *MockStorage) record(method string, args ...interface{}) error {
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+	return m.errs[method]
+}
+
+// nextID returns a new row ID; m.mu must be held
+func (m *MockStorage) nextID() int64 {
+	m.lastID++
+	return m.lastID
+}
+
+// nowMS returns the current save time in milliseconds; m.mu must be held
+func (m *MockStorage) nowMS() int64 {
+	if m.Now != nil {
+		return m.Now().UnixMilli()
+	}
+	return time.Now().UnixMilli()
+}
+
+// appendBookRow appends row saved at mts unless the same entry was already saved at mts, like the unique
+// indexes of the book tables, and reports whether it was appended
+func appendBookRow[T any](rows []stamped[T], mts int64, row T, sameEntry func(a, b T) bool) ([]stamped[T], bool) {
+	for _, r := range rows {
+		if r.mts == mts && sameEntry(r.row, row) {
+			return rows, false
+		}
+	}
+	return append(rows, stamped[T]{mts: mts, row: row}), true
+}
+
+// latest returns the rows saved at the latest save time
+func latest[T any](rows []stamped[T]) []T {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	newest := rows[len(rows)-1].mts
+	var result []T
+	for _, r := range rows {
+		if r.mts == newest {
+			result = append(result, r.row)
+		}
+	}
+	return result
+}
+
+// between returns up to limit rows saved within [start, end], newest first
+func between[T any](rows []stamped[T], start, end time.Time, limit int) []T {
+	var result []T
+	for i := len(rows) - 1; i >= 0 && len(result) < limit; i-- {
+		if rows[i].mts >= start.UnixMilli() && rows[i].mts <= end.UnixMilli() {
+			result = append(result, rows[i].row)
+		}
+	}
+	return result
+}
+
+// SaveFundingStats stores the FundingStats; an MTS of 0 is replaced with the current time.
+// Like the database, a second row with the same currency, period and MTS is rejected.
+func (m *MockStorage) SaveFundingStats(currency string, stats api.FundingStats) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveFundingStats", currency, stats); err != nil {
+		return 0, err
+	}
+	if stats.MTS == 0 {
+		stats.MTS = m.nowMS()
+	}
+	for _, existing := range m.fundingStats[currency] {
+		if existing.Period == stats.Period && existing.MTS == stats.MTS {
+			return 0, fmt.Errorf("funding stats for %s period %d at %d already stored", currency, stats.Period, stats.MTS)
+		}
+	}
+
+	m.fundingStats[currency] = append(m.fundingStats[currency], stats)
+	return m.nextID(), nil
+}
+
+// GetFundingStats returns up to limit stored FundingStats over all periods, newest first
+func (m *MockStorage) GetFundingStats(currency string, limit int) ([]api.FundingStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetFundingStats", currency, limit); err != nil {
+		return nil, err
+	}
+	return m.latestFundingStats(currency, 0, limit), nil
+}
+
+// GetLatestFundingStats returns the newest stored FundingStats over all periods, or db.ErrNoFundingStats
+func (m *MockStorage) GetLatestFundingStats(currency string) (api.FundingStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetLatestFundingStats", currency); err != nil {
+		return api.FundingStats{}, err
+	}
+	stats := m.latestFundingStats(currency, 0, 1)
+	if len(stats) == 0 {
+		return api.FundingStats{}, db.ErrNoFundingStats
+	}
+	return stats[0], nil
+}
+
+// GetLatestFundingStatsForPeriod returns the newest stored FundingStats of the period, or db.ErrNoFundingStats
+func (m *MockStorage) GetLatestFundingStatsForPeriod(currency string, period int) (api.FundingStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetLatestFundingStatsForPeriod", currency, period); err != nil {
+		return api.FundingStats{}, err
+	}
+	stats := m.latestFundingStats(currency, period, 1)
+	if len(stats) == 0 {
+		return api.FundingStats{}, db.ErrNoFundingStats
+	}
+	return stats[0], nil
+}
+
+// latestFundingStats returns up to limit FundingStats of the period, newest first; m.mu must be held
+func (m *MockStorage) latestFundingStats(currency string, period, limit int) []api.FundingStats {
+	var stats []api.FundingStats
+	for _, s := range m.fundingStats[currency] {
+		if s.Period == period {
+			stats = append(stats, s)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].MTS > stats[j].MTS })
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+// SaveTradingBook stores the TradingBook entry, returning 0 when it was already saved at the same time
+func (m *MockStorage) SaveTradingBook(symbol string, book api.TradingBook) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveTradingBook", symbol, book); err != nil {
+		return 0, err
+	}
+	var added bool
+	m.tradingBooks[symbol], added = appendBookRow(m.tradingBooks[symbol], m.nowMS(), book, func(a, b api.TradingBook) bool {
+		return a.Price == b.Price && (a.Amount > 0) == (b.Amount > 0)
+	})
+	if !added {
+		return 0, nil
+	}
+	return m.nextID(), nil
+}
+
+// GetTradingBook returns up to limit stored bid (positive amount) or ask entries, highest price first
+func (m *MockStorage) GetTradingBook(symbol string, isBid bool, limit int) ([]api.TradingBook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetTradingBook", symbol, isBid, limit); err != nil {
+		return nil, err
+	}
+	var books []api.TradingBook
+	for _, b := range m.tradingBooks[symbol] {
+		if (b.row.Amount > 0) == isBid {
+			books = append(books, b.row)
+		}
+	}
+	sort.SliceStable(books, func(i, j int) bool { return books[i].Price > books[j].Price })
+	if len(books) > limit {
+		books = books[:limit]
+	}
+	return books, nil
+}
+
+// SaveFundingBook stores the FundingBook entry at precision P0, returning 0 when it was already saved at
+// the same time
+func (m *MockStorage) SaveFundingBook(currency string, book api.FundingBook) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveFundingBook", currency, book); err != nil {
+		return 0, err
+	}
+	return m.saveFundingBook(currency, api.PrecisionP0, m.nowMS(), book), nil
+}
+
+// SaveFundingBookWithPrecision stores the FundingBook entry at the given precision, returning 0 when it was
+// already saved at the same time
+func (m *MockStorage) SaveFundingBookWithPrecision(currency string, precision api.BookPrecision, book api.FundingBook) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveFundingBookWithPrecision", currency, precision, book); err != nil {
+		return 0, err
+	}
+	return m.saveFundingBook(currency, precision, m.nowMS(), book), nil
+}
+
+// SaveFundingBookAt stores the FundingBook entry at the given precision and snapshot time, returning 0 when
+// it was already saved at that time
+func (m *MockStorage) SaveFundingBookAt(currency string, precision api.BookPrecision, mts int64, book api.FundingBook) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveFundingBookAt", currency, precision, mts, book); err != nil {
+		return 0, err
+	}
+	return m.saveFundingBook(currency, precision, mts, book), nil
+}
+
+// saveFundingBook stores the FundingBook entry and returns its row ID, or 0 for a duplicate; m.mu must be held
+func (m *MockStorage) saveFundingBook(currency string, precision api.BookPrecision, mts int64, book api.FundingBook) int64 {
+	key := currency + "/" + string(precision)
+	var added bool
+	m.fundingBooks[key], added = appendBookRow(m.fundingBooks[key], mts, book, func(a, b api.FundingBook) bool {
+		return a.Rate == b.Rate && a.Period == b.Period && (a.Amount < 0) == (b.Amount < 0)
+	})
+	if !added {
+		return 0
+	}
+	return m.nextID()
+}
+
+// GetLatestFundingBook returns the P0 funding book entries of the latest save time in save order,
+// or an error wrapping db.ErrNoFundingBook
+func (m *MockStorage) GetLatestFundingBook(currency string) ([]api.FundingBook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetLatestFundingBook", currency); err != nil {
+		return nil, err
+	}
+	books := latest(m.fundingBooks[currency+"/"+string(api.PrecisionP0)])
+	if len(books) == 0 {
+		return nil, fmt.Errorf("%w for currency: %s", db.ErrNoFundingBook, currency)
+	}
+	return books, nil
+}
+
+// SaveRawTradingBook stores the RawTradingBook entry, returning 0 when it was already saved at the same time
+func (m *MockStorage) SaveRawTradingBook(symbol string, book api.RawTradingBook) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveRawTradingBook", symbol, book); err != nil {
+		return 0, err
+	}
+	var added bool
+	m.rawTradingBooks[symbol], added = appendBookRow(m.rawTradingBooks[symbol], m.nowMS(), book, func(a, b api.RawTradingBook) bool {
+		return a.OrderID == b.OrderID
+	})
+	if !added {
+		return 0, nil
+	}
+	return m.nextID(), nil
+}
+
+// SaveRawFundingBook stores the RawFundingBook entry, returning 0 when it was already saved at the same time
+func (m *MockStorage) SaveRawFundingBook(currency string, book api.RawFundingBook) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveRawFundingBook", currency, book); err != nil {
+		return 0, err
+	}
+	return m.saveRawFundingBook(currency, m.nowMS(), book), nil
+}
+
+// SaveRawFundingBookAt stores the RawFundingBook entry at the given snapshot time, returning 0 when it was
+// already saved at that time
+func (m *MockStorage) SaveRawFundingBookAt(currency string, mts int64, book api.RawFundingBook) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveRawFundingBookAt", currency, mts, book); err != nil {
+		return 0, err
+	}
+	return m.saveRawFundingBook(currency, mts, book), nil
+}
+
+// saveRawFundingBook stores the RawFundingBook entry and returns its row ID, or 0 for a duplicate; m.mu must be held
+func (m *MockStorage) saveRawFundingBook(currency string, mts int64, book api.RawFundingBook) int64 {
+	var added bool
+	m.rawFundingBooks[currency], added = appendBookRow(m.rawFundingBooks[currency], mts, book, func(a, b api.RawFundingBook) bool {
+		return a.OfferID == b.OfferID
+	})
+	if !added {
+		return 0
+	}
+	return m.nextID()
+}
+
+// GetLatestRawFundingBook returns the raw funding book entries of the latest save time in save order,
+// or an error wrapping db.ErrNoFundingBook
+func (m *MockStorage) GetLatestRawFundingBook(currency string) ([]api.RawFundingBook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetLatestRawFundingBook", currency); err != nil {
+		return nil, err
+	}
+	books := latest(m.rawFundingBooks[currency])
+	if len(books) == 0 {
+		return nil, fmt.Errorf("%w for currency: %s", db.ErrNoFundingBook, currency)
+	}
+	return books, nil
+}
+
+// SaveTradingTicker stores the TradingTicker
+func (m *MockStorage) SaveTradingTicker(symbol string, ticker api.TradingTicker) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveTradingTicker", symbol, ticker); err != nil {
+		return 0, err
+	}
+	m.tradingTickers[symbol] = append(m.tradingTickers[symbol], stamped[api.TradingTicker]{mts: m.nowMS(), row: ticker})
+	return m.nextID(), nil
+}
+
+// GetLatestTradingTicker returns the most recently saved TradingTicker, or an error wrapping db.ErrNoTicker
+func (m *MockStorage) GetLatestTradingTicker(symbol string) (api.TradingTicker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetLatestTradingTicker", symbol); err != nil {
+		return api.TradingTicker{}, err
+	}
+	tickers := m.tradingTickers[symbol]
+	if len(tickers) == 0 {
+		return api.TradingTicker{}, fmt.Errorf("%w for symbol: %s", db.ErrNoTicker, symbol)
+	}
+	return tickers[len(tickers)-1].row, nil
+}
+
+// GetHistoricalTradingTickers returns up to limit TradingTickers saved within [startTime, endTime], newest first
+func (m *MockStorage) GetHistoricalTradingTickers(symbol string, startTime, endTime time.Time, limit int) ([]api.TradingTicker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetHistoricalTradingTickers", symbol, startTime, endTime, limit); err != nil {
+		return nil, err
+	}
+	return between(m.tradingTickers[symbol], startTime, endTime, limit), nil
+}
+
+// SaveFundingTicker stores the FundingTicker
+func (m *MockStorage) SaveFundingTicker(currency string, ticker api.FundingTicker) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveFundingTicker", currency, ticker); err != nil {
+		return 0, err
+	}
+	return m.saveFundingTicker(currency, ticker), nil
+}
+
+// saveFundingTicker stores the FundingTicker and returns its row ID; m.mu must be held
+func (m *MockStorage) saveFundingTicker(currency string, ticker api.FundingTicker) int64 {
+	m.fundingTickers[currency] = append(m.fundingTickers[currency], stamped[api.FundingTicker]{mts: m.nowMS(), row: ticker})
+	return m.nextID()
+}
+
+// SaveFundingTickerIfChanged stores the FundingTicker unless its FRR, bid and ask are all within
+// epsilon of the latest stored ticker, and reports whether it was stored
+func (m *MockStorage) SaveFundingTickerIfChanged(currency string, ticker api.FundingTicker, epsilon float64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveFundingTickerIfChanged", currency, ticker, epsilon); err != nil {
+		return false, err
+	}
+	return m.saveFundingTickerIfChanged(currency, ticker, epsilon, 0), nil
+}
+
+// SaveFundingTickerIfChangedOrStale stores the FundingTicker unless its FRR, bid and ask are all within
+// epsilon of the latest stored ticker and that ticker is at most maxGap old, and reports whether it was stored
+func (m *MockStorage) SaveFundingTickerIfChangedOrStale(currency string, ticker api.FundingTicker, epsilon float64, maxGap time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveFundingTickerIfChangedOrStale", currency, ticker, epsilon, maxGap); err != nil {
+		return false, err
+	}
+	return m.saveFundingTickerIfChanged(currency, ticker, epsilon, maxGap), nil
+}
+
+// saveFundingTickerIfChanged stores the FundingTicker unless it is unchanged and recent, reporting whether it
+// was stored; m.mu must be held
+func (m *MockStorage) saveFundingTickerIfChanged(currency string, ticker api.FundingTicker, epsilon float64, maxGap time.Duration) bool {
+	if tickers := m.fundingTickers[currency]; len(tickers) > 0 {
+		latest := tickers[len(tickers)-1]
+		stale := maxGap > 0 && m.nowMS()-latest.mts > maxGap.Milliseconds()
+		if !stale &&
+			math.Abs(ticker.FRR-latest.row.FRR) <= epsilon &&
+			math.Abs(ticker.Bid-latest.row.Bid) <= epsilon &&
+			math.Abs(ticker.Ask-latest.row.Ask) <= epsilon {
+			return false
+		}
+	}
+	m.saveFundingTicker(currency, ticker)
+	return true
+}
+
+// GetLatestFundingTicker returns the most recently saved FundingTicker, or an error wrapping db.ErrNoTicker
+func (m *MockStorage) GetLatestFundingTicker(currency string) (api.FundingTicker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetLatestFundingTicker", currency); err != nil {
+		return api.FundingTicker{}, err
+	}
+	tickers := m.fundingTickers[currency]
+	if len(tickers) == 0 {
+		return api.FundingTicker{}, fmt.Errorf("%w for currency: %s", db.ErrNoTicker, currency)
+	}
+	return tickers[len(tickers)-1].row, nil
+}
+
+// GetHistoricalFundingTickers returns up to limit FundingTickers saved within [startTime, endTime], newest first
+func (m *MockStorage) GetHistoricalFundingTickers(currency string, startTime, endTime time.Time, limit int) ([]api.FundingTicker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetHistoricalFundingTickers", currency, startTime, endTime, limit); err != nil {
+		return nil, err
+	}
+	return between(m.fundingTickers[currency], startTime, endTime, limit), nil
+}
+
+// SaveWSFundingTrade stores the WebSocket funding trade
+func (m *MockStorage) SaveWSFundingTrade(currency string, trade api.FundingTrade, msgType string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveWSFundingTrade", currency, trade, msgType); err != nil {
+		return 0, err
+	}
+	m.saveWSFundingTrade(currency, trade)
+	return m.nextID(), nil
+}
+
+// SaveWSFundingTrades stores the WebSocket funding trades, skipping trades already stored for their
+// currency, and returns the number of newly stored trades
+func (m *MockStorage) SaveWSFundingTrades(records []db.WSFundingTradeRecord) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("SaveWSFundingTrades", records); err != nil {
+		return 0, err
+	}
+	inserted := 0
+	for _, record := range records {
+		if m.wsTradeIDs[record.Currency][record.Trade.ID] {
+			continue
+		}
+		m.saveWSFundingTrade(record.Currency, record.Trade)
+		inserted++
+	}
+	return inserted, nil
+}
+
+// saveWSFundingTrade stores the trade and remembers its ID; m.mu must be held
+func (m *MockStorage) saveWSFundingTrade(currency string, trade api.FundingTrade) {
+	if m.wsTradeIDs[currency] == nil {
+		m.wsTradeIDs[currency] = make(map[int64]bool)
+	}
+	m.wsTradeIDs[currency][trade.ID] = true
+	m.wsTrades[currency] = append(m.wsTrades[currency], trade)
+}
+
+// GetLatestWSFundingTrades returns up to limit stored WebSocket funding trades, newest first
+func (m *MockStorage) GetLatestWSFundingTrades(currency string, limit int) ([]api.FundingTrade, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetLatestWSFundingTrades", currency, limit); err != nil {
+		return nil, err
+	}
+	return m.wsFundingTrades(currency, math.MinInt64, math.MaxInt64, limit), nil
+}
+
+// GetHistoricalWSFundingTrades returns up to limit WebSocket funding trades with MTS within
+// [startTime, endTime], newest first
+func (m *MockStorage) GetHistoricalWSFundingTrades(currency string, startTime, endTime time.Time, limit int) ([]api.FundingTrade, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.record("GetHistoricalWSFundingTrades", currency, startTime, endTime, limit); err != nil {
+		return nil, err
+	}
+	return m.wsFundingTrades(currency, startTime.UnixMilli(), endTime.UnixMilli(), limit), nil
+}
+
+// wsFundingTrades returns up to limit trades with MTS within [start, end], newest first; m.mu must be held
+func (m *MockStorage) wsFundingTrades(currency string, start, end int64, limit int) []api.FundingTrade {
+	var trades []api.FundingTrade
+	for _, t := range m.wsTrades[currency] {
+		if t.MTS >= start && t.MTS <= end {
+			trades = append(trades, t)
+		}
+	}
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].MTS > trades[j].MTS })
+	if len(trades) > limit {
+		trades = trades[:limit]
+	}
+	return trades
+}
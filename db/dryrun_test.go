@@ -0,0 +1,84 @@
+package db
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestDryRunStorageMakesNoWrites(t *testing.T) {
+	d := newTestDatabase(t)
+	if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: 1000, FRR: 0.0000004, FundingAmount: 100}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+	s := NewDryRunStorage(d)
+
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(prev)
+
+	var ids []int64
+	save := func(id int64, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("dry-run save returned error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	save(s.SaveFundingStats("fUSD", api.FundingStats{MTS: 2000, FRR: 0.0000005}))
+	save(s.SaveFundingTicker("fUSD", api.FundingTicker{FRR: 0.0001}))
+	save(s.SaveFundingBookAt("fUSD", api.PrecisionP0, 3000, api.FundingBook{Rate: 0.0001, Period: 2, Count: 1, Amount: 50}))
+	save(s.SaveRawFundingBookAt("fUSD", 3000, api.RawFundingBook{OfferID: 1, Period: 2, Rate: 0.0001, Amount: 50}))
+	save(s.SaveWSFundingTrade("fUSD", api.FundingTrade{ID: 1, MTS: 4000, Amount: 10, Rate: 0.0001, Period: 2}, "fte"))
+	if n, err := s.SaveWSFundingTrades([]WSFundingTradeRecord{{Currency: "fUSD", Trade: api.FundingTrade{ID: 2}, MsgType: "ftu"}}); err != nil || n != 1 {
+		t.Fatalf("SaveWSFundingTrades = %d, %v, want 1 trade reported as saved", n, err)
+	}
+	if stored, err := s.SaveFundingTickerIfChangedOrStale("fUSD", api.FundingTicker{FRR: 0.0002}, 0, time.Minute); err != nil || !stored {
+		t.Fatalf("SaveFundingTickerIfChangedOrStale = %v, %v, want the ticker reported as stored", stored, err)
+	}
+
+	// Fake IDs are distinct and increasing
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Errorf("fake IDs = %v, want 1 to %d", ids, len(ids))
+			break
+		}
+	}
+
+	for table, want := range map[string]int{
+		"funding_stats":     1, // Stored before the decorator was used
+		"funding_ticker":    0,
+		"funding_book":      0,
+		"raw_funding_book":  0,
+		"ws_funding_trades": 0,
+	} {
+		if n := countRows(t, d, table); n != want {
+			t.Errorf("%d %s rows, want %d", n, table, want)
+		}
+	}
+
+	// Reads pass through to the wrapped storage
+	latest, err := s.GetLatestFundingStats("fUSD")
+	if err != nil || latest.MTS != 1000 {
+		t.Errorf("GetLatestFundingStats = %+v, %v, want the stored row", latest, err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		"[dry-run] would insert into funding_stats for fUSD",
+		"[dry-run] would insert into funding_ticker for fUSD",
+		"[dry-run] would insert into funding_book for fUSD P0 @3000",
+		"[dry-run] would insert into raw_funding_book for fUSD @3000",
+		"[dry-run] would insert into ws_funding_trades for fUSD fte",
+		"[dry-run] would insert into ws_funding_trades for fUSD ftu",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log does not contain %q:\n%s", want, output)
+		}
+	}
+}
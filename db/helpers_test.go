@@ -0,0 +1,36 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDatabase opens a Database on a new SQLite file with all tables created
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := CreateTables(conn); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	return NewDatabase(conn)
+}
+
+// countRows returns the number of rows of table
+func countRows(t *testing.T, d *Database, table string) int {
+	t.Helper()
+
+	var count int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatalf("failed to count %s: %v", table, err)
+	}
+	return count
+}
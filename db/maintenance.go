@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+
+	"github.com/gary0122g/BitfinexFundingData/requestid"
+)
+
+// VacuumResult reports the database size around a VACUUM
+type VacuumResult struct {
+	SizeBefore     int64 `json:"size_before"`
+	SizeAfter      int64 `json:"size_after"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+// Vacuum rebuilds the database file to release the space of deleted rows.
+// VACUUM fails while another connection is writing, so callers should pause collection first.
+func (d *Database) Vacuum(ctx context.Context) (VacuumResult, error) {
+	var result VacuumResult
+
+	sizeBefore, err := d.databaseSize(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	if _, err := d.db.ExecContext(ctx, "VACUUM"); err != nil {
+		requestid.Logf(ctx, "vacuum failed: %v", err)
+		return result, err
+	}
+
+	sizeAfter, err := d.databaseSize(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	result.SizeBefore = sizeBefore
+	result.SizeAfter = sizeAfter
+	result.ReclaimedBytes = sizeBefore - sizeAfter
+	return result, nil
+}
+
+// databaseSize returns the size of the database in bytes, page_count * page_size
+func (d *Database) databaseSize(ctx context.Context) (int64, error) {
+	var pageCount, pageSize int64
+	if err := d.db.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, err
+	}
+	if err := d.db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestVacuumShrinksFileAfterPruning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer conn.Close()
+	if err := CreateTables(conn); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	d := NewDatabase(conn)
+
+	records := make([]WSFundingTradeRecord, 0, 20000)
+	for id := int64(1); id <= 20000; id++ {
+		trade := api.FundingTrade{ID: id, MTS: 1700000000000 + id, Amount: 100, Rate: 0.0001, Period: 2}
+		records = append(records, WSFundingTradeRecord{Currency: "fUSD", Trade: trade, MsgType: "ftu"})
+	}
+	if _, err := d.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+
+	fileSize := func() int64 {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat database file: %v", err)
+		}
+		return info.Size()
+	}
+
+	// Pruning alone leaves the freed pages in the file
+	if _, err := conn.Exec(`DELETE FROM ws_funding_trades WHERE timestamp <= ?`, 1700000000000+19000); err != nil {
+		t.Fatalf("failed to prune trades: %v", err)
+	}
+	pruned := fileSize()
+
+	result, err := d.Vacuum(context.Background())
+	if err != nil {
+		t.Fatalf("Vacuum: %v", err)
+	}
+	vacuumed := fileSize()
+
+	if vacuumed >= pruned {
+		t.Fatalf("file size after vacuum = %d, want less than %d after pruning", vacuumed, pruned)
+	}
+	if result.ReclaimedBytes <= 0 || result.SizeAfter != result.SizeBefore-result.ReclaimedBytes {
+		t.Errorf("vacuum result %+v, want positive reclaimed bytes", result)
+	}
+	if n := countRows(t, d, "ws_funding_trades"); n != 1000 {
+		t.Errorf("%d trades after vacuum, want the 1000 kept", n)
+	}
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// addColumnIfMissing adds a column to a table created before the column existed.
+// It reports whether the column was added.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) (bool, error) {
+	exists, err := columnExists(db, table, column)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return false, fmt.Errorf("failed to add %s to %s: %v", column, table, err)
+	}
+
+	return true, nil
+}
+
+// columnExists reports whether a table has the given column
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// addBelowThresholdRatioColumn adds funding_stats.below_threshold_ratio and backfills it for existing rows
+func addBelowThresholdRatioColumn(db *sql.DB) error {
+	added, err := addColumnIfMissing(db, "funding_stats", "below_threshold_ratio", "REAL")
+	if err != nil || !added {
+		return err
+	}
+
+	_, err = db.Exec(`
+	UPDATE funding_stats
+	SET below_threshold_ratio = funding_below_threshold / funding_amount
+	WHERE funding_amount > 0`)
+	return err
+}
+
+// addFundingStatsPeriodColumn adds funding_stats.period to tables created before it existed. Changing
+// UNIQUE(currency, mts) to UNIQUE(currency, period, mts) needs the table to be rebuilt; existing rows
+// become period 0, the stats over all periods.
+func addFundingStatsPeriodColumn(db *sql.DB) error {
+	exists, err := columnExists(db, "funding_stats", "period")
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	CREATE TABLE funding_stats_period (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		currency TEXT NOT NULL,
+		mts INTEGER NOT NULL,
+		frr REAL,
+		avg_period REAL,
+		funding_amount REAL,
+		funding_amount_used REAL,
+		funding_below_threshold REAL,
+		period INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL DEFAULT (strftime('%s','now') * 1000),
+		below_threshold_ratio REAL,
+		UNIQUE(currency, period, mts)
+	);
+	INSERT INTO funding_stats_period
+		(id, currency, mts, frr, avg_period, funding_amount, funding_amount_used, funding_below_threshold, created_at, below_threshold_ratio)
+	SELECT id, currency, mts, frr, avg_period, funding_amount, funding_amount_used, funding_below_threshold, created_at, below_threshold_ratio
+	FROM funding_stats;
+	DROP TABLE funding_stats;
+	ALTER TABLE funding_stats_period RENAME TO funding_stats;
+	CREATE INDEX IF NOT EXISTS idx_funding_stats_currency_mts ON funding_stats(currency, mts);`)
+	if err != nil {
+		return fmt.Errorf("failed to add period to funding_stats: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// bookUniqueKeys are the columns identifying a row of each book table within one snapshot; saving a row
+// whose key is already stored is ignored
+var bookUniqueKeys = []struct {
+	table   string
+	columns string
+}{
+	{"trading_book", "symbol, timestamp, price, is_bid"},
+	{"funding_book", "currency, precision, timestamp, rate, period, is_bid"},
+	{"raw_trading_book", "symbol, timestamp, order_id"},
+	{"raw_funding_book", "currency, timestamp, offer_id"},
+}
+
+// addBookUniqueIndexes adds the unique indexes of bookUniqueKeys, first deleting all but the oldest copy
+// of rows stored twice before the indexes existed
+func addBookUniqueIndexes(db *sql.DB) error {
+	for _, key := range bookUniqueKeys {
+		index := "idx_" + key.table + "_unique"
+
+		var exists int
+		if err := db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, index).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf(`
+		DELETE FROM %[1]s WHERE id NOT IN (SELECT MIN(id) FROM %[1]s GROUP BY %[2]s);
+		CREATE UNIQUE INDEX %[3]s ON %[1]s(%[2]s);`, key.table, key.columns, index))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to add unique index to %s: %v", key.table, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
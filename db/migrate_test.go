@@ -0,0 +1,157 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestFundingStatsPeriodsCoexistAfterMigration(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "old.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// funding_stats as created before the period column existed
+	_, err = conn.Exec(`
+	CREATE TABLE funding_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		currency TEXT NOT NULL,
+		mts INTEGER NOT NULL,
+		frr REAL,
+		avg_period REAL,
+		funding_amount REAL,
+		funding_amount_used REAL,
+		funding_below_threshold REAL,
+		created_at INTEGER NOT NULL DEFAULT (strftime('%s','now') * 1000),
+		UNIQUE(currency, mts)
+	);
+	INSERT INTO funding_stats (currency, mts, frr, avg_period, funding_amount) VALUES ('fUSD', 1000, 0.0000005, 10, 500);`)
+	if err != nil {
+		t.Fatalf("failed to create the old schema: %v", err)
+	}
+
+	if err := CreateTables(conn); err != nil {
+		t.Fatalf("CreateTables: %v", err)
+	}
+	d := NewDatabase(conn)
+
+	// Same currency and MTS, different periods
+	for _, period := range []int{2, 30} {
+		stats := api.FundingStats{MTS: 1000, Period: period, FRR: 0.0000006, FRRRaw: 0.0000006, FundingAmount: float64(period * 100)}
+		if _, err := d.SaveFundingStats("fUSD", stats); err != nil {
+			t.Fatalf("SaveFundingStats period %d: %v", period, err)
+		}
+	}
+	if n := countRows(t, d, "funding_stats"); n != 3 {
+		t.Fatalf("funding_stats has %d rows, want 3", n)
+	}
+
+	for period, amount := range map[int]float64{0: 500, 2: 200, 30: 3000} {
+		got, err := d.GetLatestFundingStatsForPeriod("fUSD", period)
+		if err != nil {
+			t.Fatalf("GetLatestFundingStatsForPeriod(%d): %v", period, err)
+		}
+		if got.Period != period || got.FundingAmount != amount {
+			t.Errorf("period %d: got period %d with amount %v, want amount %v", period, got.Period, got.FundingAmount, amount)
+		}
+	}
+
+	// The same period and MTS is still unique
+	if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: 1000, Period: 30}); err == nil {
+		t.Error("saving period 30 at the same MTS again succeeded, want a constraint error")
+	}
+}
+
+func TestDuplicateBookSnapshotsAreIgnored(t *testing.T) {
+	d := newTestDatabase(t)
+
+	offers := []api.RawFundingBook{
+		{OfferID: 1, Period: 2, Rate: 0.0002, Amount: 100},
+		{OfferID: 2, Period: 30, Rate: 0.0003, Amount: -50},
+	}
+	levels := []api.FundingBook{
+		{Rate: 0.0002, Period: 2, Count: 3, Amount: 100},
+		{Rate: 0.0003, Period: 30, Count: 1, Amount: -50},
+	}
+	save := func(mts int64, precision api.BookPrecision) (added int) {
+		t.Helper()
+		for _, offer := range offers {
+			id, err := d.SaveRawFundingBookAt("fUSD", mts, offer)
+			if err != nil {
+				t.Fatalf("SaveRawFundingBookAt: %v", err)
+			}
+			if id != 0 {
+				added++
+			}
+		}
+		for _, level := range levels {
+			id, err := d.SaveFundingBookAt("fUSD", precision, mts, level)
+			if err != nil {
+				t.Fatalf("SaveFundingBookAt: %v", err)
+			}
+			if id != 0 {
+				added++
+			}
+		}
+		return added
+	}
+
+	if added := save(1000, api.PrecisionP0); added != 4 {
+		t.Fatalf("first snapshot added %d rows, want 4", added)
+	}
+	// Re-saving the same snapshot is ignored
+	if added := save(1000, api.PrecisionP0); added != 0 {
+		t.Errorf("repeated snapshot added %d rows, want 0", added)
+	}
+	if raw, book := countRows(t, d, "raw_funding_book"), countRows(t, d, "funding_book"); raw != 2 || book != 2 {
+		t.Errorf("%d raw and %d aggregated book rows after a repeated snapshot, want 2 each", raw, book)
+	}
+
+	// A later snapshot, or another precision of the same one, is stored
+	if added := save(2000, api.PrecisionP0); added != 4 {
+		t.Errorf("later snapshot added %d rows, want 4", added)
+	}
+	if added := save(2000, api.PrecisionP1); added != 2 {
+		t.Errorf("another precision added %d rows, want its 2 aggregated levels", added)
+	}
+	if raw, book := countRows(t, d, "raw_funding_book"), countRows(t, d, "funding_book"); raw != 4 || book != 6 {
+		t.Errorf("%d raw and %d aggregated book rows, want 4 and 6", raw, book)
+	}
+}
+
+func TestBookUniqueIndexMigrationRemovesDuplicates(t *testing.T) {
+	d := newTestDatabase(t)
+
+	// Duplicates stored before the unique index existed
+	_, err := d.db.Exec(`
+	DROP INDEX idx_raw_funding_book_unique;
+	INSERT INTO raw_funding_book (currency, timestamp, offer_id, period, rate, amount, is_bid) VALUES
+		('fUSD', 1000, 1, 2, 0.0002, 100, 1),
+		('fUSD', 1000, 1, 2, 0.0002, 100, 1),
+		('fUSD', 1000, 2, 30, 0.0003, -50, 0),
+		('fUSD', 2000, 1, 2, 0.0002, 100, 1);`)
+	if err != nil {
+		t.Fatalf("failed to store duplicates: %v", err)
+	}
+
+	if err := CreateTables(d.db); err != nil {
+		t.Fatalf("CreateTables: %v", err)
+	}
+	if n := countRows(t, d, "raw_funding_book"); n != 3 {
+		t.Errorf("raw_funding_book has %d rows after the migration, want 3", n)
+	}
+	var minID int64
+	if err := d.db.QueryRow(`SELECT MIN(id) FROM raw_funding_book WHERE timestamp = 1000 AND offer_id = 1`).Scan(&minID); err != nil || minID != 1 {
+		t.Errorf("kept row %d (%v), want the oldest copy 1", minID, err)
+	}
+
+	// The restored index ignores further duplicates
+	id, err := d.SaveRawFundingBookAt("fUSD", 1000, api.RawFundingBook{OfferID: 2, Period: 30, Rate: 0.0003, Amount: -50})
+	if err != nil || id != 0 {
+		t.Errorf("SaveRawFundingBookAt duplicate = %d, %v, want it ignored", id, err)
+	}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"math"
+	"strconv"
+)
+
+// RateScale is the factor rates are multiplied by when stored as scaled integers.
+// Twelve decimal places cover every rate Bitfinex reports.
+const RateScale = 1e12
+
+// rateScaleDigits is the number of decimal places represented by RateScale
+const rateScaleDigits = 12
+
+// scaledRateColumns lists the tables that get a rate_scaled column next to their REAL rate column
+var scaledRateColumns = []string{"funding_book", "raw_funding_book", "ws_funding_trades"}
+
+// ScaleRate converts a rate to its scaled integer representation, rounding to the nearest unit
+func ScaleRate(rate float64) int64 {
+	return int64(math.Round(rate * RateScale))
+}
+
+// UnscaleRate converts a scaled integer rate back to a float64
+func UnscaleRate(scaled int64) float64 {
+	return float64(scaled) / RateScale
+}
+
+// FormatScaledRate formats a scaled integer rate as an exact decimal string, e.g. 123000000 -> "0.000123"
+func FormatScaledRate(scaled int64) string {
+	sign := ""
+	if scaled < 0 {
+		sign = "-"
+	}
+
+	digits := strconv.FormatUint(absInt64(scaled), 10)
+	for len(digits) <= rateScaleDigits {
+		digits = "0" + digits
+	}
+
+	whole := digits[:len(digits)-rateScaleDigits]
+	fraction := digits[len(digits)-rateScaleDigits:]
+	for len(fraction) > 1 && fraction[len(fraction)-1] == '0' {
+		fraction = fraction[:len(fraction)-1]
+	}
+
+	return sign + whole + "." + fraction
+}
+
+// absInt64 returns the absolute value of v as a uint64, which also holds math.MinInt64
+func absInt64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
+
+// SetScaledRates enables or disables writing rates as scaled integers into the rate_scaled columns.
+// The REAL rate columns are always written; rate_scaled stays NULL while disabled.
+func (d *Database) SetScaledRates(enabled bool) {
+	d.scaledRates = enabled
+}
+
+// scaledRate returns the value bound to a rate_scaled column
+func (d *Database) scaledRate(rate float64) interface{} {
+	if !d.scaledRates {
+		return nil
+	}
+	return ScaleRate(rate)
+}
+
+// addScaledRateColumns adds the rate_scaled column to tables created before it existed
+func addScaledRateColumns(db *sql.DB) error {
+	for _, table := range scaledRateColumns {
+		if _, err := addColumnIfMissing(db, table, "rate_scaled", "INTEGER"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
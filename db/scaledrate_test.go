@@ -0,0 +1,84 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestScaledRatesRoundTripExactly(t *testing.T) {
+	d := newTestDatabase(t)
+	d.SetScaledRates(true)
+
+	tests := []struct {
+		rate    float64
+		decimal string
+	}{
+		{0.000123, "0.000123"},
+		{0.0000001, "0.0000001"},
+		{0.00025, "0.00025"},
+		{0.002739726027, "0.002739726027"},
+		{0.000000000001, "0.000000000001"},
+		{0.1, "0.1"},
+		{-0.0005, "-0.0005"},
+	}
+
+	var records []WSFundingTradeRecord
+	var wantSum int64
+	for i, tt := range tests {
+		trade := api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: tt.rate, Period: 2}
+		records = append(records, WSFundingTradeRecord{Currency: "fUSD", Trade: trade, MsgType: "ftu"})
+		wantSum += ScaleRate(tt.rate)
+	}
+	if _, err := d.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+
+	rows, err := d.db.Query(`SELECT rate, rate_scaled FROM ws_funding_trades ORDER BY trade_id`)
+	if err != nil {
+		t.Fatalf("failed to query rates: %v", err)
+	}
+	defer rows.Close()
+	for i := 0; rows.Next(); i++ {
+		var rate float64
+		var scaled int64
+		if err := rows.Scan(&rate, &scaled); err != nil {
+			t.Fatalf("failed to scan rates: %v", err)
+		}
+		tt := tests[i]
+		if got := UnscaleRate(scaled); got != tt.rate || rate != tt.rate {
+			t.Errorf("rate %v stored as %v and %d, unscaled to %v", tt.rate, rate, scaled, got)
+		}
+		if got := FormatScaledRate(scaled); got != tt.decimal {
+			t.Errorf("FormatScaledRate(%d) = %q, want %q", scaled, got, tt.decimal)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to read rates: %v", err)
+	}
+
+	// Integer sums are exact, whatever the order rows are added in
+	var sum int64
+	if err := d.db.QueryRow(`SELECT SUM(rate_scaled) FROM ws_funding_trades`).Scan(&sum); err != nil {
+		t.Fatalf("failed to sum scaled rates: %v", err)
+	}
+	if sum != wantSum {
+		t.Errorf("SUM(rate_scaled) = %d, want %d", sum, wantSum)
+	}
+}
+
+func TestScaledRatesNullWhenDisabled(t *testing.T) {
+	d := newTestDatabase(t)
+	if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, 1000, api.FundingBook{Rate: 0.0001, Period: 2, Count: 1, Amount: 50}); err != nil {
+		t.Fatalf("SaveFundingBookAt: %v", err)
+	}
+
+	var scaled sql.NullInt64
+	if err := d.db.QueryRow(`SELECT rate_scaled FROM funding_book`).Scan(&scaled); err != nil {
+		t.Fatalf("failed to read rate_scaled: %v", err)
+	}
+	if scaled.Valid {
+		t.Errorf("rate_scaled = %d, want NULL with scaled rates disabled", scaled.Int64)
+	}
+}
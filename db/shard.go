@@ -0,0 +1,424 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shardedTables are the high-volume tables that SetMonthlySharding splits into monthly shards
+var shardedTables = []string{"ws_funding_trades", "funding_book", "raw_funding_book"}
+
+// shardMonthLayout formats the month suffix of a shard, e.g. ws_funding_trades_202610
+const shardMonthLayout = "200601"
+
+// shardViewSuffix names the view uniting a table with its shards, e.g. ws_funding_trades_all
+const shardViewSuffix = "_all"
+
+// shardState tracks the monthly shards of a Database. It is shared with the Databases created by WithTx.
+type shardState struct {
+	mu      sync.Mutex
+	enabled bool
+	now     func() time.Time
+	created map[string]bool // Shards known to exist
+	views   map[string]bool // Tables with shards, read through their view
+}
+
+func newShardState() *shardState {
+	return &shardState{
+		now:     time.Now,
+		created: make(map[string]bool),
+		views:   make(map[string]bool),
+	}
+}
+
+// SetMonthlySharding enables or disables writing ws_funding_trades, funding_book and raw_funding_book
+// rows into one table per month of their timestamp, e.g. ws_funding_trades_202610, created on demand with
+// the schema and indexes of the original table. Rows stored before sharding stay in the original table.
+// Once a table has shards, reads go through a view uniting it with them, e.g. ws_funding_trades_all,
+// whether or not sharding is enabled, so it must be called at startup even to disable sharding. Rows are
+// deduplicated across the original table and its shards.
+func (d *Database) SetMonthlySharding(enabled bool) error {
+	d.shards.mu.Lock()
+	defer d.shards.mu.Unlock()
+
+	for _, table := range shardedTables {
+		shards, err := listShards(d.conn, table)
+		if err != nil {
+			return err
+		}
+		if len(shards) == 0 {
+			continue
+		}
+
+		// Columns and indexes added to the original table by later migrations are added to its shards as well
+		if err := syncShardColumns(d.db, table, shards); err != nil {
+			return err
+		}
+		if err := syncShardIndexes(d.db, table, shards); err != nil {
+			return err
+		}
+		if err := rebuildShardView(d.conn, table, shards); err != nil {
+			return err
+		}
+		d.shards.views[table] = true
+
+		if !enabled {
+			// Writes go to the original table again; continue its IDs after those of the shards
+			if err := continueIDs(d.conn, table, table+shardViewSuffix); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.shards.enabled = enabled
+	d.shards.created = make(map[string]bool)
+	return nil
+}
+
+// readTable returns the table or view that reads of table go through
+func (d *Database) readTable(table string) string {
+	d.shards.mu.Lock()
+	defer d.shards.mu.Unlock()
+
+	if d.shards.views[table] {
+		return table + shardViewSuffix
+	}
+	return table
+}
+
+// writeTable returns the table that a row of table with the timestamp mts (MTS) is written to, creating
+// the shard of the row's month when sharding is enabled. A row without a timestamp (mts <= 0) is written
+// to the shard of the current month.
+func (d *Database) writeTable(table string, mts int64) (string, error) {
+	d.shards.mu.Lock()
+	defer d.shards.mu.Unlock()
+
+	if !d.shards.enabled {
+		return table, nil
+	}
+
+	month := d.shards.now()
+	if mts > 0 {
+		month = time.UnixMilli(mts)
+	}
+	shard := table + "_" + month.UTC().Format(shardMonthLayout)
+	if d.shards.created[shard] {
+		return shard, nil
+	}
+
+	// Inside a transaction the shard is created in it; it is only remembered once it was created
+	// outside one, since a rollback would drop it again
+	if tx, inTx := d.conn.(*sql.Tx); inTx {
+		if err := createShard(tx, table, shard); err != nil {
+			return "", err
+		}
+		d.shards.views[table] = true
+		return shard, nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if err := createShard(tx, table, shard); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	d.shards.created[shard] = true
+	d.shards.views[table] = true
+	return shard, nil
+}
+
+// shardedInsert returns an INSERT OR IGNORE of one row of columns into table, which holds rows of base,
+// and a function turning the row's values into the arguments of the statement. Unique indexes only hold
+// within one table, so once base is read through its view, a row whose key columns (indexes into columns)
+// match a row stored anywhere in the view is skipped as well.
+func (d *Database) shardedInsert(base, table string, columns []string, keys []int) (string, func(values ...interface{}) []interface{}) {
+	columnList := strings.Join(columns, ", ")
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+
+	view := d.readTable(base)
+	if view == table {
+		query := "INSERT OR IGNORE INTO " + table + " (" + columnList + ") VALUES (" + placeholders + ")"
+		return query, func(values ...interface{}) []interface{} { return values }
+	}
+
+	conditions := make([]string, len(keys))
+	for i, key := range keys {
+		conditions[i] = columns[key] + " = ?"
+	}
+	query := "INSERT OR IGNORE INTO " + table + " (" + columnList + ")\n" +
+		"SELECT " + placeholders + "\n" +
+		"WHERE NOT EXISTS (SELECT 1 FROM " + view + " WHERE " + strings.Join(conditions, " AND ") + ")"
+	return query, func(values ...interface{}) []interface{} {
+		args := append([]interface{}{}, values...)
+		for _, key := range keys {
+			args = append(args, values[key])
+		}
+		return args
+	}
+}
+
+// createShard creates shard with the schema and indexes of table unless it exists, and adds it to the
+// view of table. New shards continue the IDs of the view so IDs stay unique across shards.
+func createShard(conn execer, table, shard string) error {
+	var exists int
+	if err := conn.QueryRow(`
+	SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, shard).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	// The stored CREATE statements include columns added by migrations; shard names extend the
+	// table name, so index names stay unique as well
+	rows, err := conn.Query(`
+	SELECT sql FROM sqlite_master
+	WHERE tbl_name = ? AND type IN ('table', 'index') AND sql IS NOT NULL
+	ORDER BY type = 'index'`, table)
+	if err != nil {
+		return err
+	}
+	var statements []string
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			rows.Close()
+			return err
+		}
+		statements = append(statements, strings.ReplaceAll(statement, table, shard))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return fmt.Errorf("cannot shard %s: table does not exist", table)
+	}
+
+	for _, statement := range statements {
+		if _, err := conn.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create shard %s: %v", shard, err)
+		}
+	}
+
+	shards, err := listShards(conn, table)
+	if err != nil {
+		return err
+	}
+	if err := rebuildShardView(conn, table, shards); err != nil {
+		return err
+	}
+
+	return continueIDs(conn, shard, table+shardViewSuffix)
+}
+
+// continueIDs makes the AUTOINCREMENT IDs of table continue after the highest ID in source
+func continueIDs(conn execer, table, source string) error {
+	var maxID int64
+	if err := conn.QueryRow("SELECT COALESCE(MAX(id), 0) FROM " + source).Scan(&maxID); err != nil {
+		return err
+	}
+
+	result, err := conn.Exec("UPDATE sqlite_sequence SET seq = MAX(seq, ?) WHERE name = ?", maxID, table)
+	if err != nil {
+		return fmt.Errorf("failed to continue %s IDs: %v", table, err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated > 0 {
+		return nil
+	}
+	if _, err := conn.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)", table, maxID); err != nil {
+		return fmt.Errorf("failed to continue %s IDs: %v", table, err)
+	}
+	return nil
+}
+
+// listShards returns the monthly shards of table, oldest first
+func listShards(conn execer, table string) ([]string, error) {
+	rows, err := conn.Query(`
+	SELECT name FROM sqlite_master
+	WHERE type = 'table' AND name GLOB ? || '_[0-9][0-9][0-9][0-9][0-9][0-9]'
+	ORDER BY name`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shards []string
+	for rows.Next() {
+		var shard string
+		if err := rows.Scan(&shard); err != nil {
+			return nil, err
+		}
+		shards = append(shards, shard)
+	}
+	return shards, rows.Err()
+}
+
+// rebuildShardView recreates the view uniting table with its shards
+func rebuildShardView(conn execer, table string, shards []string) error {
+	columns, err := tableColumns(conn, table)
+	if err != nil {
+		return err
+	}
+	columnList := strings.Join(columns, ", ")
+
+	selects := []string{"SELECT " + columnList + " FROM " + table}
+	for _, shard := range shards {
+		selects = append(selects, "SELECT "+columnList+" FROM "+shard)
+	}
+
+	view := table + shardViewSuffix
+	if _, err := conn.Exec("DROP VIEW IF EXISTS " + view); err != nil {
+		return err
+	}
+	if _, err := conn.Exec("CREATE VIEW " + view + " AS\n" + strings.Join(selects, "\nUNION ALL\n")); err != nil {
+		return fmt.Errorf("failed to create view %s: %v", view, err)
+	}
+	return nil
+}
+
+// syncShardColumns adds the columns of table that its shards are missing
+func syncShardColumns(db *sql.DB, table string, shards []string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	type column struct {
+		name, definition string
+	}
+	var columns []column
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		definition := colType
+		if notNull {
+			definition += " NOT NULL"
+		}
+		if dfltValue.Valid {
+			definition += " DEFAULT " + dfltValue.String
+		}
+		columns = append(columns, column{name: name, definition: definition})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, shard := range shards {
+		for _, c := range columns {
+			if _, err := addColumnIfMissing(db, shard, c.name, c.definition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncShardIndexes creates the indexes of table that its shards are missing, e.g. unique indexes added by
+// later migrations. Rows stored twice in a shard before it had a unique index are deleted first, keeping
+// the oldest copy.
+func syncShardIndexes(db *sql.DB, table string, shards []string) error {
+	rows, err := db.Query(`
+	SELECT name, sql FROM sqlite_master
+	WHERE tbl_name = ? AND type = 'index' AND sql IS NOT NULL`, table)
+	if err != nil {
+		return err
+	}
+	type index struct {
+		name, statement string
+	}
+	var indexes []index
+	for rows.Next() {
+		var i index
+		if err := rows.Scan(&i.name, &i.statement); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, i)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, shard := range shards {
+		for _, i := range indexes {
+			name := strings.ReplaceAll(i.name, table, shard)
+			var exists int
+			if err := db.QueryRow(`
+			SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, name).Scan(&exists); err != nil {
+				return err
+			}
+			if exists > 0 {
+				continue
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			for _, key := range bookUniqueKeys {
+				if key.table == table && name == "idx_"+shard+"_unique" {
+					if _, err := tx.Exec(fmt.Sprintf(`
+					DELETE FROM %[1]s WHERE id NOT IN (SELECT MIN(id) FROM %[1]s GROUP BY %[2]s)`, shard, key.columns)); err != nil {
+						tx.Rollback()
+						return fmt.Errorf("failed to deduplicate shard %s: %v", shard, err)
+					}
+				}
+			}
+			if _, err := tx.Exec(strings.ReplaceAll(i.statement, table, shard)); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to add index %s to shard %s: %v", name, shard, err)
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the column names of table in order
+func tableColumns(conn execer, table string) ([]string, error) {
+	rows, err := conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
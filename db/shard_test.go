@@ -0,0 +1,142 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestWriteTableRoutesByRowTimestamp(t *testing.T) {
+	d := newTestDatabase(t)
+	d.shards.now = func() time.Time { return time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC) }
+	if err := d.SetMonthlySharding(true); err != nil {
+		t.Fatalf("SetMonthlySharding: %v", err)
+	}
+
+	august := time.Date(2026, 8, 20, 12, 0, 0, 0, time.UTC).UnixMilli()
+	table, err := d.writeTable("ws_funding_trades", august)
+	if err != nil {
+		t.Fatalf("writeTable: %v", err)
+	}
+	if table != "ws_funding_trades_202608" {
+		t.Errorf("writeTable(%d) = %s, want ws_funding_trades_202608", august, table)
+	}
+
+	table, err = d.writeTable("ws_funding_trades", 0)
+	if err != nil {
+		t.Fatalf("writeTable: %v", err)
+	}
+	if table != "ws_funding_trades_202610" {
+		t.Errorf("writeTable(0) = %s, want the current month's ws_funding_trades_202610", table)
+	}
+}
+
+func TestShardedTradesAreDeduplicatedAcrossTables(t *testing.T) {
+	d := newTestDatabase(t)
+	mts := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	trade := api.FundingTrade{ID: 42, MTS: mts, Amount: 100, Rate: 0.0002, Period: 2}
+
+	// Stored before sharding, in the original table
+	if _, err := d.SaveWSFundingTrades([]WSFundingTradeRecord{{Currency: "fUSD", Trade: trade, MsgType: "ftu"}}); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+
+	d.shards.now = func() time.Time { return time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC) }
+	if err := d.SetMonthlySharding(true); err != nil {
+		t.Fatalf("SetMonthlySharding: %v", err)
+	}
+
+	newer := api.FundingTrade{ID: 43, MTS: mts + 1, Amount: 50, Rate: 0.0003, Period: 2}
+	records := []WSFundingTradeRecord{
+		{Currency: "fUSD", Trade: trade, MsgType: "ftu"},
+		{Currency: "fUSD", Trade: newer, MsgType: "ftu"},
+		{Currency: "fUSD", Trade: newer, MsgType: "ftu"},
+	}
+	inserted, err := d.SaveWSFundingTrades(records)
+	if err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+	if inserted != 1 {
+		t.Errorf("inserted %d trades, want 1", inserted)
+	}
+	if id, err := d.SaveWSFundingTrade("fUSD", trade, "ftu"); err != nil || id != 0 {
+		t.Errorf("SaveWSFundingTrade of a stored trade = %d, %v, want 0, nil", id, err)
+	}
+
+	if got := countRows(t, d, "ws_funding_trades_all"); got != 2 {
+		t.Errorf("ws_funding_trades_all holds %d rows, want 2", got)
+	}
+	if got := countRows(t, d, "ws_funding_trades_202609"); got != 1 {
+		t.Errorf("ws_funding_trades_202609 holds %d rows, want 1", got)
+	}
+}
+
+func TestShardedBookRowsAreDeduplicatedAcrossTables(t *testing.T) {
+	d := newTestDatabase(t)
+	mts := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	book := api.FundingBook{Rate: 0.0002, Period: 2, Count: 3, Amount: -1000}
+	raw := api.RawFundingBook{OfferID: 7, Period: 2, Rate: 0.0002, Amount: 500}
+
+	if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, mts, book); err != nil {
+		t.Fatalf("SaveFundingBookAt: %v", err)
+	}
+	if _, err := d.SaveRawFundingBookAt("fUSD", mts, raw); err != nil {
+		t.Fatalf("SaveRawFundingBookAt: %v", err)
+	}
+	if err := d.SetMonthlySharding(true); err != nil {
+		t.Fatalf("SetMonthlySharding: %v", err)
+	}
+
+	if id, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, mts, book); err != nil || id != 0 {
+		t.Errorf("SaveFundingBookAt of a stored entry = %d, %v, want 0, nil", id, err)
+	}
+	if id, err := d.SaveRawFundingBookAt("fUSD", mts, raw); err != nil || id != 0 {
+		t.Errorf("SaveRawFundingBookAt of a stored entry = %d, %v, want 0, nil", id, err)
+	}
+	if got := countRows(t, d, "funding_book_all"); got != 1 {
+		t.Errorf("funding_book_all holds %d rows, want 1", got)
+	}
+	if got := countRows(t, d, "raw_funding_book_all"); got != 1 {
+		t.Errorf("raw_funding_book_all holds %d rows, want 1", got)
+	}
+}
+
+func TestSetMonthlyShardingAddsMissingIndexesToShards(t *testing.T) {
+	d := newTestDatabase(t)
+	if err := d.SetMonthlySharding(true); err != nil {
+		t.Fatalf("SetMonthlySharding: %v", err)
+	}
+	mts := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	if _, err := d.writeTable("funding_book", mts); err != nil {
+		t.Fatalf("writeTable: %v", err)
+	}
+
+	// A shard created before the unique index existed, holding a duplicate
+	if _, err := d.db.Exec("DROP INDEX idx_funding_book_202609_unique"); err != nil {
+		t.Fatalf("failed to drop shard index: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := d.db.Exec(`
+		INSERT INTO funding_book_202609 (currency, precision, timestamp, rate, period, count, amount, is_bid)
+		VALUES ('fUSD', 'P0', ?, 0.0002, 2, 1, 100, 0)`, mts); err != nil {
+			t.Fatalf("failed to insert duplicate: %v", err)
+		}
+	}
+
+	if err := d.SetMonthlySharding(true); err != nil {
+		t.Fatalf("SetMonthlySharding: %v", err)
+	}
+
+	var exists int
+	if err := d.db.QueryRow(`
+	SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_funding_book_202609_unique'`).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if exists != 1 {
+		t.Error("unique index was not added to the existing shard")
+	}
+	if got := countRows(t, d, "funding_book_202609"); got != 1 {
+		t.Errorf("shard holds %d rows after deduplication, want 1", got)
+	}
+}
@@ -1,35 +1,58 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/rates"
+	"github.com/gary0122g/BitfinexFundingData/requestid"
 )
 
 // Database encapsulates interaction with the SQLite database
 type Database struct {
-	db *sql.DB
+	db          *sql.DB
+	conn        execer // db, or the transaction of a Database created by WithTx
+	scaledRates bool
+	inMemory    bool        // Created by NewInMemoryDatabase, allows TruncateAll
+	shards      *shardState // See SetMonthlySharding
 }
 
 // NewDatabase creates a new database connection
 func NewDatabase(db *sql.DB) *Database {
-	return &Database{db: db}
+	return &Database{db: db, conn: db, shards: newShardState()}
+}
+
+// queryContext runs a query, logging failures together with the request ID carried by ctx
+func (d *Database) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+	}
+	return rows, err
 }
 
 type Storage interface {
 	// FundingStats related methods
 	SaveFundingStats(currency string, stats api.FundingStats) (int64, error)
 	GetFundingStats(currency string, limit int) ([]api.FundingStats, error)
+	GetLatestFundingStats(currency string) (api.FundingStats, error)
+	GetLatestFundingStatsForPeriod(currency string, period int) (api.FundingStats, error)
 
-	// TradingBook related methods
+	// TradingBook related methods; book saves return 0 instead of a row ID when the same entry of the
+	// same snapshot was already stored
 	SaveTradingBook(symbol string, book api.TradingBook) (int64, error)
 	GetTradingBook(symbol string, isBid bool, limit int) ([]api.TradingBook, error)
 
 	// FundingBook related methods
 	SaveFundingBook(currency string, book api.FundingBook) (int64, error)
+	SaveFundingBookWithPrecision(currency string, precision api.BookPrecision, book api.FundingBook) (int64, error)
+	SaveFundingBookAt(currency string, precision api.BookPrecision, mts int64, book api.FundingBook) (int64, error)
 	GetLatestFundingBook(currency string) ([]api.FundingBook, error)
 
 	// RawTradingBook related methods
@@ -37,6 +60,7 @@ type Storage interface {
 
 	// RawFundingBook related methods
 	SaveRawFundingBook(currency string, book api.RawFundingBook) (int64, error)
+	SaveRawFundingBookAt(currency string, mts int64, book api.RawFundingBook) (int64, error)
 	GetLatestRawFundingBook(currency string) ([]api.RawFundingBook, error)
 
 	// TradingTicker related methods
@@ -46,11 +70,14 @@ type Storage interface {
 
 	// FundingTicker related methods
 	SaveFundingTicker(currency string, ticker api.FundingTicker) (int64, error)
+	SaveFundingTickerIfChanged(currency string, ticker api.FundingTicker, epsilon float64) (bool, error)
+	SaveFundingTickerIfChangedOrStale(currency string, ticker api.FundingTicker, epsilon float64, maxGap time.Duration) (bool, error)
 	GetLatestFundingTicker(currency string) (api.FundingTicker, error)
 	GetHistoricalFundingTickers(currency string, startTime, endTime time.Time, limit int) ([]api.FundingTicker, error)
 
 	// WebSocket Funding Trades related methods
 	SaveWSFundingTrade(currency string, trade api.FundingTrade, msgType string) (int64, error)
+	SaveWSFundingTrades(records []WSFundingTradeRecord) (int, error)
 	GetLatestWSFundingTrades(currency string, limit int) ([]api.FundingTrade, error)
 	GetHistoricalWSFundingTrades(currency string, startTime, endTime time.Time, limit int) ([]api.FundingTrade, error)
 }
@@ -64,18 +91,32 @@ func (d *Database) SaveFundingStats(currency string, stats api.FundingStats) (in
 
 	query := `
     INSERT INTO funding_stats 
-    (currency, mts, frr, avg_period, funding_amount, funding_amount_used, funding_below_threshold)
-    VALUES (?, ?, ?, ?, ?, ?, ?)`
+    (currency, period, mts, frr, avg_period, funding_amount, funding_amount_used, funding_below_threshold, below_threshold_ratio)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	// NULL when there is no funding to compare against
+	var ratio interface{}
+	if value, ok := BelowThresholdRatio(stats); ok {
+		ratio = value
+	}
+
+	// NULL when Bitfinex reported no FRR, so FRR aggregates skip the row
+	var frr interface{} = stats.FRR
+	if stats.FRRMissing {
+		frr = nil
+	}
 
-	result, err := d.db.Exec(
+	result, err := d.conn.Exec(
 		query,
 		currency,
+		stats.Period,
 		stats.MTS,
-		stats.FRR,
+		frr,
 		stats.AveragePeriod,
 		stats.FundingAmount,
 		stats.FundingAmountUsed,
 		stats.FundingBelowThreshold,
+		ratio,
 	)
 	if err != nil {
 		return 0, err
@@ -84,21 +125,344 @@ func (d *Database) SaveFundingStats(currency string, stats api.FundingStats) (in
 	return result.LastInsertId()
 }
 
+// BelowThresholdRatio returns the share of funding below the threshold, FundingBelowThreshold / FundingAmount.
+// It returns false when FundingAmount is not positive and the ratio is undefined.
+func BelowThresholdRatio(stats api.FundingStats) (float64, bool) {
+	if stats.FundingAmount <= 0 {
+		return 0, false
+	}
+	return stats.FundingBelowThreshold / stats.FundingAmount, true
+}
+
+// Utilization returns the share of offered funding that is lent out, funding_amount_used / funding_amount.
+// It reports false when funding_amount is zero.
+func Utilization(stats api.FundingStats) (float64, bool) {
+	if stats.FundingAmount <= 0 {
+		return 0, false
+	}
+	return stats.FundingAmountUsed / stats.FundingAmount, true
+}
+
+// UtilizationPoint is the utilization of one FundingStats row; Utilization is nil when total funding was zero
+type UtilizationPoint struct {
+	MTS               int64    `json:"mts"`
+	Utilization       *float64 `json:"utilization"`
+	FundingAmount     float64  `json:"funding_amount"`
+	FundingAmountUsed float64  `json:"funding_amount_used"`
+}
+
+// NewUtilizationPoints computes the utilization of each stats row, keeping their order
+func NewUtilizationPoints(stats []api.FundingStats) []UtilizationPoint {
+	points := make([]UtilizationPoint, len(stats))
+	for i, stat := range stats {
+		points[i] = UtilizationPoint{
+			MTS:               stat.MTS,
+			FundingAmount:     stat.FundingAmount,
+			FundingAmountUsed: stat.FundingAmountUsed,
+		}
+		if utilization, ok := Utilization(stat); ok {
+			points[i].Utilization = &utilization
+		}
+	}
+	return points
+}
+
+// BelowThresholdRatioPoint is a stored below-threshold ratio; Ratio is nil when total funding was zero
+type BelowThresholdRatioPoint struct {
+	MTS   int64    `json:"mts"`
+	Ratio *float64 `json:"ratio"`
+}
+
+// GetBelowThresholdRatios retrieves stored below-threshold ratios with MTS before the given cursor, newest first
+func (d *Database) GetBelowThresholdRatios(currency string, before int64, limit int) ([]BelowThresholdRatioPoint, error) {
+	return d.GetBelowThresholdRatiosWithContext(context.Background(), currency, before, limit)
+}
+
+// GetBelowThresholdRatiosWithContext retrieves stored below-threshold ratios with MTS before the given cursor, newest first using context
+func (d *Database) GetBelowThresholdRatiosWithContext(ctx context.Context, currency string, before int64, limit int) ([]BelowThresholdRatioPoint, error) {
+	query := `
+    SELECT mts, below_threshold_ratio
+    FROM funding_stats
+    WHERE currency = ? AND period = 0 AND mts < ?
+    ORDER BY mts DESC
+    LIMIT ?`
+
+	rows, err := d.queryContext(ctx, query, currency, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []BelowThresholdRatioPoint{}
+	for rows.Next() {
+		var point BelowThresholdRatioPoint
+		var ratio sql.NullFloat64
+		if err := rows.Scan(&point.MTS, &ratio); err != nil {
+			return nil, err
+		}
+		if ratio.Valid {
+			value := ratio.Float64
+			point.Ratio = &value
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+// FRRAmountAvailablePoint is the funding offered at FRR of a stored funding ticker; FRRAmountAvailable is nil
+// when the ticker did not report it
+type FRRAmountAvailablePoint struct {
+	Timestamp          int64    `json:"timestamp"`
+	FRRAmountAvailable *float64 `json:"frr_amount_available"`
+}
+
+// GetFRRAmountAvailableSeries retrieves the FRR amount available of stored funding tickers with a timestamp
+// before the given cursor, newest first
+func (d *Database) GetFRRAmountAvailableSeries(currency string, before int64, limit int) ([]FRRAmountAvailablePoint, error) {
+	return d.GetFRRAmountAvailableSeriesWithContext(context.Background(), currency, before, limit)
+}
+
+// GetFRRAmountAvailableSeriesWithContext retrieves the FRR amount available of stored funding tickers with a
+// timestamp before the given cursor, newest first using context
+func (d *Database) GetFRRAmountAvailableSeriesWithContext(ctx context.Context, currency string, before int64, limit int) ([]FRRAmountAvailablePoint, error) {
+	query := `
+    SELECT timestamp, frr_amount_available
+    FROM funding_ticker
+    WHERE currency = ? AND timestamp < ?
+    ORDER BY timestamp DESC
+    LIMIT ?`
+
+	rows, err := d.queryContext(ctx, query, currency, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []FRRAmountAvailablePoint{}
+	for rows.Next() {
+		var point FRRAmountAvailablePoint
+		var amount sql.NullFloat64
+		if err := rows.Scan(&point.Timestamp, &amount); err != nil {
+			return nil, err
+		}
+		if amount.Valid {
+			value := amount.Float64
+			point.FRRAmountAvailable = &value
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
 // GetFundingStats retrieves FundingStats for the specified currency from the database
 func (d *Database) GetFundingStats(currency string, limit int) ([]api.FundingStats, error) {
+	return d.GetFundingStatsWithContext(context.Background(), currency, limit)
+}
+
+// GetFundingStatsWithContext retrieves FundingStats for the specified currency from the database using context
+func (d *Database) GetFundingStatsWithContext(ctx context.Context, currency string, limit int) ([]api.FundingStats, error) {
+	return d.GetFundingStatsBeforeWithContext(ctx, currency, math.MaxInt64, limit)
+}
+
+// ErrNoFundingStats is returned by latest funding stats reads when no stats are stored for the currency.
+// It wraps sql.ErrNoRows, so errors.Is matches either.
+var ErrNoFundingStats = fmt.Errorf("no funding stats found: %w", sql.ErrNoRows)
+
+// GetLatestFundingStats retrieves the newest FundingStats for the specified currency, returning
+// ErrNoFundingStats when none are stored
+func (d *Database) GetLatestFundingStats(currency string) (api.FundingStats, error) {
+	return d.GetLatestFundingStatsWithContext(context.Background(), currency)
+}
+
+// GetLatestFundingStatsWithContext retrieves the newest FundingStats for the specified currency using context,
+// returning ErrNoFundingStats when none are stored
+func (d *Database) GetLatestFundingStatsWithContext(ctx context.Context, currency string) (api.FundingStats, error) {
+	return d.GetLatestFundingStatsForPeriodWithContext(ctx, currency, 0)
+}
+
+// GetLatestFundingStatsForPeriod retrieves the newest FundingStats of the given period, 0 for the stats over
+// all periods, returning ErrNoFundingStats when none are stored
+func (d *Database) GetLatestFundingStatsForPeriod(currency string, period int) (api.FundingStats, error) {
+	return d.GetLatestFundingStatsForPeriodWithContext(context.Background(), currency, period)
+}
+
+// GetLatestFundingStatsForPeriodWithContext retrieves the newest FundingStats of the given period using context,
+// returning ErrNoFundingStats when none are stored
+func (d *Database) GetLatestFundingStatsForPeriodWithContext(ctx context.Context, currency string, period int) (api.FundingStats, error) {
+	stats, err := d.GetFundingStatsForPeriodWithContext(ctx, currency, period, 1)
+	if err != nil {
+		return api.FundingStats{}, err
+	}
+	if len(stats) == 0 {
+		return api.FundingStats{}, ErrNoFundingStats
+	}
+	return stats[0], nil
+}
+
+// GetFundingStatsForPeriodWithContext retrieves FundingStats of the given period, 0 for the stats over
+// all periods, for the specified currency from the database using context
+func (d *Database) GetFundingStatsForPeriodWithContext(ctx context.Context, currency string, period, limit int) ([]api.FundingStats, error) {
+	return d.GetFundingStatsBeforeForPeriodWithContext(ctx, currency, period, math.MaxInt64, limit)
+}
+
+// GetFundingStatsBefore retrieves FundingStats recorded before the given MTS, newest first
+func (d *Database) GetFundingStatsBefore(currency string, before int64, limit int) ([]api.FundingStats, error) {
+	return d.GetFundingStatsBeforeWithContext(context.Background(), currency, before, limit)
+}
+
+// GetFundingStatsBeforeWithContext retrieves FundingStats recorded before the given MTS, newest first using context
+func (d *Database) GetFundingStatsBeforeWithContext(ctx context.Context, currency string, before int64, limit int) ([]api.FundingStats, error) {
+	return d.GetFundingStatsBeforeForPeriodWithContext(ctx, currency, 0, before, limit)
+}
+
+// GetFundingStatsBeforeForPeriodWithContext retrieves FundingStats of the given period recorded before
+// the given MTS, newest first using context
+func (d *Database) GetFundingStatsBeforeForPeriodWithContext(ctx context.Context, currency string, period int, before int64, limit int) ([]api.FundingStats, error) {
 	query := `
-    SELECT mts, frr, avg_period, funding_amount, funding_amount_used, funding_below_threshold
+    SELECT mts, frr, avg_period, funding_amount, funding_amount_used, funding_below_threshold, period
     FROM funding_stats
-    WHERE currency = ?
+    WHERE currency = ? AND period = ? AND mts < ?
     ORDER BY mts DESC
     LIMIT ?`
 
-	rows, err := d.db.Query(query, currency, limit)
+	rows, err := d.queryContext(ctx, query, currency, period, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFundingStats(rows)
+}
+
+// GetFundingStatsResampled buckets FundingStats between start and end (MTS, inclusive) into
+// fixed intervals and returns the last row of each non-empty bucket, oldest first
+func (d *Database) GetFundingStatsResampled(currency string, start, end int64, interval time.Duration) ([]api.FundingStats, error) {
+	return d.GetFundingStatsResampledWithContext(context.Background(), currency, start, end, interval)
+}
+
+// GetFundingStatsResampledWithContext buckets FundingStats between start and end (MTS, inclusive) into
+// fixed intervals and returns the last row of each non-empty bucket, oldest first using context
+func (d *Database) GetFundingStatsResampledWithContext(ctx context.Context, currency string, start, end int64, interval time.Duration) ([]api.FundingStats, error) {
+	intervalMs := interval.Milliseconds()
+	if intervalMs <= 0 {
+		return nil, fmt.Errorf("invalid resample interval: %s", interval)
+	}
+
+	query := `
+    SELECT f.mts, f.frr, f.avg_period, f.funding_amount, f.funding_amount_used, f.funding_below_threshold, f.period
+    FROM funding_stats f
+    JOIN (
+        SELECT MAX(mts) AS mts
+        FROM funding_stats
+        WHERE currency = ? AND period = 0 AND mts BETWEEN ? AND ?
+        GROUP BY mts / ?
+    ) last ON f.mts = last.mts
+    WHERE f.currency = ? AND f.period = 0
+    ORDER BY f.mts ASC`
+
+	rows, err := d.queryContext(ctx, query, currency, start, end, intervalMs, currency)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanFundingStats(rows)
+}
+
+// FundingStatsAggregates summarizes the overall (period 0) FundingStats of a window. Empty is set and
+// every value is zero when the window holds no rows.
+type FundingStatsAggregates struct {
+	Count          int64
+	Empty          bool
+	LatestMTS      int64
+	LatestFRR      float64 // Unscaled FRR of the newest row with an FRR
+	MinFRR         float64
+	MaxFRR         float64
+	AvgFRR         float64
+	AvgUtilization float64 // Mean funding_amount_used / funding_amount over rows with funding offered
+}
+
+// GetFundingStatsBetweenWithAggregates computes the latest, min, max and average FRR and the average
+// utilization of the FundingStats between start and end (MTS, inclusive) in a single query
+func (d *Database) GetFundingStatsBetweenWithAggregates(currency string, start, end int64) (FundingStatsAggregates, error) {
+	return d.GetFundingStatsBetweenWithAggregatesWithContext(context.Background(), currency, start, end)
+}
+
+// GetFundingStatsBetweenWithAggregatesWithContext computes the latest, min, max and average FRR and the
+// average utilization of the FundingStats between start and end (MTS, inclusive) in a single query using context
+func (d *Database) GetFundingStatsBetweenWithAggregatesWithContext(ctx context.Context, currency string, start, end int64) (FundingStatsAggregates, error) {
+	query := `
+    WITH w AS (
+        SELECT mts, frr, funding_amount, funding_amount_used
+        FROM funding_stats
+        WHERE currency = ? AND period = 0 AND mts BETWEEN ? AND ?
+    ), latest AS (
+        SELECT mts, frr FROM w WHERE frr IS NOT NULL ORDER BY mts DESC LIMIT 1
+    )
+    SELECT COUNT(*),
+           COALESCE((SELECT mts FROM latest), 0),
+           COALESCE((SELECT frr FROM latest), 0),
+           COALESCE(MIN(frr), 0),
+           COALESCE(MAX(frr), 0),
+           COALESCE(AVG(frr), 0),
+           COALESCE(AVG(CASE WHEN funding_amount > 0 THEN funding_amount_used / funding_amount END), 0)
+    FROM w`
+
+	var agg FundingStatsAggregates
+	if err := d.conn.QueryRowContext(ctx, query, currency, start, end).Scan(
+		&agg.Count,
+		&agg.LatestMTS,
+		&agg.LatestFRR,
+		&agg.MinFRR,
+		&agg.MaxFRR,
+		&agg.AvgFRR,
+		&agg.AvgUtilization,
+	); err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return FundingStatsAggregates{}, err
+	}
+	agg.Empty = agg.Count == 0
+
+	return agg, nil
+}
+
+// CountFundingStatsWithContext returns the number of stored FundingStats rows of a currency and period using context
+func (d *Database) CountFundingStatsWithContext(ctx context.Context, currency string, period int) (int64, error) {
+	var count int64
+	if err := d.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM funding_stats WHERE currency = ? AND period = ?", currency, period).Scan(&count); err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// CountWSFundingTradesWithContext returns the number of stored WebSocket funding trades of a currency using
+// context, counting a trade stored as both "fte" and "ftu" once
+func (d *Database) CountWSFundingTradesWithContext(ctx context.Context, currency string) (int64, error) {
+	var count int64
+	query := "SELECT COUNT(DISTINCT trade_id) FROM " + d.readTable("ws_funding_trades") + " WHERE currency = ?"
+	if err := d.conn.QueryRowContext(ctx, query, currency).Scan(&count); err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// countRows counts the rows of a currency in table, answered from the table's currency index
+func (d *Database) countRows(ctx context.Context, table, currency string) (int64, error) {
+	var count int64
+	if err := d.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE currency = ?", currency).Scan(&count); err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// scanFundingStats reads FundingStats rows selected as
+// mts, frr, avg_period, funding_amount, funding_amount_used, funding_below_threshold, period
+func scanFundingStats(rows *sql.Rows) ([]api.FundingStats, error) {
 	var stats []api.FundingStats
 	for rows.Next() {
 		var s api.FundingStats
@@ -112,6 +476,7 @@ func (d *Database) GetFundingStats(currency string, limit int) ([]api.FundingSta
 			&fundingAmount,
 			&fundingAmountUsed,
 			&fundingBelowThreshold,
+			&s.Period,
 		); err != nil {
 			return nil, err
 		}
@@ -122,8 +487,13 @@ func (d *Database) GetFundingStats(currency string, limit int) ([]api.FundingSta
 			s.MTS = time.Now().UnixMilli() // Use current time as default value
 		}
 
+		// The stored FRR is the raw stats value; it is returned unscaled in FRR and FRRRaw and annualized in FRRAPR
 		if frr.Valid {
-			s.FRR = frr.Float64 * 365 * 365
+			s.FRR = frr.Float64
+			s.FRRRaw = frr.Float64
+			s.FRRAPR = rates.StatsFRRToAPR(frr.Float64)
+		} else {
+			s.FRRMissing = true
 		}
 
 		if avgPeriod.Valid {
@@ -152,17 +522,17 @@ func (d *Database) GetFundingStats(currency string, limit int) ([]api.FundingSta
 	return stats, nil
 }
 
-// SaveTradingBook saves TradingBook data to the database
+// SaveTradingBook saves TradingBook data to the database, returning 0 when the entry was already stored
 func (d *Database) SaveTradingBook(symbol string, book api.TradingBook) (int64, error) {
 	query := `
-	INSERT INTO trading_book 
+	INSERT OR IGNORE INTO trading_book
 	(symbol, price, count, amount, is_bid)
 	VALUES (?, ?, ?, ?, ?)`
 
 	// In TradingBook, amount > 0 indicates bid, < 0 indicates ask
 	isBid := book.Amount > 0
 
-	result, err := d.db.Exec(
+	result, err := d.conn.Exec(
 		query,
 		symbol,
 		book.Price,
@@ -174,7 +544,7 @@ func (d *Database) SaveTradingBook(symbol string, book api.TradingBook) (int64,
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return insertedID(result)
 }
 
 // GetTradingBook retrieves TradingBook data for the specified trading pair from the database
@@ -186,7 +556,7 @@ func (d *Database) GetTradingBook(symbol string, isBid bool, limit int) ([]api.T
 	ORDER BY price DESC
 	LIMIT ?`
 
-	rows, err := d.db.Query(query, symbol, isBid, limit)
+	rows, err := d.conn.Query(query, symbol, isBid, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -212,43 +582,166 @@ func (d *Database) GetTradingBook(symbol string, isBid bool, limit int) ([]api.T
 	return books, nil
 }
 
-// SaveFundingBook saves FundingBook data to the database
+// SaveFundingBook saves P0 FundingBook data to the database, returning 0 when the entry was already stored
 func (d *Database) SaveFundingBook(currency string, book api.FundingBook) (int64, error) {
-	query := `
-	INSERT INTO funding_book 
-	(currency, rate, period, count, amount, is_bid)
-	VALUES (?, ?, ?, ?, ?, ?)`
+	return d.SaveFundingBookWithPrecision(currency, api.PrecisionP0, book)
+}
+
+// SaveFundingBookWithPrecision saves FundingBook data aggregated at the given precision to the database,
+// stamped with the current second, returning 0 when the entry was already stored. Entries of one snapshot
+// can straddle a second this way; use SaveFundingBookAt to store a snapshot under one timestamp.
+func (d *Database) SaveFundingBookWithPrecision(currency string, precision api.BookPrecision, book api.FundingBook) (int64, error) {
+	return d.SaveFundingBookAt(currency, precision, time.Now().Unix()*1000, book)
+}
+
+// SaveFundingBookAt saves a FundingBook entry aggregated at the given precision with the snapshot timestamp
+// mts, returning 0 when the entry was already stored. All entries of one snapshot must share mts for
+// the latest-snapshot queries to return the whole book.
+func (d *Database) SaveFundingBookAt(currency string, precision api.BookPrecision, mts int64, book api.FundingBook) (int64, error) {
+	if mts <= 0 {
+		return 0, fmt.Errorf("invalid funding book snapshot timestamp %d for %s", mts, currency)
+	}
+
+	table, err := d.writeTable("funding_book", mts)
+	if err != nil {
+		return 0, err
+	}
+
+	query, args := d.shardedInsert("funding_book", table,
+		[]string{"currency", "precision", "timestamp", "rate", "rate_scaled", "period", "count", "amount", "is_bid"},
+		[]int{0, 1, 2, 3, 5, 8})
 
 	// In FundingBook, amount > 0 indicates asks, < 0 indicates bids
 	isBid := book.Amount < 0
 
-	result, err := d.db.Exec(
-		query,
+	result, err := d.conn.Exec(query, args(
 		currency,
+		string(precision),
+		mts,
 		book.Rate,
+		d.scaledRate(book.Rate),
 		book.Period,
 		book.Count,
 		book.Amount,
 		isBid,
-	)
+	)...)
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return insertedID(result)
+}
+
+// BookDepthPoint is the total bid and ask amount of one funding book snapshot
+type BookDepthPoint struct {
+	MTS      int64   `json:"mts"`
+	TotalBid float64 `json:"total_bid"`
+	TotalAsk float64 `json:"total_ask"`
+}
+
+// GetFundingBookSummaryHistory retrieves the depth of the latest limit funding book snapshots, oldest first
+func (d *Database) GetFundingBookSummaryHistory(currency string, limit int) ([]BookDepthPoint, error) {
+	return d.GetFundingBookSummaryHistoryWithContext(context.Background(), currency, limit)
+}
+
+// GetFundingBookSummaryHistoryWithContext retrieves the depth of the latest limit funding book snapshots,
+// oldest first using context, summing the stored P0 snapshots in funding_book
+func (d *Database) GetFundingBookSummaryHistoryWithContext(ctx context.Context, currency string, limit int) ([]BookDepthPoint, error) {
+	return d.GetFundingBookSummaryHistoryBeforeWithContext(ctx, currency, math.MaxInt64, limit)
+}
+
+// GetFundingBookSummaryHistoryBeforeWithContext retrieves the depth of the latest limit funding book snapshots
+// taken before the given MTS, oldest first using context
+func (d *Database) GetFundingBookSummaryHistoryBeforeWithContext(ctx context.Context, currency string, before int64, limit int) ([]BookDepthPoint, error) {
+	query := `
+	SELECT mts, total_bid, total_ask FROM (
+		SELECT timestamp AS mts,
+		       COALESCE(SUM(CASE WHEN is_bid = 1 THEN ABS(amount) END), 0) AS total_bid,
+		       COALESCE(SUM(CASE WHEN is_bid = 0 THEN ABS(amount) END), 0) AS total_ask
+		FROM ` + d.readTable("funding_book") + `
+		WHERE currency = ? AND precision = 'P0' AND timestamp < ?
+		GROUP BY timestamp
+		ORDER BY timestamp DESC
+		LIMIT ?
+	) ORDER BY mts ASC`
+
+	rows, err := d.queryContext(ctx, query, currency, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []BookDepthPoint{}
+	for rows.Next() {
+		var p BookDepthPoint
+		if err := rows.Scan(&p.MTS, &p.TotalBid, &p.TotalAsk); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// BookSnapshotSummary summarizes one aggregated funding book snapshot. Best rates are nil when a side is empty.
+type BookSnapshotSummary struct {
+	MTS       int64    `json:"mts"`
+	BestBid   *float64 `json:"best_bid"`
+	BestAsk   *float64 `json:"best_ask"`
+	BidLevels int      `json:"bid_levels"`
+	AskLevels int      `json:"ask_levels"`
+}
+
+// GetFundingBookSnapshotSummariesWithContext summarizes the funding book snapshots taken between start and end (ms),
+// oldest first using context
+func (d *Database) GetFundingBookSnapshotSummariesWithContext(ctx context.Context, currency string, start, end int64) ([]BookSnapshotSummary, error) {
+	query := `
+	SELECT timestamp,
+	       MAX(CASE WHEN is_bid = 1 THEN rate END),
+	       MIN(CASE WHEN is_bid = 0 THEN rate END),
+	       SUM(CASE WHEN is_bid = 1 THEN 1 ELSE 0 END),
+	       SUM(CASE WHEN is_bid = 0 THEN 1 ELSE 0 END)
+	FROM ` + d.readTable("funding_book") + `
+	WHERE currency = ? AND precision = 'P0' AND timestamp BETWEEN ? AND ?
+	GROUP BY timestamp
+	ORDER BY timestamp ASC`
+
+	rows, err := d.queryContext(ctx, query, currency, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []BookSnapshotSummary{}
+	for rows.Next() {
+		var summary BookSnapshotSummary
+		var bestBid, bestAsk sql.NullFloat64
+		if err := rows.Scan(&summary.MTS, &bestBid, &bestAsk, &summary.BidLevels, &summary.AskLevels); err != nil {
+			return nil, err
+		}
+		if bestBid.Valid {
+			summary.BestBid = &bestBid.Float64
+		}
+		if bestAsk.Valid {
+			summary.BestAsk = &bestAsk.Float64
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, rows.Err()
 }
 
-// SaveRawTradingBook saves RawTradingBook data to the database
+// SaveRawTradingBook saves RawTradingBook data to the database, returning 0 when the entry was already stored
 func (d *Database) SaveRawTradingBook(symbol string, book api.RawTradingBook) (int64, error) {
 	query := `
-	INSERT INTO raw_trading_book 
+	INSERT OR IGNORE INTO raw_trading_book
 	(symbol, order_id, price, amount, is_bid)
 	VALUES (?, ?, ?, ?, ?)`
 
 	// In RawTradingBook, amount > 0 indicates bid, < 0 indicates ask
 	isBid := book.Amount > 0
 
-	result, err := d.db.Exec(
+	result, err := d.conn.Exec(
 		query,
 		symbol,
 		book.OrderID,
@@ -260,32 +753,57 @@ func (d *Database) SaveRawTradingBook(symbol string, book api.RawTradingBook) (i
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return insertedID(result)
 }
 
-// SaveRawFundingBook saves RawFundingBook data to the database
+// SaveRawFundingBook saves RawFundingBook data to the database stamped with the current second, returning 0
+// when the entry was already stored
 func (d *Database) SaveRawFundingBook(currency string, book api.RawFundingBook) (int64, error) {
-	query := `
-	INSERT INTO raw_funding_book 
-	(currency, offer_id, period, rate, amount, is_bid)
-	VALUES (?, ?, ?, ?, ?, ?)`
+	return d.SaveRawFundingBookAt(currency, time.Now().Unix()*1000, book)
+}
+
+// SaveRawFundingBookAt saves a RawFundingBook entry with the snapshot timestamp mts, returning 0 when the
+// entry was already stored
+func (d *Database) SaveRawFundingBookAt(currency string, mts int64, book api.RawFundingBook) (int64, error) {
+	if mts <= 0 {
+		return 0, fmt.Errorf("invalid raw funding book snapshot timestamp %d for %s", mts, currency)
+	}
+
+	table, err := d.writeTable("raw_funding_book", mts)
+	if err != nil {
+		return 0, err
+	}
+
+	query, args := d.shardedInsert("raw_funding_book", table,
+		[]string{"currency", "timestamp", "offer_id", "period", "rate", "rate_scaled", "amount", "is_bid"},
+		[]int{0, 1, 2})
 
 	// In RawFundingBook, amount > 0 indicates asks, < 0 indicates bids
 	isBid := book.Amount < 0
 
-	result, err := d.db.Exec(
-		query,
+	result, err := d.conn.Exec(query, args(
 		currency,
+		mts,
 		book.OfferID,
 		book.Period,
 		book.Rate,
+		d.scaledRate(book.Rate),
 		book.Amount,
 		isBid,
-	)
+	)...)
 	if err != nil {
 		return 0, err
 	}
 
+	return insertedID(result)
+}
+
+// insertedID returns the ID of the row stored by an INSERT OR IGNORE, or 0 when it was ignored as a duplicate
+func insertedID(result sql.Result) (int64, error) {
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return 0, err
+	}
 	return result.LastInsertId()
 }
 
@@ -297,7 +815,7 @@ func (d *Database) SaveTradingTicker(symbol string, ticker api.TradingTicker) (i
 	last_price, volume, high, low)
 	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := d.db.Exec(
+	result, err := d.conn.Exec(
 		query,
 		symbol,
 		ticker.Bid,
@@ -318,6 +836,9 @@ func (d *Database) SaveTradingTicker(symbol string, ticker api.TradingTicker) (i
 	return result.LastInsertId()
 }
 
+// ErrNoTicker is returned by latest ticker reads when no ticker is stored for the symbol or currency
+var ErrNoTicker = errors.New("no ticker found")
+
 // GetLatestTradingTicker retrieves the latest TradingTicker for the specified trading pair from the database
 func (d *Database) GetLatestTradingTicker(symbol string) (api.TradingTicker, error) {
 	query := `
@@ -329,7 +850,7 @@ func (d *Database) GetLatestTradingTicker(symbol string) (api.TradingTicker, err
 	LIMIT 1`
 
 	var ticker api.TradingTicker
-	err := d.db.QueryRow(query, symbol).Scan(
+	err := d.conn.QueryRow(query, symbol).Scan(
 		&ticker.Bid,
 		&ticker.BidSize,
 		&ticker.Ask,
@@ -343,23 +864,26 @@ func (d *Database) GetLatestTradingTicker(symbol string) (api.TradingTicker, err
 	)
 
 	if err == sql.ErrNoRows {
-		return ticker, errors.New("no ticker found for symbol: " + symbol)
+		return ticker, fmt.Errorf("%w for symbol: %s", ErrNoTicker, symbol)
 	}
 
 	return ticker, err
 }
 
-// SaveFundingTicker saves FundingTicker data to the database
+// SaveFundingTicker saves FundingTicker data to the database stamped with the current millisecond, returning 0
+// when a ticker of the currency was already stored for that millisecond. Streamed tickers can arrive several
+// times a second, which the second resolution of the column default would reject.
 func (d *Database) SaveFundingTicker(currency string, ticker api.FundingTicker) (int64, error) {
 	query := `
-	INSERT INTO funding_ticker 
-	(currency, frr, bid, bid_period, bid_size, ask, ask_period, ask_size, 
+	INSERT OR IGNORE INTO funding_ticker 
+	(currency, timestamp, frr, bid, bid_period, bid_size, ask, ask_period, ask_size, 
 	daily_change, daily_change_percent, last_price, volume, high, low, frr_amount_available)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := d.db.Exec(
+	result, err := d.conn.Exec(
 		query,
 		currency,
+		time.Now().UnixMilli(),
 		ticker.FRR,
 		ticker.Bid,
 		ticker.BidPeriod,
@@ -379,11 +903,79 @@ func (d *Database) SaveFundingTicker(currency string, ticker api.FundingTicker)
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return insertedID(result)
+}
+
+// SaveFundingTickerIfChanged saves FundingTicker data unless its FRR, bid and ask are all within epsilon of the
+// latest stored ticker of the currency, reporting whether the ticker was stored
+func (d *Database) SaveFundingTickerIfChanged(currency string, ticker api.FundingTicker, epsilon float64) (bool, error) {
+	return d.SaveFundingTickerIfChangedOrStale(currency, ticker, epsilon, 0)
+}
+
+// SaveFundingTickerIfChangedOrStale saves FundingTicker data unless its FRR, bid and ask are all within epsilon
+// of the latest stored ticker of the currency and that ticker is at most maxGap old, reporting whether the
+// ticker was stored. The gap bounds how long frequent polling of an unchanged ticker goes without a row;
+// a non-positive maxGap never stores an unchanged ticker.
+func (d *Database) SaveFundingTickerIfChangedOrStale(currency string, ticker api.FundingTicker, epsilon float64, maxGap time.Duration) (bool, error) {
+	var latest api.FundingTicker
+	var latestMTS int64
+	err := d.conn.QueryRowContext(context.Background(), `
+	SELECT frr, bid, ask, timestamp
+	FROM funding_ticker
+	WHERE currency = ?
+	ORDER BY timestamp DESC, id DESC
+	LIMIT 1`, currency).Scan(&latest.FRR, &latest.Bid, &latest.Ask, &latestMTS)
+
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return false, err
+	case maxGap > 0 && time.Since(time.UnixMilli(latestMTS)) > maxGap:
+	case math.Abs(ticker.FRR-latest.FRR) <= epsilon &&
+		math.Abs(ticker.Bid-latest.Bid) <= epsilon &&
+		math.Abs(ticker.Ask-latest.Ask) <= epsilon:
+		return false, nil
+	}
+
+	if _, err := d.SaveFundingTicker(currency, ticker); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ErrStale is returned by WithMaxAge reads when the newest stored row is older than the allowed age
+var ErrStale = errors.New("latest data is stale")
+
+// checkFreshness returns an error wrapping ErrStale when the newest row of table for currency is older than maxAge.
+// A non-positive maxAge disables the check, and a currency without rows is left to the read to report.
+func (d *Database) checkFreshness(ctx context.Context, table, currency string, maxAge time.Duration) error {
+	if maxAge <= 0 {
+		return nil
+	}
+
+	var latest sql.NullInt64
+	err := d.conn.QueryRowContext(ctx, "SELECT MAX(timestamp) FROM "+table+" WHERE currency = ?", currency).Scan(&latest)
+	if err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return err
+	}
+	if !latest.Valid {
+		return nil
+	}
+
+	if age := time.Since(time.UnixMilli(latest.Int64)); age > maxAge {
+		return fmt.Errorf("%w: newest %s row for %s is %s old", ErrStale, table, currency, age.Round(time.Second))
+	}
+	return nil
 }
 
 // GetLatestFundingTicker retrieves the latest FundingTicker for the specified currency from the database
 func (d *Database) GetLatestFundingTicker(currency string) (api.FundingTicker, error) {
+	return d.GetLatestFundingTickerWithContext(context.Background(), currency)
+}
+
+// GetLatestFundingTickerWithContext retrieves the latest FundingTicker for the specified currency from the database using context
+func (d *Database) GetLatestFundingTickerWithContext(ctx context.Context, currency string) (api.FundingTicker, error) {
 	query := `
 	SELECT frr, bid, bid_period, bid_size, ask, ask_period, ask_size, 
 	daily_change, daily_change_percent, last_price, volume, high, low, frr_amount_available
@@ -393,7 +985,7 @@ func (d *Database) GetLatestFundingTicker(currency string) (api.FundingTicker, e
 	LIMIT 1`
 
 	var ticker api.FundingTicker
-	err := d.db.QueryRow(query, currency).Scan(
+	err := d.conn.QueryRowContext(ctx, query, currency).Scan(
 		&ticker.FRR,
 		&ticker.Bid,
 		&ticker.BidPeriod,
@@ -411,12 +1003,24 @@ func (d *Database) GetLatestFundingTicker(currency string) (api.FundingTicker, e
 	)
 
 	if err == sql.ErrNoRows {
-		return ticker, errors.New("no ticker found for currency: " + currency)
+		return ticker, fmt.Errorf("%w for currency: %s", ErrNoTicker, currency)
+	}
+	if err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
 	}
 
 	return ticker, err
 }
 
+// GetLatestFundingTickerWithMaxAge retrieves the latest FundingTicker using context,
+// returning ErrStale when it is older than maxAge
+func (d *Database) GetLatestFundingTickerWithMaxAge(ctx context.Context, currency string, maxAge time.Duration) (api.FundingTicker, error) {
+	if err := d.checkFreshness(ctx, "funding_ticker", currency, maxAge); err != nil {
+		return api.FundingTicker{}, err
+	}
+	return d.GetLatestFundingTickerWithContext(ctx, currency)
+}
+
 // GetHistoricalTradingTickers retrieves historical TradingTicker data for the specified trading pair
 func (d *Database) GetHistoricalTradingTickers(symbol string, startTime, endTime time.Time, limit int) ([]api.TradingTicker, error) {
 	query := `
@@ -427,7 +1031,7 @@ func (d *Database) GetHistoricalTradingTickers(symbol string, startTime, endTime
 	ORDER BY timestamp DESC
 	LIMIT ?`
 
-	rows, err := d.db.Query(query, symbol, startTime, endTime, limit)
+	rows, err := d.conn.Query(query, symbol, startTime.UnixMilli(), endTime.UnixMilli(), limit)
 	if err != nil {
 		return nil, err
 	}
@@ -462,15 +1066,32 @@ func (d *Database) GetHistoricalTradingTickers(symbol string, startTime, endTime
 
 // GetHistoricalFundingTickers retrieves historical FundingTicker data for the specified currency
 func (d *Database) GetHistoricalFundingTickers(currency string, startTime, endTime time.Time, limit int) ([]api.FundingTicker, error) {
+	return d.GetHistoricalFundingTickersWithContext(context.Background(), currency, startTime, endTime, limit)
+}
+
+// GetHistoricalFundingTickersWithContext retrieves historical FundingTicker data for the specified currency using context
+func (d *Database) GetHistoricalFundingTickersWithContext(ctx context.Context, currency string, startTime, endTime time.Time, limit int) ([]api.FundingTicker, error) {
+	return d.GetHistoricalFundingTickersOrderedWithContext(ctx, currency, startTime, endTime, limit, false)
+}
+
+// GetHistoricalFundingTickersOrderedWithContext retrieves historical FundingTicker data for the specified currency
+// using context, newest first or, when ascending, oldest first. The limit applies after ordering, so ascending
+// results start at startTime.
+func (d *Database) GetHistoricalFundingTickersOrderedWithContext(ctx context.Context, currency string, startTime, endTime time.Time, limit int, ascending bool) ([]api.FundingTicker, error) {
+	order := "DESC"
+	if ascending {
+		order = "ASC"
+	}
+
 	query := `
 	SELECT frr, bid, bid_period, bid_size, ask, ask_period, ask_size, 
 	daily_change, daily_change_percent, last_price, volume, high, low, frr_amount_available
 	FROM funding_ticker
 	WHERE currency = ? AND timestamp BETWEEN ? AND ?
-	ORDER BY timestamp DESC
+	ORDER BY timestamp ` + order + `
 	LIMIT ?`
 
-	rows, err := d.db.Query(query, currency, startTime, endTime, limit)
+	rows, err := d.queryContext(ctx, query, currency, startTime.UnixMilli(), endTime.UnixMilli(), limit)
 	if err != nil {
 		return nil, err
 	}
@@ -507,88 +1128,256 @@ func (d *Database) GetHistoricalFundingTickers(currency string, startTime, endTi
 	return tickers, nil
 }
 
-// GetLatestFundingBook retrieves the latest funding order book data
-func (d *Database) GetLatestFundingBook(currency string) ([]api.FundingBook, error) {
-	// Query the latest timestamp
-	var latestTimestamp int64
-	err := d.db.QueryRow(`
-		SELECT MAX(timestamp) 
-		FROM funding_book 
-		WHERE currency = ?
-	`, currency).Scan(&latestTimestamp)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("no funding book found for currency: " + currency)
-		}
-		return nil, err
-	}
+// TimestampedFundingTicker is a stored funding ticker together with the time it was collected
+type TimestampedFundingTicker struct {
+	Timestamp int64 `json:"timestamp"`
+	api.FundingTicker
+}
 
-	// Query all orders at the latest timestamp
+// GetTimestampedFundingTickersWithContext retrieves funding tickers collected between startTime and endTime,
+// oldest first, together with their timestamps using context
+func (d *Database) GetTimestampedFundingTickersWithContext(ctx context.Context, currency string, startTime, endTime time.Time, limit int) ([]TimestampedFundingTicker, error) {
 	query := `
-	SELECT rate, period, count, amount
-	FROM funding_book
-	WHERE currency = ? AND timestamp = ?
-	ORDER BY CASE WHEN is_bid = 1 THEN rate END DESC,
-	         CASE WHEN is_bid = 0 THEN rate END ASC`
+	SELECT timestamp, frr, bid, bid_period, bid_size, ask, ask_period, ask_size,
+	daily_change, daily_change_percent, last_price, volume, high, low, frr_amount_available
+	FROM funding_ticker
+	WHERE currency = ? AND timestamp BETWEEN ? AND ?
+	ORDER BY timestamp ASC
+	LIMIT ?`
 
-	rows, err := d.db.Query(query, currency, latestTimestamp)
+	rows, err := d.queryContext(ctx, query, currency, startTime.UnixMilli(), endTime.UnixMilli(), limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var books []api.FundingBook
+	tickers := []TimestampedFundingTicker{}
 	for rows.Next() {
-		var b api.FundingBook
+		var t TimestampedFundingTicker
 		if err := rows.Scan(
-			&b.Rate,
-			&b.Period,
-			&b.Count,
-			&b.Amount,
-		); err != nil {
-			return nil, err
-		}
-		books = append(books, b)
+			&t.Timestamp,
+			&t.FRR,
+			&t.Bid,
+			&t.BidPeriod,
+			&t.BidSize,
+			&t.Ask,
+			&t.AskPeriod,
+			&t.AskSize,
+			&t.DailyChange,
+			&t.DailyChangePercent,
+			&t.LastPrice,
+			&t.Volume,
+			&t.High,
+			&t.Low,
+			&t.FRRAmountAvailable,
+		); err != nil {
+			return nil, err
+		}
+		tickers = append(tickers, t)
 	}
 
-	if err := rows.Err(); err != nil {
+	return tickers, rows.Err()
+}
+
+// FundingTickerDelta represents the change between the latest funding ticker and an earlier one
+type FundingTickerDelta struct {
+	Current        api.FundingTicker `json:"current"`
+	Previous       api.FundingTicker `json:"previous"`
+	FRRDelta       float64           `json:"frr_delta"`
+	LastPriceDelta float64           `json:"last_price_delta"`
+	VolumeDelta    float64           `json:"volume_delta"`
+}
+
+// GetFundingTickerDelta compares the latest FundingTicker with the latest one recorded at least since ago
+func (d *Database) GetFundingTickerDelta(currency string, since time.Duration) (FundingTickerDelta, error) {
+	return d.GetFundingTickerDeltaWithContext(context.Background(), currency, since)
+}
+
+// GetFundingTickerDeltaWithContext compares the latest FundingTicker with the latest one recorded at least since ago using context
+func (d *Database) GetFundingTickerDeltaWithContext(ctx context.Context, currency string, since time.Duration) (FundingTickerDelta, error) {
+	var delta FundingTickerDelta
+
+	current, err := d.GetLatestFundingTickerWithContext(ctx, currency)
+	if err != nil {
+		return delta, err
+	}
+
+	previous, err := d.GetHistoricalFundingTickersWithContext(ctx, currency, time.UnixMilli(0), time.Now().Add(-since), 1)
+	if err != nil {
+		return delta, err
+	}
+	if len(previous) == 0 {
+		return delta, fmt.Errorf("no ticker found for currency %s older than %s", currency, since)
+	}
+
+	delta.Current = current
+	delta.Previous = previous[0]
+	delta.FRRDelta = current.FRR - previous[0].FRR
+	delta.LastPriceDelta = current.LastPrice - previous[0].LastPrice
+	delta.VolumeDelta = current.Volume - previous[0].Volume
+
+	return delta, nil
+}
+
+// ErrNoFundingBook is returned by latest funding book reads, aggregated or raw, when no book is stored for the currency
+var ErrNoFundingBook = errors.New("no funding book found")
+
+// GetLatestFundingBook retrieves the latest funding order book data
+func (d *Database) GetLatestFundingBook(currency string) ([]api.FundingBook, error) {
+	return d.GetLatestFundingBookWithContext(context.Background(), currency)
+}
+
+// GetLatestFundingBookWithContext retrieves the latest P0 funding order book data using context
+func (d *Database) GetLatestFundingBookWithContext(ctx context.Context, currency string) ([]api.FundingBook, error) {
+	return d.GetLatestFundingBookByPrecisionWithContext(ctx, currency, api.PrecisionP0)
+}
+
+// GetLatestFundingBookByPrecisionWithContext retrieves the latest funding order book data stored at the given precision using context
+func (d *Database) GetLatestFundingBookByPrecisionWithContext(ctx context.Context, currency string, precision api.BookPrecision) ([]api.FundingBook, error) {
+	// Query the latest timestamp
+	var latestTimestamp sql.NullInt64
+	err := d.conn.QueryRowContext(ctx, `
+		SELECT MAX(timestamp) 
+		FROM `+d.readTable("funding_book")+`
+		WHERE currency = ? AND precision = ?
+	`, currency, string(precision)).Scan(&latestTimestamp)
+
+	if err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return nil, err
+	}
+	if !latestTimestamp.Valid {
+		return nil, fmt.Errorf("%w for currency: %s", ErrNoFundingBook, currency)
+	}
+
+	// Query all orders at the latest timestamp
+	books, err := d.fundingBookAt(ctx, currency, precision, latestTimestamp.Int64)
+	if err != nil {
 		return nil, err
 	}
 
 	if len(books) == 0 {
-		return nil, errors.New("no funding book found for currency: " + currency)
+		return nil, fmt.Errorf("%w for currency: %s", ErrNoFundingBook, currency)
 	}
 
 	return books, nil
 }
 
+// fundingBookAt returns the funding book rows stored at exactly timestamp, bids first, best rate first
+func (d *Database) fundingBookAt(ctx context.Context, currency string, precision api.BookPrecision, timestamp int64) ([]api.FundingBook, error) {
+	query := `
+	SELECT rate, period, count, amount
+	FROM ` + d.readTable("funding_book") + `
+	WHERE currency = ? AND precision = ? AND timestamp = ?
+	ORDER BY CASE WHEN is_bid = 1 THEN rate END DESC,
+	         CASE WHEN is_bid = 0 THEN rate END ASC`
+
+	rows, err := d.queryContext(ctx, query, currency, string(precision), timestamp)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []api.FundingBook
+	for rows.Next() {
+		var b api.FundingBook
+		if err := rows.Scan(
+			&b.Rate,
+			&b.Period,
+			&b.Count,
+			&b.Amount,
+		); err != nil {
+			return nil, err
+		}
+		books = append(books, b)
+	}
+
+	return books, rows.Err()
+}
+
+// FundingBookSnapshot is the funding book stored at one timestamp
+type FundingBookSnapshot struct {
+	Timestamp int64
+	Books     []api.FundingBook // Bids first, best rate first
+}
+
+// GetFundingBookAtTimestamp retrieves the P0 funding book stored at mts, or the latest one stored before it
+func (d *Database) GetFundingBookAtTimestamp(currency string, mts int64) (FundingBookSnapshot, error) {
+	return d.GetFundingBookAtTimestampWithContext(context.Background(), currency, api.PrecisionP0, mts)
+}
+
+// GetFundingBookAtTimestampWithContext retrieves the funding book stored at the given precision at mts, or the
+// latest one stored before it, using context. It returns an error wrapping ErrNoFundingBook when none was
+// stored at or before mts.
+func (d *Database) GetFundingBookAtTimestampWithContext(ctx context.Context, currency string, precision api.BookPrecision, mts int64) (FundingBookSnapshot, error) {
+	var timestamp sql.NullInt64
+	err := d.conn.QueryRowContext(ctx, `
+		SELECT MAX(timestamp)
+		FROM `+d.readTable("funding_book")+`
+		WHERE currency = ? AND precision = ? AND timestamp <= ?
+	`, currency, string(precision), mts).Scan(&timestamp)
+	if err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return FundingBookSnapshot{}, err
+	}
+	if !timestamp.Valid {
+		return FundingBookSnapshot{}, fmt.Errorf("%w for currency %s at or before %d", ErrNoFundingBook, currency, mts)
+	}
+
+	books, err := d.fundingBookAt(ctx, currency, precision, timestamp.Int64)
+	if err != nil {
+		return FundingBookSnapshot{}, err
+	}
+	return FundingBookSnapshot{Timestamp: timestamp.Int64, Books: books}, nil
+}
+
+// GetLatestFundingBookWithMaxAge retrieves the latest funding order book data using context,
+// returning ErrStale when it is older than maxAge
+func (d *Database) GetLatestFundingBookWithMaxAge(ctx context.Context, currency string, maxAge time.Duration) ([]api.FundingBook, error) {
+	return d.GetLatestFundingBookByPrecisionWithMaxAge(ctx, currency, api.PrecisionP0, maxAge)
+}
+
+// GetLatestFundingBookByPrecisionWithMaxAge retrieves the latest funding order book data stored at the given
+// precision using context, returning ErrStale when the newest funding book row is older than maxAge
+func (d *Database) GetLatestFundingBookByPrecisionWithMaxAge(ctx context.Context, currency string, precision api.BookPrecision, maxAge time.Duration) ([]api.FundingBook, error) {
+	if err := d.checkFreshness(ctx, d.readTable("funding_book"), currency, maxAge); err != nil {
+		return nil, err
+	}
+	return d.GetLatestFundingBookByPrecisionWithContext(ctx, currency, precision)
+}
+
 // GetLatestRawFundingBook retrieves the latest raw funding order book data
 func (d *Database) GetLatestRawFundingBook(currency string) ([]api.RawFundingBook, error) {
+	return d.GetLatestRawFundingBookWithContext(context.Background(), currency)
+}
+
+// GetLatestRawFundingBookWithContext retrieves the latest raw funding order book data using context
+func (d *Database) GetLatestRawFundingBookWithContext(ctx context.Context, currency string) ([]api.RawFundingBook, error) {
 	// Query the latest timestamp
-	var latestTimestamp int64
-	err := d.db.QueryRow(`
+	var latestTimestamp sql.NullInt64
+	err := d.conn.QueryRowContext(ctx, `
 		SELECT MAX(timestamp) 
-		FROM raw_funding_book 
+		FROM `+d.readTable("raw_funding_book")+`
 		WHERE currency = ?
 	`, currency).Scan(&latestTimestamp)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("no raw funding book found for currency: " + currency)
-		}
+		requestid.Logf(ctx, "database query failed: %v", err)
 		return nil, err
 	}
+	if !latestTimestamp.Valid {
+		return nil, fmt.Errorf("%w for currency: %s", ErrNoFundingBook, currency)
+	}
 
 	// Query all orders at the latest timestamp
 	query := `
 	SELECT offer_id, period, rate, amount
-	FROM raw_funding_book
+	FROM ` + d.readTable("raw_funding_book") + `
 	WHERE currency = ? AND timestamp = ?
 	ORDER BY CASE WHEN is_bid = 1 THEN rate END DESC,
 	         CASE WHEN is_bid = 0 THEN rate END ASC`
 
-	rows, err := d.db.Query(query, currency, latestTimestamp)
+	rows, err := d.queryContext(ctx, query, currency, latestTimestamp.Int64)
 	if err != nil {
 		return nil, err
 	}
@@ -613,46 +1402,276 @@ func (d *Database) GetLatestRawFundingBook(currency string) ([]api.RawFundingBoo
 	}
 
 	if len(books) == 0 {
-		return nil, errors.New("no raw funding book found for currency: " + currency)
+		return nil, fmt.Errorf("%w for currency: %s", ErrNoFundingBook, currency)
 	}
 
 	return books, nil
 }
 
-// SaveWSFundingTrade saves a WebSocket funding trade to the database
-func (d *Database) SaveWSFundingTrade(currency string, trade api.FundingTrade, msgType string) (int64, error) {
+// GetLatestRawFundingBookWithMaxAge retrieves the latest raw funding order book data using context,
+// returning ErrStale when it is older than maxAge
+func (d *Database) GetLatestRawFundingBookWithMaxAge(ctx context.Context, currency string, maxAge time.Duration) ([]api.RawFundingBook, error) {
+	if err := d.checkFreshness(ctx, d.readTable("raw_funding_book"), currency, maxAge); err != nil {
+		return nil, err
+	}
+	return d.GetLatestRawFundingBookWithContext(ctx, currency)
+}
+
+// PeriodAmountPoint is the amount offered at one period in one raw funding book snapshot
+type PeriodAmountPoint struct {
+	MTS    int64   `json:"mts"`
+	Period int     `json:"period"`
+	Amount float64 `json:"amount"`
+	Offers int     `json:"offers"`
+}
+
+// GetRawFundingBookPeriodAmountsWithContext sums the offered (ask) amount per period of every raw funding
+// book snapshot between start and end (ms, inclusive), oldest first using context. At most limit rows
+// are returned.
+func (d *Database) GetRawFundingBookPeriodAmountsWithContext(ctx context.Context, currency string, start, end int64, limit int) ([]PeriodAmountPoint, error) {
 	query := `
-	INSERT INTO ws_funding_trades 
-	(trade_id, currency, timestamp, amount, rate, period, msg_type)
-	VALUES (?, ?, ?, ?, ?, ?, ?)`
+	SELECT timestamp, period, SUM(amount), COUNT(*)
+	FROM ` + d.readTable("raw_funding_book") + `
+	WHERE currency = ? AND timestamp BETWEEN ? AND ? AND is_bid = 0
+	GROUP BY timestamp, period
+	ORDER BY timestamp ASC, period ASC
+	LIMIT ?`
 
-	result, err := d.db.Exec(
-		query,
+	rows, err := d.queryContext(ctx, query, currency, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []PeriodAmountPoint{}
+	for rows.Next() {
+		var p PeriodAmountPoint
+		if err := rows.Scan(&p.MTS, &p.Period, &p.Amount, &p.Offers); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// ErrOneSidedBook is returned by GetFundingBookMidRate when the latest book has no bids or no asks
+var ErrOneSidedBook = errors.New("funding book is one-sided")
+
+// GetFundingBookMidRate returns the mid between the best bid and best ask rate of the latest raw funding book
+func (d *Database) GetFundingBookMidRate(currency string) (mid, bestBid, bestAsk float64, err error) {
+	return d.GetFundingBookMidRateWithContext(context.Background(), currency)
+}
+
+// GetFundingBookMidRateWithContext returns the mid between the best bid and best ask rate of the latest raw
+// funding book using context, or an error wrapping ErrOneSidedBook when either side is empty
+func (d *Database) GetFundingBookMidRateWithContext(ctx context.Context, currency string) (mid, bestBid, bestAsk float64, err error) {
+	bids, asks, err := d.GetLatestRawFundingBookSidesWithContext(ctx, currency)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(bids) == 0 || len(asks) == 0 {
+		return 0, 0, 0, fmt.Errorf("%w: latest %s book has %d bids and %d asks", ErrOneSidedBook, currency, len(bids), len(asks))
+	}
+
+	// Bids are ordered highest rate first and asks lowest rate first
+	bestBid, bestAsk = bids[0].Rate, asks[0].Rate
+	return (bestBid + bestAsk) / 2, bestBid, bestAsk, nil
+}
+
+// GetLatestRawFundingBookSides retrieves the latest raw funding order book split into bids and asks
+func (d *Database) GetLatestRawFundingBookSides(currency string) (bids, asks []api.RawFundingBook, err error) {
+	return d.GetLatestRawFundingBookSidesWithContext(context.Background(), currency)
+}
+
+// GetLatestRawFundingBookSidesWithContext retrieves the latest raw funding order book split into bids and asks
+// using context. Bids are ordered by rate descending and asks by rate ascending, so the best offer of each
+// side comes first; offers at the same rate keep their offer ID order.
+func (d *Database) GetLatestRawFundingBookSidesWithContext(ctx context.Context, currency string) (bids, asks []api.RawFundingBook, err error) {
+	var latestTimestamp sql.NullInt64
+	err = d.conn.QueryRowContext(ctx, `
+		SELECT MAX(timestamp)
+		FROM `+d.readTable("raw_funding_book")+`
+		WHERE currency = ?
+	`, currency).Scan(&latestTimestamp)
+	if err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return nil, nil, err
+	}
+	if !latestTimestamp.Valid {
+		return nil, nil, fmt.Errorf("%w for currency: %s", ErrNoFundingBook, currency)
+	}
+
+	query := `
+	SELECT offer_id, period, rate, amount, is_bid
+	FROM ` + d.readTable("raw_funding_book") + `
+	WHERE currency = ? AND timestamp = ?
+	ORDER BY is_bid DESC,
+	         CASE WHEN is_bid = 1 THEN rate END DESC,
+	         CASE WHEN is_bid = 0 THEN rate END ASC,
+	         offer_id ASC`
+
+	rows, err := d.queryContext(ctx, query, currency, latestTimestamp.Int64)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b api.RawFundingBook
+		var isBid bool
+		if err := rows.Scan(
+			&b.OfferID,
+			&b.Period,
+			&b.Rate,
+			&b.Amount,
+			&isBid,
+		); err != nil {
+			return nil, nil, err
+		}
+		if isBid {
+			bids = append(bids, b)
+		} else {
+			asks = append(asks, b)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(bids) == 0 && len(asks) == 0 {
+		return nil, nil, fmt.Errorf("%w for currency: %s", ErrNoFundingBook, currency)
+	}
+
+	return bids, asks, nil
+}
+
+// wsFundingTradeColumns are the columns written by the WebSocket funding trade saves; trades are keyed
+// by trade_id and msg_type
+var wsFundingTradeColumns = []string{"trade_id", "currency", "timestamp", "amount", "rate", "rate_scaled", "period", "msg_type"}
+
+// SaveWSFundingTrade saves a WebSocket funding trade to the database, returning 0 when the trade was
+// already stored
+func (d *Database) SaveWSFundingTrade(currency string, trade api.FundingTrade, msgType string) (int64, error) {
+	table, err := d.writeTable("ws_funding_trades", trade.MTS)
+	if err != nil {
+		return 0, err
+	}
+
+	query, args := d.shardedInsert("ws_funding_trades", table, wsFundingTradeColumns, []int{0, 7})
+	result, err := d.conn.Exec(query, args(
 		trade.ID,
 		currency,
 		trade.MTS,
 		trade.Amount,
 		trade.Rate,
+		d.scaledRate(trade.Rate),
 		trade.Period,
 		msgType,
-	)
+	)...)
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return insertedID(result)
+}
+
+// WSFundingTradeRecord is a WebSocket funding trade together with its currency and message type
+type WSFundingTradeRecord struct {
+	Currency string
+	Trade    api.FundingTrade
+	MsgType  string
+}
+
+// SaveWSFundingTrades saves WebSocket funding trades in a single transaction.
+// Trades that were already stored are skipped; the number of newly inserted trades is returned.
+func (d *Database) SaveWSFundingTrades(records []WSFundingTradeRecord) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	// Trades are written to the shard of their month, so a batch may span several tables
+	tables := make([]string, len(records))
+	for i, record := range records {
+		table, err := d.writeTable("ws_funding_trades", record.Trade.MTS)
+		if err != nil {
+			return 0, err
+		}
+		tables[i] = table
+	}
+
+	// Join the surrounding transaction when called from WithTx
+	var err error
+	tx, inTx := d.conn.(*sql.Tx)
+	if !inTx {
+		if tx, err = d.db.Begin(); err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+	}
+
+	type insert struct {
+		stmt *sql.Stmt
+		args func(values ...interface{}) []interface{}
+	}
+	inserts := make(map[string]insert)
+	defer func() {
+		for _, ins := range inserts {
+			ins.stmt.Close()
+		}
+	}()
+
+	inserted := 0
+	for i, record := range records {
+		ins, ok := inserts[tables[i]]
+		if !ok {
+			query, args := d.shardedInsert("ws_funding_trades", tables[i], wsFundingTradeColumns, []int{0, 7})
+			stmt, err := tx.Prepare(query)
+			if err != nil {
+				return 0, err
+			}
+			ins = insert{stmt: stmt, args: args}
+			inserts[tables[i]] = ins
+		}
+
+		result, err := ins.stmt.Exec(ins.args(
+			record.Trade.ID,
+			record.Currency,
+			record.Trade.MTS,
+			record.Trade.Amount,
+			record.Trade.Rate,
+			d.scaledRate(record.Trade.Rate),
+			record.Trade.Period,
+			record.MsgType,
+		)...)
+		if err != nil {
+			return 0, err
+		}
+		if affected, err := result.RowsAffected(); err == nil {
+			inserted += int(affected)
+		}
+	}
+
+	if !inTx {
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	return inserted, nil
 }
 
 // GetLatestWSFundingTrades retrieves the latest WebSocket funding trades for the specified currency
 func (d *Database) GetLatestWSFundingTrades(currency string, limit int) ([]api.FundingTrade, error) {
 	query := `
 	SELECT trade_id, timestamp, amount, rate, period
-	FROM ws_funding_trades
+	FROM ` + d.readTable("ws_funding_trades") + `
 	WHERE currency = ?
 	ORDER BY timestamp DESC
 	LIMIT ?`
 
-	rows, err := d.db.Query(query, currency, limit)
+	rows, err := d.conn.Query(query, currency, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -682,14 +1701,19 @@ func (d *Database) GetLatestWSFundingTrades(currency string, limit int) ([]api.F
 
 // GetHistoricalWSFundingTrades retrieves historical WebSocket funding trades for the specified currency
 func (d *Database) GetHistoricalWSFundingTrades(currency string, startTime, endTime time.Time, limit int) ([]api.FundingTrade, error) {
+	return d.GetHistoricalWSFundingTradesWithContext(context.Background(), currency, startTime, endTime, limit)
+}
+
+// GetHistoricalWSFundingTradesWithContext retrieves historical WebSocket funding trades for the specified currency using context
+func (d *Database) GetHistoricalWSFundingTradesWithContext(ctx context.Context, currency string, startTime, endTime time.Time, limit int) ([]api.FundingTrade, error) {
 	query := `
 	SELECT trade_id, timestamp, amount, rate, period
-	FROM ws_funding_trades
+	FROM ` + d.readTable("ws_funding_trades") + `
 	WHERE currency = ? AND timestamp BETWEEN ? AND ?
 	ORDER BY timestamp DESC
 	LIMIT ?`
 
-	rows, err := d.db.Query(query, currency, startTime.UnixMilli(), endTime.UnixMilli(), limit)
+	rows, err := d.queryContext(ctx, query, currency, startTime.UnixMilli(), endTime.UnixMilli(), limit)
 	if err != nil {
 		return nil, err
 	}
@@ -717,6 +1741,79 @@ func (d *Database) GetHistoricalWSFundingTrades(currency string, startTime, endT
 	return trades, nil
 }
 
+// GetWSFundingTradesBeforeWithContext retrieves up to limit stored WebSocket funding trades, newest first by
+// timestamp and trade ID, starting before the trade with beforeMTS and beforeID. Pass the last trade of a page
+// to read the next one; beforeID math.MinInt64 starts before beforeMTS itself. Each trade is returned once.
+func (d *Database) GetWSFundingTradesBeforeWithContext(ctx context.Context, currency string, beforeMTS, beforeID int64, limit int) ([]api.FundingTrade, error) {
+	table := d.readTable("ws_funding_trades")
+	query := `
+	SELECT t.trade_id, t.timestamp, t.amount, t.rate, t.period
+	FROM ` + table + ` t
+	WHERE t.currency = ?
+	  AND (t.timestamp < ? OR (t.timestamp = ? AND t.trade_id < ?))
+	  AND ` + oneRowPerTrade(table) + `
+	ORDER BY t.timestamp DESC, t.trade_id DESC
+	LIMIT ?`
+
+	rows, err := d.queryContext(ctx, query, currency, beforeMTS, beforeMTS, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []api.FundingTrade
+	for rows.Next() {
+		var t api.FundingTrade
+		if err := rows.Scan(&t.ID, &t.MTS, &t.Amount, &t.Rate, &t.Period); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
+// oneRowPerTrade returns a condition keeping one row per trade of table aliased t: a streamed trade is
+// stored as both an "fte" and an "ftu" row with the same trade ID, the "ftu" row is kept when present.
+// Keyset pages on (timestamp, trade_id) need it, the pair is only unique across single rows.
+func oneRowPerTrade(table string) string {
+	return `(t.msg_type = 'ftu' OR NOT EXISTS (
+		SELECT 1 FROM ` + table + ` u WHERE u.trade_id = t.trade_id AND u.msg_type = 'ftu'))`
+}
+
+// GetWSFundingTradesFromWithContext retrieves up to limit stored WebSocket funding trades up to end (MTS,
+// inclusive), oldest first by timestamp and trade ID, starting after the trade with afterMTS and afterID.
+// Pass the last trade of a page to read the next one; afterID math.MinInt64 starts at afterMTS itself.
+// Each trade is returned once.
+func (d *Database) GetWSFundingTradesFromWithContext(ctx context.Context, currency string, afterMTS, afterID, end int64, limit int) ([]api.FundingTrade, error) {
+	table := d.readTable("ws_funding_trades")
+	query := `
+	SELECT t.trade_id, t.timestamp, t.amount, t.rate, t.period
+	FROM ` + table + ` t
+	WHERE t.currency = ? AND t.timestamp <= ?
+	  AND (t.timestamp > ? OR (t.timestamp = ? AND t.trade_id > ?))
+	  AND ` + oneRowPerTrade(table) + `
+	ORDER BY t.timestamp ASC, t.trade_id ASC
+	LIMIT ?`
+
+	rows, err := d.queryContext(ctx, query, currency, end, afterMTS, afterMTS, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []api.FundingTrade
+	for rows.Next() {
+		var t api.FundingTrade
+		if err := rows.Scan(&t.ID, &t.MTS, &t.Amount, &t.Rate, &t.Period); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
 // FundingTradeDistribution represents the distribution of funding trades for a given hour
 type FundingTradeDistribution struct {
 	Hour        string  `json:"hour"`
@@ -727,8 +1824,66 @@ type FundingTradeDistribution struct {
 	TotalAmount float64 `json:"total_amount"`
 }
 
+// TradeSide selects funding trades by the sign of their amount
+type TradeSide string
+
+const (
+	SideAll  TradeSide = "all"
+	SideLend TradeSide = "lend" // amount > 0
+	SideTake TradeSide = "take" // amount < 0
+)
+
+// ParseTradeSide parses a trade side name, an empty name selecting all trades
+func ParseTradeSide(s string) (TradeSide, error) {
+	switch side := TradeSide(s); side {
+	case "":
+		return SideAll, nil
+	case SideAll, SideLend, SideTake:
+		return side, nil
+	default:
+		return "", fmt.Errorf("invalid trade side %q, must be lend, take or all", s)
+	}
+}
+
+// amountFilter returns the SQL condition on amount selecting trades of the side
+func (side TradeSide) amountFilter() string {
+	switch side {
+	case SideLend:
+		return " AND amount > 0"
+	case SideTake:
+		return " AND amount < 0"
+	default:
+		return ""
+	}
+}
+
 // GetFundingTradesDistribution retrieves the distribution of funding trades by hour
 func (db *Database) GetFundingTradesDistribution(currency string, limit int) ([]FundingTradeDistribution, error) {
+	return db.GetFundingTradesDistributionWithContext(context.Background(), currency, limit)
+}
+
+// GetFundingTradesDistributionWithContext retrieves the distribution of funding trades by hour using context
+func (db *Database) GetFundingTradesDistributionWithContext(ctx context.Context, currency string, limit int) ([]FundingTradeDistribution, error) {
+	return db.GetFundingTradesDistributionBeforeWithContext(ctx, currency, "", limit)
+}
+
+// GetFundingTradesDistributionBefore retrieves the hourly distribution of funding trades for hours before the given one
+func (db *Database) GetFundingTradesDistributionBefore(currency string, before string, limit int) ([]FundingTradeDistribution, error) {
+	return db.GetFundingTradesDistributionBeforeWithContext(context.Background(), currency, before, limit)
+}
+
+// GetFundingTradesDistributionBeforeWithContext retrieves the hourly distribution of funding trades for hours before the given one using context
+func (db *Database) GetFundingTradesDistributionBeforeWithContext(ctx context.Context, currency string, before string, limit int) ([]FundingTradeDistribution, error) {
+	return db.GetFundingTradesDistributionBySideWithContext(ctx, currency, SideAll, before, limit)
+}
+
+// GetFundingTradesDistributionBySideWithContext retrieves the hourly distribution of funding trades of one side
+// for hours before the given one using context. An empty before includes the latest hour.
+func (db *Database) GetFundingTradesDistributionBySideWithContext(ctx context.Context, currency string, side TradeSide, before string, limit int) ([]FundingTradeDistribution, error) {
+	if before == "" {
+		before = "9999-12-31 23:00:00"
+	}
+
 	query := `
 		SELECT 
 			strftime('%Y-%m-%d %H:00:00', datetime(timestamp/1000, 'unixepoch', 'localtime')) as hour,
@@ -737,14 +1892,15 @@ func (db *Database) GetFundingTradesDistribution(currency string, limit int) ([]
 			MIN(rate) as min_rate,
 			COUNT(*) as trade_count,
 			SUM(amount) as total_amount
-		FROM ws_funding_trades
-		WHERE currency = ?
+		FROM ` + db.readTable("ws_funding_trades") + `
+		WHERE currency = ?` + side.amountFilter() + `
 		GROUP BY hour
+		HAVING hour < ?
 		ORDER BY hour DESC
 		LIMIT ?
 	`
 
-	rows, err := db.db.Query(query, currency, limit)
+	rows, err := db.queryContext(ctx, query, currency, before, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query funding trades distribution: %v", err)
 	}
@@ -771,6 +1927,97 @@ func (db *Database) GetFundingTradesDistribution(currency string, limit int) ([]
 	return distributions, nil
 }
 
+// RateDistributionVariant describes a stored rate distribution for one bin count
+type RateDistributionVariant struct {
+	BinCount    int   `json:"bin_count"`
+	TotalTrades int   `json:"total_trades"`
+	UpdatedAt   int64 `json:"updated_at"`
+}
+
+// GetRateDistributionVariants lists the bin counts stored for a currency's rate distribution
+func (d *Database) GetRateDistributionVariants(currency string) ([]RateDistributionVariant, error) {
+	return d.GetRateDistributionVariantsWithContext(context.Background(), currency)
+}
+
+// GetRateDistributionVariantsWithContext lists the bin counts stored for a currency's rate distribution with the
+// current annualization using context
+func (d *Database) GetRateDistributionVariantsWithContext(ctx context.Context, currency string) ([]RateDistributionVariant, error) {
+	query := `
+	SELECT DISTINCT bin_count, total_trades, updated_at
+	FROM rate_distribution
+	WHERE currency = ? AND annualization = ?
+	ORDER BY bin_count ASC`
+
+	rows, err := d.queryContext(ctx, query, currency, rates.CurrentAnnualization().Formula())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []RateDistributionVariant{}
+	for rows.Next() {
+		var v RateDistributionVariant
+		if err := rows.Scan(&v.BinCount, &v.TotalTrades, &v.UpdatedAt); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+
+	return variants, rows.Err()
+}
+
+// RateDistributionSnapshot is a stored rate distribution as it was saved at CreatedAt (MTS)
+type RateDistributionSnapshot struct {
+	BinCount        int     `json:"bin_count"`
+	MinRate         float64 `json:"min_rate"`
+	MaxRate         float64 `json:"max_rate"`
+	BinWidth        float64 `json:"bin_width"`
+	Distribution    []int   `json:"distribution"`
+	TotalTrades     int     `json:"total_trades"`
+	LastProcessedID int64   `json:"last_processed_id"`
+	Annualization   string  `json:"annualization"` // Formula the APR bins were built with, see rates.Annualization
+	CreatedAt       int64   `json:"created_at"`
+}
+
+// GetRateDistributionHistory retrieves saved snapshots of a currency's rate distribution with binCount bins
+// created before the given MTS, newest first
+func (d *Database) GetRateDistributionHistory(currency string, binCount int, before int64, limit int) ([]RateDistributionSnapshot, error) {
+	return d.GetRateDistributionHistoryWithContext(context.Background(), currency, binCount, before, limit)
+}
+
+// GetRateDistributionHistoryWithContext retrieves saved snapshots of a currency's rate distribution with
+// binCount bins created before the given MTS, newest first, using context
+func (d *Database) GetRateDistributionHistoryWithContext(ctx context.Context, currency string, binCount int, before int64, limit int) ([]RateDistributionSnapshot, error) {
+	query := `
+	SELECT bin_count, min_rate, max_rate, bin_width, distribution, total_trades, last_processed_trade_id, annualization, created_at
+	FROM rate_distribution_history
+	WHERE currency = ? AND bin_count = ? AND created_at < ?
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?`
+
+	rows, err := d.queryContext(ctx, query, currency, binCount, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []RateDistributionSnapshot{}
+	for rows.Next() {
+		var snapshot RateDistributionSnapshot
+		var distributionJSON string
+		if err := rows.Scan(&snapshot.BinCount, &snapshot.MinRate, &snapshot.MaxRate, &snapshot.BinWidth,
+			&distributionJSON, &snapshot.TotalTrades, &snapshot.LastProcessedID, &snapshot.Annualization, &snapshot.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(distributionJSON), &snapshot.Distribution); err != nil {
+			return nil, fmt.Errorf("invalid distribution saved at %d: %v", snapshot.CreatedAt, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
 // GetDB returns the underlying sql.DB instance
 func (d *Database) GetDB() *sql.DB {
 	return d.db
@@ -780,11 +2027,11 @@ func (d *Database) GetDB() *sql.DB {
 func (d *Database) GetAllWSFundingTrades(currency string) ([]api.FundingTrade, error) {
 	query := `
 	SELECT trade_id, timestamp, amount, rate, period
-	FROM ws_funding_trades
+	FROM ` + d.readTable("ws_funding_trades") + `
 	WHERE currency = ?
 	ORDER BY trade_id ASC`
 
-	rows, err := d.db.Query(query, currency)
+	rows, err := d.conn.Query(query, currency)
 	if err != nil {
 		return nil, err
 	}
@@ -802,15 +2049,183 @@ func (d *Database) GetAllWSFundingTrades(currency string) ([]api.FundingTrade, e
 	return trades, rows.Err()
 }
 
+// WSFundingTradeRange summarizes the stored trades of a currency
+type WSFundingTradeRange struct {
+	Count   int
+	MinRate float64
+	MaxRate float64
+	MaxID   int64
+}
+
+// GetWSFundingTradeRangeWithContext returns the number of stored trades of a currency, their rate range
+// and the highest trade ID using context
+func (d *Database) GetWSFundingTradeRangeWithContext(ctx context.Context, currency string) (WSFundingTradeRange, error) {
+	var r WSFundingTradeRange
+	var minRate, maxRate sql.NullFloat64
+	var maxID sql.NullInt64
+	err := d.conn.QueryRowContext(ctx, `
+	SELECT COUNT(*), MIN(rate), MAX(rate), MAX(trade_id)
+	FROM `+d.readTable("ws_funding_trades")+`
+	WHERE currency = ?`, currency).Scan(&r.Count, &minRate, &maxRate, &maxID)
+	if err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return WSFundingTradeRange{}, err
+	}
+
+	r.MinRate = minRate.Float64
+	r.MaxRate = maxRate.Float64
+	r.MaxID = maxID.Int64
+	return r, nil
+}
+
+// ForEachWSFundingTradeWithContext calls fn for every stored trade of a currency with a trade ID up to
+// maxID in trade ID order without loading them all into memory, so trades stored while it runs beyond a
+// range read earlier are left out. It stops at the first error returned by fn or when ctx is done.
+func (d *Database) ForEachWSFundingTradeWithContext(ctx context.Context, currency string, maxID int64, fn func(trade api.FundingTrade) error) error {
+	query := `
+	SELECT trade_id, timestamp, amount, rate, period
+	FROM ` + d.readTable("ws_funding_trades") + `
+	WHERE currency = ? AND trade_id <= ?
+	ORDER BY trade_id ASC`
+
+	rows, err := d.queryContext(ctx, query, currency, maxID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var t api.FundingTrade
+		if err := rows.Scan(&t.ID, &t.MTS, &t.Amount, &t.Rate, &t.Period); err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetWSFundingTradesInAPRRange returns a currency's trades whose rate, as APR percent (rates.DailyToAPRPercent),
+// is at least minAPR and below maxAPR, or at most maxAPR when includeMax is set
+func (d *Database) GetWSFundingTradesInAPRRange(currency string, minAPR, maxAPR float64, includeMax bool) ([]api.FundingTrade, error) {
+	// The daily bounds are widened slightly so trades on a bin edge survive the inverse conversion;
+	// the exact bounds are applied to the converted rates below, as the distribution bins them
+	minDaily := rates.APRToDaily(minAPR / 100)
+	maxDaily := rates.APRToDaily(maxAPR / 100)
+	margin := 1e-9 * math.Max(math.Abs(minDaily), math.Abs(maxDaily))
+
+	query := `
+	SELECT trade_id, timestamp, amount, rate, period
+	FROM ` + d.readTable("ws_funding_trades") + `
+	WHERE currency = ? AND rate >= ? AND rate <= ?
+	ORDER BY trade_id ASC`
+
+	rows, err := d.conn.Query(query, currency, minDaily-margin, maxDaily+margin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := []api.FundingTrade{}
+	for rows.Next() {
+		var t api.FundingTrade
+		if err := rows.Scan(&t.ID, &t.MTS, &t.Amount, &t.Rate, &t.Period); err != nil {
+			return nil, err
+		}
+		apr := rates.DailyToAPRPercent(t.Rate)
+		if apr < minAPR || apr > maxAPR || (apr == maxAPR && !includeMax) {
+			continue
+		}
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
+// NetFlowPoint is the net funding flow of one bucket, MTS being the bucket start
+type NetFlowPoint struct {
+	MTS       int64   `json:"mts"`
+	NetAmount float64 `json:"net_amount"`
+	Trades    int     `json:"trades"`
+}
+
+// netFlowTrades selects each trade between start and end once, as a trade is stored for both its
+// executed (fte) and updated (ftu) message
+func (d *Database) netFlowTrades() string {
+	return `
+	SELECT trade_id, MIN(timestamp) AS timestamp, MAX(amount) AS amount
+	FROM ` + d.readTable("ws_funding_trades") + `
+	WHERE currency = ? AND timestamp BETWEEN ? AND ?
+	GROUP BY trade_id`
+}
+
+// GetNetFundingFlow sums the signed amounts of the funding trades between start and end (ms, inclusive);
+// positive amounts are new lending, negative amounts funding taken
+func (d *Database) GetNetFundingFlow(currency string, start, end int64) (float64, error) {
+	return d.GetNetFundingFlowWithContext(context.Background(), currency, start, end)
+}
+
+// GetNetFundingFlowWithContext sums the signed amounts of the funding trades between start and end using context
+func (d *Database) GetNetFundingFlowWithContext(ctx context.Context, currency string, start, end int64) (float64, error) {
+	var netAmount float64
+	err := d.conn.QueryRowContext(ctx, `
+	SELECT COALESCE(SUM(amount), 0) FROM (`+d.netFlowTrades()+`
+	)`, currency, start, end).Scan(&netAmount)
+	if err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return 0, err
+	}
+	return netAmount, nil
+}
+
+// GetNetFundingFlowSeriesWithContext sums the signed amounts of the funding trades between start and end
+// per interval bucket, oldest first using context. Buckets without trades are omitted.
+func (d *Database) GetNetFundingFlowSeriesWithContext(ctx context.Context, currency string, start, end int64, interval time.Duration) ([]NetFlowPoint, error) {
+	intervalMs := interval.Milliseconds()
+	if intervalMs <= 0 {
+		return nil, fmt.Errorf("invalid net flow interval: %s", interval)
+	}
+
+	query := `
+	SELECT (timestamp / ?) * ? AS bucket, SUM(amount), COUNT(*)
+	FROM (` + d.netFlowTrades() + `
+	)
+	GROUP BY bucket
+	ORDER BY bucket ASC`
+
+	rows, err := d.queryContext(ctx, query, intervalMs, intervalMs, currency, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []NetFlowPoint{}
+	for rows.Next() {
+		var p NetFlowPoint
+		if err := rows.Scan(&p.MTS, &p.NetAmount, &p.Trades); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
 // GetWSFundingTradesAfterID 獲取指定ID之後的交易（用於增量更新）
 func (d *Database) GetWSFundingTradesAfterID(currency string, lastID int64) ([]api.FundingTrade, error) {
 	query := `
 	SELECT trade_id, timestamp, amount, rate, period
-	FROM ws_funding_trades
+	FROM ` + d.readTable("ws_funding_trades") + `
 	WHERE currency = ? AND trade_id > ?
 	ORDER BY trade_id ASC`
 
-	rows, err := d.db.Query(query, currency, lastID)
+	rows, err := d.conn.Query(query, currency, lastID)
 	if err != nil {
 		return nil, err
 	}
@@ -827,3 +2242,62 @@ func (d *Database) GetWSFundingTradesAfterID(currency string, lastID int64) ([]a
 
 	return trades, rows.Err()
 }
+
+// TableCoverage is the time span and row count of a currency's rows in one table.
+// Earliest and Latest are nil when there are no rows.
+type TableCoverage struct {
+	Earliest *int64 `json:"earliest"`
+	Latest   *int64 `json:"latest"`
+	Count    int64  `json:"count"`
+}
+
+// DataCoverage is the stored time coverage of a currency
+type DataCoverage struct {
+	Currency        string        `json:"currency"`
+	FundingStats    TableCoverage `json:"funding_stats"`
+	WSFundingTrades TableCoverage `json:"ws_funding_trades"`
+	FundingBook     TableCoverage `json:"funding_book"`
+}
+
+// GetDataCoverage returns the earliest and latest timestamps and row counts stored for a currency
+func (d *Database) GetDataCoverage(currency string) (DataCoverage, error) {
+	return d.GetDataCoverageWithContext(context.Background(), currency)
+}
+
+// GetDataCoverageWithContext returns the earliest and latest timestamps and row counts stored for a currency using context
+func (d *Database) GetDataCoverageWithContext(ctx context.Context, currency string) (DataCoverage, error) {
+	coverage := DataCoverage{Currency: currency}
+
+	var err error
+	if coverage.FundingStats, err = d.tableCoverage(ctx, "funding_stats", "mts", currency); err != nil {
+		return DataCoverage{}, err
+	}
+	if coverage.WSFundingTrades, err = d.tableCoverage(ctx, d.readTable("ws_funding_trades"), "timestamp", currency); err != nil {
+		return DataCoverage{}, err
+	}
+	if coverage.FundingBook, err = d.tableCoverage(ctx, d.readTable("funding_book"), "timestamp", currency); err != nil {
+		return DataCoverage{}, err
+	}
+
+	return coverage, nil
+}
+
+// tableCoverage reads the coverage of a currency's rows in table, timed by column. The
+// (currency, column) index of each table lets this be answered from the index alone.
+func (d *Database) tableCoverage(ctx context.Context, table, column, currency string) (TableCoverage, error) {
+	var earliest, latest sql.NullInt64
+	var coverage TableCoverage
+	query := "SELECT MIN(" + column + "), MAX(" + column + "), COUNT(*) FROM " + table + " WHERE currency = ?"
+	if err := d.conn.QueryRowContext(ctx, query, currency).Scan(&earliest, &latest, &coverage.Count); err != nil {
+		requestid.Logf(ctx, "database query failed: %v", err)
+		return TableCoverage{}, err
+	}
+
+	if earliest.Valid {
+		coverage.Earliest = &earliest.Int64
+	}
+	if latest.Valid {
+		coverage.Latest = &latest.Int64
+	}
+	return coverage, nil
+}
@@ -0,0 +1,597 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/rates"
+)
+
+// saveTestTrades stores trades of currency as ftu updates
+func saveTestTrades(t *testing.T, d *Database, currency string, trades ...api.FundingTrade) {
+	t.Helper()
+
+	records := make([]WSFundingTradeRecord, len(trades))
+	for i, trade := range trades {
+		records[i] = WSFundingTradeRecord{Currency: currency, Trade: trade, MsgType: "ftu"}
+	}
+	if _, err := d.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+}
+
+func TestForEachWSFundingTradeStopsAtMaxID(t *testing.T) {
+	d := newTestDatabase(t)
+	saveTestTrades(t, d, "fUSD",
+		api.FundingTrade{ID: 1, MTS: 1000, Amount: 10, Rate: 0.0001, Period: 2},
+		api.FundingTrade{ID: 2, MTS: 2000, Amount: 10, Rate: 0.0002, Period: 2},
+	)
+	tradeRange, err := d.GetWSFundingTradeRangeWithContext(context.Background(), "fUSD")
+	if err != nil {
+		t.Fatalf("GetWSFundingTradeRangeWithContext: %v", err)
+	}
+
+	// Stored after the range was read
+	saveTestTrades(t, d, "fUSD", api.FundingTrade{ID: 3, MTS: 3000, Amount: 10, Rate: 0.0003, Period: 2})
+
+	var ids []int64
+	err = d.ForEachWSFundingTradeWithContext(context.Background(), "fUSD", tradeRange.MaxID, func(trade api.FundingTrade) error {
+		ids = append(ids, trade.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachWSFundingTradeWithContext: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("streamed trades %v, want [1 2]", ids)
+	}
+}
+
+func TestForEachWSFundingTradeStopsWhenCanceled(t *testing.T) {
+	d := newTestDatabase(t)
+	trades := make([]api.FundingTrade, 20)
+	for i := range trades {
+		trades[i] = api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: 0.0001, Period: 2}
+	}
+	saveTestTrades(t, d, "fUSD", trades...)
+
+	// The request goes away after five trades
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	streamed := 0
+	err := d.ForEachWSFundingTradeWithContext(ctx, "fUSD", 20, func(trade api.FundingTrade) error {
+		streamed++
+		if streamed == 5 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ForEachWSFundingTradeWithContext = %v, want context.Canceled", err)
+	}
+	if streamed != 5 {
+		t.Errorf("streamed %d trades, want the stream to stop after 5", streamed)
+	}
+}
+
+func TestGetWSFundingTradesFromReturnsEachTradeOnce(t *testing.T) {
+	d := newTestDatabase(t)
+
+	// Streamed trades are stored as both "fte" and "ftu" with the same trade ID and timestamp
+	var records []WSFundingTradeRecord
+	for id := int64(1); id <= 4; id++ {
+		trade := api.FundingTrade{ID: id, MTS: 1000, Amount: 10, Rate: 0.0001, Period: 2}
+		records = append(records,
+			WSFundingTradeRecord{Currency: "fUSD", Trade: trade, MsgType: "fte"},
+			WSFundingTradeRecord{Currency: "fUSD", Trade: trade, MsgType: "ftu"},
+		)
+	}
+	if _, err := d.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+
+	var ids []int64
+	afterMTS, afterID := int64(0), int64(math.MinInt64)
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("paging did not end")
+		}
+		trades, err := d.GetWSFundingTradesFromWithContext(context.Background(), "fUSD", afterMTS, afterID, 2000, 3)
+		if err != nil {
+			t.Fatalf("GetWSFundingTradesFromWithContext: %v", err)
+		}
+		for _, trade := range trades {
+			ids = append(ids, trade.ID)
+		}
+		if len(trades) < 3 {
+			break
+		}
+		last := trades[len(trades)-1]
+		afterMTS, afterID = last.MTS, last.ID
+	}
+
+	if len(ids) != 4 {
+		t.Fatalf("paged trades %v, want each of 1-4 once", ids)
+	}
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Fatalf("paged trades %v, want [1 2 3 4]", ids)
+		}
+	}
+}
+
+func TestGetFundingBookSummaryHistoryOrderedAndSummed(t *testing.T) {
+	d := newTestDatabase(t)
+	for i, mts := range []int64{3000, 1000, 2000} {
+		levels := []api.FundingBook{
+			{Rate: 0.0001, Period: 2, Count: 1, Amount: -float64(10 * (i + 1))}, // Bid
+			{Rate: 0.0002, Period: 2, Count: 1, Amount: -5},                     // Bid
+			{Rate: 0.0003, Period: 2, Count: 1, Amount: float64(100 * (i + 1))}, // Ask
+		}
+		for _, level := range levels {
+			if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, mts, level); err != nil {
+				t.Fatalf("SaveFundingBookAt: %v", err)
+			}
+		}
+	}
+
+	points, err := d.GetFundingBookSummaryHistory("fUSD", 2)
+	if err != nil {
+		t.Fatalf("GetFundingBookSummaryHistory: %v", err)
+	}
+
+	// The latest two snapshots, oldest first
+	want := []BookDepthPoint{
+		{MTS: 2000, TotalBid: 35, TotalAsk: 300},
+		{MTS: 3000, TotalBid: 15, TotalAsk: 100},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("got %d points, want %d: %+v", len(points), len(want), points)
+	}
+	for i := range want {
+		if points[i] != want[i] {
+			t.Errorf("point %d = %+v, want %+v", i, points[i], want[i])
+		}
+	}
+}
+
+func TestGetLatestFundingStatsWithoutStats(t *testing.T) {
+	d := newTestDatabase(t)
+
+	_, err := d.GetLatestFundingStats("fUSD")
+	if !errors.Is(err, ErrNoFundingStats) {
+		t.Fatalf("err = %v, want ErrNoFundingStats", err)
+	}
+	// Callers matching sql.ErrNoRows keep working
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("err = %v does not wrap sql.ErrNoRows", err)
+	}
+}
+
+func TestGetLatestFundingStatsReturnsNewestRow(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, stats := range []api.FundingStats{
+		{MTS: 2000, FRR: 0.0000006, FRRRaw: 0.0000006, AveragePeriod: 3.5, FundingAmount: 2000, FundingAmountUsed: 1500, FundingBelowThreshold: 20},
+		{MTS: 1000, FRR: 0.0000004, FRRRaw: 0.0000004, AveragePeriod: 2, FundingAmount: 1000, FundingAmountUsed: 500, FundingBelowThreshold: 10},
+		{MTS: 3000, Period: 30, FRR: 0.0000009, FRRRaw: 0.0000009, FundingAmount: 9000}, // Other period
+	} {
+		if _, err := d.SaveFundingStats("fUSD", stats); err != nil {
+			t.Fatalf("SaveFundingStats: %v", err)
+		}
+	}
+	if _, err := d.SaveFundingStats("fBTC", api.FundingStats{MTS: 5000, FRR: 0.000001, FRRRaw: 0.000001}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+
+	got, err := d.GetLatestFundingStats("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestFundingStats: %v", err)
+	}
+	want := api.FundingStats{
+		MTS:                   2000,
+		FRR:                   0.0000006,
+		FRRRaw:                0.0000006,
+		FRRAPR:                rates.StatsFRRToAPR(0.0000006),
+		AveragePeriod:         3.5,
+		FundingAmount:         2000,
+		FundingAmountUsed:     1500,
+		FundingBelowThreshold: 20,
+	}
+	if got != want {
+		t.Errorf("GetLatestFundingStats = %+v, want %+v", got, want)
+	}
+}
+
+func TestFundingStatsRawAndAPRFRR(t *testing.T) {
+	d := newTestDatabase(t)
+	const raw = 0.00000055
+	if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: 1000, FRR: raw, FRRRaw: raw, FundingAmount: 100}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+
+	got, err := d.GetLatestFundingStats("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestFundingStats: %v", err)
+	}
+	if got.FRR != raw || got.FRRRaw != raw {
+		t.Errorf("FRR = %v, FRRRaw = %v, want both the raw %v", got.FRR, got.FRRRaw, raw)
+	}
+
+	// Raw stats FRR is 1/365th of the daily rate, annualized over 365 days by default
+	factor := float64(rates.StatsFRRDays * rates.DefaultAnnualizationDays)
+	if want := raw * factor; math.Abs(got.FRRAPR-want) > 1e-15 {
+		t.Errorf("FRRAPR = %v, want FRR * %v = %v", got.FRRAPR, factor, want)
+	}
+}
+
+func TestMissingFRRStoredAsNull(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, stats := range []api.FundingStats{
+		{MTS: 1000, FRR: 0.0000004, FRRRaw: 0.0000004, FundingAmount: 100},
+		{MTS: 2000, FRR: 0.0000006, FRRRaw: 0.0000006, FundingAmount: 100},
+		{MTS: 3000, FRRMissing: true, FundingAmount: 100},
+	} {
+		if _, err := d.SaveFundingStats("fUSD", stats); err != nil {
+			t.Fatalf("SaveFundingStats: %v", err)
+		}
+	}
+
+	var nulls int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM funding_stats WHERE frr IS NULL`).Scan(&nulls); err != nil {
+		t.Fatalf("failed to count NULL FRRs: %v", err)
+	}
+	if nulls != 1 {
+		t.Fatalf("%d rows with a NULL FRR, want 1", nulls)
+	}
+
+	latest, err := d.GetLatestFundingStats("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestFundingStats: %v", err)
+	}
+	if !latest.FRRMissing || latest.FRR != 0 {
+		t.Errorf("latest row FRR = %v, FRRMissing = %v, want a missing FRR", latest.FRR, latest.FRRMissing)
+	}
+
+	// The row without an FRR does not pull the minimum or average down
+	agg, err := d.GetFundingStatsBetweenWithAggregates("fUSD", 0, 5000)
+	if err != nil {
+		t.Fatalf("GetFundingStatsBetweenWithAggregates: %v", err)
+	}
+	if agg.Count != 3 || agg.MinFRR != 0.0000004 || math.Abs(agg.AvgFRR-0.0000005) > 1e-15 || agg.LatestFRR != 0.0000006 {
+		t.Errorf("aggregates %+v, want 3 rows with min 4e-7, avg 5e-7 and latest 6e-7", agg)
+	}
+}
+
+func TestSaveFundingTickerWithinOneSecond(t *testing.T) {
+	d := newTestDatabase(t)
+
+	for i := 0; i < 3; i++ {
+		ticker := api.FundingTicker{FRR: 0.0001, Bid: 0.0002, Ask: 0.0003, FRRAmountAvailable: float64(i)}
+		if _, err := d.SaveFundingTicker("fUSD", ticker); err != nil {
+			t.Fatalf("SaveFundingTicker %d: %v", i, err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if n := countRows(t, d, "funding_ticker"); n != 3 {
+		t.Fatalf("%d funding_ticker rows, want 3", n)
+	}
+
+	var distinct int
+	if err := d.db.QueryRow(`SELECT COUNT(DISTINCT timestamp) FROM funding_ticker`).Scan(&distinct); err != nil {
+		t.Fatalf("failed to count timestamps: %v", err)
+	}
+	if distinct != 3 {
+		t.Errorf("%d distinct timestamps, want millisecond timestamps for each of the 3 tickers", distinct)
+	}
+}
+
+func TestGetFundingStatsResampledReturnsLastRowPerBucket(t *testing.T) {
+	d := newTestDatabase(t)
+	hour := time.Hour.Milliseconds()
+	for _, stats := range []api.FundingStats{
+		{MTS: 1, FRR: 0.0000001},
+		{MTS: 10 * 60 * 1000, FRR: 0.0000002}, // Near-duplicate in the first hour
+		{MTS: 50 * 60 * 1000, FRR: 0.0000003},
+		// No rows in the second hour
+		{MTS: 2*hour + 5*60*1000, FRR: 0.0000004},
+		{MTS: 3 * hour, FRR: 0.0000005},
+		{MTS: 3*hour + 1, FRR: 0.0000006},
+		{MTS: 3*hour + 2, Period: 30, FRR: 0.0000009}, // Other period
+		{MTS: 5 * hour, FRR: 0.0000007},               // After end
+	} {
+		if _, err := d.SaveFundingStats("fUSD", stats); err != nil {
+			t.Fatalf("SaveFundingStats: %v", err)
+		}
+	}
+
+	got, err := d.GetFundingStatsResampled("fUSD", 0, 4*hour, time.Hour)
+	if err != nil {
+		t.Fatalf("GetFundingStatsResampled: %v", err)
+	}
+	want := []struct {
+		mts int64
+		frr float64
+	}{
+		{50 * 60 * 1000, 0.0000003},
+		{2*hour + 5*60*1000, 0.0000004},
+		{3*hour + 1, 0.0000006},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows %+v, want one per non-empty bucket: %+v", len(got), got, want)
+	}
+	for i, w := range want {
+		if got[i].MTS != w.mts || got[i].FRR != w.frr || got[i].Period != 0 {
+			t.Errorf("bucket %d = MTS %d FRR %v period %d, want MTS %d FRR %v period 0", i, got[i].MTS, got[i].FRR, got[i].Period, w.mts, w.frr)
+		}
+	}
+
+	if _, err := d.GetFundingStatsResampled("fUSD", 0, 4*hour, 0); err == nil {
+		t.Error("zero interval accepted, want an error")
+	}
+}
+
+func TestBelowThresholdRatioStoredPerRow(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, stats := range []api.FundingStats{
+		{MTS: 1000, FundingAmount: 1000, FundingBelowThreshold: 250},
+		{MTS: 2000, FundingAmount: 0, FundingBelowThreshold: 50}, // No funding, no ratio
+		{MTS: 3000, FundingAmount: 400, FundingBelowThreshold: 100},
+	} {
+		if _, err := d.SaveFundingStats("fUSD", stats); err != nil {
+			t.Fatalf("SaveFundingStats: %v", err)
+		}
+	}
+
+	var stored []sql.NullFloat64
+	rows, err := d.db.Query(`SELECT below_threshold_ratio FROM funding_stats ORDER BY mts`)
+	if err != nil {
+		t.Fatalf("failed to query ratios: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ratio sql.NullFloat64
+		if err := rows.Scan(&ratio); err != nil {
+			t.Fatalf("failed to scan ratio: %v", err)
+		}
+		stored = append(stored, ratio)
+	}
+	if len(stored) != 3 || stored[0] != (sql.NullFloat64{Float64: 0.25, Valid: true}) || stored[1].Valid ||
+		stored[2] != (sql.NullFloat64{Float64: 0.25, Valid: true}) {
+		t.Fatalf("stored ratios = %+v, want 0.25, NULL, 0.25", stored)
+	}
+
+	points, err := d.GetBelowThresholdRatios("fUSD", math.MaxInt64, 10)
+	if err != nil {
+		t.Fatalf("GetBelowThresholdRatios: %v", err)
+	}
+	if len(points) != 3 || points[0].MTS != 3000 || points[0].Ratio == nil || *points[0].Ratio != 0.25 ||
+		points[1].MTS != 2000 || points[1].Ratio != nil || points[2].MTS != 1000 {
+		t.Errorf("GetBelowThresholdRatios = %+v, want the 3 rows newest first with a nil ratio without funding", points)
+	}
+}
+
+func TestGetLatestRawFundingBookSidesPartitionsAndOrders(t *testing.T) {
+	d := newTestDatabase(t)
+
+	// An older snapshot that must not be returned
+	if _, err := d.SaveRawFundingBookAt("fUSD", 1000, api.RawFundingBook{OfferID: 99, Period: 2, Rate: 0.0009, Amount: -10}); err != nil {
+		t.Fatalf("SaveRawFundingBookAt: %v", err)
+	}
+	for _, book := range []api.RawFundingBook{
+		{OfferID: 1, Period: 2, Rate: 0.0001, Amount: -100},
+		{OfferID: 2, Period: 30, Rate: 0.0003, Amount: 200},
+		{OfferID: 3, Period: 2, Rate: 0.0002, Amount: -50},
+		{OfferID: 4, Period: 7, Rate: 0.0004, Amount: 300},
+		{OfferID: 5, Period: 2, Rate: 0.0002, Amount: -25},
+		{OfferID: 6, Period: 2, Rate: 0.00025, Amount: 75},
+	} {
+		if _, err := d.SaveRawFundingBookAt("fUSD", 2000, book); err != nil {
+			t.Fatalf("SaveRawFundingBookAt: %v", err)
+		}
+	}
+
+	bids, asks, err := d.GetLatestRawFundingBookSides("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestRawFundingBookSides: %v", err)
+	}
+
+	// Best bid (highest rate) and best ask (lowest rate) first, ties by offer ID
+	wantBids := []int{3, 5, 1}
+	wantAsks := []int{6, 2, 4}
+	if len(bids) != len(wantBids) || len(asks) != len(wantAsks) {
+		t.Fatalf("got %d bids %+v and %d asks %+v, want %d and %d", len(bids), bids, len(asks), asks, len(wantBids), len(wantAsks))
+	}
+	for i, id := range wantBids {
+		if bids[i].OfferID != id || bids[i].Amount >= 0 {
+			t.Errorf("bid %d = %+v, want offer %d with a negative amount", i, bids[i], id)
+		}
+	}
+	for i, id := range wantAsks {
+		if asks[i].OfferID != id || asks[i].Amount <= 0 {
+			t.Errorf("ask %d = %+v, want offer %d with a positive amount", i, asks[i], id)
+		}
+	}
+	if bids[0].Rate != 0.0002 || bids[0].Period != 2 || asks[0].Rate != 0.00025 {
+		t.Errorf("best bid %+v and ask %+v, want rates 0.0002 and 0.00025", bids[0], asks[0])
+	}
+
+	if _, _, err := d.GetLatestRawFundingBookSides("fUST"); err == nil {
+		t.Error("no error for a currency without a raw funding book")
+	}
+}
+
+func TestSaveFundingTickerIfChangedSkipsUnchanged(t *testing.T) {
+	d := newTestDatabase(t)
+	const epsilon = 1e-8
+	base := api.FundingTicker{FRR: 0.0001, Bid: 0.0002, Ask: 0.0003, Volume: 1000}
+
+	steps := []struct {
+		name     string
+		currency string
+		ticker   api.FundingTicker
+		maxGap   time.Duration
+		want     bool
+	}{
+		{"first ticker", "fUSD", base, 0, true},
+		{"unchanged", "fUSD", base, 0, false},
+		{"within epsilon, other fields changed", "fUSD", api.FundingTicker{FRR: 0.0001 + 1e-10, Bid: 0.0002, Ask: 0.0003, Volume: 5000}, 0, false},
+		{"bid changed", "fUSD", api.FundingTicker{FRR: 0.0001, Bid: 0.00021, Ask: 0.0003}, 0, true},
+		{"other currency", "fUST", base, 0, true},
+		{"unchanged but older than the gap", "fUST", base, time.Millisecond, true},
+	}
+	for _, step := range steps {
+		// Tickers are stored per millisecond
+		time.Sleep(5 * time.Millisecond)
+
+		stored, err := d.SaveFundingTickerIfChangedOrStale(step.currency, step.ticker, epsilon, step.maxGap)
+		if err != nil {
+			t.Fatalf("%s: SaveFundingTickerIfChangedOrStale: %v", step.name, err)
+		}
+		if stored != step.want {
+			t.Errorf("%s: stored = %v, want %v", step.name, stored, step.want)
+		}
+	}
+
+	if n := countRows(t, d, "funding_ticker"); n != 4 {
+		t.Errorf("funding_ticker has %d rows, want 4", n)
+	}
+	latest, err := d.GetLatestFundingTicker("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestFundingTicker: %v", err)
+	}
+	if latest.Bid != 0.00021 {
+		t.Errorf("latest fUSD ticker = %+v, want the changed bid", latest)
+	}
+}
+
+func TestGetFundingBookAtTimestampExactAndNearest(t *testing.T) {
+	d := newTestDatabase(t)
+
+	// Snapshots at 1000, 2000 and 3000 told apart by their bid rate, plus a P1 snapshot at 2500
+	for i, mts := range []int64{1000, 2000, 3000} {
+		rate := float64(i+1) * 0.0001
+		for _, book := range []api.FundingBook{
+			{Rate: rate, Period: 2, Count: 1, Amount: -100},
+			{Rate: rate + 0.00005, Period: 2, Count: 1, Amount: -50},
+			{Rate: rate * 2, Period: 30, Count: 1, Amount: 200},
+		} {
+			if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, mts, book); err != nil {
+				t.Fatalf("SaveFundingBookAt: %v", err)
+			}
+		}
+	}
+	if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP1, 2500, api.FundingBook{Rate: 0.0009, Period: 2, Count: 1, Amount: -1}); err != nil {
+		t.Fatalf("SaveFundingBookAt: %v", err)
+	}
+
+	for _, tt := range []struct {
+		mts, want int64
+		bid       float64
+	}{
+		{2000, 2000, 0.00025}, // Exact
+		{2999, 2000, 0.00025}, // Nearest before, ignoring the P1 snapshot at 2500
+		{5000, 3000, 0.00035}, // After the latest
+		{1000, 1000, 0.00015},
+	} {
+		snapshot, err := d.GetFundingBookAtTimestamp("fUSD", tt.mts)
+		if err != nil {
+			t.Fatalf("GetFundingBookAtTimestamp(%d): %v", tt.mts, err)
+		}
+		if snapshot.Timestamp != tt.want || len(snapshot.Books) != 3 {
+			t.Errorf("at %d: snapshot %d with %d levels, want %d with 3", tt.mts, snapshot.Timestamp, len(snapshot.Books), tt.want)
+			continue
+		}
+		// Bids first, best rate first
+		if got := snapshot.Books[0]; got.Amount >= 0 || math.Abs(got.Rate-tt.bid) > 1e-12 {
+			t.Errorf("at %d: first level %+v, want the best bid at %v", tt.mts, got, tt.bid)
+		}
+	}
+
+	if _, err := d.GetFundingBookAtTimestamp("fUSD", 999); !errors.Is(err, ErrNoFundingBook) {
+		t.Errorf("before the first snapshot: err = %v, want ErrNoFundingBook", err)
+	}
+	if _, err := d.GetFundingBookAtTimestamp("fUST", 5000); !errors.Is(err, ErrNoFundingBook) {
+		t.Errorf("other currency: err = %v, want ErrNoFundingBook", err)
+	}
+}
+
+func TestFundingBookSnapshotSharesOneTimestamp(t *testing.T) {
+	d := newTestDatabase(t)
+
+	// A snapshot large enough to straddle a clock tick when each row is stamped on insert
+	mts := time.Now().UnixMilli()
+	for i := 0; i < 500; i++ {
+		rate := 0.0001 + float64(i)*0.000001
+		if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, mts, api.FundingBook{Rate: rate, Period: 2, Count: 1, Amount: 100}); err != nil {
+			t.Fatalf("SaveFundingBookAt: %v", err)
+		}
+		if _, err := d.SaveRawFundingBookAt("fUSD", mts, api.RawFundingBook{OfferID: i + 1, Period: 2, Rate: rate, Amount: 100}); err != nil {
+			t.Fatalf("SaveRawFundingBookAt: %v", err)
+		}
+	}
+
+	for _, table := range []string{"funding_book", "raw_funding_book"} {
+		var timestamps int
+		var stored int64
+		if err := d.db.QueryRow("SELECT COUNT(DISTINCT timestamp), MAX(timestamp) FROM "+table).Scan(&timestamps, &stored); err != nil {
+			t.Fatalf("failed to read %s timestamps: %v", table, err)
+		}
+		if timestamps != 1 || stored != mts {
+			t.Errorf("%s rows have %d timestamps up to %d, want all at %d", table, timestamps, stored, mts)
+		}
+	}
+
+	// The latest book is the whole snapshot, not a fragment
+	books, err := d.GetLatestFundingBook("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestFundingBook: %v", err)
+	}
+	raw, err := d.GetLatestRawFundingBook("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestRawFundingBook: %v", err)
+	}
+	if len(books) != 500 || len(raw) != 500 {
+		t.Errorf("latest books have %d aggregated and %d raw rows, want 500 each", len(books), len(raw))
+	}
+
+	if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, 0, api.FundingBook{Rate: 0.0001}); err == nil {
+		t.Error("SaveFundingBookAt with timestamp 0 succeeded, want an error")
+	}
+	if _, err := d.SaveRawFundingBookAt("fUSD", -1, api.RawFundingBook{OfferID: 1}); err == nil {
+		t.Error("SaveRawFundingBookAt with a negative timestamp succeeded, want an error")
+	}
+}
+
+func TestNotFoundErrorsMatchSentinels(t *testing.T) {
+	d := newTestDatabase(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		read func() error
+		want error
+	}{
+		{"GetLatestFundingStats", func() error { _, err := d.GetLatestFundingStats("fUSD"); return err }, ErrNoFundingStats},
+		{"GetLatestTradingTicker", func() error { _, err := d.GetLatestTradingTicker("tBTCUSD"); return err }, ErrNoTicker},
+		{"GetLatestFundingTicker", func() error { _, err := d.GetLatestFundingTicker("fUSD"); return err }, ErrNoTicker},
+		{"GetLatestFundingBook", func() error { _, err := d.GetLatestFundingBook("fUSD"); return err }, ErrNoFundingBook},
+		{"GetLatestFundingBookByPrecisionWithContext", func() error {
+			_, err := d.GetLatestFundingBookByPrecisionWithContext(ctx, "fUSD", api.PrecisionP1)
+			return err
+		}, ErrNoFundingBook},
+		{"GetLatestRawFundingBook", func() error { _, err := d.GetLatestRawFundingBook("fUSD"); return err }, ErrNoFundingBook},
+		{"GetLatestRawFundingBookSides", func() error { _, _, err := d.GetLatestRawFundingBookSides("fUSD"); return err }, ErrNoFundingBook},
+	}
+	for _, tt := range tests {
+		err := tt.read()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want it to wrap %v", tt.name, err, tt.want)
+		}
+	}
+}
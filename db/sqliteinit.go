@@ -1,18 +1,103 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync/atomic"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
-// InitDB initializes the database connection and creates necessary tables
+// Options holds SQLite tuning pragmas applied to every pooled connection.
+//
+// Memory implications: the page cache is allocated per connection, so the worst case
+// is CacheSize multiplied by the number of open connections. Memory-mapped I/O does not
+// allocate heap memory but maps up to MmapSize bytes of the file into the address space,
+// backed by the OS page cache. TempStore=MEMORY keeps temporary tables and sort spills
+// in RAM, which speeds up large ORDER BY / GROUP BY queries at the cost of memory.
+type Options struct {
+	CacheSize int    // PRAGMA cache_size; negative values are KiB, positive values are pages
+	MmapSize  int64  // PRAGMA mmap_size in bytes, 0 disables memory-mapped I/O
+	TempStore string // PRAGMA temp_store: DEFAULT, FILE or MEMORY
+}
+
+// DefaultOptions returns pragmas tuned for read-heavy workloads over large historical tables
+func DefaultOptions() Options {
+	return Options{
+		CacheSize: -64000,    // 64 MiB per connection
+		MmapSize:  256 << 20, // 256 MiB
+		TempStore: "MEMORY",
+	}
+}
+
+// pragmas builds the PRAGMA statements for the options
+func (o Options) pragmas() ([]string, error) {
+	pragmas := []string{
+		fmt.Sprintf("PRAGMA cache_size = %d", o.CacheSize),
+		fmt.Sprintf("PRAGMA mmap_size = %d", o.MmapSize),
+	}
+
+	if o.TempStore != "" {
+		tempStore := strings.ToUpper(o.TempStore)
+		switch tempStore {
+		case "DEFAULT", "FILE", "MEMORY":
+			pragmas = append(pragmas, "PRAGMA temp_store = "+tempStore)
+		default:
+			return nil, fmt.Errorf("invalid temp_store value: %s", o.TempStore)
+		}
+	}
+
+	return pragmas, nil
+}
+
+// pragmaConnector opens SQLite connections that run the configured pragmas on connect
+type pragmaConnector struct {
+	driver *sqlite3.SQLiteDriver
+	dsn    string
+}
+
+// Connect implements driver.Connector
+func (c *pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver implements driver.Connector
+func (c *pragmaConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// memoryDBCounter gives each in-memory database a unique name
+var memoryDBCounter int64
+
+// InitDB initializes the database connection with the default options and creates necessary tables
 func InitDB(dataSourceName string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dataSourceName)
+	return InitDBWithOptions(dataSourceName, DefaultOptions())
+}
+
+// InitDBWithOptions initializes the database connection, applying the given pragmas to every connection
+func InitDBWithOptions(dataSourceName string, options Options) (*sql.DB, error) {
+	pragmas, err := options.pragmas()
 	if err != nil {
 		return nil, err
 	}
 
+	db := sql.OpenDB(&pragmaConnector{
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, pragma := range pragmas {
+					if _, err := conn.Exec(pragma, nil); err != nil {
+						return fmt.Errorf("failed to apply %q: %v", pragma, err)
+					}
+				}
+				return nil
+			},
+		},
+		dsn: dataSourceName,
+	})
+
 	// Ensure connection is available
 	if err = db.Ping(); err != nil {
 		return nil, err
@@ -26,6 +111,22 @@ func InitDB(dataSourceName string) (*sql.DB, error) {
 	return db, nil
 }
 
+// NewInMemoryDatabase creates a Database backed by a private in-memory SQLite database.
+// A shared cache is used so every pooled connection sees the same data; the data is
+// discarded once the database is closed. Intended for tests.
+func NewInMemoryDatabase() (*Database, error) {
+	name := fmt.Sprintf("file:memdb%d?mode=memory&cache=shared", atomic.AddInt64(&memoryDBCounter, 1))
+
+	sqlDB, err := InitDB(name)
+	if err != nil {
+		return nil, err
+	}
+
+	database := NewDatabase(sqlDB)
+	database.inMemory = true
+	return database, nil
+}
+
 // CreateTables creates the database schema
 func CreateTables(db *sql.DB) error {
 	createTableSQL := `
@@ -39,8 +140,9 @@ func CreateTables(db *sql.DB) error {
 		funding_amount REAL,
 		funding_amount_used REAL,
 		funding_below_threshold REAL,
+		period INTEGER NOT NULL DEFAULT 0,
 		created_at INTEGER NOT NULL DEFAULT (strftime('%s','now') * 1000),
-		UNIQUE(currency, mts)
+		UNIQUE(currency, period, mts)
 	);
 	CREATE INDEX IF NOT EXISTS idx_funding_stats_currency_mts ON funding_stats(currency, mts);
 	
@@ -155,7 +257,11 @@ func CreateTables(db *sql.DB) error {
 		created_at INTEGER NOT NULL DEFAULT (strftime('%s','now') * 1000),
 		UNIQUE(trade_id, msg_type)
 	);
-	CREATE INDEX IF NOT EXISTS idx_ws_funding_trades_currency_timestamp ON ws_funding_trades(currency, timestamp);
+	-- Covering index so historical range queries (currency, timestamp range, ORDER BY timestamp DESC)
+	-- are answered from the index alone; it replaces the narrower idx_ws_funding_trades_currency_timestamp
+	DROP INDEX IF EXISTS idx_ws_funding_trades_currency_timestamp;
+	CREATE INDEX IF NOT EXISTS idx_ws_funding_trades_currency_timestamp_covering
+		ON ws_funding_trades(currency, timestamp, trade_id, amount, rate, period);
 	CREATE INDEX IF NOT EXISTS idx_ws_funding_trades_trade_id ON ws_funding_trades(trade_id);
 	
 	-- Rate Distribution table
@@ -175,7 +281,56 @@ func CreateTables(db *sql.DB) error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_rate_distribution_currency ON rate_distribution(currency);
 	CREATE INDEX IF NOT EXISTS idx_rate_distribution_last_processed ON rate_distribution(last_processed_trade_id);
+
+	-- Rate Distribution snapshots, appended on each save when history is kept
+	CREATE TABLE IF NOT EXISTS rate_distribution_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		currency TEXT NOT NULL,
+		bin_count INTEGER NOT NULL,
+		min_rate REAL NOT NULL,
+		max_rate REAL NOT NULL,
+		bin_width REAL NOT NULL,
+		distribution TEXT NOT NULL, -- JSON array of bin counts
+		total_trades INTEGER NOT NULL,
+		last_processed_trade_id INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL DEFAULT (strftime('%s','now') * 1000)
+	);
+	CREATE INDEX IF NOT EXISTS idx_rate_distribution_history_lookup ON rate_distribution_history(currency, bin_count, created_at);
     `
-	_, err := db.Exec(createTableSQL)
-	return err
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	// Optional scaled integer copies of REAL rate columns, see SetScaledRates
+	if err := addScaledRateColumns(db); err != nil {
+		return err
+	}
+
+	if err := addBelowThresholdRatioColumn(db); err != nil {
+		return err
+	}
+
+	// Stats of different periods share timestamps, so the period is part of the unique key
+	if err := addFundingStatsPeriodColumn(db); err != nil {
+		return err
+	}
+
+	// Aggregation precision of funding_book rows; rows stored before it existed are P0
+	if _, err := addColumnIfMissing(db, "funding_book", "precision", "TEXT NOT NULL DEFAULT 'P0'"); err != nil {
+		return err
+	}
+
+	// Re-saving a book row of the same snapshot is ignored instead of duplicating it
+	if err := addBookUniqueIndexes(db); err != nil {
+		return err
+	}
+
+	// Annualization formula the APR bins of a rate distribution were built with, see rates.Annualization;
+	// distributions stored before it existed were annualized with 365 simple days
+	for _, table := range []string{"rate_distribution", "rate_distribution_history"} {
+		if _, err := addColumnIfMissing(db, table, "annualization", "TEXT NOT NULL DEFAULT 'daily_rate*365'"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
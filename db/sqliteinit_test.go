@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestInMemoryDatabaseSavesAndReadsFundingStats(t *testing.T) {
+	d, err := NewInMemoryDatabase()
+	if err != nil {
+		t.Fatalf("NewInMemoryDatabase: %v", err)
+	}
+	t.Cleanup(func() { d.db.Close() })
+
+	stats := api.FundingStats{MTS: 1700000000000, FRR: 0.0000005, FRRRaw: 0.0000005, AveragePeriod: 12.5, FundingAmount: 1000, FundingAmountUsed: 800}
+	if _, err := d.SaveFundingStats("fUSD", stats); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+
+	got, err := d.GetLatestFundingStats("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestFundingStats: %v", err)
+	}
+	if got.MTS != stats.MTS || got.FRRRaw != stats.FRRRaw || got.AveragePeriod != stats.AveragePeriod ||
+		got.FundingAmount != stats.FundingAmount || got.FundingAmountUsed != stats.FundingAmountUsed {
+		t.Errorf("read back %+v, want %+v", got, stats)
+	}
+
+	// Each in-memory database is separate
+	other, err := NewInMemoryDatabase()
+	if err != nil {
+		t.Fatalf("NewInMemoryDatabase: %v", err)
+	}
+	t.Cleanup(func() { other.db.Close() })
+	if _, err := other.GetLatestFundingStats("fUSD"); err == nil {
+		t.Error("a second in-memory database sees the stats of the first")
+	}
+}
+
+func TestInitDBAppliesPragmasToEveryConnection(t *testing.T) {
+	conn, err := InitDBWithOptions(filepath.Join(t.TempDir(), "test.db"), Options{CacheSize: -2000, MmapSize: 1 << 20, TempStore: "memory"})
+	if err != nil {
+		t.Fatalf("InitDBWithOptions: %v", err)
+	}
+	defer conn.Close()
+
+	// Hold several pooled connections at once so each one is checked
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		c, err := conn.Conn(ctx)
+		if err != nil {
+			t.Fatalf("failed to get connection %d: %v", i, err)
+		}
+		defer c.Close()
+
+		var cacheSize, mmapSize, tempStore int64
+		for pragma, dest := range map[string]*int64{"cache_size": &cacheSize, "mmap_size": &mmapSize, "temp_store": &tempStore} {
+			if err := c.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(dest); err != nil {
+				t.Fatalf("connection %d: PRAGMA %s: %v", i, pragma, err)
+			}
+		}
+		if cacheSize != -2000 || mmapSize != 1<<20 || tempStore != 2 {
+			t.Errorf("connection %d: cache_size = %d, mmap_size = %d, temp_store = %d, want -2000, %d and 2 (MEMORY)",
+				i, cacheSize, mmapSize, tempStore, 1<<20)
+		}
+	}
+
+	if _, err := InitDBWithOptions(filepath.Join(t.TempDir(), "bad.db"), Options{TempStore: "disk"}); err == nil {
+		t.Error("expected an error for an invalid temp_store")
+	}
+}
+
+// queryPlan returns the EXPLAIN QUERY PLAN details of query, one line per step
+func queryPlan(t *testing.T, d *Database, query string, args ...interface{}) string {
+	t.Helper()
+
+	rows, err := d.db.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		t.Fatalf("EXPLAIN QUERY PLAN failed: %v", err)
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatalf("failed to scan query plan: %v", err)
+		}
+		plan = append(plan, detail)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to read query plan: %v", err)
+	}
+	return strings.Join(plan, "\n")
+}
+
+func TestWSFundingTradeRangeQueriesUseCoveringIndex(t *testing.T) {
+	d := newTestDatabase(t)
+
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+	}{
+		{
+			"historical range",
+			`SELECT trade_id, timestamp, amount, rate, period
+			FROM ws_funding_trades
+			WHERE currency = ? AND timestamp BETWEEN ? AND ?
+			ORDER BY timestamp DESC
+			LIMIT ?`,
+			[]interface{}{"fUSD", 0, 1, 10},
+		},
+		{
+			"page before cursor",
+			`SELECT t.trade_id, t.timestamp, t.amount, t.rate, t.period
+			FROM ws_funding_trades t
+			WHERE t.currency = ?
+			  AND (t.timestamp < ? OR (t.timestamp = ? AND t.trade_id < ?))
+			ORDER BY t.timestamp DESC, t.trade_id DESC
+			LIMIT ?`,
+			[]interface{}{"fUSD", 1, 1, 1, 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := queryPlan(t, d, tt.query, tt.args...)
+			if !strings.Contains(plan, "USING COVERING INDEX idx_ws_funding_trades_currency_timestamp_covering") {
+				t.Errorf("query does not use the covering index, plan:\n%s", plan)
+			}
+			if strings.Contains(plan, "TEMP B-TREE") {
+				t.Errorf("query sorts in a temporary B-tree instead of reading the index in order, plan:\n%s", plan)
+			}
+		})
+	}
+}
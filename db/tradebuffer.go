@@ -0,0 +1,149 @@
+package db
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+// TradeBuffer accumulates WebSocket funding trades and saves them in batches, flushing
+// whenever batchSize trades are buffered or flushInterval has passed, whichever comes first.
+// Hold keeps trades in memory instead of saving them until Release. Close flushes the remaining trades.
+type TradeBuffer struct {
+	storage       Storage
+	batchSize     int
+	flushInterval time.Duration
+
+	// OnSaved, when set before trades are added, is called with the trades of each successful flush
+	OnSaved func(records []WSFundingTradeRecord)
+
+	mu      sync.Mutex
+	records []WSFundingTradeRecord
+	held    bool // Set by Hold, flushes leave the trades buffered
+
+	flushMu sync.Mutex // Serializes saves, so Hold can wait for one in progress
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewTradeBuffer creates a trade buffer and starts its periodic flush loop
+func NewTradeBuffer(storage Storage, batchSize int, flushInterval time.Duration) *TradeBuffer {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	b := &TradeBuffer{
+		storage:       storage,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		records:       make([]WSFundingTradeRecord, 0, batchSize),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go b.flushLoop()
+	return b
+}
+
+// Add buffers a trade, flushing the buffer once it holds batchSize trades
+func (b *TradeBuffer) Add(currency string, trade api.FundingTrade, msgType string) error {
+	b.mu.Lock()
+	b.records = append(b.records, WSFundingTradeRecord{
+		Currency: currency,
+		Trade:    trade,
+		MsgType:  msgType,
+	})
+	full := len(b.records) >= b.batchSize
+	b.mu.Unlock()
+
+	if full {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Flush saves all buffered trades in a single batch. It does nothing while the buffer is held.
+func (b *TradeBuffer) Flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	if b.held || len(b.records) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	records := b.records
+	b.records = make([]WSFundingTradeRecord, 0, b.batchSize)
+	b.mu.Unlock()
+
+	inserted, err := b.storage.SaveWSFundingTrades(records)
+	if err != nil {
+		// Put the trades back so they are retried on the next flush
+		b.mu.Lock()
+		b.records = append(records, b.records...)
+		b.mu.Unlock()
+		return err
+	}
+
+	log.Printf("Flushed %d funding trades (%d new)", len(records), inserted)
+	if b.OnSaved != nil {
+		b.OnSaved(records)
+	}
+	return nil
+}
+
+// Hold stops saving trades and waits for a save in progress to finish, so the database can be
+// maintained without concurrent trade writes. Trades added meanwhile stay buffered until Release.
+func (b *TradeBuffer) Hold() {
+	b.mu.Lock()
+	b.held = true
+	b.mu.Unlock()
+
+	b.flushMu.Lock()
+	b.flushMu.Unlock()
+}
+
+// Release lets trades be saved again after Hold and flushes the trades buffered meanwhile
+func (b *TradeBuffer) Release() error {
+	b.mu.Lock()
+	b.held = false
+	b.mu.Unlock()
+
+	return b.Flush()
+}
+
+// flushLoop flushes the buffer every flushInterval until the buffer is closed
+func (b *TradeBuffer) flushLoop() {
+	defer close(b.done)
+
+	if b.flushInterval <= 0 {
+		<-b.stop
+		return
+	}
+
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(); err != nil {
+				log.Printf("Failed to flush funding trades: %v", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Close stops the flush loop and saves any remaining trades, releasing a held buffer
+func (b *TradeBuffer) Close() error {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+	<-b.done
+	return b.Release()
+}
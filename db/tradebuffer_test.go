@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestTradeBufferHoldKeepsTradesUntilRelease(t *testing.T) {
+	d := newTestDatabase(t)
+	b := NewTradeBuffer(d, 1, 0)
+	defer b.Close()
+
+	b.Hold()
+	// A full batch would normally be saved right away
+	if err := b.Add("fUSD", api.FundingTrade{ID: 1, MTS: 1000, Amount: 10, Rate: 0.0001, Period: 2}, "ftu"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n := countRows(t, d, "ws_funding_trades"); n != 0 {
+		t.Fatalf("%d trades saved while held, want 0", n)
+	}
+
+	if err := b.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if n := countRows(t, d, "ws_funding_trades"); n != 1 {
+		t.Fatalf("%d trades saved after Release, want 1", n)
+	}
+}
+
+// countingStorage counts the SaveWSFundingTrades calls, one transaction each, of the wrapped Storage
+type countingStorage struct {
+	Storage
+	saves int
+}
+
+func (s *countingStorage) SaveWSFundingTrades(records []WSFundingTradeRecord) (int, error) {
+	s.saves++
+	return s.Storage.SaveWSFundingTrades(records)
+}
+
+func TestTradeBufferBatchesTrades(t *testing.T) {
+	tests := []struct {
+		batchSize int
+		wantSaves int
+	}{
+		{1, 25},
+		{10, 3}, // Two full batches and the remainder flushed by Close
+		{100, 1},
+	}
+	for _, tt := range tests {
+		d := newTestDatabase(t)
+		storage := &countingStorage{Storage: d}
+		b := NewTradeBuffer(storage, tt.batchSize, 0)
+
+		for id := int64(1); id <= 25; id++ {
+			if err := b.Add("fUSD", api.FundingTrade{ID: id, MTS: 1000 + id, Amount: 10, Rate: 0.0001, Period: 2}, "ftu"); err != nil {
+				t.Fatalf("batch size %d: Add: %v", tt.batchSize, err)
+			}
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("batch size %d: Close: %v", tt.batchSize, err)
+		}
+
+		if storage.saves != tt.wantSaves {
+			t.Errorf("batch size %d: %d transactions, want %d", tt.batchSize, storage.saves, tt.wantSaves)
+		}
+		if n := countRows(t, d, "ws_funding_trades"); n != 25 {
+			t.Errorf("batch size %d: %d trades saved, want all 25", tt.batchSize, n)
+		}
+	}
+}
+
+func TestTradeBufferFlushesOnInterval(t *testing.T) {
+	d := newTestDatabase(t)
+	b := NewTradeBuffer(d, 100, 10*time.Millisecond)
+	defer b.Close()
+
+	if err := b.Add("fUSD", api.FundingTrade{ID: 1, MTS: 1000, Amount: 10, Rate: 0.0001, Period: 2}, "ftu"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for countRows(t, d, "ws_funding_trades") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("a partial batch was not flushed by the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotInMemory is returned by TruncateAll for databases not created by NewInMemoryDatabase
+var ErrNotInMemory = errors.New("TruncateAll is only allowed on databases created by NewInMemoryDatabase")
+
+// TruncateAll deletes every row of every table and resets AUTOINCREMENT sequences, leaving the schema
+// in place. It is a destructive helper for tests sharing one database between cases and refuses to
+// run on anything but an in-memory database created by NewInMemoryDatabase.
+func (d *Database) TruncateAll() error {
+	if !d.inMemory {
+		return ErrNotInMemory
+	}
+
+	rows, err := d.conn.Query(`
+	SELECT name FROM sqlite_master
+	WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return d.WithTx(func(txStorage Storage) error {
+		tx := txStorage.(*Database)
+		for _, table := range tables {
+			if _, err := tx.conn.Exec(fmt.Sprintf("DELETE FROM %q", table)); err != nil {
+				return fmt.Errorf("failed to truncate %s: %v", table, err)
+			}
+		}
+
+		// sqlite_sequence only exists once an AUTOINCREMENT table has had a row
+		var sequences int
+		if err := tx.conn.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'
+		`).Scan(&sequences); err != nil {
+			return err
+		}
+		if sequences > 0 {
+			if _, err := tx.conn.Exec("DELETE FROM sqlite_sequence"); err != nil {
+				return fmt.Errorf("failed to reset autoincrement sequences: %v", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestTruncateAllEmptiesEveryTable(t *testing.T) {
+	d, err := NewInMemoryDatabase()
+	if err != nil {
+		t.Fatalf("NewInMemoryDatabase: %v", err)
+	}
+	t.Cleanup(func() { d.db.Close() })
+
+	if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: 1000, FRR: 0.0000004, FundingAmount: 100}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+	if _, err := d.SaveFundingTicker("fUSD", api.FundingTicker{FRR: 0.0001, Bid: 0.0002, Ask: 0.0003}); err != nil {
+		t.Fatalf("SaveFundingTicker: %v", err)
+	}
+	if _, err := d.SaveFundingBook("fUSD", api.FundingBook{Rate: 0.0002, Period: 2, Count: 1, Amount: 100}); err != nil {
+		t.Fatalf("SaveFundingBook: %v", err)
+	}
+	if _, err := d.SaveRawFundingBookAt("fUSD", 1000, api.RawFundingBook{OfferID: 1, Period: 2, Rate: 0.0002, Amount: 100}); err != nil {
+		t.Fatalf("SaveRawFundingBookAt: %v", err)
+	}
+	if _, err := d.SaveWSFundingTrade("fUSD", api.FundingTrade{ID: 1, MTS: 1000, Amount: 100, Rate: 0.0002, Period: 2}, "ftu"); err != nil {
+		t.Fatalf("SaveWSFundingTrade: %v", err)
+	}
+
+	if err := d.TruncateAll(); err != nil {
+		t.Fatalf("TruncateAll: %v", err)
+	}
+
+	rows, err := d.db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("failed to scan table name: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	for _, table := range append(tables, "sqlite_sequence") {
+		if n := countRows(t, d, table); n != 0 {
+			t.Errorf("%s has %d rows after TruncateAll, want 0", table, n)
+		}
+	}
+
+	if _, err := d.GetLatestFundingStats("fUSD"); !errors.Is(err, ErrNoFundingStats) {
+		t.Errorf("GetLatestFundingStats error = %v, want ErrNoFundingStats", err)
+	}
+	if _, err := d.GetLatestFundingTicker("fUSD"); !errors.Is(err, ErrNoTicker) {
+		t.Errorf("GetLatestFundingTicker error = %v, want ErrNoTicker", err)
+	}
+	if _, err := d.GetLatestFundingBook("fUSD"); !errors.Is(err, ErrNoFundingBook) {
+		t.Errorf("GetLatestFundingBook error = %v, want ErrNoFundingBook", err)
+	}
+	if _, err := d.GetLatestRawFundingBook("fUSD"); !errors.Is(err, ErrNoFundingBook) {
+		t.Errorf("GetLatestRawFundingBook error = %v, want ErrNoFundingBook", err)
+	}
+	if trades, err := d.GetLatestWSFundingTrades("fUSD", 10); err != nil || len(trades) != 0 {
+		t.Errorf("GetLatestWSFundingTrades = %+v, %v, want no trades", trades, err)
+	}
+
+	// Sequences restart, so IDs are the same as in a new database
+	id, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: 2000, FRR: 0.0000004, FundingAmount: 100})
+	if err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+	if id != 1 {
+		t.Errorf("first ID after TruncateAll = %d, want 1", id)
+	}
+}
+
+func TestTruncateAllRefusesFileDatabases(t *testing.T) {
+	d := newTestDatabase(t)
+	if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: 1000, FundingAmount: 100}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+
+	if err := d.TruncateAll(); !errors.Is(err, ErrNotInMemory) {
+		t.Fatalf("TruncateAll error = %v, want ErrNotInMemory", err)
+	}
+	if n := countRows(t, d, "funding_stats"); n != 1 {
+		t.Errorf("funding_stats has %d rows, want the row kept", n)
+	}
+}
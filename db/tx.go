@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx, so Database methods run the same
+// statements whether or not they are inside a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+var (
+	_ execer = (*sql.DB)(nil)
+	_ execer = (*sql.Tx)(nil)
+)
+
+// WithTx runs fn inside a transaction, passing a Storage bound to it. The transaction is committed
+// when fn returns nil and rolled back when it returns an error or panics. Calling WithTx on the
+// Storage passed to fn runs the nested callback in the same transaction.
+func (d *Database) WithTx(fn func(txStorage Storage) error) error {
+	if _, inTx := d.conn.(*sql.Tx); inTx {
+		return fn(d)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	txDatabase := &Database{
+		db:          d.db,
+		conn:        tx,
+		scaledRates: d.scaledRates,
+		inMemory:    d.inMemory,
+		shards:      d.shards,
+	}
+
+	if err := fn(txDatabase); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
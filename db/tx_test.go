@@ -0,0 +1,55 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+// saveSnapshot stores a book level, its stats and a trade through s
+func saveSnapshot(s Storage) error {
+	if _, err := s.SaveFundingBookAt("fUSD", api.PrecisionP0, 1000, api.FundingBook{Rate: 0.0001, Period: 2, Count: 1, Amount: 50}); err != nil {
+		return err
+	}
+	if _, err := s.SaveFundingStats("fUSD", api.FundingStats{MTS: 1000, FRR: 0.0000005, FundingAmount: 100}); err != nil {
+		return err
+	}
+	_, err := s.SaveWSFundingTrades([]WSFundingTradeRecord{{Currency: "fUSD", Trade: api.FundingTrade{ID: 1, MTS: 1000, Amount: 10, Rate: 0.0001, Period: 2}, MsgType: "ftu"}})
+	return err
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	d := newTestDatabase(t)
+	fail := errors.New("summary failed")
+
+	err := d.WithTx(func(tx Storage) error {
+		if err := saveSnapshot(tx); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Fatalf("WithTx = %v, want the callback's error", err)
+	}
+
+	for _, table := range []string{"funding_book", "funding_stats", "ws_funding_trades"} {
+		if n := countRows(t, d, table); n != 0 {
+			t.Errorf("%s has %d rows after rollback, want 0", table, n)
+		}
+	}
+}
+
+func TestWithTxCommits(t *testing.T) {
+	d := newTestDatabase(t)
+
+	if err := d.WithTx(saveSnapshot); err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	for _, table := range []string{"funding_book", "funding_stats", "ws_funding_trades"} {
+		if n := countRows(t, d, table); n != 1 {
+			t.Errorf("%s has %d rows after commit, want 1", table, n)
+		}
+	}
+}
@@ -2,9 +2,9 @@ module github.com/gary0122g/BitfinexFundingData
 
 go 1.22.6
 
-require github.com/mattn/go-sqlite3 v1.14.28
-
 require (
-	github.com/gorilla/mux v1.8.1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/sync v0.10.0
 )
@@ -3,89 +3,135 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/buildinfo"
 	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/rates"
 	"github.com/gary0122g/BitfinexFundingData/scheduler"
 	"github.com/gary0122g/BitfinexFundingData/server"
+	"github.com/gary0122g/BitfinexFundingData/service"
 	"github.com/gary0122g/BitfinexFundingData/task"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// handleWebSocketData handles WebSocket data in a separate goroutine
-func handleWebSocketData(ctx context.Context, database *db.Database) {
-	// Create new WebSocket client
-	wsClient := api.NewWebSocketClient()
+// defaultDistributionBins is the bin count of the rate distribution kept up to date in the background,
+// matching the default used by the rate distribution API
+const defaultDistributionBins = 20
 
+// handleWebSocketData handles WebSocket data in a separate goroutine, connecting wsClient and subscribing to
+// the configured channels of each currency. Trades are stored through tradeBuffer, which is closed on return.
+// Live books are stored on their snapshot and then at most every bookInterval.
+func handleWebSocketData(ctx context.Context, wsClient *api.WebSocketClient, database db.Storage, channels map[string][]string, tradeBuffer *db.TradeBuffer, bookInterval time.Duration) {
 	// Connect to Bitfinex WebSocket
-	if err := wsClient.Connect(); err != nil {
+	if err := wsClient.ConnectWithContext(ctx); err != nil {
 		log.Printf("Failed to connect to Bitfinex WebSocket: %v", err)
+		tradeBuffer.Close()
 		return
 	}
 	defer wsClient.Close()
 
-	// Subscribe to fUSD funding trades
-	if err := wsClient.SubscribeToFundingTrades("fUSD"); err != nil {
-		log.Printf("Failed to subscribe to funding trades: %v", err)
-		return
+	// Subscribe to the configured channels of each currency
+	for _, currency := range sortedKeys(channels) {
+		for _, channel := range channels[currency] {
+			if err := wsClient.SubscribeToChannel(channel, currency); err != nil {
+				log.Printf("Failed to subscribe to %s %s: %v", currency, channel, err)
+				tradeBuffer.Close()
+				return
+			}
+		}
 	}
 
+	// Store tickers as they arrive
+	wsClient.HandleFundingTickers(func(currency string, ticker api.FundingTicker) error {
+		if _, err := database.SaveFundingTicker(currency, ticker); err != nil {
+			return fmt.Errorf("failed to save streamed FundingTicker for %s: %v", currency, err)
+		}
+		return nil
+	})
+
+	// Maintain live books and store them as P0 snapshots
+	books := make(map[string]*service.LiveFundingBook)
+	lastBookSave := make(map[string]time.Time)
+	wsClient.HandleFundingBook(func(currency string, updates []api.FundingBook, snapshot bool) error {
+		book, ok := books[currency]
+		if !ok {
+			book = service.NewLiveFundingBook()
+			books[currency] = book
+		}
+		book.Apply(updates, snapshot)
+
+		if !snapshot && time.Since(lastBookSave[currency]) < bookInterval {
+			return nil
+		}
+		lastBookSave[currency] = time.Now()
+		// All levels of a snapshot share one timestamp so the latest snapshot is read back whole
+		mts := lastBookSave[currency].UnixMilli()
+		for _, level := range book.Levels() {
+			if _, err := database.SaveFundingBookAt(currency, api.PrecisionP0, mts, level); err != nil {
+				return fmt.Errorf("failed to save streamed FundingBook for %s: %v", currency, err)
+			}
+		}
+		return nil
+	})
+
 	// Handle incoming messages
-	wsClient.HandleFundingTrades(func(trade api.FundingTrade, msgType string) error {
-		// Store trade in database
-		_, err := database.SaveWSFundingTrade("fUSD", trade, msgType)
-		if err != nil {
-			log.Printf("Failed to store trade: %v", err)
+	wsClient.HandleFundingTradesWithSymbol(func(currency string, trade api.FundingTrade, msgType string) error {
+		if currency == "" {
+			return fmt.Errorf("received trade %d on an unknown channel", trade.ID)
+		}
+
+		if err := tradeBuffer.Add(currency, trade, msgType); err != nil {
+			log.Printf("Failed to store trades: %v", err)
 			return err
 		}
-		log.Printf("Stored funding trade: %+v", trade)
 		return nil
 	})
 
 	// Wait for context cancellation
 	<-ctx.Done()
 	log.Println("WebSocket handler shutting down...")
+
+	// Stop receiving trades before the final flush so nothing is left in the buffer
+	wsClient.Close()
+	if dropped := wsClient.DroppedFrames(); dropped > 0 {
+		log.Printf("WebSocket sequence gaps dropped %d frames during this session", dropped)
+	}
+	if err := tradeBuffer.Close(); err != nil {
+		log.Printf("Failed to flush remaining trades: %v", err)
+	}
 }
 
-// Get initial FundingStats data
-func fetchInitialFundingStats(ctx context.Context, client *api.Client, database *db.Database, currency string) error {
+// Get initial FundingStats data going back window, paging through the stats history
+func fetchInitialFundingStats(ctx context.Context, client *api.Client, database db.Storage, currency string, period int, window time.Duration) error {
 	// Check if data already exists
-	stats, err := database.GetFundingStats(currency, 1)
-	if err != nil && err != sql.ErrNoRows {
+	_, err := database.GetLatestFundingStatsForPeriod(currency, period)
+	if err != nil && !errors.Is(err, db.ErrNoFundingStats) {
 		return fmt.Errorf("failed to check database: %v", err)
 	}
 
 	// If data already exists, no need to get initial data
-	if len(stats) > 0 {
-		log.Printf("FundingStats records for %s already exist in database, skipping initial data collection", currency)
+	if err == nil {
+		log.Printf("FundingStats records for %s period %d already exist in database, skipping initial data collection", currency, period)
 		return nil
 	}
 
-	// Create result channel
-	resultChan := make(chan task.FundingStatsResult, 1)
-
-	// Create and execute task to get initial 250 records
-	statsTask := task.NewGetFundingStatsTask(client, currency, 250, resultChan, 3)
-	if err := statsTask.Execute(ctx); err != nil {
-		return fmt.Errorf("failed to execute initial data collection task: %v", err)
-	}
-
-	// Get result
-	result := <-resultChan
-	if result.Error != nil {
-		return fmt.Errorf("failed to get initial data: %v", result.Error)
-	}
+	start := time.Now().Add(-window).UnixMilli()
+	stats, fetchErr := client.GetFundingStatsHistoryWithContext(ctx, currency, start, 0, period)
 
-	// Save to database
+	// Save to database, including the pages fetched before a failure
 	count := 0
-	for _, stat := range result.Data {
+	for _, stat := range stats {
 		_, err := database.SaveFundingStats(currency, stat)
 		if err != nil {
 			log.Printf("failed to save FundingStats data: %v", err)
@@ -93,22 +139,24 @@ func fetchInitialFundingStats(ctx context.Context, client *api.Client, database
 		}
 		count++
 	}
+	if fetchErr != nil {
+		return fmt.Errorf("failed to get initial data after saving %d records: %v", count, fetchErr)
+	}
 
-	log.Printf("Successfully retrieved and saved %d initial FundingStats records for %s", count, currency)
+	log.Printf("Successfully retrieved and saved %d initial FundingStats records for %s period %d", count, currency, period)
 	return nil
 }
 
-// Update FundingStats data
-func updateFundingStats(ctx context.Context, client *api.Client, database *db.Database, currency string) error {
+// Update FundingStats data of a period, 0 for the stats over all periods
+func updateFundingStats(ctx context.Context, client *api.Client, database db.Storage, currency string, period int, belowThresholdAlert float64, publish func(string, api.FundingStats)) error {
 	// Get latest data
-	latestStats, err := database.GetFundingStats(currency, 1)
-	if err != nil {
-		return fmt.Errorf("failed to get latest data: %v", err)
-	}
-
 	var latestMts int64 = 0
-	if len(latestStats) > 0 {
-		latestMts = latestStats[0].MTS
+	latestStats, err := database.GetLatestFundingStatsForPeriod(currency, period)
+	switch {
+	case err == nil:
+		latestMts = latestStats.MTS
+	case !errors.Is(err, db.ErrNoFundingStats):
+		return fmt.Errorf("failed to get latest data: %v", err)
 	}
 
 	// Create result channel
@@ -124,6 +172,7 @@ func updateFundingStats(ctx context.Context, client *api.Client, database *db.Da
 		resultChan,
 		3,
 	)
+	statsTask.Period = period
 
 	if err := statsTask.Execute(ctx); err != nil {
 		return fmt.Errorf("failed to execute data retrieval task: %v", err)
@@ -144,26 +193,34 @@ func updateFundingStats(ctx context.Context, client *api.Client, database *db.Da
 			continue
 		}
 		count++
+		// Stream subscribers follow the stats over all periods
+		if period == 0 {
+			publish(currency, stat)
+		}
+
+		if ratio, ok := db.BelowThresholdRatio(stat); ok && belowThresholdAlert > 0 && ratio >= belowThresholdAlert {
+			log.Printf("ALERT: %s below-threshold funding ratio %.4f reached alert level %.4f", currency, ratio, belowThresholdAlert)
+		}
 	}
 
 	if count > 0 {
-		log.Printf("Successfully retrieved and saved %d new FundingStats records for %s", count, currency)
+		log.Printf("Successfully retrieved and saved %d new FundingStats records for %s period %d", count, currency, period)
 	} else {
-		log.Printf("No new FundingStats data for %s", currency)
+		log.Printf("No new FundingStats data for %s period %d", currency, period)
 	}
 
 	return nil
 }
 
 // Get initial FundingTicker data
-func fetchInitialFundingTicker(ctx context.Context, client *api.Client, database *db.Database, currency string) error {
+func fetchInitialFundingTicker(ctx context.Context, client *api.Client, database db.Storage, currency string) error {
 	// Check if data already exists
 	_, err := database.GetLatestFundingTicker(currency)
 	if err == nil {
 		// Data already exists
 		log.Printf("FundingTicker records for %s already exist in database, skipping initial data collection", currency)
 		return nil
-	} else if err.Error() != "no ticker found for currency: "+currency && err != sql.ErrNoRows {
+	} else if !errors.Is(err, db.ErrNoTicker) && !errors.Is(err, sql.ErrNoRows) {
 		// Other error occurred
 		return fmt.Errorf("failed to check database: %v", err)
 	}
@@ -193,8 +250,47 @@ func fetchInitialFundingTicker(ctx context.Context, client *api.Client, database
 	return nil
 }
 
-// Update FundingTicker data
-func updateFundingTicker(ctx context.Context, client *api.Client, database *db.Database, currency string) error {
+// tradeBackfillMsgType is stored as the message type of seeded trades; the REST history lists executed
+// trades, so like streamed "ftu" updates a trade already received over the WebSocket is not stored twice
+const tradeBackfillMsgType = "ftu"
+
+// Seed stored WebSocket funding trades from the REST trades history, oldest first, from the newest stored
+// trade or from window ago, whichever is later, so the rate distribution does not wait for live trades
+func fetchInitialFundingTrades(ctx context.Context, client *api.Client, database db.Storage, currency string, window time.Duration) error {
+	end := time.Now().UnixMilli()
+	start := end - window.Milliseconds()
+
+	latest, err := database.GetLatestWSFundingTrades(currency, 1)
+	if err != nil {
+		return fmt.Errorf("failed to check database: %v", err)
+	}
+	if len(latest) > 0 && latest[0].MTS > start {
+		start = latest[0].MTS
+	}
+
+	// Trades of the newest stored millisecond are fetched again and skipped on save
+	trades, fetchErr := client.GetFundingTradesHistoryWithContext(ctx, currency, start, end, api.SortAscending)
+
+	// Save the pages fetched before a failure as well
+	records := make([]db.WSFundingTradeRecord, len(trades))
+	for i, trade := range trades {
+		records[i] = db.WSFundingTradeRecord{Currency: currency, Trade: trade, MsgType: tradeBackfillMsgType}
+	}
+	saved, err := database.SaveWSFundingTrades(records)
+	if err != nil {
+		return fmt.Errorf("failed to save funding trades: %v", err)
+	}
+	if fetchErr != nil {
+		return fmt.Errorf("failed to get funding trades after saving %d: %v", saved, fetchErr)
+	}
+
+	log.Printf("Successfully backfilled %d funding trades for %s", saved, currency)
+	return nil
+}
+
+// Update FundingTicker data. With changedOnly a ticker whose FRR, bid and ask are within changeEpsilon of the
+// latest stored ticker is not stored again, unless the latest stored ticker is older than heartbeat.
+func updateFundingTicker(ctx context.Context, client *api.Client, database db.Storage, currency string, changedOnly bool, changeEpsilon float64, heartbeat time.Duration) error {
 	// Create result channel
 	resultChan := make(chan task.FundingTickerResult, 1)
 
@@ -210,8 +306,16 @@ func updateFundingTicker(ctx context.Context, client *api.Client, database *db.D
 		return fmt.Errorf("failed to get data: %v", result.Error)
 	}
 	// Save to database
-	_, err := database.SaveFundingTicker(currency, *result.Data)
-	if err != nil {
+	if changedOnly {
+		stored, err := database.SaveFundingTickerIfChangedOrStale(currency, *result.Data, changeEpsilon, heartbeat)
+		if err != nil {
+			return fmt.Errorf("failed to save data: %v", err)
+		}
+		if !stored {
+			log.Printf("FundingTicker for %s unchanged, not stored", currency)
+			return nil
+		}
+	} else if _, err := database.SaveFundingTicker(currency, *result.Data); err != nil {
 		return fmt.Errorf("failed to save data: %v", err)
 	}
 
@@ -220,17 +324,18 @@ func updateFundingTicker(ctx context.Context, client *api.Client, database *db.D
 }
 
 // Get initial FundingBook data
-func fetchInitialFundingBook(ctx context.Context, client *api.Client, database *db.Database, currency string) error {
+func fetchInitialFundingBook(ctx context.Context, client *api.Client, database db.Storage, currency string) error {
 	// Get raw funding book
 	rawBooks, err := client.GetRawFundingBookWithContext(ctx, currency)
 	if err != nil {
 		return fmt.Errorf("failed to get raw funding book: %v", err)
 	}
 
-	// Save raw funding book data
+	// Save raw funding book data under one snapshot timestamp
 	rawCount := 0
+	rawMTS := time.Now().UnixMilli()
 	for _, rawBook := range rawBooks {
-		_, err := database.SaveRawFundingBook(currency, rawBook)
+		_, err := database.SaveRawFundingBookAt(currency, rawMTS, rawBook)
 		if err != nil {
 			log.Printf("failed to save RawFundingBook data: %v", err)
 			continue
@@ -245,10 +350,11 @@ func fetchInitialFundingBook(ctx context.Context, client *api.Client, database *
 		return fmt.Errorf("failed to get aggregated funding book: %v", err)
 	}
 
-	// Save aggregated funding book data
+	// Save aggregated funding book data under one snapshot timestamp
 	bookCount := 0
+	bookMTS := time.Now().UnixMilli()
 	for _, book := range books {
-		_, err := database.SaveFundingBook(currency, book)
+		_, err := database.SaveFundingBookAt(currency, api.PrecisionP0, bookMTS, book)
 		if err != nil {
 			log.Printf("failed to save FundingBook data: %v", err)
 			continue
@@ -260,18 +366,19 @@ func fetchInitialFundingBook(ctx context.Context, client *api.Client, database *
 	return nil
 }
 
-// Update FundingBook data
-func updateFundingBook(ctx context.Context, client *api.Client, database *db.Database, currency string) error {
+// Update raw FundingBook data
+func updateRawFundingBook(ctx context.Context, client *api.Client, database db.Storage, currency string) error {
 	// Get raw funding book
 	rawBooks, err := client.GetRawFundingBookWithContext(ctx, currency)
 	if err != nil {
 		return fmt.Errorf("failed to get raw funding book: %v", err)
 	}
 
-	// Save raw funding book data
+	// Save raw funding book data under one snapshot timestamp
 	rawCount := 0
+	rawMTS := time.Now().UnixMilli()
 	for _, rawBook := range rawBooks {
-		_, err := database.SaveRawFundingBook(currency, rawBook)
+		_, err := database.SaveRawFundingBookAt(currency, rawMTS, rawBook)
 		if err != nil {
 			log.Printf("failed to save RawFundingBook data: %v", err)
 			continue
@@ -280,28 +387,370 @@ func updateFundingBook(ctx context.Context, client *api.Client, database *db.Dat
 	}
 	log.Printf("Successfully retrieved and saved %d latest raw funding book records for %s", rawCount, currency)
 
-	// Get aggregated funding book (P0 Precision)
-	books, err := client.GetFundingBookWithContext(ctx, currency, api.PrecisionP0)
-	if err != nil {
-		return fmt.Errorf("failed to get aggregated funding book: %v", err)
+	return nil
+}
+
+// fetchInitialData fetches initial stats going back statsBackfill, ticker and book data for each currency,
+// at most concurrency currencies at a time, and seeds the funding trades of the tradeCurrencies among them
+// going back up to tradeBackfill (0 disables either backfill); a failing fetch is logged and does not stop
+// the others. Each fetch is cancelled after timeout so a stuck request cannot hold up startup, 0 disables
+// the timeout.
+func fetchInitialData(ctx context.Context, client *api.Client, database db.Storage, currencies []string, concurrency int, timeout time.Duration, statsBackfill time.Duration, statsPeriods []int, tradeCurrencies []string, tradeBackfill time.Duration) {
+	if concurrency <= 0 {
+		concurrency = 1
 	}
 
-	// Save aggregated funding book data
-	bookCount := 0
-	for _, book := range books {
-		_, err := database.SaveFundingBook(currency, book)
+	start := time.Now()
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, currency := range currencies {
+		currency := currency // Create local copy for use in closures
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			fetch := func(fetchData func(context.Context, *api.Client, db.Storage, string) error) error {
+				fetchCtx := ctx
+				if timeout > 0 {
+					var cancel context.CancelFunc
+					fetchCtx, cancel = context.WithTimeout(ctx, timeout)
+					defer cancel()
+				}
+				err := fetchData(fetchCtx, client, database, currency)
+				if err != nil && ctx.Err() == nil && fetchCtx.Err() == context.DeadlineExceeded {
+					return fmt.Errorf("timed out after %s: %v", timeout, err)
+				}
+				return err
+			}
+
+			// Get initial FundingStats data of each period
+			for _, period := range statsPeriods {
+				if statsBackfill <= 0 {
+					break
+				}
+				err := fetch(func(ctx context.Context, client *api.Client, database db.Storage, currency string) error {
+					return fetchInitialFundingStats(ctx, client, database, currency, period, statsBackfill)
+				})
+				if err != nil {
+					log.Printf("Failed to get initial FundingStats data for %s period %d: %v", currency, period, err)
+				}
+			}
+
+			// Get initial FundingTicker data
+			if err := fetch(fetchInitialFundingTicker); err != nil {
+				log.Printf("Failed to get initial FundingTicker data for %s: %v", currency, err)
+			}
+
+			// Get initial FundingBook data
+			if err := fetch(fetchInitialFundingBook); err != nil {
+				log.Printf("Failed to get initial FundingBook data for %s: %v", currency, err)
+			}
+
+			// Seed streamed funding trades from the REST history
+			if tradeBackfill > 0 && containsString(tradeCurrencies, currency) {
+				err := fetch(func(ctx context.Context, client *api.Client, database db.Storage, currency string) error {
+					return fetchInitialFundingTrades(ctx, client, database, currency, tradeBackfill)
+				})
+				if err != nil {
+					log.Printf("Failed to backfill funding trades for %s: %v", currency, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	log.Printf("Initial data for %d currencies fetched in %s", len(currencies), time.Since(start).Round(time.Millisecond))
+}
+
+// Update aggregated FundingBook data for each configured precision
+func updateAggregatedFundingBook(ctx context.Context, client *api.Client, database db.Storage, currency string, precisions []api.BookPrecision, depthAlert *service.DepthDropDetector) error {
+	for _, precision := range precisions {
+		// Get aggregated funding book
+		books, err := client.GetFundingBookWithContext(ctx, currency, precision)
 		if err != nil {
-			log.Printf("failed to save FundingBook data: %v", err)
-			continue
+			return fmt.Errorf("failed to get %s aggregated funding book: %v", precision, err)
+		}
+
+		// Save aggregated funding book data tagged with its precision under one snapshot timestamp
+		bookCount := 0
+		mts := time.Now().UnixMilli()
+		for _, book := range books {
+			_, err := database.SaveFundingBookAt(currency, precision, mts, book)
+			if err != nil {
+				log.Printf("failed to save FundingBook data: %v", err)
+				continue
+			}
+			bookCount++
+		}
+		log.Printf("Successfully retrieved and saved %d latest %s aggregated funding book records for %s", bookCount, precision, currency)
+
+		// Depth alerts compare P0 snapshots only, other precisions aggregate the same offers
+		if depthAlert != nil && precision == api.PrecisionP0 {
+			if drop, ok := depthAlert.Observe(currency, service.LendDepth(books)); ok {
+				log.Printf("ALERT: %s lend depth %.2f dropped %.2f%% below its trailing average %.2f (alert level %.2f%%)",
+					currency, drop.Depth, drop.DropPercent, drop.TrailingAvg, drop.ThresholdDrop)
+			}
 		}
-		bookCount++
 	}
-	log.Printf("Successfully retrieved and saved %d latest aggregated funding book records for %s", bookCount, currency)
 
 	return nil
 }
 
+// collectors are the functions run by the periodic collection tasks of a currency
+type collectors struct {
+	stats          func(ctx context.Context, currency string, period int) error
+	ticker         func(ctx context.Context, currency string) error
+	rawBook        func(ctx context.Context, currency string) error
+	aggregatedBook func(ctx context.Context, currency string, precisions []api.BookPrecision) error
+}
+
+// scheduleCollectionTasks creates the periodic collection tasks of every configured currency,
+// each running at the interval configured for its currency and kind of data
+func scheduleCollectionTasks(ctx context.Context, s *scheduler.Scheduler, config collectionConfig, collect collectors) {
+	for _, currency := range config.Currencies {
+		currency := currency // Create local copy for use in closures
+		intervals := config.intervalsFor(currency)
+		precisions := config.precisionsFor(currency)
+
+		// Create a FundingStats task per period, the one over all periods keeps its original name
+		for _, period := range config.statsPeriods() {
+			period := period
+			name := fmt.Sprintf("FundingStats_%s", currency)
+			if period != 0 {
+				name = fmt.Sprintf("FundingStats_%s_p%d", currency, period)
+			}
+			statsTask := s.NewPeriodicTask(
+				name,
+				intervals.Stats,
+				func(ctx context.Context) error {
+					return collect.stats(ctx, currency, period)
+				},
+				3, // Number of retries
+			)
+			s.ScheduleWithDelay(ctx, statsTask, statsTask.StartupOffset())
+			log.Printf("Set up FundingStats data collection task for %s period %d every %s", currency, period, intervals.Stats)
+		}
+
+		// Create FundingTicker task
+		tickerTask := s.NewPeriodicTask(
+			fmt.Sprintf("FundingTicker_%s", currency),
+			intervals.Ticker,
+			func(ctx context.Context) error {
+				return collect.ticker(ctx, currency)
+			},
+			3, // Number of retries
+		)
+		s.ScheduleWithDelay(ctx, tickerTask, tickerTask.StartupOffset())
+		log.Printf("Set up FundingTicker data collection task for %s every %s", currency, intervals.Ticker)
+
+		// Create raw FundingBook task
+		rawBookTask := s.NewPeriodicTask(
+			fmt.Sprintf("RawFundingBook_%s", currency),
+			intervals.RawBook,
+			func(ctx context.Context) error {
+				return collect.rawBook(ctx, currency)
+			},
+			3, // Number of retries
+		)
+		s.ScheduleWithDelay(ctx, rawBookTask, rawBookTask.StartupOffset())
+		log.Printf("Set up raw FundingBook data collection task for %s every %s", currency, intervals.RawBook)
+
+		// Create aggregated FundingBook task
+		bookTask := s.NewPeriodicTask(
+			fmt.Sprintf("FundingBook_%s", currency),
+			intervals.AggregatedBook,
+			func(ctx context.Context) error {
+				return collect.aggregatedBook(ctx, currency, precisions)
+			},
+			3, // Number of retries
+		)
+		s.ScheduleWithDelay(ctx, bookTask, bookTask.StartupOffset())
+		log.Printf("Set up aggregated FundingBook data collection task for %s (%v) every %s", currency, precisions, intervals.AggregatedBook)
+	}
+}
+
 func main() {
+	staticDir := flag.String("static-dir", "", "Serve web assets from this directory instead of the embedded copy (for development)")
+	maxResponseItems := flag.Int("max-response-items", 10000, "Maximum number of items returned by a single list API response")
+	defaultDBOptions := db.DefaultOptions()
+	sqliteCacheSize := flag.Int("sqlite-cache-size", defaultDBOptions.CacheSize, "SQLite cache_size pragma per connection (negative values are KiB)")
+	sqliteMmapSize := flag.Int64("sqlite-mmap-size", defaultDBOptions.MmapSize, "SQLite mmap_size pragma in bytes (0 disables memory-mapped I/O)")
+	sqliteTempStore := flag.String("sqlite-temp-store", defaultDBOptions.TempStore, "SQLite temp_store pragma: DEFAULT, FILE or MEMORY")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	httpReadTimeout := flag.Duration("http-read-timeout", 15*time.Second, "Maximum duration for reading an entire API request")
+	httpWriteTimeout := flag.Duration("http-write-timeout", 30*time.Second, "Maximum duration before timing out writes of an API response")
+	httpIdleTimeout := flag.Duration("http-idle-timeout", 60*time.Second, "Maximum time to wait for the next request on a keep-alive connection")
+	streamEvictTimeout := flag.Duration("stream-evict-timeout", time.Minute, "Disconnect a streaming API client that has not kept up with events or writes for this long (negative never disconnects)")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "Bearer token required by admin API endpoints (defaults to $ADMIN_TOKEN, admin endpoints are disabled when empty)")
+	scaledRates := flag.Bool("scaled-rates", false, "Also store book and trade rates as integers scaled by 1e12 in rate_scaled columns for exact comparisons")
+	shardMonthly := flag.Bool("shard-monthly", false, "Write funding trades and book snapshots into one table per month, read through *_all views")
+	aprDays := flag.Int("apr-days", rates.DefaultAnnualizationDays, "Days per year used to annualize daily funding rates into APR")
+	frrScalingFlag := flag.String("frr-scaling", string(server.FRRScalingAPR), "Value of the frr field of funding stats responses: apr (annual rate per -apr-days/-apr-compound), legacy (frr_raw*365*365) or raw")
+	frrRegimeSlope := flag.Float64("frr-regime-slope", service.DefaultRegimeThresholds.SlopePerDay, "Minimum FRR trend, in APR percentage points per day, that /api/frr-regime reports as rising or falling")
+	frrRegimeConfidence := flag.Float64("frr-regime-confidence", service.DefaultRegimeThresholds.MinConfidence, "Minimum R² (0-1) of the FRR trend fit for /api/frr-regime to report rising or falling")
+	aprCompound := flag.Bool("apr-compound", false, "Annualize daily funding rates with daily compounding, (1+daily)^days-1, instead of daily*days")
+	belowThresholdAlert := flag.Float64("below-threshold-alert", 0, "Log an alert when a new funding stats row's below-threshold / total funding ratio reaches this value (0 disables)")
+	depthDropAlert := flag.Float64("depth-drop-alert", 0, "Log an alert when P0 funding book lend depth drops this many percent below its trailing average (0 disables)")
+	depthDropWindow := flag.Int("depth-drop-window", 6, "Number of previous funding book snapshots averaged by -depth-drop-alert")
+	skipInitialFetch := flag.Bool("skip-initial-fetch", false, "Skip fetching initial data at startup and rely on the periodic tasks")
+	initialFetchConcurrency := flag.Int("initial-fetch-concurrency", 2, "Number of currencies whose initial data is fetched concurrently at startup")
+	initialFetchTimeout := flag.Duration("initial-fetch-timeout", 30*time.Second, "Maximum duration of each initial stats, ticker, book or trade backfill fetch before it is logged and skipped (0 disables)")
+	statsPeriods := flag.String("stats-periods", "", "Comma-separated offer periods in days (2-120), e.g. 2,30, whose funding stats are collected besides the stats over all periods")
+	statsBackfill := flag.Duration("stats-backfill", 7*24*time.Hour, "At startup, fetch the funding stats history going back this far for currencies without stored stats (0 disables)")
+	tradeBackfill := flag.Duration("trade-backfill", 24*time.Hour, "At startup, seed the stored funding trades of streamed currencies from the REST trade history going back this far (0 disables)")
+	apiRateLimit := flag.Int("api-rate-limit", api.DefaultRequestsPerMinute, "Maximum Bitfinex REST requests per minute (0 disables limiting)")
+	apiRateBurst := flag.Int("api-rate-burst", api.DefaultRateBurst, "Bitfinex REST requests allowed at once before -api-rate-limit spacing starts")
+	apiRateLimitPerFamily := flag.Bool("api-rate-limit-per-family", true, "Apply -api-rate-limit to each endpoint family (book, ticker, funding stats) separately instead of to all requests together")
+	dryRun := flag.Bool("dry-run", false, "Log collected data instead of writing it to the database")
+	currenciesFlag := flag.String("currencies", "fUSD,fUST", "Comma-separated list of funding currencies to collect")
+	statsInterval := flag.Duration("stats-interval", 1*time.Hour, "Default funding stats collection interval")
+	tickerInterval := flag.Duration("ticker-interval", 1*time.Minute, "Default funding ticker collection interval")
+	tickerPersist := flag.String("ticker-persist", "every", "Funding ticker persistence mode: every stores each polled ticker, changed skips tickers whose FRR, bid and ask did not change")
+	tickerChangeEpsilon := flag.Float64("ticker-change-epsilon", 0, "Largest FRR, bid or ask difference treated as unchanged by -ticker-persist=changed")
+	tickerHeartbeat := flag.Duration("ticker-heartbeat", 0, "With -ticker-persist=changed, store an unchanged funding ticker anyway once the latest stored one is older than this (0 disables)")
+	rawBookInterval := flag.Duration("raw-book-interval", 1*time.Minute, "Default raw funding book collection interval")
+	aggregatedBookInterval := flag.Duration("aggregated-book-interval", 1*time.Minute, "Default aggregated funding book collection interval")
+	wsCurrenciesFlag := flag.String("ws-currencies", "", "Comma-separated funding currencies to stream trades for over WebSocket (defaults to -currencies, \"none\" disables)")
+	wsChannelsFlag := flag.String("ws-channels", "", "Per-currency WebSocket channels, e.g. fUSD=trades|ticker|book,fUST=trades (currencies not listed stream trades only)")
+	wsBookInterval := flag.Duration("ws-book-interval", 1*time.Minute, "Minimum time between stored snapshots of a live WebSocket funding book")
+	wsResubscribeOnGap := flag.Bool("ws-resubscribe-on-gap", false, "Resubscribe to every WebSocket channel when a sequence gap shows frames were dropped")
+	wsRetryDelay := flag.Duration("ws-retry-delay", 5*time.Second, "Delay between WebSocket reconnection attempts")
+	wsBatchSize := flag.Int("ws-batch-size", 100, "Number of streamed trades written per database transaction")
+	wsFlushInterval := flag.Duration("ws-flush-interval", 1*time.Second, "Maximum time streamed trades are buffered before being written")
+	wsStaleAfter := flag.Duration("ws-stale-after", 30*time.Minute, "Report a currency's WebSocket trade feed as degraded when no trade was stored for this long (0 disables)")
+	wsStaleHours := flag.String("ws-stale-hours", "", "UTC hours, e.g. 8-22, in which -ws-stale-after applies (empty for the whole day)")
+	taskMaxFailures := flag.Int("task-max-failures", 10, "Disable a periodic task after this many consecutive failures (0 never disables)")
+	maintenanceRecheck := flag.Duration("maintenance-recheck", 30*time.Second, "Skip periodic tasks while Bitfinex reports maintenance, re-checking its status after this delay and doubling it up to -maintenance-recheck-max (0 disables)")
+	maintenanceRecheckMax := flag.Duration("maintenance-recheck-max", 10*time.Minute, "Longest delay between platform status checks during Bitfinex maintenance")
+	taskJitter := flag.Duration("task-jitter", 10*time.Second, "Maximum random startup offset per collection task, staggers requests for different currencies (0 disables)")
+	distributionInterval := flag.Duration("distribution-interval", 5*time.Minute, "Interval for updating the stored rate distribution from new trades")
+	distributionHistory := flag.Bool("distribution-history", false, "Append a snapshot of the rate distribution to rate_distribution_history each time it is saved")
+	bookPrecisions := flag.String("book-precisions", "P0", "Comma-separated aggregated funding book precisions (P0-P4) collected each cycle")
+	bookPrecisionOverrides := flag.String("book-precision-overrides", "", "Per-currency book precisions, e.g. fUSD=P0|P1|P2,fUST=P0")
+	intervalOverrides := flag.String("interval-overrides", "", "Per-currency interval overrides, e.g. fUSD.ticker=30s,fUST.raw-book=5m")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(buildinfo.Get())
+		return
+	}
+
+	if err := rates.SetAnnualization(*aprDays, *aprCompound); err != nil {
+		log.Fatalf("Invalid -apr-days: %v", err)
+	}
+
+	frrScaling, err := server.ParseFRRScaling(*frrScalingFlag)
+	if err != nil {
+		log.Fatalf("Invalid -frr-scaling: %v", err)
+	}
+
+	feedHours, err := server.ParseFeedHours(*wsStaleHours)
+	if err != nil {
+		log.Fatalf("Invalid -ws-stale-hours: %v", err)
+	}
+	if *wsStaleAfter < 0 {
+		log.Fatalf("Invalid -ws-stale-after: %v, must not be negative", *wsStaleAfter)
+	}
+
+	if *frrRegimeSlope < 0 || *frrRegimeConfidence < 0 || *frrRegimeConfidence > 1 {
+		log.Fatalf("Invalid -frr-regime-slope or -frr-regime-confidence: slope must not be negative and confidence must be between 0 and 1")
+	}
+
+	if *tickerPersist != "every" && *tickerPersist != "changed" {
+		log.Fatalf("Invalid -ticker-persist: %q, must be every or changed", *tickerPersist)
+	}
+	if *tickerChangeEpsilon < 0 {
+		log.Fatalf("Invalid -ticker-change-epsilon: %v, must not be negative", *tickerChangeEpsilon)
+	}
+	if *tickerHeartbeat < 0 {
+		log.Fatalf("Invalid -ticker-heartbeat: %v, must not be negative", *tickerHeartbeat)
+	}
+	if *initialFetchTimeout < 0 {
+		log.Fatalf("Invalid -initial-fetch-timeout: %v, must not be negative", *initialFetchTimeout)
+	}
+	if *statsBackfill < 0 {
+		log.Fatalf("Invalid -stats-backfill: %v, must not be negative", *statsBackfill)
+	}
+	if *tradeBackfill < 0 {
+		log.Fatalf("Invalid -trade-backfill: %v, must not be negative", *tradeBackfill)
+	}
+
+	var depthAlert *service.DepthDropDetector
+	if *depthDropAlert > 0 {
+		if *depthDropWindow <= 0 {
+			log.Fatalf("Invalid -depth-drop-window: %d, must be positive", *depthDropWindow)
+		}
+		depthAlert = service.NewDepthDropDetector(*depthDropWindow, *depthDropAlert)
+	}
+
+	overrides, err := parseIntervalOverrides(*intervalOverrides)
+	if err != nil {
+		log.Fatalf("Invalid -interval-overrides: %v", err)
+	}
+	config := collectionConfig{
+		Currencies: parseCurrencies(*currenciesFlag),
+		Defaults: collectionIntervals{
+			Stats:          *statsInterval,
+			Ticker:         *tickerInterval,
+			RawBook:        *rawBookInterval,
+			AggregatedBook: *aggregatedBookInterval,
+		},
+		Overrides: overrides,
+	}
+	if config.BookPrecisions, err = parseBookPrecisions(*bookPrecisions, ","); err != nil {
+		log.Fatalf("Invalid -book-precisions: %v", err)
+	}
+	if config.PrecisionOverrides, err = parsePrecisionOverrides(*bookPrecisionOverrides); err != nil {
+		log.Fatalf("Invalid -book-precision-overrides: %v", err)
+	}
+	if config.StatsPeriods, err = parseStatsPeriods(*statsPeriods); err != nil {
+		log.Fatalf("Invalid -stats-periods: %v", err)
+	}
+	if err := config.validate(); err != nil {
+		log.Fatalf("Invalid collection configuration: %v", err)
+	}
+
+	wsCurrencies := config.Currencies
+	switch *wsCurrenciesFlag {
+	case "":
+	case "none":
+		wsCurrencies = nil
+	default:
+		wsCurrencies = parseCurrencies(*wsCurrenciesFlag)
+	}
+
+	// Every streamed currency subscribes to trades unless -ws-channels lists its channels
+	wsChannels := make(map[string][]string)
+	for _, currency := range wsCurrencies {
+		wsChannels[currency] = []string{api.ChannelTrades}
+	}
+	channelOverrides, err := parseWSChannels(*wsChannelsFlag)
+	if err != nil {
+		log.Fatalf("Invalid -ws-channels: %v", err)
+	}
+	for currency, channels := range channelOverrides {
+		if len(channels) == 0 {
+			delete(wsChannels, currency)
+			continue
+		}
+		wsChannels[currency] = channels
+	}
+
+	// Rate distributions are built from streamed trades
+	var wsTradeCurrencies []string
+	for _, currency := range sortedKeys(wsChannels) {
+		if containsString(wsChannels[currency], api.ChannelTrades) {
+			wsTradeCurrencies = append(wsTradeCurrencies, currency)
+		}
+	}
+
 	currentDir, err := os.Getwd()
 	if err != nil {
 		log.Fatalf("Unable to get current working directory: %v", err)
@@ -317,7 +766,11 @@ func main() {
 	}
 
 	// Initialize database and get connection
-	sqlDB, err := db.InitDB(dbPath)
+	sqlDB, err := db.InitDBWithOptions(dbPath, db.Options{
+		CacheSize: *sqliteCacheSize,
+		MmapSize:  *sqliteMmapSize,
+		TempStore: *sqliteTempStore,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -327,94 +780,139 @@ func main() {
 
 	// Create database wrapper
 	database := db.NewDatabase(sqlDB)
-	apiServer := server.NewAPIServer(database)
-	// Create scheduler
-	scheduler := scheduler.NewScheduler(5, 50) // 5 workers, queue size 50
-	scheduler.Start()
-	defer scheduler.Stop()
+	database.SetScaledRates(*scaledRates)
+	if err := database.SetMonthlySharding(*shardMonthly); err != nil {
+		log.Fatalf("Failed to set up monthly sharding: %v", err)
+	}
 
+	// Storage used by collection; in dry-run mode writes are only logged
+	var storage db.Storage = database
+	if *dryRun {
+		log.Println("Dry-run mode enabled, collected data will not be written to the database")
+		storage = db.NewDryRunStorage(database)
+	}
+	// Canceled on the stop signal; collection tasks, initial fetches and the WebSocket client all observe it
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Create API client
-	client := api.NewClient()
+	// Create scheduler
+	scheduler := scheduler.NewScheduler(5, 50) // 5 workers, queue size 50
+	scheduler.SetJitter(*taskJitter)
+	scheduler.SetMaxConsecutiveFailures(*taskMaxFailures)
+	scheduler.StartWithContext(ctx)
+	defer scheduler.Stop()
 
-	currencies := []string{"fUSD", "fUST"}
+	// Buffer streamed trades and store them in batches
+	var tradeBuffer *db.TradeBuffer
+	if len(wsChannels) > 0 {
+		tradeBuffer = db.NewTradeBuffer(storage, *wsBatchSize, *wsFlushInterval)
+	}
+
+	apiServer := server.NewAPIServerWithConfig(database, server.Config{
+		StaticDir:          *staticDir,
+		Scheduler:          scheduler,
+		TradeBuffer:        tradeBuffer,
+		AdminToken:         *adminToken,
+		MaxResponseItems:   *maxResponseItems,
+		ReadTimeout:        *httpReadTimeout,
+		WriteTimeout:       *httpWriteTimeout,
+		IdleTimeout:        *httpIdleTimeout,
+		StreamEvictTimeout: *streamEvictTimeout,
+		FRRScaling:         frrScaling,
+		FRRRegime: service.RegimeThresholds{
+			SlopePerDay:   *frrRegimeSlope,
+			MinConfidence: *frrRegimeConfidence,
+		},
+		WSTradeCurrencies: wsTradeCurrencies,
+		WSFeedStaleAfter:  *wsStaleAfter,
+		WSFeedHours:       feedHours,
+	})
 
-	// Get initial data for each currency
-	for _, currency := range currencies {
-		// Get initial FundingStats data
-		if err := fetchInitialFundingStats(ctx, client, database, currency); err != nil {
-			log.Printf("Failed to get initial FundingStats data for %s: %v", currency, err)
-		}
+	// Create API client
+	client := api.NewClient(api.WithRateLimit(*apiRateLimit, *apiRateBurst, *apiRateLimitPerFamily))
+	if *maintenanceRecheck > 0 {
+		scheduler.SetMaintenanceCheck(func(ctx context.Context) (bool, error) {
+			status, err := client.GetPlatformStatusWithContext(ctx)
+			return status == api.PlatformMaintenance, err
+		}, *maintenanceRecheck, *maintenanceRecheckMax)
+	}
 
-		// Get initial FundingTicker data
-		if err := fetchInitialFundingTicker(ctx, client, database, currency); err != nil {
-			log.Printf("Failed to get initial FundingTicker data for %s: %v", currency, err)
+	// Start API server in a new goroutine; /readyz reports ready once initial data is loaded
+	apiServer.SetReady(*skipInitialFetch)
+	go func() {
+		if err := apiServer.Start(":8080"); err != nil {
+			log.Fatalf("Failed to start API server: %v", err)
 		}
+	}()
 
-		// Get initial FundingBook data
-		if err := fetchInitialFundingBook(ctx, client, database, currency); err != nil {
-			log.Printf("Failed to get initial FundingBook data for %s: %v", currency, err)
-		}
+	// Get initial data for each currency in the background
+	if !*skipInitialFetch {
+		go func() {
+			fetchInitialData(ctx, client, storage, config.Currencies, *initialFetchConcurrency, *initialFetchTimeout, *statsBackfill, config.statsPeriods(), wsTradeCurrencies, *tradeBackfill)
+			apiServer.SetReady(true)
+		}()
 	}
 
 	// Create periodic tasks for each currency
-	for _, currency := range currencies {
-		currency := currency // Create local copy for use in closures
-
-		// Create hourly FundingStats task
-		hourlyStatsTask := scheduler.NewPeriodicTask(
-			fmt.Sprintf("FundingStats_%s_Hourly", currency),
-			1*time.Hour, // Run once per hour
-			func(ctx context.Context) error {
-				return updateFundingStats(ctx, client, database, currency)
-			},
-			3, // Number of retries
-		)
-		scheduler.SubmitTask(hourlyStatsTask)
-		log.Printf("Set up hourly FundingStats data collection task for %s", currency)
-
-		tickerTask := scheduler.NewPeriodicTask(
-			fmt.Sprintf("FundingTicker_%s", currency),
-			1*time.Minute,
-			func(ctx context.Context) error {
-				return updateFundingTicker(ctx, client, database, currency)
-			},
-			3, // Number of retries
-		)
-		scheduler.SubmitTask(tickerTask)
-		log.Printf("Set up hourly FundingTicker data collection task for %s", currency)
+	scheduleCollectionTasks(ctx, scheduler, config, collectors{
+		stats: func(ctx context.Context, currency string, period int) error {
+			return updateFundingStats(ctx, client, storage, currency, period, *belowThresholdAlert, apiServer.PublishFundingStats)
+		},
+		ticker: func(ctx context.Context, currency string) error {
+			return updateFundingTicker(ctx, client, storage, currency, *tickerPersist == "changed", *tickerChangeEpsilon, *tickerHeartbeat)
+		},
+		rawBook: func(ctx context.Context, currency string) error {
+			return updateRawFundingBook(ctx, client, storage, currency)
+		},
+		aggregatedBook: func(ctx context.Context, currency string, precisions []api.BookPrecision) error {
+			return updateAggregatedFundingBook(ctx, client, storage, currency, precisions, depthAlert)
+		},
+	})
 
-		// Create FundingBook task to run every minute
-		bookTask := scheduler.NewPeriodicTask(
-			fmt.Sprintf("FundingBook_%s", currency),
-			1*time.Minute, // Run every minute
-			func(ctx context.Context) error {
-				return updateFundingBook(ctx, client, database, currency)
-			},
-			3, // Number of retries
-		)
-		scheduler.SubmitTask(bookTask)
-		log.Printf("Set up minute FundingBook data collection task for %s", currency)
+	// Keep the stored rate distribution up to date with streamed trades
+	if !*dryRun {
+		distributionService := service.NewDistributionService(database)
+		distributionService.KeepHistory = *distributionHistory
+		for _, currency := range wsTradeCurrencies {
+			currency := currency // Create local copy for use in closures
+
+			scheduler.NewPeriodicTask(
+				fmt.Sprintf("RateDistribution_%s", currency),
+				*distributionInterval,
+				func(ctx context.Context) error {
+					return distributionService.UpdateDistribution(currency, defaultDistributionBins)
+				},
+				1, // Number of retries
+			)
+			log.Printf("Set up rate distribution update task for %s every %s", currency, *distributionInterval)
+		}
 	}
 
 	// Start WebSocket handler in a new goroutine
-	go handleWebSocketData(ctx, database)
+	wsDone := make(chan struct{})
+	if len(wsChannels) > 0 {
+		go func() {
+			defer close(wsDone)
+			tradeBuffer.OnSaved = apiServer.RecordWSTrades
+			wsClient := api.NewWebSocketClient()
+			wsClient.RetryDelay = *wsRetryDelay
+			wsClient.ResubscribeOnGap = *wsResubscribeOnGap
+			handleWebSocketData(ctx, wsClient, storage, wsChannels, tradeBuffer, *wsBookInterval)
+		}()
+	} else {
+		close(wsDone)
+	}
 
 	// Create a signal capture
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start API server in a new goroutine
-	go func() {
-		if err := apiServer.Start(":8080"); err != nil {
-			log.Fatalf("Failed to start API server: %v", err)
-		}
-	}()
-
 	// Wait for termination signal
 	<-signalChan
 	fmt.Println("Received stop signal, gracefully exiting...")
+
+	// Cancel outstanding API calls and collection tasks, then let the WebSocket handler flush buffered trades
+	cancel()
+	<-wsDone
 	scheduler.Stop() // Stop scheduler
 }
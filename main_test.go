@@ -0,0 +1,620 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/db/dbtest"
+	"github.com/gary0122g/BitfinexFundingData/scheduler"
+	"github.com/gary0122g/BitfinexFundingData/server"
+	"github.com/gorilla/websocket"
+)
+
+// newMainTestDatabase opens a Database on a new SQLite file with all tables created
+func newMainTestDatabase(t *testing.T) *db.Database {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.CreateTables(conn); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	return db.NewDatabase(conn)
+}
+
+// newMockWSClient starts a mock Bitfinex WebSocket server and returns a client for it. Each subscribe
+// frame is sent to frames and confirmed, then stream is called to send the channel's data.
+func newMockWSClient(t *testing.T, frames chan<- api.SubscribeMessage, stream func(ws *websocket.Conn, sub api.SubscribeMessage, chanID int)) *api.WebSocketClient {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		var chanID int
+		for {
+			_, message, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var sub api.SubscribeMessage
+			if err := json.Unmarshal(message, &sub); err != nil || sub.Event != "subscribe" {
+				continue
+			}
+			frames <- sub
+
+			chanID++
+			ws.WriteJSON(api.SubscribedResponse{Event: "subscribed", Channel: sub.Channel, ChanID: chanID, Symbol: sub.Symbol})
+			stream(ws, sub, chanID)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	wsClient := api.NewWebSocketClient()
+	wsClient.URL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	wsClient.SetReconnect(false)
+	return wsClient
+}
+
+func TestHandleWebSocketDataSubscribesAndStoresTickers(t *testing.T) {
+	database := newMainTestDatabase(t)
+
+	frames := make(chan api.SubscribeMessage, 8)
+	wsClient := newMockWSClient(t, frames, func(ws *websocket.Conn, sub api.SubscribeMessage, chanID int) {
+		if sub.Channel != api.ChannelTicker {
+			return
+		}
+		// Several tickers within one second, as Bitfinex streams them
+		for i := 0; i < 3; i++ {
+			ws.WriteJSON([]interface{}{chanID, []interface{}{0.0001, 0.0002, 30, 1000, 0.0003, 2, 2000, 0, 0, 0.00025, 5e6, 0.0004, 0.0001, nil, nil, 1e5 + float64(i)}, i + 1})
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handleWebSocketData(ctx, wsClient, database, map[string][]string{
+			"fUSD": {api.ChannelTicker},
+			"fUST": {api.ChannelTrades, api.ChannelBook},
+		}, db.NewTradeBuffer(database, 1, 0), time.Minute)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	want := []api.SubscribeMessage{
+		{Event: "subscribe", Channel: api.ChannelTicker, Symbol: "fUSD"},
+		{Event: "subscribe", Channel: api.ChannelTrades, Symbol: "fUST"},
+		{Event: "subscribe", Channel: api.ChannelBook, Symbol: "fUST", Prec: string(api.PrecisionP0), Len: "25"},
+	}
+	for i, w := range want {
+		select {
+		case got := <-frames:
+			if got != w {
+				t.Errorf("subscribe frame %d = %+v, want %+v", i, got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for subscribe frame %d", i)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tickers, err := database.GetHistoricalFundingTickers("fUSD", time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 10)
+		if err != nil {
+			t.Fatalf("GetHistoricalFundingTickers returned error: %v", err)
+		}
+		if len(tickers) > 0 && tickers[0].FRRAmountAvailable == 1e5+2 {
+			if tickers[0].FRR != 0.0001 || tickers[0].Bid != 0.0002 || tickers[0].Ask != 0.0003 {
+				t.Errorf("stored ticker = %+v, want the streamed values", tickers[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("streamed tickers were not stored, got %+v", tickers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleWebSocketDataStoresTrades(t *testing.T) {
+	database := newMainTestDatabase(t)
+
+	frames := make(chan api.SubscribeMessage, 8)
+	wsClient := newMockWSClient(t, frames, func(ws *websocket.Conn, sub api.SubscribeMessage, chanID int) {
+		// A trade is executed (fte) and then updated (ftu)
+		ws.WriteJSON([]interface{}{chanID, "fte", []interface{}{7, 1700000000000, -250, 0.0002, 2}, 1})
+		ws.WriteJSON([]interface{}{chanID, "ftu", []interface{}{7, 1700000000000, -250, 0.0002, 2}, 2})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handleWebSocketData(ctx, wsClient, database, map[string][]string{"fUSD": {api.ChannelTrades}}, db.NewTradeBuffer(database, 1, 0), time.Minute)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case <-frames:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the trades subscription")
+	}
+
+	want := api.FundingTrade{ID: 7, MTS: 1700000000000, Amount: -250, Rate: 0.0002, Period: 2}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		trades, err := database.GetLatestWSFundingTrades("fUSD", 10)
+		if err != nil {
+			t.Fatalf("GetLatestWSFundingTrades returned error: %v", err)
+		}
+		if len(trades) > 0 {
+			if trades[0] != want {
+				t.Errorf("stored trade = %+v, want %+v", trades[0], want)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("streamed trade was not stored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpdateAggregatedFundingBookTagsRowsByPrecision(t *testing.T) {
+	database := newMainTestDatabase(t)
+
+	// Each precision returns a bid and an ask at rates that identify it
+	rates := map[string]float64{"P0": 0.0001, "P1": 0.0002, "P2": 0.0003}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		precision := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		rate, ok := rates[precision]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "[[%g,2,1,-100],[%g,30,3,200]]", rate, rate)
+	}))
+	defer srv.Close()
+	client := api.NewClient(api.WithBaseURL(srv.URL), api.WithRateLimit(0, 0, false))
+
+	precisions := []api.BookPrecision{api.PrecisionP0, api.PrecisionP1, api.PrecisionP2}
+	if err := updateAggregatedFundingBook(context.Background(), client, database, "fUSD", precisions, nil); err != nil {
+		t.Fatalf("updateAggregatedFundingBook: %v", err)
+	}
+
+	for _, precision := range precisions {
+		var count int
+		if err := database.GetDB().QueryRow(`SELECT COUNT(*) FROM funding_book WHERE currency = 'fUSD' AND precision = ?`, string(precision)).Scan(&count); err != nil {
+			t.Fatalf("failed to count %s rows: %v", precision, err)
+		}
+		if count != 2 {
+			t.Errorf("%s rows = %d, want 2", precision, count)
+		}
+
+		books, err := database.GetLatestFundingBookByPrecisionWithContext(context.Background(), "fUSD", precision)
+		if err != nil {
+			t.Fatalf("GetLatestFundingBookByPrecisionWithContext(%s): %v", precision, err)
+		}
+		if len(books) != 2 {
+			t.Fatalf("%s book = %+v, want 2 rows", precision, books)
+		}
+		for _, book := range books {
+			if book.Rate != rates[string(precision)] {
+				t.Errorf("%s book row = %+v, want rate %g", precision, book, rates[string(precision)])
+			}
+		}
+	}
+
+	// The default reads stay on P0
+	books, err := database.GetLatestFundingBook("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestFundingBook: %v", err)
+	}
+	for _, book := range books {
+		if book.Rate != rates["P0"] {
+			t.Errorf("GetLatestFundingBook row = %+v, want only P0 rows", book)
+		}
+	}
+}
+
+func TestServerAcceptsRequestsDuringInitialFetch(t *testing.T) {
+	database := newMainTestDatabase(t)
+
+	// Bitfinex requests block until released, keeping the initial fetch in progress
+	release := make(chan struct{})
+	requested := make(chan struct{}, 16)
+	bitfinex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		fmt.Fprint(w, "[]")
+	}))
+	defer bitfinex.Close()
+	var releaseOnce sync.Once
+	releaseAll := func() { releaseOnce.Do(func() { close(release) }) }
+	defer releaseAll()
+	client := api.NewClient(api.WithBaseURL(bitfinex.URL), api.WithRateLimit(0, 0, false))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	// As in main: the server starts not ready, then the initial fetch runs in the background
+	apiServer := server.NewAPIServer(database)
+	apiServer.SetReady(false)
+	go apiServer.Start(addr)
+	fetched := make(chan struct{})
+	go func() {
+		defer close(fetched)
+		fetchInitialData(context.Background(), client, database, []string{"fUSD"}, 1, 0, 0, nil, nil, 0)
+		apiServer.SetReady(true)
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("initial fetch did not start")
+	}
+
+	status := func(path string) int {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			resp, err := http.Get("http://" + addr + path)
+			if err == nil {
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GET %s: %v", path, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if code := status("/api/version"); code != http.StatusOK {
+		t.Errorf("/api/version during the initial fetch = %d, want 200", code)
+	}
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz during the initial fetch = %d, want 503", code)
+	}
+
+	releaseAll()
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("initial fetch did not finish")
+	}
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz after the initial fetch = %d, want 200", code)
+	}
+}
+
+func TestScheduleCollectionTasksUsesConfiguredIntervals(t *testing.T) {
+	config := collectionConfig{
+		Currencies: []string{"fUSD", "fUST"},
+		Defaults: collectionIntervals{
+			Stats:          time.Hour,
+			Ticker:         time.Minute,
+			RawBook:        2 * time.Minute,
+			AggregatedBook: 3 * time.Minute,
+		},
+		Overrides: map[string]collectionIntervals{
+			"fUST": {Ticker: 30 * time.Second, RawBook: 5 * time.Minute},
+		},
+		BookPrecisions:     []api.BookPrecision{api.PrecisionP0},
+		PrecisionOverrides: map[string][]api.BookPrecision{"fUST": {api.PrecisionP1, api.PrecisionP2}},
+		StatsPeriods:       []int{30},
+	}
+	if err := config.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	s := scheduler.NewScheduler(2, 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartWithContext(ctx)
+	defer s.Stop()
+
+	var mu sync.Mutex
+	ran := make(map[string]bool)
+	record := func(name string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran[name] = true
+		return nil
+	}
+	scheduleCollectionTasks(ctx, s, config, collectors{
+		stats: func(ctx context.Context, currency string, period int) error {
+			return record(fmt.Sprintf("stats %s %d", currency, period))
+		},
+		ticker: func(ctx context.Context, currency string) error {
+			return record("ticker " + currency)
+		},
+		rawBook: func(ctx context.Context, currency string) error {
+			return record("raw book " + currency)
+		},
+		aggregatedBook: func(ctx context.Context, currency string, precisions []api.BookPrecision) error {
+			return record(fmt.Sprintf("book %s %v", currency, precisions))
+		},
+	})
+
+	for name, want := range map[string]time.Duration{
+		"FundingStats_fUSD":     time.Hour,
+		"FundingStats_fUSD_p30": time.Hour,
+		"FundingTicker_fUSD":    time.Minute,
+		"RawFundingBook_fUSD":   2 * time.Minute,
+		"FundingBook_fUSD":      3 * time.Minute,
+		"FundingStats_fUST":     time.Hour,
+		"FundingStats_fUST_p30": time.Hour,
+		"FundingTicker_fUST":    30 * time.Second,
+		"RawFundingBook_fUST":   5 * time.Minute,
+		"FundingBook_fUST":      3 * time.Minute,
+	} {
+		task, ok := s.GetPeriodicTask(name)
+		if !ok {
+			t.Errorf("task %s was not created", name)
+			continue
+		}
+		if got := task.Interval(); got != want {
+			t.Errorf("task %s interval = %s, want %s", name, got, want)
+		}
+	}
+
+	// The first run of each task calls its collector with the task's currency
+	want := []string{
+		"stats fUSD 0", "stats fUSD 30", "ticker fUSD", "raw book fUSD", "book fUSD [P0]",
+		"stats fUST 0", "stats fUST 30", "ticker fUST", "raw book fUST", "book fUST [P1 P2]",
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		missing := ""
+		for _, name := range want {
+			if !ran[name] {
+				missing = name
+				break
+			}
+		}
+		mu.Unlock()
+		if missing == "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("collector %q never ran", missing)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFetchInitialDataTimesOutHangingFetch(t *testing.T) {
+	database := newMainTestDatabase(t)
+
+	// Every fUSD request hangs until the test ends, fUST requests answer at once
+	var mu sync.Mutex
+	var paths []string
+	hang := make(chan struct{})
+	bitfinex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if strings.Contains(r.URL.Path, "fUSD") {
+			select {
+			case <-hang:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		fmt.Fprint(w, "[]")
+	}))
+	defer bitfinex.Close()
+	defer close(hang)
+	client := api.NewClient(api.WithBaseURL(bitfinex.URL), api.WithRateLimit(0, 0, false))
+
+	// Even one currency at a time, the hanging fUSD fetches do not hold up fUST
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(done)
+		fetchInitialData(context.Background(), client, database, []string{"fUSD", "fUST"}, 1, 100*time.Millisecond, 0, nil, nil, 0)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("initial fetch hung on the unresponsive currency")
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("initial fetch finished after %s, want the ticker and book fetches of fUSD to wait for the timeout", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, want := range []string{"/v2/book/fUST/R0", "/v2/book/fUST/P0"} {
+		found := false
+		for _, path := range paths {
+			found = found || strings.HasPrefix(path, want)
+		}
+		if !found {
+			t.Errorf("%s was not requested, requests %v", want, paths)
+		}
+	}
+}
+
+func TestFetchInitialFundingBookStampsSnapshotOnce(t *testing.T) {
+	// 300 levels in each book
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rows := make([]string, 300)
+		for i := range rows {
+			rate := 0.0001 + float64(i)*0.000001
+			if strings.HasSuffix(r.URL.Path, "/R0") {
+				rows[i] = fmt.Sprintf("[%d,2,%g,100]", i+1, rate)
+			} else {
+				rows[i] = fmt.Sprintf("[%g,2,1,100]", rate)
+			}
+		}
+		fmt.Fprint(w, "["+strings.Join(rows, ",")+"]")
+	}))
+	defer srv.Close()
+	client := api.NewClient(api.WithBaseURL(srv.URL), api.WithRateLimit(0, 0, false))
+
+	storage := dbtest.NewMockStorage()
+	if err := fetchInitialFundingBook(context.Background(), client, storage, "fUSD"); err != nil {
+		t.Fatalf("fetchInitialFundingBook: %v", err)
+	}
+
+	// Every row of a snapshot is saved with the same timestamp
+	timestamps := map[string]map[int64]int{}
+	for _, call := range storage.Calls() {
+		var mts int64
+		switch call.Method {
+		case "SaveFundingBookAt":
+			mts = call.Args[2].(int64)
+		case "SaveRawFundingBookAt":
+			mts = call.Args[1].(int64)
+		case "SaveFundingBook", "SaveFundingBookWithPrecision", "SaveRawFundingBook":
+			t.Fatalf("%s stamps each row on insert, want the snapshot saved with one timestamp", call.Method)
+		default:
+			continue
+		}
+		if timestamps[call.Method] == nil {
+			timestamps[call.Method] = map[int64]int{}
+		}
+		timestamps[call.Method][mts]++
+	}
+	for _, method := range []string{"SaveFundingBookAt", "SaveRawFundingBookAt"} {
+		if len(timestamps[method]) != 1 {
+			t.Errorf("%s saved rows at %d timestamps, want 1", method, len(timestamps[method]))
+		}
+		for mts, rows := range timestamps[method] {
+			if rows != 300 || mts <= 0 {
+				t.Errorf("%s saved %d rows at %d, want 300 at one positive timestamp", method, rows, mts)
+			}
+		}
+	}
+}
+
+func TestFetchInitialFundingTickerTreatsNoTickerAsEmpty(t *testing.T) {
+	database := newMainTestDatabase(t)
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, "[0.0001,0.0002,30,1000,0.0003,2,500,0,0,0.00025,10000,0.0004,0.0001,null,null,50000]")
+	}))
+	defer srv.Close()
+	client := api.NewClient(api.WithBaseURL(srv.URL), api.WithRateLimit(0, 0, false))
+
+	// ErrNoTicker from the empty database means the ticker is fetched, not a database failure
+	if err := fetchInitialFundingTicker(context.Background(), client, database, "fUSD"); err != nil {
+		t.Fatalf("fetchInitialFundingTicker without a stored ticker: %v", err)
+	}
+	if _, err := database.GetLatestFundingTicker("fUSD"); err != nil {
+		t.Fatalf("ticker was not stored: %v", err)
+	}
+
+	// A stored ticker is not fetched again
+	if err := fetchInitialFundingTicker(context.Background(), client, database, "fUSD"); err != nil {
+		t.Fatalf("fetchInitialFundingTicker with a stored ticker: %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("%d ticker requests, want 1", got)
+	}
+}
+
+func TestFrequentTickerPollingStoresOnlyChanges(t *testing.T) {
+	database := newMainTestDatabase(t)
+
+	var frr atomic.Value
+	frr.Store("0.0001")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "[%s,0.0002,30,1000,0.0003,2,500,0,0,0.00025,10000,0.0004,0.0001,null,null,50000]", frr.Load())
+	}))
+	defer srv.Close()
+	client := api.NewClient(api.WithBaseURL(srv.URL), api.WithRateLimit(0, 0, false))
+
+	rows := func() int {
+		t.Helper()
+		var count int
+		if err := database.GetDB().QueryRow(`SELECT COUNT(*) FROM funding_ticker WHERE currency = 'fUSD'`).Scan(&count); err != nil {
+			t.Fatalf("failed to count tickers: %v", err)
+		}
+		return count
+	}
+	poll := func(times int, heartbeat time.Duration) {
+		t.Helper()
+		for i := 0; i < times; i++ {
+			if err := updateFundingTicker(context.Background(), client, database, "fUSD", true, 0, heartbeat); err != nil {
+				t.Fatalf("updateFundingTicker: %v", err)
+			}
+		}
+	}
+
+	// Ten polls of an unchanged ticker store it once
+	poll(10, time.Hour)
+	if got := rows(); got != 1 {
+		t.Errorf("%d tickers after unchanged polls, want 1", got)
+	}
+
+	// A moved FRR is captured by the next poll
+	frr.Store("0.00012")
+	poll(5, time.Hour)
+	if got := rows(); got != 2 {
+		t.Errorf("%d tickers after the FRR moved, want 2", got)
+	}
+	latest, err := database.GetLatestFundingTicker("fUSD")
+	if err != nil {
+		t.Fatalf("GetLatestFundingTicker: %v", err)
+	}
+	if latest.FRR != 0.00012 {
+		t.Errorf("latest FRR = %v, want the changed 0.00012", latest.FRR)
+	}
+
+	// Once the latest row is older than the heartbeat an unchanged ticker is stored again
+	if _, err := database.GetDB().Exec(`UPDATE funding_ticker SET timestamp = timestamp - ?`, (2 * time.Hour).Milliseconds()); err != nil {
+		t.Fatalf("failed to age the tickers: %v", err)
+	}
+	poll(5, time.Hour)
+	if got := rows(); got != 3 {
+		t.Errorf("%d tickers after the heartbeat elapsed, want 3", got)
+	}
+	// Without a heartbeat an old unchanged ticker is not stored
+	if _, err := database.GetDB().Exec(`UPDATE funding_ticker SET timestamp = timestamp - ?`, (2 * time.Hour).Milliseconds()); err != nil {
+		t.Fatalf("failed to age the tickers: %v", err)
+	}
+	poll(5, 0)
+	if got := rows(); got != 3 {
+		t.Errorf("%d tickers after polling without a heartbeat, want 3", got)
+	}
+}
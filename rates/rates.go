@@ -0,0 +1,103 @@
+// Package rates converts between the funding rate representations used by Bitfinex and this application.
+//
+// Bitfinex reports funding rates as daily rates, except the FRR in funding stats, which is
+// 1/365th of the daily FRR. Annual rates (APR) follow the configured Annualization:
+//
+//	simple:   apr = daily * days
+//	compound: apr = (1 + daily)^days - 1
+//
+// with days 365 and simple annualization unless SetAnnualization is called.
+package rates
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// StatsFRRDays is the factor between the FRR reported by the funding stats endpoint and the daily FRR.
+// It is fixed by Bitfinex and independent of the configured annualization.
+const StatsFRRDays = 365
+
+// DefaultAnnualizationDays is the number of days used to annualize daily rates by default
+const DefaultAnnualizationDays = 365
+
+// Annualization describes how daily rates are converted to annual rates
+type Annualization struct {
+	Days     int  // Days per year
+	Compound bool // Compound the daily rate instead of multiplying it by Days
+}
+
+// Formula describes the conversion from a daily rate to an annual rate
+func (a Annualization) Formula() string {
+	if a.Compound {
+		return fmt.Sprintf("(1+daily_rate)^%d-1", a.Days)
+	}
+	return fmt.Sprintf("daily_rate*%d", a.Days)
+}
+
+var annualization atomic.Pointer[Annualization]
+
+func init() {
+	annualization.Store(&Annualization{Days: DefaultAnnualizationDays})
+}
+
+// SetAnnualization sets how daily rates are annualized. It is meant to be called once at startup;
+// rates converted before the call keep the previous setting, and stored rate distributions built with
+// another setting are rebuilt on their next use.
+func SetAnnualization(days int, compound bool) error {
+	if days <= 0 {
+		return fmt.Errorf("annualization days must be positive, got %d", days)
+	}
+	annualization.Store(&Annualization{Days: days, Compound: compound})
+	return nil
+}
+
+// CurrentAnnualization returns the annualization used by DailyToAPR and APRToDaily
+func CurrentAnnualization() Annualization {
+	return *annualization.Load()
+}
+
+// StatsFRRToDaily converts the FRR reported by the funding stats endpoint to a daily rate
+func StatsFRRToDaily(statsFRR float64) float64 {
+	return statsFRR * StatsFRRDays
+}
+
+// StatsFRRToAPR converts the FRR reported by the funding stats endpoint to an annual rate
+func StatsFRRToAPR(statsFRR float64) float64 {
+	return DailyToAPR(StatsFRRToDaily(statsFRR))
+}
+
+// DailyToAPR converts a daily rate to an annual rate
+func DailyToAPR(daily float64) float64 {
+	a := CurrentAnnualization()
+	if a.Compound {
+		return math.Pow(1+daily, float64(a.Days)) - 1
+	}
+	return daily * float64(a.Days)
+}
+
+// APRToDaily converts an annual rate to a daily rate
+func APRToDaily(apr float64) float64 {
+	a := CurrentAnnualization()
+	if a.Compound {
+		return math.Pow(1+apr, 1/float64(a.Days)) - 1
+	}
+	return apr / float64(a.Days)
+}
+
+// DailyToAPRPercent converts a daily rate to an annual rate in percent
+func DailyToAPRPercent(daily float64) float64 {
+	return ToPercent(DailyToAPR(daily))
+}
+
+// ToPercent converts a rate fraction to a percentage
+func ToPercent(rate float64) float64 {
+	return rate * 100
+}
+
+// Round rounds value to the given number of decimal places
+func Round(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,81 @@
+package rates
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnnualization(t *testing.T) {
+	defer SetAnnualization(DefaultAnnualizationDays, false)
+
+	const daily = 0.0002
+	tests := []struct {
+		name     string
+		days     int
+		compound bool
+		wantAPR  float64
+		formula  string
+	}{
+		{"simple 365", 365, false, daily * 365, "daily_rate*365"},
+		{"simple 360", 360, false, daily * 360, "daily_rate*360"},
+		{"compound 365", 365, true, math.Pow(1+daily, 365) - 1, "(1+daily_rate)^365-1"},
+		{"compound 360", 360, true, math.Pow(1+daily, 360) - 1, "(1+daily_rate)^360-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetAnnualization(tt.days, tt.compound); err != nil {
+				t.Fatalf("SetAnnualization: %v", err)
+			}
+
+			apr := DailyToAPR(daily)
+			if math.Abs(apr-tt.wantAPR) > 1e-12 {
+				t.Errorf("DailyToAPR(%v) = %v, want %v", daily, apr, tt.wantAPR)
+			}
+			if back := APRToDaily(apr); math.Abs(back-daily) > 1e-12 {
+				t.Errorf("APRToDaily(DailyToAPR(%v)) = %v, want the daily rate back", daily, back)
+			}
+			if got := CurrentAnnualization().Formula(); got != tt.formula {
+				t.Errorf("Formula() = %q, want %q", got, tt.formula)
+			}
+			if got, want := DailyToAPRPercent(daily), tt.wantAPR*100; math.Abs(got-want) > 1e-10 {
+				t.Errorf("DailyToAPRPercent(%v) = %v, want %v", daily, got, want)
+			}
+		})
+	}
+
+	// Compounding yields more than simple annualization over the same days
+	SetAnnualization(365, false)
+	simple := DailyToAPR(daily)
+	SetAnnualization(365, true)
+	if compound := DailyToAPR(daily); compound <= simple {
+		t.Errorf("compound APR %v, want more than simple APR %v", compound, simple)
+	}
+}
+
+func TestStatsFRRIgnoresAnnualizationDays(t *testing.T) {
+	defer SetAnnualization(DefaultAnnualizationDays, false)
+
+	const statsFRR = 0.0000005
+	for _, days := range []int{360, 365} {
+		SetAnnualization(days, false)
+		if got, want := StatsFRRToDaily(statsFRR), statsFRR*StatsFRRDays; math.Abs(got-want) > 1e-15 {
+			t.Errorf("%d days: StatsFRRToDaily = %v, want %v", days, got, want)
+		}
+		if got, want := StatsFRRToAPR(statsFRR), statsFRR*StatsFRRDays*float64(days); math.Abs(got-want) > 1e-12 {
+			t.Errorf("%d days: StatsFRRToAPR = %v, want %v", days, got, want)
+		}
+	}
+}
+
+func TestSetAnnualizationRejectsNonPositiveDays(t *testing.T) {
+	defer SetAnnualization(DefaultAnnualizationDays, false)
+
+	for _, days := range []int{0, -365} {
+		if err := SetAnnualization(days, false); err == nil {
+			t.Errorf("SetAnnualization(%d) succeeded, want an error", days)
+		}
+	}
+	if a := CurrentAnnualization(); a.Days != DefaultAnnualizationDays || a.Compound {
+		t.Errorf("annualization after rejected calls = %+v, want the default", a)
+	}
+}
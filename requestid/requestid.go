@@ -0,0 +1,42 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+)
+
+// Header is the HTTP header used to pass request IDs in and out of the API server
+const Header = "X-Request-ID"
+
+// contextKey is the type of the context key holding the request ID
+type contextKey struct{}
+
+// New generates a random request ID
+func New() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns a copy of ctx carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, if any
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok
+}
+
+// Logf logs like log.Printf, prefixing the message with the request ID from ctx when present
+func Logf(ctx context.Context, format string, args ...interface{}) {
+	if id, ok := FromContext(ctx); ok {
+		format = "[request " + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParentDeadlineCancelsTask(t *testing.T) {
+	s := NewScheduler(1, 10)
+	s.Start()
+	defer s.Stop()
+
+	task := s.NewPeriodicTask("blocking", time.Hour, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 1)
+	parent, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	task.SetParent(parent)
+
+	// The worker's context has no deadline, so only the caller's deadline ends the task
+	start := time.Now()
+	err := s.SubmitAndWait(context.Background(), task)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SubmitAndWait = %v, want context.DeadlineExceeded from the parent deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("task ran for %s after its parent's deadline", elapsed)
+	}
+}
+
+func TestBindContext(t *testing.T) {
+	// Canceling a parent without a deadline cancels the merged context
+	parent, cancelParent := context.WithCancel(context.Background())
+	task := &BaseTask{Name: "bound"}
+	task.SetParent(parent)
+
+	ctx, cancel := task.BindContext(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("merged context has a deadline, want none without a parent deadline")
+	}
+	cancelParent()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("merged context not canceled with its parent")
+	}
+
+	// The parent's deadline carries over
+	deadline := time.Now().Add(time.Hour)
+	parent, cancelParent = context.WithDeadline(context.Background(), deadline)
+	defer cancelParent()
+	task.SetParent(parent)
+	ctx, cancel = task.BindContext(context.Background())
+	defer cancel()
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(deadline) {
+		t.Errorf("merged deadline = %v, %v, want %v", got, ok, deadline)
+	}
+
+	// Without a parent the Execute context is used as is
+	worker, cancelWorker := context.WithCancel(context.Background())
+	ctx, cancel = (&BaseTask{Name: "unbound"}).BindContext(worker)
+	defer cancel()
+	cancelWorker()
+	if ctx.Err() == nil {
+		t.Error("context not canceled with the worker context")
+	}
+}
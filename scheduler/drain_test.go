@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countTask sleeps briefly and counts its runs
+type countTask struct {
+	BaseTask
+	runs *int32
+}
+
+func (t *countTask) Execute(ctx context.Context) error {
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt32(t.runs, 1)
+	return nil
+}
+
+func TestDrainWaitsForQueuedTasks(t *testing.T) {
+	const n = 20
+	s := NewScheduler(2, n)
+	s.Start()
+	defer s.Stop()
+
+	var runs int32
+	for i := 0; i < n; i++ {
+		s.SubmitTask(&countTask{BaseTask: BaseTask{Name: "count"}, runs: &runs})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if got := atomic.LoadInt32(&runs); got != n {
+		t.Fatalf("%d tasks ran before Drain returned, want %d", got, n)
+	}
+
+	err := s.SubmitAndWait(ctx, &countTask{BaseTask: BaseTask{Name: "late"}, runs: &runs})
+	if !errors.Is(err, ErrSchedulerDraining) {
+		t.Fatalf("SubmitAndWait after Drain = %v, want ErrSchedulerDraining", err)
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	s := NewScheduler(1, 1)
+	s.Start()
+
+	done := make(chan struct{})
+	go func() {
+		s.Stop()
+		s.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("second Stop did not return")
+	}
+}
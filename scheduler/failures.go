@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+)
+
+// TaskStatus reports whether a periodic task is still scheduled and how often it failed in a row
+type TaskStatus struct {
+	Name                string        `json:"name"`
+	Interval            time.Duration `json:"interval_ns"`
+	Disabled            bool          `json:"disabled"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+}
+
+// SetMaxConsecutiveFailures disables periodic tasks after this many consecutive failed runs.
+// Zero, the default, keeps failing tasks scheduled.
+func (s *Scheduler) SetMaxConsecutiveFailures(max int) {
+	if max < 0 {
+		max = 0
+	}
+
+	s.mu.Lock()
+	s.maxFailures = max
+	s.mu.Unlock()
+}
+
+// recordPeriodicResult tracks consecutive failures of periodic tasks, disabling a task once it
+// reaches the configured maximum. A successful run resets the count and re-enables the task.
+func (s *Scheduler) recordPeriodicResult(task Task, err error) {
+	periodic, ok := asPeriodic(task)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	maxFailures := s.maxFailures
+	s.mu.Unlock()
+
+	periodic.mu.Lock()
+	defer periodic.mu.Unlock()
+
+	if err == nil {
+		periodic.consecutiveFailures = 0
+		periodic.disabled = false
+		return
+	}
+
+	periodic.consecutiveFailures++
+	if maxFailures > 0 && periodic.consecutiveFailures >= maxFailures && !periodic.disabled {
+		periodic.disabled = true
+		log.Printf("Disabled task %s after %d consecutive failures, last error: %v", periodic.Name, periodic.consecutiveFailures, err)
+	}
+}
+
+// asPeriodic returns the periodic task behind task, unwrapping tasks submitted with SubmitAndWait
+func asPeriodic(task Task) (*PeriodicTask, bool) {
+	if wrapped, ok := task.(*waitTask); ok {
+		task = wrapped.Task
+	}
+	periodic, ok := task.(*PeriodicTask)
+	return periodic, ok
+}
+
+// GetTaskStatus returns the status of the named periodic task
+func (s *Scheduler) GetTaskStatus(name string) (TaskStatus, bool) {
+	task, ok := s.GetPeriodicTask(name)
+	if !ok {
+		return TaskStatus{}, false
+	}
+
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	return TaskStatus{
+		Name:                task.Name,
+		Interval:            task.interval,
+		Disabled:            task.disabled,
+		ConsecutiveFailures: task.consecutiveFailures,
+	}, true
+}
+
+// EnableTask re-enables a periodic task disabled after consecutive failures and resets its failure count
+func (s *Scheduler) EnableTask(name string) bool {
+	task, ok := s.GetPeriodicTask(name)
+	if !ok {
+		return false
+	}
+
+	task.mu.Lock()
+	task.disabled = false
+	task.consecutiveFailures = 0
+	task.mu.Unlock()
+	return true
+}
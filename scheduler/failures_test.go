@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForFailures waits until the named task has failed want times in a row and returns its status.
+// SubmitAndWait returns once the task has run, slightly before the worker records the result.
+func waitForFailures(t *testing.T, s *Scheduler, name string, want int) TaskStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, ok := s.GetTaskStatus(name)
+		if !ok {
+			t.Fatalf("no status for task %s", name)
+		}
+		if status.ConsecutiveFailures == want {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task %s consecutive failures = %d, want %d", name, status.ConsecutiveFailures, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAlwaysFailingTaskDisabledAfterThreshold(t *testing.T) {
+	s := NewScheduler(1, 10)
+	s.SetMaxConsecutiveFailures(2)
+	s.Start()
+	defer s.Stop()
+
+	var runs int32
+	task := s.NewPeriodicTask("failing", time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("unknown currency")
+	}, 0)
+
+	// The periodic handler runs the overdue task on each tick until it is disabled
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status, ok := s.GetTaskStatus("failing")
+		if !ok {
+			t.Fatal("no status for a registered task")
+		}
+		if status.Disabled {
+			if status.ConsecutiveFailures != 2 {
+				t.Errorf("disabled after %d consecutive failures, want 2", status.ConsecutiveFailures)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task was not disabled, status %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// It is no longer queued although it is long overdue
+	if task.ShouldRun() {
+		t.Error("ShouldRun reported a disabled task as due")
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if got := atomic.LoadInt32(&runs); got != 2 {
+		t.Errorf("task ran %d times, want 2", got)
+	}
+
+	// Re-enabling resets the failure count and schedules it again
+	if !s.EnableTask("failing") {
+		t.Fatal("EnableTask did not find the task")
+	}
+	if status, _ := s.GetTaskStatus("failing"); status.Disabled || status.ConsecutiveFailures != 0 {
+		t.Errorf("status after EnableTask = %+v, want enabled without failures", status)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&runs) == 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("re-enabled task did not run again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSuccessfulRunResetsConsecutiveFailures(t *testing.T) {
+	s := NewScheduler(1, 10)
+	s.SetMaxConsecutiveFailures(2)
+	s.Start()
+	defer s.Stop()
+
+	var fail atomic.Bool
+	task := s.NewPeriodicTask("flaky", time.Hour, func(ctx context.Context) error {
+		if fail.Load() {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}, 0)
+
+	// Failures separated by a success never reach the threshold
+	for _, shouldFail := range []bool{true, false, true} {
+		fail.Store(shouldFail)
+		s.SubmitAndWait(context.Background(), task)
+	}
+
+	if status := waitForFailures(t, s, "flaky", 1); status.Disabled {
+		t.Errorf("status = %+v, want enabled", status)
+	}
+	if _, ok := s.GetTaskStatus("missing"); ok {
+		t.Error("status reported for an unknown task")
+	}
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import "time"
+
+// defaultHistorySize is the number of executions kept per task name
+const defaultHistorySize = 50
+
+// TaskExecution records a single execution of a task
+type TaskExecution struct {
+	StartTime time.Time     `json:"start_time"`
+	Duration  time.Duration `json:"duration_ns"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// recordExecution appends an execution to the bounded history of the named task
+func (s *Scheduler) recordExecution(name string, startTime time.Time, err error) {
+	execution := TaskExecution{
+		StartTime: startTime,
+		Duration:  time.Since(startTime),
+	}
+	if err != nil {
+		execution.Error = err.Error()
+	}
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	executions := append(s.history[name], execution)
+	if len(executions) > s.historySize {
+		executions = executions[len(executions)-s.historySize:]
+	}
+	s.history[name] = executions
+}
+
+// GetTaskHistory returns the most recent executions of the named task, oldest first.
+// The second return value is false if the task has never been executed.
+func (s *Scheduler) GetTaskHistory(name string) ([]TaskExecution, bool) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	executions, ok := s.history[name]
+	if !ok {
+		return nil, false
+	}
+
+	result := make([]TaskExecution, len(executions))
+	copy(result, executions)
+	return result, true
+}
+
+// SetHistorySize changes the number of executions kept per task
+func (s *Scheduler) SetHistorySize(size int) {
+	if size <= 0 {
+		return
+	}
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	s.historySize = size
+	for name, executions := range s.history {
+		if len(executions) > size {
+			s.history[name] = executions[len(executions)-size:]
+		}
+	}
+}
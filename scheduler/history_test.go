@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// resultTask returns err when executed
+type resultTask struct {
+	BaseTask
+	err error
+}
+
+func (t *resultTask) Execute(ctx context.Context) error {
+	return t.err
+}
+
+func TestTaskHistoryKeepsRecentExecutions(t *testing.T) {
+	s := NewScheduler(1, 10)
+	s.SetHistorySize(3)
+	s.Start()
+	defer s.Stop()
+
+	before := time.Now()
+	for i := 1; i <= 5; i++ {
+		var err error
+		if i%2 == 0 {
+			err = fmt.Errorf("run %d failed", i)
+		}
+		s.SubmitTask(&resultTask{BaseTask: BaseTask{Name: "flaky"}, err: err})
+	}
+	s.SubmitTask(&resultTask{BaseTask: BaseTask{Name: "other"}})
+
+	// The single worker runs the tasks in order, so the other task is recorded last
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := s.GetTaskHistory("other"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("tasks were not executed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	history, ok := s.GetTaskHistory("flaky")
+	if !ok {
+		t.Fatal("no history for an executed task")
+	}
+	// The window holds runs 3 to 5
+	wantErrors := []string{"", "run 4 failed", ""}
+	if len(history) != len(wantErrors) {
+		t.Fatalf("%d executions in history, want %d: %+v", len(history), len(wantErrors), history)
+	}
+	for i, execution := range history {
+		if execution.Error != wantErrors[i] {
+			t.Errorf("execution %d error = %q, want %q", i, execution.Error, wantErrors[i])
+		}
+		if execution.StartTime.Before(before) || execution.Duration < 0 {
+			t.Errorf("execution %d started %v after %v with duration %v", i, execution.StartTime, before, execution.Duration)
+		}
+		if i > 0 && execution.StartTime.Before(history[i-1].StartTime) {
+			t.Errorf("execution %d is older than execution %d, want oldest first", i, i-1)
+		}
+	}
+
+	if other, ok := s.GetTaskHistory("other"); !ok || len(other) != 1 {
+		t.Errorf("history of other = %+v, %v, want its single execution", other, ok)
+	}
+	if _, ok := s.GetTaskHistory("never"); ok {
+		t.Error("history reported for a task that never ran")
+	}
+
+	// Shrinking the window trims the kept executions
+	s.SetHistorySize(1)
+	if history, _ := s.GetTaskHistory("flaky"); len(history) != 1 || history[0].Error != "" {
+		t.Errorf("history after SetHistorySize(1) = %+v, want the latest execution only", history)
+	}
+}
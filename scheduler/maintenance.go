@@ -0,0 +1,205 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// maintenanceCheckTimeout bounds a single call of the maintenance check
+const maintenanceCheckTimeout = 10 * time.Second
+
+// MaintenanceCheck reports whether the upstream platform is in maintenance
+type MaintenanceCheck func(ctx context.Context) (bool, error)
+
+// MaintenanceStatus reports whether periodic tasks are held back by platform maintenance
+type MaintenanceStatus struct {
+	Enabled       bool       `json:"enabled"`
+	InMaintenance bool       `json:"in_maintenance"`
+	Since         *time.Time `json:"since,omitempty"`      // Start of the current maintenance
+	NextCheck     *time.Time `json:"next_check,omitempty"` // Next recovery check during maintenance
+	Checks        int        `json:"checks"`               // Maintenance checks made so far
+	Maintenances  int        `json:"maintenances"`         // Maintenance periods detected so far
+}
+
+// maintenanceGate holds the maintenance state of a Scheduler; guarded by Scheduler.mu
+type maintenanceGate struct {
+	check       MaintenanceCheck
+	minInterval time.Duration
+	maxInterval time.Duration
+
+	active       bool
+	checking     bool
+	since        time.Time
+	lastCheck    time.Time
+	nextCheck    time.Time
+	checks       int
+	maintenances int
+}
+
+// SetMaintenanceCheck makes the scheduler hold back periodic tasks while the platform is in maintenance.
+// When a periodic task fails, check is called at most once per minInterval; if it reports maintenance,
+// periodic tasks are skipped instead of queued, so they neither fail nor count towards
+// SetMaxConsecutiveFailures. The check is then repeated after minInterval, doubling up to maxInterval,
+// until the platform is operative again and due tasks run on the next tick. Tasks submitted directly
+// are still accepted. A nil check disables the gate.
+func (s *Scheduler) SetMaintenanceCheck(check MaintenanceCheck, minInterval, maxInterval time.Duration) {
+	if minInterval <= 0 {
+		minInterval = time.Second
+	}
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+
+	s.mu.Lock()
+	s.maintenance.check = check
+	s.maintenance.minInterval = minInterval
+	s.maintenance.maxInterval = maxInterval
+	s.mu.Unlock()
+}
+
+// GetMaintenanceStatus returns whether periodic tasks are currently held back by platform maintenance
+func (s *Scheduler) GetMaintenanceStatus() MaintenanceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := MaintenanceStatus{
+		Enabled:       s.maintenance.check != nil,
+		InMaintenance: s.maintenance.active,
+		Checks:        s.maintenance.checks,
+		Maintenances:  s.maintenance.maintenances,
+	}
+	if s.maintenance.active {
+		since := s.maintenance.since
+		status.Since = &since
+		if !s.maintenance.nextCheck.IsZero() {
+			nextCheck := s.maintenance.nextCheck
+			status.NextCheck = &nextCheck
+		}
+	}
+	return status
+}
+
+// inMaintenance reports whether periodic tasks are held back by platform maintenance
+func (s *Scheduler) inMaintenance() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.maintenance.active
+}
+
+// checkMaintenance starts a maintenance check in the background after a periodic task failed,
+// unless the gate is disabled, already active, or checked recently
+func (s *Scheduler) checkMaintenance() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gate := &s.maintenance
+	if gate.check == nil || gate.active || gate.checking || time.Since(gate.lastCheck) < gate.minInterval {
+		return
+	}
+	gate.checking = true
+
+	// Called from a worker, so the wait group cannot be at zero here
+	s.wg.Add(1)
+	go s.detectMaintenance()
+}
+
+// detectMaintenance runs the maintenance check and activates the gate if the platform is in maintenance
+func (s *Scheduler) detectMaintenance() {
+	defer s.wg.Done()
+
+	inMaintenance, err := s.runMaintenanceCheck()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maintenance.checking = false
+	if err != nil {
+		log.Printf("Maintenance check failed: %v", err)
+		return
+	}
+	if !inMaintenance {
+		return
+	}
+
+	s.maintenance.active = true
+	s.maintenance.since = time.Now()
+	s.maintenance.maintenances++
+	log.Printf("Platform is in maintenance, skipping periodic tasks until it recovers")
+
+	s.wg.Add(1)
+	go s.awaitRecovery()
+}
+
+// awaitRecovery repeats the maintenance check with exponential backoff and lifts the gate once the
+// platform is operative. A failing check keeps the gate, as the platform may still be unreachable.
+func (s *Scheduler) awaitRecovery() {
+	defer s.wg.Done()
+
+	s.mu.Lock()
+	delay := s.maintenance.minInterval
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		s.maintenance.nextCheck = time.Now().Add(delay)
+		maxInterval := s.maintenance.maxInterval
+		s.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-s.quit:
+			timer.Stop()
+			return
+		}
+
+		inMaintenance, err := s.runMaintenanceCheck()
+		if err == nil && !inMaintenance {
+			s.mu.Lock()
+			log.Printf("Platform recovered after %v of maintenance, resuming periodic tasks", time.Since(s.maintenance.since).Round(time.Second))
+			s.maintenance.active = false
+			s.maintenance.nextCheck = time.Time{}
+			s.mu.Unlock()
+			return
+		}
+		if err != nil {
+			log.Printf("Maintenance recovery check failed: %v", err)
+		}
+
+		delay *= 2
+		if delay > maxInterval {
+			delay = maxInterval
+		}
+	}
+}
+
+// runMaintenanceCheck calls the maintenance check with a timeout, cancelling it when the scheduler stops
+func (s *Scheduler) runMaintenanceCheck() (bool, error) {
+	s.mu.Lock()
+	check := s.maintenance.check
+	s.mu.Unlock()
+	if check == nil {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), maintenanceCheckTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	inMaintenance, err := check(ctx)
+
+	s.mu.Lock()
+	s.maintenance.lastCheck = time.Now()
+	s.maintenance.checks++
+	s.mu.Unlock()
+
+	return inMaintenance, err
+}
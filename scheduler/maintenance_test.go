@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor waits until cond holds, failing the test with msg after a few seconds
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMaintenanceSkipsPeriodicTasksUntilRecovery(t *testing.T) {
+	s := NewScheduler(1, 10)
+	s.SetMaxConsecutiveFailures(2)
+
+	var maintenance atomic.Bool
+	maintenance.Store(true)
+	var checks int32
+	s.SetMaintenanceCheck(func(ctx context.Context) (bool, error) {
+		atomic.AddInt32(&checks, 1)
+		return maintenance.Load(), nil
+	}, 50*time.Millisecond, 200*time.Millisecond)
+	s.Start()
+	defer s.Stop()
+
+	var runs int32
+	s.NewPeriodicTask("ticker", time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		if maintenance.Load() {
+			return errors.New("platform in maintenance")
+		}
+		return nil
+	}, 0)
+
+	// The first failing run triggers the check, which activates the gate
+	waitFor(t, "maintenance was not detected", func() bool { return s.GetMaintenanceStatus().InMaintenance })
+	status := s.GetMaintenanceStatus()
+	if !status.Enabled || status.Maintenances != 1 || status.Since == nil {
+		t.Errorf("status = %+v, want one maintenance in progress", status)
+	}
+
+	// While the gate is active the overdue task is skipped, and the platform is re-checked
+	skippedFrom := atomic.LoadInt32(&runs)
+	time.Sleep(1500 * time.Millisecond)
+	if got := atomic.LoadInt32(&runs); got != skippedFrom {
+		t.Errorf("task ran %d times during maintenance, want it skipped", got-skippedFrom)
+	}
+	if got := atomic.LoadInt32(&checks); got < 3 {
+		t.Errorf("%d maintenance checks, want repeated re-checks", got)
+	}
+	if status := s.GetMaintenanceStatus(); status.NextCheck == nil {
+		t.Errorf("status = %+v, want the next re-check", status)
+	}
+	if task, _ := s.GetTaskStatus("ticker"); task.Disabled {
+		t.Errorf("task status = %+v, want it kept enabled during maintenance", task)
+	}
+
+	// Once the platform recovers the task runs again and succeeds
+	maintenance.Store(false)
+	waitFor(t, "gate was not lifted after recovery", func() bool { return !s.GetMaintenanceStatus().InMaintenance })
+	waitFor(t, "task did not resume after recovery", func() bool { return atomic.LoadInt32(&runs) > skippedFrom })
+	waitFor(t, "resumed run did not succeed", func() bool {
+		task, _ := s.GetTaskStatus("ticker")
+		return task.ConsecutiveFailures == 0
+	})
+	if status := s.GetMaintenanceStatus(); status.Since != nil || status.NextCheck != nil {
+		t.Errorf("status after recovery = %+v, want no maintenance in progress", status)
+	}
+}
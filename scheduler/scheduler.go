@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -22,9 +23,47 @@ type RetryPolicy struct {
 
 // BaseTask provides a basic implementation of a task
 type BaseTask struct {
-	Name        string      // Task name
-	Priority    int         // Task priority, higher numbers mean higher priority
-	RetryPolicy RetryPolicy // Retry strategy
+	Name        string          // Task name
+	Priority    int             // Task priority, higher numbers mean higher priority
+	RetryPolicy RetryPolicy     // Retry strategy
+	Parent      context.Context // Optional caller context whose deadline and cancellation also bound Execute
+}
+
+// SetParent sets the caller context whose deadline and cancellation bound the task's execution
+func (t *BaseTask) SetParent(parent context.Context) {
+	t.Parent = parent
+}
+
+// BindContext merges the context passed to Execute with the task's parent context, if any.
+// The returned context carries the parent's deadline and is canceled when either context is done;
+// the cancel function must be called once the task finishes.
+func (t *BaseTask) BindContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.Parent == nil {
+		return context.WithCancel(ctx)
+	}
+
+	var merged context.Context
+	var cancel context.CancelFunc
+	deadline, hasDeadline := t.Parent.Deadline()
+	if hasDeadline {
+		merged, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		merged, cancel = context.WithCancel(ctx)
+	}
+
+	parent := t.Parent
+	stop := context.AfterFunc(parent, func() {
+		// An expired parent deadline ends merged by its own deadline, reporting DeadlineExceeded
+		// rather than Canceled
+		if hasDeadline && errors.Is(parent.Err(), context.DeadlineExceeded) {
+			return
+		}
+		cancel()
+	})
+	return merged, func() {
+		stop()
+		cancel()
+	}
 }
 
 // GetName returns the task name
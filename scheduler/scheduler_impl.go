@@ -2,10 +2,22 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrSchedulerStopped is returned when a task is submitted to a stopped scheduler
+var ErrSchedulerStopped = errors.New("scheduler stopped")
+
+// ErrSchedulerDraining is returned when a task is submitted to a scheduler that is being drained
+var ErrSchedulerDraining = errors.New("scheduler draining")
+
+// ErrTaskRunning is returned by PeriodicTask.Execute when the same task instance is already executing
+var ErrTaskRunning = errors.New("task is already running")
+
 // Scheduler implements the TaskScheduler interface
 type Scheduler struct {
 	workers      int
@@ -15,16 +27,34 @@ type Scheduler struct {
 	mu           sync.Mutex
 	wg           sync.WaitGroup
 	quit         chan struct{}
+	stopOnce     sync.Once
+	ctx          context.Context // Passed to executed tasks, canceled by Stop
+	cancel       context.CancelFunc
+	history      map[string][]TaskExecution
+	historySize  int
+	historyMu    sync.Mutex
+	jitter       time.Duration
+	paused       bool
+	draining     bool // Set by Drain, new tasks are rejected
+	maxFailures  int
+	maintenance  maintenanceGate // See SetMaintenanceCheck
+	running      int32           // Number of tasks being executed, accessed atomically
+	inFlight     int32           // Number of tasks queued or being executed, accessed atomically
 }
 
 // NewScheduler creates a new task scheduler
 func NewScheduler(workers, queueSize int) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Scheduler{
+		ctx:          ctx,
+		cancel:       cancel,
 		workers:      workers,
 		queueSize:    queueSize,
 		taskQueue:    make(chan Task, queueSize),
 		periodicTask: make(map[string]*PeriodicTask),
 		quit:         make(chan struct{}),
+		history:      make(map[string][]TaskExecution),
+		historySize:  defaultHistorySize,
 	}
 }
 
@@ -49,8 +79,23 @@ func (s *Scheduler) worker() {
 		select {
 		case task := <-s.taskQueue:
 			// Execute task
-			ctx := context.Background()
-			err := task.Execute(ctx)
+			startTime := time.Now()
+			atomic.AddInt32(&s.running, 1)
+			err := task.Execute(s.ctx)
+			atomic.AddInt32(&s.running, -1)
+			atomic.AddInt32(&s.inFlight, -1)
+			if errors.Is(err, ErrTaskRunning) {
+				// A duplicate submission of a task that is still executing did not run
+				continue
+			}
+			s.recordExecution(task.GetName(), startTime, err)
+			// Failures during platform maintenance do not count towards disabling the task
+			if err == nil || !s.inMaintenance() {
+				s.recordPeriodicResult(task, err)
+			}
+			if _, periodic := asPeriodic(task); err != nil && periodic {
+				s.checkMaintenance()
+			}
 
 			// If task execution fails and there's a retry policy, handle retry logic here
 			if err != nil {
@@ -76,12 +121,22 @@ func (s *Scheduler) periodicTaskHandler() {
 		select {
 		case <-ticker.C:
 			s.mu.Lock()
+			if s.paused || s.draining || s.maintenance.active {
+				s.mu.Unlock()
+				continue
+			}
+			tasks := make([]*PeriodicTask, 0, len(s.periodicTask))
 			for _, task := range s.periodicTask {
-				if task.ShouldRun() {
-					s.SubmitTask(task)
-				}
+				tasks = append(tasks, task)
 			}
 			s.mu.Unlock()
+
+			// trySubmit takes s.mu itself, so tasks are queued without holding it
+			for _, task := range tasks {
+				if task.claim() && !s.trySubmit(task) {
+					task.release()
+				}
+			}
 		case <-s.quit:
 			return
 		}
@@ -90,27 +145,200 @@ func (s *Scheduler) periodicTaskHandler() {
 
 // SubmitTask submits a task to the scheduler
 func (s *Scheduler) SubmitTask(task Task) {
+	s.trySubmit(task)
+}
+
+// trySubmit queues a task without blocking and reports whether it was queued.
+// Tasks are not queued while the scheduler is being drained.
+func (s *Scheduler) trySubmit(task Task) bool {
+	if s.isDraining() {
+		return false
+	}
+
+	// Counted before queueing so a worker finishing the task never sees the count below zero
+	atomic.AddInt32(&s.inFlight, 1)
 	select {
 	case s.taskQueue <- task:
-		// Task successfully submitted
+		return true
 	default:
-		// Queue is full, can add handling logic here
+		// Queue is full
+		atomic.AddInt32(&s.inFlight, -1)
+		return false
 	}
 }
 
-// Stop stops the scheduler
+// isDraining reports whether Drain has been called
+func (s *Scheduler) isDraining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.draining
+}
+
+// Drain stops accepting new tasks, including periodic runs, and blocks until every queued task
+// has been executed and no task is executing. It returns the context's error if ctx is done
+// first; the scheduler keeps rejecting new tasks either way. Call Stop afterwards to end the workers.
+func (s *Scheduler) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt32(&s.inFlight) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.quit:
+			return ErrSchedulerStopped
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// waitTask wraps a task and reports its result once it has been executed
+type waitTask struct {
+	Task
+	result chan error
+}
+
+// Execute runs the wrapped task and reports its result
+func (t *waitTask) Execute(ctx context.Context) error {
+	err := t.Task.Execute(ctx)
+	t.result <- err
+	return err
+}
+
+// SubmitAndWait queues a task, waiting for queue space if needed, and blocks until it has been executed.
+// It returns the task's error, or the context's error if ctx is done first.
+func (s *Scheduler) SubmitAndWait(ctx context.Context, task Task) error {
+	wrapped := &waitTask{
+		Task:   task,
+		result: make(chan error, 1),
+	}
+
+	if s.isDraining() {
+		return ErrSchedulerDraining
+	}
+
+	atomic.AddInt32(&s.inFlight, 1)
+	select {
+	case s.taskQueue <- wrapped:
+	case <-ctx.Done():
+		atomic.AddInt32(&s.inFlight, -1)
+		return ctx.Err()
+	case <-s.quit:
+		atomic.AddInt32(&s.inFlight, -1)
+		return ErrSchedulerStopped
+	}
+
+	select {
+	case err := <-wrapped.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetPeriodicTask returns the registered periodic task with the given name
+func (s *Scheduler) GetPeriodicTask(name string) (*PeriodicTask, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.periodicTask[name]
+	return task, ok
+}
+
+// SetJitter sets the maximum random startup offset given to periodic tasks created afterwards, see
+// PeriodicTask.StartupOffset. Offsetting each task's first run staggers tasks that share an interval
+// instead of firing them together.
+func (s *Scheduler) SetJitter(jitter time.Duration) {
+	if jitter < 0 {
+		jitter = 0
+	}
+
+	s.mu.Lock()
+	s.jitter = jitter
+	s.mu.Unlock()
+}
+
+// startupOffset returns a random offset in [0, jitter)
+func (s *Scheduler) startupOffset() time.Duration {
+	s.mu.Lock()
+	jitter := s.jitter
+	s.mu.Unlock()
+
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// Pause stops periodic tasks from being queued and waits until no task is executing.
+// Tasks submitted directly are still accepted. If ctx is done first the scheduler is resumed
+// and the context's error is returned.
+func (s *Scheduler) Pause(ctx context.Context) error {
+	s.mu.Lock()
+	s.paused = true
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt32(&s.running) > 0 || len(s.taskQueue) > 0 {
+		select {
+		case <-ctx.Done():
+			s.Resume()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// Resume lets periodic tasks be queued again after Pause
+func (s *Scheduler) Resume() {
+	s.mu.Lock()
+	s.paused = false
+	s.mu.Unlock()
+}
+
+// Stop stops the scheduler and cancels the context of executing tasks. Queued tasks that have not started
+// are dropped; use Drain first to run them. Calling Stop more than once is safe.
 func (s *Scheduler) Stop() {
-	close(s.quit)
+	s.stopOnce.Do(func() {
+		s.cancel()
+		close(s.quit)
+	})
 	s.wg.Wait()
 }
 
-// PeriodicTask represents a task that runs periodically
+// PeriodicTask represents a task that runs periodically.
+//
+// One instance may be submitted from several places at once: the periodic loop, SubmitTask calls at
+// startup or from the admin API, and ScheduleRecurring. All fields are guarded by mu, and an instance
+// never runs twice simultaneously:
+//   - the periodic loop claims a due task before queueing it, and does not queue it again while it is
+//     queued or executing, so a slow run or a backed up queue does not pile up copies;
+//   - Execute itself refuses to start while the same instance is executing and returns ErrTaskRunning,
+//     which covers submissions that bypass the periodic loop. Such skipped runs are not recorded.
 type PeriodicTask struct {
 	BaseTask
 	interval time.Duration
-	lastRun  time.Time
+	offset   time.Duration // Random startup offset, see StartupOffset
+	lastRun  time.Time     // Start of the latest execution
 	runFunc  func(ctx context.Context) error
 	mu       sync.Mutex
+
+	pending bool // Queued by the periodic loop or executing
+	running bool // Executing
+
+	consecutiveFailures int
+	disabled            bool // Set after too many consecutive failures, see SetMaxConsecutiveFailures
 }
 
 // NewPeriodicTask creates a new periodic task
@@ -125,6 +353,7 @@ func (s *Scheduler) NewPeriodicTask(name string, interval time.Duration, runFunc
 			},
 		},
 		interval: interval,
+		offset:   s.startupOffset(),
 		lastRun:  time.Now(),
 		runFunc:  runFunc,
 	}
@@ -136,21 +365,73 @@ func (s *Scheduler) NewPeriodicTask(name string, interval time.Duration, runFunc
 	return task
 }
 
-// Execute runs the periodic task
+// Interval returns how often the task runs
+func (p *PeriodicTask) Interval() time.Duration {
+	return p.interval
+}
+
+// StartupOffset returns the random offset in [0, jitter) drawn when the task was created. Submit the
+// first run with ScheduleWithDelay(ctx, task, task.StartupOffset()) instead of SubmitTask; since every
+// later run is measured from the start of the previous one, the stagger carries over to them.
+func (p *PeriodicTask) StartupOffset() time.Duration {
+	return p.offset
+}
+
+// Execute runs the periodic task, or returns ErrTaskRunning if it is already executing
 func (p *PeriodicTask) Execute(ctx context.Context) error {
 	p.mu.Lock()
+	if p.running {
+		p.mu.Unlock()
+		return ErrTaskRunning
+	}
+	p.running = true
+	p.pending = true
 	p.lastRun = time.Now()
 	p.mu.Unlock()
 
+	defer func() {
+		p.mu.Lock()
+		p.running = false
+		p.pending = false
+		p.mu.Unlock()
+	}()
+
+	ctx, cancel := p.BindContext(ctx)
+	defer cancel()
+
 	return p.runFunc(ctx)
 }
 
-// ShouldRun checks if the task should be executed
+// ShouldRun checks if the task should be executed: it is enabled, due, and neither queued nor executing
 func (p *PeriodicTask) ShouldRun() bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	return time.Since(p.lastRun) >= p.interval
+	return p.due()
+}
+
+// due reports whether the task should be executed; p.mu must be held
+func (p *PeriodicTask) due() bool {
+	return !p.disabled && !p.pending && time.Since(p.lastRun) >= p.interval
+}
+
+// claim marks a due task as pending and reports whether it did, so the caller is the only one queueing it
+func (p *PeriodicTask) claim() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.due() {
+		return false
+	}
+	p.pending = true
+	return true
+}
+
+// release clears the pending mark of a claimed task that could not be queued
+func (p *PeriodicTask) release() {
+	p.mu.Lock()
+	p.pending = false
+	p.mu.Unlock()
 }
 
 // Schedule implements the TaskScheduler interface
@@ -200,8 +481,12 @@ func (s *Scheduler) Cancel(taskName string) error {
 	return nil
 }
 
-// StartWithContext implements the Start method of the TaskScheduler interface, but accepts a context parameter
+// StartWithContext implements the Start method of the TaskScheduler interface, but accepts a context parameter.
+// Executed tasks get a context derived from ctx, so canceling it cancels running tasks like Stop does.
+// It must be called instead of Start, not after it.
 func (s *Scheduler) StartWithContext(ctx context.Context) error {
+	s.cancel()
+	s.ctx, s.cancel = context.WithCancel(ctx)
 	s.Start()
 	return nil
 }
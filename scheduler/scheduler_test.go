@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStartupOffsetWithinJitter(t *testing.T) {
+	s := NewScheduler(1, 1)
+
+	task := s.NewPeriodicTask("none", time.Hour, func(ctx context.Context) error { return nil }, 0)
+	if got := task.StartupOffset(); got != 0 {
+		t.Fatalf("StartupOffset without jitter = %s, want 0", got)
+	}
+
+	s.SetJitter(time.Second)
+	for i := 0; i < 100; i++ {
+		task := s.NewPeriodicTask("jittered", time.Hour, func(ctx context.Context) error { return nil }, 0)
+		if got := task.StartupOffset(); got < 0 || got >= time.Second {
+			t.Fatalf("StartupOffset = %s, want within [0, 1s)", got)
+		}
+	}
+}
+
+func TestFirstRunDelayedByStartupOffset(t *testing.T) {
+	s := NewScheduler(1, 1)
+	s.SetJitter(time.Second)
+	s.Start()
+	defer s.Stop()
+
+	ran := make(chan time.Time, 1)
+	task := s.NewPeriodicTask("delayed", time.Hour, func(ctx context.Context) error {
+		ran <- time.Now()
+		return nil
+	}, 0)
+
+	start := time.Now()
+	s.ScheduleWithDelay(context.Background(), task, task.StartupOffset())
+
+	select {
+	case at := <-ran:
+		if elapsed := at.Sub(start); elapsed < task.StartupOffset() {
+			t.Fatalf("first run after %s, want at least the startup offset %s", elapsed, task.StartupOffset())
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("first run did not happen")
+	}
+}
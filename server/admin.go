@@ -0,0 +1,153 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gary0122g/BitfinexFundingData/requestid"
+	"github.com/gary0122g/BitfinexFundingData/scheduler"
+	"github.com/gorilla/mux"
+)
+
+// collectionTaskNames maps a collection type to the names of the periodic tasks that collect it.
+// The names match the tasks registered by main for each currency.
+var collectionTaskNames = map[string][]string{
+	"stats":  {"FundingStats_%s"},
+	"ticker": {"FundingTicker_%s"},
+	"book":   {"RawFundingBook_%s", "FundingBook_%s"},
+}
+
+// requireAdmin only lets requests through that carry the configured admin token as a bearer token.
+// Admin endpoints are disabled when no token is configured.
+func (s *APIServer) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handleCollect processes requests to run a currency's collection task immediately.
+// By default it waits for the task to finish; with async=true it returns 202 once queued.
+func (s *APIServer) handleCollect(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "Scheduler is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	collectionType := r.URL.Query().Get("type")
+	nameFormats, ok := collectionTaskNames[collectionType]
+	if !ok {
+		http.Error(w, "Invalid type parameter, expected stats, ticker or book", http.StatusBadRequest)
+		return
+	}
+
+	var taskNames []string
+	for _, nameFormat := range nameFormats {
+		name := fmt.Sprintf(nameFormat, currency)
+		if _, ok := s.scheduler.GetPeriodicTask(name); !ok {
+			http.Error(w, "No collection task registered: "+name, http.StatusNotFound)
+			return
+		}
+		taskNames = append(taskNames, name)
+	}
+
+	if r.URL.Query().Get("async") == "true" {
+		for _, name := range taskNames {
+			task, _ := s.scheduler.GetPeriodicTask(name)
+			s.scheduler.SubmitTask(task)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tasks":  taskNames,
+			"status": "queued",
+		})
+		return
+	}
+
+	for _, name := range taskNames {
+		task, _ := s.scheduler.GetPeriodicTask(name)
+		if err := s.scheduler.SubmitAndWait(r.Context(), task); errors.Is(err, scheduler.ErrTaskRunning) {
+			http.Error(w, fmt.Sprintf("Collection task %s is already running", name), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Collection task %s failed: %v", name, err), http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tasks":  taskNames,
+		"status": "completed",
+	})
+}
+
+// handleVacuum processes requests to compact the database. Collection is paused and streamed trades
+// are held in memory while VACUUM runs so it does not compete with scheduled or streamed writes.
+func (s *APIServer) handleVacuum(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler != nil {
+		if err := s.scheduler.Pause(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to pause collection: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		defer s.scheduler.Resume()
+	}
+	if s.trades != nil {
+		s.trades.Hold()
+		defer func() {
+			if err := s.trades.Release(); err != nil {
+				requestid.Logf(r.Context(), "Failed to flush funding trades held during vacuum: %v", err)
+			}
+		}()
+	}
+
+	result, err := s.database.Vacuum(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Vacuum failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleEnableTask processes requests to re-enable a periodic task disabled after consecutive failures
+func (s *APIServer) handleEnableTask(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "Scheduler is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if !s.scheduler.EnableTask(name) {
+		http.Error(w, "No periodic task registered: "+name, http.StatusNotFound)
+		return
+	}
+
+	status, _ := s.scheduler.GetTaskStatus(name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
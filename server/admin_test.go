@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/scheduler"
+)
+
+// postAdmin serves a POST request for target carrying token as a bearer token, omitted when empty
+func postAdmin(t *testing.T, s *APIServer, target, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCollectRunsTaskAndSaves(t *testing.T) {
+	d := newTestDatabase(t)
+
+	sched := scheduler.NewScheduler(1, 10)
+	sched.Start()
+	defer sched.Stop()
+	// Registered like main does; the long interval keeps the periodic loop from running it
+	sched.NewPeriodicTask("FundingTicker_fUSD", time.Hour, func(ctx context.Context) error {
+		_, err := d.SaveFundingTicker("fUSD", api.FundingTicker{FRR: 0.0001, Bid: 0.0002, Ask: 0.0003})
+		return err
+	}, 3)
+
+	s := NewAPIServerWithConfig(d, Config{Scheduler: sched, AdminToken: "secret"})
+
+	if rec := postAdmin(t, s, "/api/collect/USD?type=ticker", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status without token = %d, want 401", rec.Code)
+	}
+	if rec := postAdmin(t, s, "/api/collect/USD?type=ticker", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status with a wrong token = %d, want 401", rec.Code)
+	}
+	if n := countRows(t, d, "funding_ticker"); n != 0 {
+		t.Fatalf("%d tickers saved by unauthorized requests, want 0", n)
+	}
+
+	rec := postAdmin(t, s, "/api/collect/USD?type=ticker", "secret")
+	var result struct {
+		Tasks  []string `json:"tasks"`
+		Status string   `json:"status"`
+	}
+	decodeJSON(t, rec, &result)
+	if result.Status != "completed" || len(result.Tasks) != 1 || result.Tasks[0] != "FundingTicker_fUSD" {
+		t.Errorf("response = %+v, want FundingTicker_fUSD completed", result)
+	}
+	// The request returns once the task has run, so the ticker is already saved
+	if n := countRows(t, d, "funding_ticker"); n != 1 {
+		t.Errorf("%d tickers saved, want 1", n)
+	}
+
+	for target, want := range map[string]int{
+		"/api/collect/USD?type=trades": http.StatusBadRequest,
+		"/api/collect/BTC?type=ticker": http.StatusNotFound,
+		"/api/collect/USD?type=book":   http.StatusNotFound, // No book tasks registered
+	} {
+		if rec := postAdmin(t, s, target, "secret"); rec.Code != want {
+			t.Errorf("%s status = %d, want %d", target, rec.Code, want)
+		}
+	}
+
+	if rec := postAdmin(t, NewAPIServerWithConfig(d, Config{Scheduler: sched}), "/api/collect/USD?type=ticker", "secret"); rec.Code != http.StatusForbidden {
+		t.Errorf("status without a configured admin token = %d, want 403", rec.Code)
+	}
+}
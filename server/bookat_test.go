@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestFundingBookAtTimestamp(t *testing.T) {
+	d := newTestDatabase(t)
+	for mts, books := range map[int64][]api.FundingBook{
+		1000: {{Rate: 0.0001, Period: 2, Count: 1, Amount: -100}, {Rate: 0.0002, Period: 2, Count: 1, Amount: 100}},
+		2000: {
+			{Rate: 0.0003, Period: 2, Count: 1, Amount: -300},
+			{Rate: 0.0004, Period: 2, Count: 2, Amount: -400},
+			{Rate: 0.0006, Period: 30, Count: 1, Amount: 600},
+			{Rate: 0.0005, Period: 30, Count: 1, Amount: 500},
+		},
+	} {
+		for _, book := range books {
+			if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, mts, book); err != nil {
+				t.Fatalf("SaveFundingBookAt: %v", err)
+			}
+		}
+	}
+	s := NewAPIServer(d)
+
+	var book FundingBookAt
+	decodeJSON(t, get(t, s, "/api/funding-book/USD/at/2000"), &book)
+	if !book.Exact || book.Timestamp != 2000 || book.Requested != 2000 || book.Currency != "fUSD" || book.Precision != "P0" {
+		t.Errorf("exact lookup = %+v, want the snapshot at 2000", book)
+	}
+	if len(book.Bids) != 2 || book.Bids[0].Rate != 0.0004 || len(book.Asks) != 2 || book.Asks[0].Rate != 0.0005 {
+		t.Errorf("exact lookup ladder = %+v, want 2 bids from 0.0004 and 2 asks from 0.0005", book.FundingLadder)
+	}
+
+	// Between snapshots the earlier one is returned
+	decodeJSON(t, get(t, s, "/api/funding-book/fUSD/at/1999"), &book)
+	if book.Exact || book.Timestamp != 1000 || book.Requested != 1999 || len(book.Bids) != 1 || book.Bids[0].Rate != 0.0001 {
+		t.Errorf("nearest lookup = %+v, want the snapshot at 1000", book)
+	}
+
+	for path, want := range map[string]int{
+		"/api/funding-book/USD/at/999":               http.StatusNotFound,
+		"/api/funding-book/USD/at/2000?precision=p1": http.StatusNotFound,
+		"/api/funding-book/USD/at/abc":               http.StatusBadRequest,
+		"/api/funding-book/USD/at/0":                 http.StatusBadRequest,
+	} {
+		if rec := get(t, s, path); rec.Code != want {
+			t.Errorf("%s status = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestFundingCalendarSeriesPerPeriod(t *testing.T) {
+	d := newTestDatabase(t)
+	snapshots := map[int64][]api.RawFundingBook{
+		1000: {
+			{OfferID: 1, Period: 2, Rate: 0.0001, Amount: 100},
+			{OfferID: 2, Period: 2, Rate: 0.0002, Amount: 50},
+			{OfferID: 3, Period: 30, Rate: 0.0003, Amount: 200},
+			{OfferID: 4, Period: 2, Rate: 0.00005, Amount: -500}, // Bids are not offered funding
+		},
+		2000: {
+			{OfferID: 1, Period: 2, Rate: 0.0001, Amount: 80},
+			{OfferID: 5, Period: 120, Rate: 0.0004, Amount: 1000},
+		},
+		9000: { // Outside the range
+			{OfferID: 6, Period: 2, Rate: 0.0001, Amount: 999},
+		},
+	}
+	for mts, offers := range snapshots {
+		for _, offer := range offers {
+			if _, err := d.SaveRawFundingBookAt("fUSD", mts, offer); err != nil {
+				t.Fatalf("SaveRawFundingBookAt: %v", err)
+			}
+		}
+	}
+
+	var calendar FundingCalendar
+	decodeJSON(t, get(t, NewAPIServer(d), "/api/funding-calendar/USD?start=0&end=5000"), &calendar)
+
+	if calendar.Currency != "fUSD" || calendar.Start != 0 || calendar.End != 5000 {
+		t.Errorf("calendar = %s %d-%d, want fUSD 0-5000", calendar.Currency, calendar.Start, calendar.End)
+	}
+	if fmt.Sprint(calendar.Periods) != "[2 30 120]" {
+		t.Errorf("periods = %v, want [2 30 120]", calendar.Periods)
+	}
+	want := map[int][]FundingCalendarPoint{
+		2:   {{MTS: 1000, Amount: 150, Offers: 2}, {MTS: 2000, Amount: 80, Offers: 1}},
+		30:  {{MTS: 1000, Amount: 200, Offers: 1}},
+		120: {{MTS: 2000, Amount: 1000, Offers: 1}},
+	}
+	if len(calendar.Series) != len(want) {
+		t.Fatalf("series = %+v, want %d periods", calendar.Series, len(want))
+	}
+	for period, points := range want {
+		if fmt.Sprint(calendar.Series[period]) != fmt.Sprint(points) {
+			t.Errorf("period %d series = %+v, want %+v", period, calendar.Series[period], points)
+		}
+	}
+}
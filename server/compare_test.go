@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestFRRComparisonAlignsBuckets(t *testing.T) {
+	d := newTestDatabase(t)
+	hour := time.Hour.Milliseconds()
+	for _, row := range []struct {
+		currency string
+		mts      int64
+		frr      float64
+	}{
+		{"fUSD", 10 * 60 * 1000, 0.0000001},
+		{"fUSD", hour + 30*60*1000, 0.0000002},
+		{"fUSD", 2*hour + 5*60*1000, 0.0000003},
+		{"fUST", 50 * 60 * 1000, 0.0000004},
+		{"fUST", 2*hour + 40*60*1000, 0.0000005},
+	} {
+		if _, err := d.SaveFundingStats(row.currency, api.FundingStats{MTS: row.mts, FRR: row.frr, FRRRaw: row.frr}); err != nil {
+			t.Fatalf("SaveFundingStats: %v", err)
+		}
+	}
+	s := NewAPIServer(d)
+
+	var comparison FRRComparison
+	decodeJSON(t, get(t, s, "/api/frr-compare?currencies=USD,fUST,BTC&start=0&end=10800000&interval=1h"), &comparison)
+
+	wantBuckets := []int64{0, hour, 2 * hour}
+	if len(comparison.Buckets) != len(wantBuckets) {
+		t.Fatalf("buckets = %v, want %v", comparison.Buckets, wantBuckets)
+	}
+	for i, bucket := range wantBuckets {
+		if comparison.Buckets[i] != bucket {
+			t.Fatalf("buckets = %v, want %v", comparison.Buckets, wantBuckets)
+		}
+	}
+
+	for currency, want := range map[string][]float64{
+		"fUSD": {0.0000001, 0.0000002, 0.0000003},
+		"fUST": {0.0000004, 0, 0.0000005}, // No fUST row in the second hour
+		"fBTC": {0, 0, 0},                 // No fBTC data at all
+	} {
+		series, ok := comparison.Series[currency]
+		if !ok || len(series) != len(wantBuckets) {
+			t.Errorf("%s series = %v, want one value per bucket", currency, series)
+			continue
+		}
+		for i, frr := range want {
+			switch {
+			case frr == 0 && series[i] != nil:
+				t.Errorf("%s bucket %d = %v, want null", currency, i, *series[i])
+			case frr != 0 && (series[i] == nil || *series[i] != s.frrScaling.frr(frr)):
+				t.Errorf("%s bucket %d = %v, want %v", currency, i, series[i], s.frrScaling.frr(frr))
+			}
+		}
+	}
+
+	if rec := get(t, s, "/api/frr-compare"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status without currencies = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestCoverageReportsSpanAndCounts(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, mts := range []int64{3000, 1000, 5000} {
+		if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: mts, FRR: 0.0000004, FundingAmount: 100}); err != nil {
+			t.Fatalf("SaveFundingStats: %v", err)
+		}
+	}
+	for i, mts := range []int64{8000, 2000} {
+		if _, err := d.SaveWSFundingTrade("fUSD", api.FundingTrade{ID: int64(i + 1), MTS: mts, Amount: 10, Rate: 0.0001, Period: 2}, "ftu"); err != nil {
+			t.Fatalf("SaveWSFundingTrade: %v", err)
+		}
+	}
+	for _, row := range []struct {
+		mts  int64
+		rate float64
+	}{{4000, 0.0001}, {4000, 0.0002}, {6000, 0.0001}} {
+		if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, row.mts, api.FundingBook{Rate: row.rate, Period: 2, Count: 1, Amount: 10}); err != nil {
+			t.Fatalf("SaveFundingBookAt: %v", err)
+		}
+	}
+	// Rows of other currencies are not counted
+	if _, err := d.SaveFundingStats("fUST", api.FundingStats{MTS: 100, FRR: 0.0000004, FundingAmount: 1}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+
+	s := NewAPIServer(d)
+	var coverage db.DataCoverage
+	decodeJSON(t, get(t, s, "/api/coverage/USD"), &coverage)
+
+	if coverage.Currency != "fUSD" {
+		t.Errorf("currency = %q, want fUSD", coverage.Currency)
+	}
+	for name, tt := range map[string]struct {
+		got                     db.TableCoverage
+		earliest, latest, count int64
+	}{
+		"funding_stats":     {coverage.FundingStats, 1000, 5000, 3},
+		"ws_funding_trades": {coverage.WSFundingTrades, 2000, 8000, 2},
+		"funding_book":      {coverage.FundingBook, 4000, 6000, 3},
+	} {
+		if tt.got.Earliest == nil || tt.got.Latest == nil || *tt.got.Earliest != tt.earliest || *tt.got.Latest != tt.latest || tt.got.Count != tt.count {
+			t.Errorf("%s coverage = %+v, want %d rows from %d to %d", name, tt.got, tt.count, tt.earliest, tt.latest)
+		}
+	}
+
+	// A currency without data reports null bounds
+	rec := get(t, s, "/api/coverage/EUR")
+	if !strings.Contains(rec.Body.String(), `"funding_stats":{"earliest":null,"latest":null,"count":0}`) {
+		t.Errorf("coverage of an empty currency = %s, want null bounds and no rows", rec.Body.String())
+	}
+}
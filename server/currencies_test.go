@@ -0,0 +1,34 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCurrencyListEndpointsRejectOversizedLists(t *testing.T) {
+	s := NewAPIServer(newTestDatabase(t))
+
+	currencies := make([]string, maxCompareCurrencies+1)
+	for i := range currencies {
+		currencies[i] = fmt.Sprintf("C%02d", i)
+	}
+	list := strings.Join(currencies, ",")
+
+	for _, path := range []string{"/api/funding-books-latest", "/api/frr-compare", "/api/frr-correlation"} {
+		rec := get(t, s, path+"?currencies="+list)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s with %d currencies: status = %d, want 400", path, len(currencies), rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), fmt.Sprint(maxCompareCurrencies)) {
+			t.Errorf("%s: error %q does not state the cap", path, rec.Body.String())
+		}
+	}
+
+	// Duplicates are dropped before the cap is checked
+	duplicated := strings.Repeat("USD,BTC,", maxCompareCurrencies)
+	if rec := get(t, s, "/api/funding-books-latest?currencies="+duplicated); rec.Code != http.StatusOK {
+		t.Errorf("duplicated list: status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,519 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Response content types negotiated on the Accept header
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeMsgpack = "application/msgpack"
+)
+
+// negotiateContentType returns the response content type preferred by the Accept header of r. JSON is the
+// default and wins ties; application/x-msgpack is accepted as an alias of application/msgpack.
+func negotiateContentType(r *http.Request) string {
+	jsonQ, msgpackQ := -1.0, -1.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case contentTypeMsgpack, "application/x-msgpack":
+			msgpackQ = math.Max(msgpackQ, q)
+		case contentTypeJSON, "application/*", "*/*":
+			jsonQ = math.Max(jsonQ, q)
+		}
+	}
+
+	if msgpackQ > 0 && msgpackQ > jsonQ {
+		return contentTypeMsgpack
+	}
+	return contentTypeJSON
+}
+
+// writeResponse encodes v as JSON, or as MessagePack when the request prefers it. MessagePack bodies
+// carry the same fields as the JSON ones, named by the json tags, see marshalMsgpack.
+func writeResponse(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	if negotiateContentType(r) != contentTypeMsgpack {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+
+	body, err := marshalMsgpack(v)
+	if err != nil {
+		http.Error(w, "Failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeMsgpack)
+	w.Write(body)
+}
+
+// marshalMsgpack encodes v as MessagePack. Structs become maps with the fields and names encoding/json
+// would use, following the json tags; floats are always encoded as floats, so a whole float64 stays a
+// float64 for the consumer. Values with a custom JSON encoding, like timestamps, are encoded from it.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	return appendMsgpackValue(nil, reflect.ValueOf(v))
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// appendMsgpackValue appends the MessagePack encoding of v
+func appendMsgpackValue(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, 0xc0), nil
+	}
+	if v.Type().Implements(jsonMarshalerType) && !(v.Kind() == reflect.Pointer && v.IsNil()) {
+		return appendMsgpackJSON(buf, v.Interface().(json.Marshaler))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		return appendMsgpackValue(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u > math.MaxInt64 {
+			return binary.BigEndian.AppendUint64(append(buf, 0xcf), u), nil
+		}
+		return appendMsgpackInt(buf, int64(v.Uint())), nil
+	case reflect.Float32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xca), math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendMsgpackString(buf, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			buf = appendMsgpackHeader(buf, v.Len(), 0, 0, 0xc4, 0xc5, 0xc6)
+			return append(buf, v.Bytes()...), nil
+		}
+		return appendMsgpackArray(buf, v)
+	case reflect.Array:
+		return appendMsgpackArray(buf, v)
+	case reflect.Map:
+		return appendMsgpackMap(buf, v)
+	case reflect.Struct:
+		return appendMsgpackStruct(buf, v)
+	default:
+		return nil, fmt.Errorf("cannot encode %s as msgpack", v.Type())
+	}
+}
+
+// appendMsgpackArray appends the elements of a slice or array
+func appendMsgpackArray(buf []byte, v reflect.Value) ([]byte, error) {
+	buf = appendMsgpackHeader(buf, v.Len(), 0x90, 16, 0, 0xdc, 0xdd)
+	for i := 0; i < v.Len(); i++ {
+		var err error
+		if buf, err = appendMsgpackValue(buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendMsgpackMap appends a map with string or integer keys, keys sorted as by encoding/json
+func appendMsgpackMap(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.IsNil() {
+		return append(buf, 0xc0), nil
+	}
+
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var key string
+		switch k := iter.Key(); k.Kind() {
+		case reflect.String:
+			key = k.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			key = strconv.FormatInt(k.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			key = strconv.FormatUint(k.Uint(), 10)
+		default:
+			return nil, fmt.Errorf("cannot encode map key %s as msgpack", k.Type())
+		}
+		entries = append(entries, entry{key: key, value: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	buf = appendMsgpackHeader(buf, len(entries), 0x80, 16, 0, 0xde, 0xdf)
+	for _, e := range entries {
+		buf = appendMsgpackString(buf, e.key)
+		var err error
+		if buf, err = appendMsgpackValue(buf, e.value); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendMsgpackStruct appends a struct as a map of its JSON fields
+func appendMsgpackStruct(buf []byte, v reflect.Value) ([]byte, error) {
+	fields := jsonFieldsOf(v.Type())
+
+	values := make([]reflect.Value, 0, len(fields))
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		fv, ok := fieldByIndex(v, field.index)
+		if !ok || (field.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		values = append(values, fv)
+		names = append(names, field.name)
+	}
+
+	buf = appendMsgpackHeader(buf, len(values), 0x80, 16, 0, 0xde, 0xdf)
+	for i, fv := range values {
+		buf = appendMsgpackString(buf, names[i])
+		var err error
+		if buf, err = appendMsgpackValue(buf, fv); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendMsgpackJSON appends a value with a custom JSON encoding, decoding that encoding in order.
+// JSON numbers become integers when they have no fraction and fit in 64 bits.
+func appendMsgpackJSON(buf []byte, m json.Marshaler) ([]byte, error) {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgpack(buf, value)
+}
+
+// appendMsgpackString appends a MessagePack string
+func appendMsgpackString(buf []byte, s string) []byte {
+	buf = appendMsgpackHeader(buf, len(s), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	return append(buf, s...)
+}
+
+// jsonStructField is a struct field as encoded by encoding/json
+type jsonStructField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool
+}
+
+var jsonFieldCache sync.Map // reflect.Type -> []jsonStructField
+
+// jsonFieldsOf returns the fields encoding/json encodes for struct type t, in order: exported fields named
+// by their json tag, with the fields of untagged embedded structs promoted unless a shallower or tagged
+// field of the same name takes precedence
+func jsonFieldsOf(t reflect.Type) []jsonStructField {
+	if cached, ok := jsonFieldCache.Load(t); ok {
+		return cached.([]jsonStructField)
+	}
+
+	var all []jsonStructField
+	var collect func(t reflect.Type, index []int)
+	collect = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			fieldIndex := append(append([]int(nil), index...), i)
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				collect(ft, fieldIndex)
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+
+			field := jsonStructField{name: name, index: fieldIndex, tagged: name != ""}
+			if field.name == "" {
+				field.name = sf.Name
+			}
+			for _, opt := range strings.Split(opts, ",") {
+				if opt == "omitempty" {
+					field.omitEmpty = true
+				}
+			}
+			all = append(all, field)
+		}
+	}
+	collect(t, nil)
+
+	// Keep the dominant field of each name: the shallowest, then the tagged one; drop ambiguous names
+	byName := make(map[string][]jsonStructField)
+	for _, field := range all {
+		byName[field.name] = append(byName[field.name], field)
+	}
+	var fields []jsonStructField
+	for _, field := range all {
+		if dominant, ok := dominantField(byName[field.name]); ok && sameIndex(dominant.index, field.index) {
+			fields = append(fields, field)
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return lessIndex(fields[i].index, fields[j].index) })
+
+	jsonFieldCache.Store(t, fields)
+	return fields
+}
+
+// dominantField picks the field encoding/json encodes among fields sharing a name
+func dominantField(fields []jsonStructField) (jsonStructField, bool) {
+	depth := len(fields[0].index)
+	for _, field := range fields {
+		if len(field.index) < depth {
+			depth = len(field.index)
+		}
+	}
+	var candidates []jsonStructField
+	for _, field := range fields {
+		if len(field.index) == depth {
+			candidates = append(candidates, field)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	var tagged []jsonStructField
+	for _, field := range candidates {
+		if field.tagged {
+			tagged = append(tagged, field)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return jsonStructField{}, false
+}
+
+func sameIndex(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lessIndex orders fields by their position in the struct, embedded fields at the position of their struct
+func lessIndex(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// fieldByIndex returns the field at index, reporting false when it is behind a nil embedded pointer
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue reports whether v is empty in the sense of the omitempty json option
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// jsonField is one member of a JSON object, kept in order
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// decodeOrdered decodes the next JSON value of dec, keeping objects as ordered []jsonField
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		fields := []jsonField{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, jsonField{key: key.(string), value: value})
+		}
+		_, err := dec.Token() // }
+		return fields, err
+	case json.Delim('['):
+		values := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		_, err := dec.Token() // ]
+		return values, err
+	default:
+		return token, nil
+	}
+}
+
+// appendMsgpack appends the MessagePack encoding of a value produced by decodeOrdered
+func appendMsgpack(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if v {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return appendMsgpackInt(buf, i), nil
+		}
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return binary.BigEndian.AppendUint64(append(buf, 0xcf), u), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(f)), nil
+	case string:
+		return appendMsgpackString(buf, v), nil
+	case []interface{}:
+		buf = appendMsgpackHeader(buf, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			var err error
+			if buf, err = appendMsgpack(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case []jsonField:
+		buf = appendMsgpackHeader(buf, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, field := range v {
+			var err error
+			if buf, err = appendMsgpack(buf, field.key); err != nil {
+				return nil, err
+			}
+			if buf, err = appendMsgpack(buf, field.value); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("cannot encode %T as msgpack", value)
+	}
+}
+
+// appendMsgpackInt appends i in the smallest MessagePack integer format that holds it
+func appendMsgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(i))
+	}
+}
+
+// appendMsgpackHeader appends the header of a string, array or map of n elements: a fix format below fixLimit,
+// then the 8-bit (when the type has one), 16-bit and 32-bit length formats
+func appendMsgpackHeader(buf []byte, n int, fix byte, fixLimit int, code8, code16, code32 byte) []byte {
+	switch {
+	case n < fixLimit:
+		return append(buf, fix|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(buf, code8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, code32), uint32(n))
+	}
+}
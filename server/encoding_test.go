@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+// decodeMsgpack decodes the MessagePack subset written by marshalMsgpack into maps, slices, int64,
+// float64, string, []byte, bool and nil, returning the rest of data
+func decodeMsgpack(data []byte) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end of data")
+	}
+	code, data := data[0], data[1:]
+
+	length := func(size int) (int, []byte, error) {
+		if len(data) < size {
+			return 0, nil, fmt.Errorf("short length")
+		}
+		switch size {
+		case 1:
+			return int(data[0]), data[1:], nil
+		case 2:
+			return int(binary.BigEndian.Uint16(data)), data[2:], nil
+		default:
+			return int(binary.BigEndian.Uint32(data)), data[4:], nil
+		}
+	}
+	str := func(n int, rest []byte) (interface{}, []byte, error) {
+		if len(rest) < n {
+			return nil, nil, fmt.Errorf("short string")
+		}
+		return string(rest[:n]), rest[n:], nil
+	}
+	array := func(n int, rest []byte) (interface{}, []byte, error) {
+		values := make([]interface{}, n)
+		for i := range values {
+			var err error
+			if values[i], rest, err = decodeMsgpack(rest); err != nil {
+				return nil, nil, err
+			}
+		}
+		return values, rest, nil
+	}
+	object := func(n int, rest []byte) (interface{}, []byte, error) {
+		values := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key, next, err := decodeMsgpack(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			if values[key.(string)], rest, err = decodeMsgpack(next); err != nil {
+				return nil, nil, err
+			}
+		}
+		return values, rest, nil
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), data, nil
+	case code >= 0xe0:
+		return int64(int8(code)), data, nil
+	case code&0xe0 == 0xa0:
+		return str(int(code&0x1f), data)
+	case code&0xf0 == 0x90:
+		return array(int(code&0x0f), data)
+	case code&0xf0 == 0x80:
+		return object(int(code&0x0f), data)
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, data, nil
+	case 0xc2, 0xc3:
+		return code == 0xc3, data, nil
+	case 0xca:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), data[4:], nil
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	case 0xcf:
+		return int64(binary.BigEndian.Uint64(data)), data[8:], nil
+	case 0xd0:
+		return int64(int8(data[0])), data[1:], nil
+	case 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(data))), data[2:], nil
+	case 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(data))), data[4:], nil
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(data)), data[8:], nil
+	case 0xd9, 0xda, 0xdb:
+		n, rest, err := length(map[byte]int{0xd9: 1, 0xda: 2, 0xdb: 4}[code])
+		if err != nil {
+			return nil, nil, err
+		}
+		return str(n, rest)
+	case 0xdc, 0xdd:
+		n, rest, err := length(map[byte]int{0xdc: 2, 0xdd: 4}[code])
+		if err != nil {
+			return nil, nil, err
+		}
+		return array(n, rest)
+	case 0xde, 0xdf:
+		n, rest, err := length(map[byte]int{0xde: 2, 0xdf: 4}[code])
+		if err != nil {
+			return nil, nil, err
+		}
+		return object(n, rest)
+	}
+	return nil, nil, fmt.Errorf("unsupported code 0x%x", code)
+}
+
+func TestWSFundingTradesAsMsgpack(t *testing.T) {
+	d := newTestDatabase(t)
+	// A whole amount must still arrive as a float
+	trade := api.FundingTrade{ID: 7, MTS: 1700000000000, Amount: 100, Rate: 0.0002, Period: 30}
+	if _, err := d.SaveWSFundingTrades([]db.WSFundingTradeRecord{{Currency: "fUSD", Trade: trade, MsgType: "ftu"}}); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+	s := NewAPIServer(d)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/ws-funding-trades/USD", nil)
+	req.Header.Set("Accept", contentTypeMsgpack)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != contentTypeMsgpack {
+		t.Fatalf("Content-Type = %q, want %q", got, contentTypeMsgpack)
+	}
+
+	decoded, rest, err := decodeMsgpack(rec.Body.Bytes())
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("failed to decode body: %v, %d bytes left", err, len(rest))
+	}
+	want := []interface{}{map[string]interface{}{
+		"id":     int64(7),
+		"mts":    int64(1700000000000),
+		"amount": float64(100),
+		"rate":   0.0002,
+		"period": int64(30),
+	}}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("decoded %#v, want %#v", decoded, want)
+	}
+}
+
+func TestMarshalMsgpackFollowsJSONFields(t *testing.T) {
+	type inner struct {
+		Shadowed int    `json:"shadowed"`
+		Promoted string `json:"promoted"`
+	}
+	type outer struct {
+		inner
+		Shadowed   float64 `json:"shadowed"`
+		Skipped    int     `json:"-"`
+		Omitted    []int   `json:"omitted,omitempty"`
+		Untagged   bool
+		Pointer    *float64 `json:"pointer"`
+		unexported int
+	}
+
+	body, err := marshalMsgpack(outer{inner: inner{Shadowed: 1, Promoted: "p"}, Shadowed: 2, Skipped: 3, Untagged: true})
+	if err != nil {
+		t.Fatalf("marshalMsgpack: %v", err)
+	}
+	decoded, _, err := decodeMsgpack(body)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	want := map[string]interface{}{
+		"promoted": "p",
+		"shadowed": float64(2),
+		"Untagged": true,
+		"pointer":  nil,
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("decoded %#v, want %#v", decoded, want)
+	}
+}
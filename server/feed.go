@@ -0,0 +1,178 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+// FeedHours are the UTC hours, from Start up to but excluding End, in which a silent trade feed counts as
+// degraded. Start after End wraps past midnight; the zero value covers the whole day.
+type FeedHours struct {
+	Start int
+	End   int
+}
+
+// ParseFeedHours parses UTC hours like 8-22, an empty string covering the whole day
+func ParseFeedHours(s string) (FeedHours, error) {
+	if s == "" {
+		return FeedHours{}, nil
+	}
+
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return FeedHours{}, fmt.Errorf("invalid feed hours %q, expected start-end in UTC hours, e.g. 8-22", s)
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil || start < 0 || start > 23 {
+		return FeedHours{}, fmt.Errorf("invalid start hour in %q, must be 0-23", s)
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endStr))
+	if err != nil || end < 0 || end > 24 {
+		return FeedHours{}, fmt.Errorf("invalid end hour in %q, must be 0-24", s)
+	}
+	return FeedHours{Start: start, End: end % 24}, nil
+}
+
+// contains reports whether t falls within the hours
+func (h FeedHours) contains(t time.Time) bool {
+	hour := t.UTC().Hour()
+	switch {
+	case h.Start == h.End:
+		return true
+	case h.Start < h.End:
+		return hour >= h.Start && hour < h.End
+	default:
+		return hour >= h.Start || hour < h.End
+	}
+}
+
+// Trade feed states reported by /api/feed-status
+const (
+	FeedOK           = "ok"
+	FeedDegraded     = "degraded"
+	FeedOutsideHours = "outside_hours"
+)
+
+// CurrencyFeedStatus is the state of the WebSocket trade feed of one currency
+type CurrencyFeedStatus struct {
+	Currency   string  `json:"currency"`
+	Status     string  `json:"status"`
+	LastTrade  *int64  `json:"last_trade"`  // MTS of the newest stored trade, null before the first one
+	AgeSeconds float64 `json:"age_seconds"` // Since the newest stored trade, or since monitoring started
+}
+
+// FeedStatus is the state of the WebSocket trade feeds
+type FeedStatus struct {
+	Enabled    bool                 `json:"enabled"`
+	StaleAfter string               `json:"stale_after"`
+	InHours    bool                 `json:"in_hours"`
+	Degraded   bool                 `json:"degraded"`
+	Feeds      []CurrencyFeedStatus `json:"feeds"`
+}
+
+// feedMonitor tracks the newest stored WebSocket trade of each currency and flags a currency's feed as
+// degraded when no trade was stored for staleAfter within the configured hours
+type feedMonitor struct {
+	staleAfter time.Duration // 0 disables monitoring
+	hours      FeedHours
+	now        func() time.Time
+
+	mu         sync.Mutex
+	since      time.Time // Start of monitoring, the baseline of currencies without trades
+	currencies []string
+	lastTrade  map[string]int64
+}
+
+func newFeedMonitor(staleAfter time.Duration, hours FeedHours, currencies []string) *feedMonitor {
+	return &feedMonitor{
+		staleAfter: staleAfter,
+		hours:      hours,
+		now:        time.Now,
+		since:      time.Now(),
+		currencies: append([]string(nil), currencies...),
+		lastTrade:  make(map[string]int64),
+	}
+}
+
+// record remembers the newest trade of each currency in records
+func (m *feedMonitor) record(records []db.WSFundingTradeRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, record := range records {
+		if last, ok := m.lastTrade[record.Currency]; !ok || record.Trade.MTS > last {
+			m.lastTrade[record.Currency] = record.Trade.MTS
+		}
+		if !containsString(m.currencies, record.Currency) {
+			m.currencies = append(m.currencies, record.Currency)
+		}
+	}
+}
+
+// status reports the state of the feed of each monitored currency
+func (m *feedMonitor) status() FeedStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	status := FeedStatus{
+		Enabled:    m.staleAfter > 0,
+		StaleAfter: m.staleAfter.String(),
+		InHours:    m.hours.contains(now),
+		Feeds:      []CurrencyFeedStatus{},
+	}
+
+	currencies := append([]string(nil), m.currencies...)
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		feed := CurrencyFeedStatus{Currency: currency, Status: FeedOK}
+
+		last := m.since
+		if mts, ok := m.lastTrade[currency]; ok {
+			mts := mts
+			feed.LastTrade = &mts
+			last = time.UnixMilli(mts)
+		}
+		age := now.Sub(last)
+		feed.AgeSeconds = age.Seconds()
+
+		switch {
+		case !status.InHours:
+			feed.Status = FeedOutsideHours
+		case status.Enabled && age > m.staleAfter:
+			feed.Status = FeedDegraded
+			status.Degraded = true
+		}
+		status.Feeds = append(status.Feeds, feed)
+	}
+	return status
+}
+
+// degraded returns the currencies whose trade feed is degraded
+func (m *feedMonitor) degraded() []string {
+	var currencies []string
+	for _, feed := range m.status().Feeds {
+		if feed.Status == FeedDegraded {
+			currencies = append(currencies, feed.Currency)
+		}
+	}
+	return currencies
+}
+
+// RecordWSTrades notes the newest stored WebSocket trade of each currency for /api/feed-status;
+// it is meant as the db.TradeBuffer OnSaved hook
+func (s *APIServer) RecordWSTrades(records []db.WSFundingTradeRecord) {
+	s.feeds.record(records)
+}
+
+// handleGetFeedStatus reports whether the WebSocket trade feed of each currency is still storing trades
+func (s *APIServer) handleGetFeedStatus(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, s.feeds.status())
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestFeedStatusReportsStaleTradeFeed(t *testing.T) {
+	s := NewAPIServerWithConfig(newTestDatabase(t), Config{
+		WSTradeCurrencies: []string{"fUSD", "fUST"},
+		WSFeedStaleAfter:  10 * time.Minute,
+		WSFeedHours:       FeedHours{Start: 8, End: 22},
+	})
+	noon := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	now := noon
+	s.feeds.now = func() time.Time { return now }
+	s.feeds.since = noon
+
+	trade := func(currency string, at time.Time) db.WSFundingTradeRecord {
+		return db.WSFundingTradeRecord{Currency: currency, Trade: api.FundingTrade{MTS: at.UnixMilli()}, MsgType: "ftu"}
+	}
+	s.RecordWSTrades([]db.WSFundingTradeRecord{trade("fUSD", noon)})
+
+	readyz := func() map[string]interface{} {
+		t.Helper()
+		rec := get(t, s, "/readyz")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/readyz status = %d, want 200", rec.Code)
+		}
+		var body map[string]interface{}
+		decodeJSON(t, rec, &body)
+		return body
+	}
+
+	// Within the window both feeds are fine, including fUST which has no trade yet
+	var status FeedStatus
+	decodeJSON(t, get(t, s, "/api/feed-status"), &status)
+	if !status.Enabled || !status.InHours || status.Degraded || len(status.Feeds) != 2 {
+		t.Fatalf("status = %+v, want two healthy feeds", status)
+	}
+	for _, feed := range status.Feeds {
+		if feed.Status != FeedOK {
+			t.Errorf("%s feed = %s, want ok", feed.Currency, feed.Status)
+		}
+	}
+	if body := readyz(); body["status"] != "ready" {
+		t.Errorf("/readyz = %v, want ready", body)
+	}
+
+	// Once the window elapses the silent feeds are degraded, one with a recent trade is not
+	now = noon.Add(11 * time.Minute)
+	s.RecordWSTrades([]db.WSFundingTradeRecord{trade("fUST", noon.Add(10*time.Minute)), trade("fBTC", noon.Add(-time.Minute))})
+	decodeJSON(t, get(t, s, "/api/feed-status"), &status)
+	want := map[string]string{"fBTC": FeedDegraded, "fUSD": FeedDegraded, "fUST": FeedOK}
+	got := make(map[string]string)
+	for _, feed := range status.Feeds {
+		got[feed.Currency] = feed.Status
+	}
+	if !status.Degraded || !reflect.DeepEqual(got, want) {
+		t.Errorf("feeds = %v (degraded %v), want %v", got, status.Degraded, want)
+	}
+	if feed := status.Feeds[1]; feed.Currency != "fUSD" || feed.LastTrade == nil || *feed.LastTrade != noon.UnixMilli() || feed.AgeSeconds != 660 {
+		t.Errorf("fUSD feed = %+v, want its last trade at noon, 660s ago", feed)
+	}
+	body := readyz()
+	if body["status"] != "degraded" || !reflect.DeepEqual(body["degraded_feeds"], []interface{}{"fBTC", "fUSD"}) {
+		t.Errorf("/readyz = %v, want degraded with fBTC and fUSD", body)
+	}
+
+	// Outside the configured hours silence is expected
+	now = time.Date(2024, 1, 2, 23, 0, 0, 0, time.UTC)
+	decodeJSON(t, get(t, s, "/api/feed-status"), &status)
+	if status.InHours || status.Degraded {
+		t.Errorf("status at 23:00 = %+v, want outside hours and not degraded", status)
+	}
+	for _, feed := range status.Feeds {
+		if feed.Status != FeedOutsideHours {
+			t.Errorf("%s feed at 23:00 = %s, want outside_hours", feed.Currency, feed.Status)
+		}
+	}
+	if body := readyz(); body["status"] != "ready" {
+		t.Errorf("/readyz at 23:00 = %v, want ready", body)
+	}
+}
+
+func TestParseFeedHours(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    FeedHours
+		in23    bool // Whether 23:00 UTC falls within the hours
+		wantErr bool
+	}{
+		{"", FeedHours{}, true, false},
+		{"8-22", FeedHours{Start: 8, End: 22}, false, false},
+		{"22-6", FeedHours{Start: 22, End: 6}, true, false},
+		{"0-24", FeedHours{Start: 0, End: 0}, true, false},
+		{"8", FeedHours{}, false, true},
+		{"24-2", FeedHours{}, false, true},
+		{"2-25", FeedHours{}, false, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFeedHours(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFeedHours(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFeedHours(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if in := got.contains(time.Date(2024, 1, 2, 23, 0, 0, 0, time.UTC)); in != tt.in23 {
+			t.Errorf("ParseFeedHours(%q) contains 23:00 = %v, want %v", tt.in, in, tt.in23)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/rates"
+	"github.com/gary0122g/BitfinexFundingData/service"
+)
+
+const (
+	// defaultDecimals is the number of decimals of percentage fields unless ?decimals= is given
+	defaultDecimals = 4
+	// maxDecimals bounds ?decimals=
+	maxDecimals = 12
+)
+
+// FRRScaling selects the value of the frr field of funding stats responses
+type FRRScaling string
+
+const (
+	FRRScalingAPR    FRRScaling = "apr"    // Annual rate as a fraction, following the configured annualization
+	FRRScalingLegacy FRRScaling = "legacy" // frr_raw*365*365, as served before the annualization was configurable
+	FRRScalingRaw    FRRScaling = "raw"    // Unscaled FRR as returned by Bitfinex
+)
+
+// ParseFRRScaling parses an FRR scaling name, an empty name selecting apr
+func ParseFRRScaling(s string) (FRRScaling, error) {
+	switch scaling := FRRScaling(s); scaling {
+	case "":
+		return FRRScalingAPR, nil
+	case FRRScalingAPR, FRRScalingLegacy, FRRScalingRaw:
+		return scaling, nil
+	default:
+		return "", fmt.Errorf("invalid FRR scaling %q, must be apr, legacy or raw", s)
+	}
+}
+
+// frr converts the unscaled stats FRR to the value served in frr
+func (scaling FRRScaling) frr(statsFRR float64) float64 {
+	switch scaling {
+	case FRRScalingRaw:
+		return statsFRR
+	case FRRScalingLegacy:
+		return statsFRR * rates.StatsFRRDays * rates.DefaultAnnualizationDays
+	default:
+		return rates.StatsFRRToAPR(statsFRR)
+	}
+}
+
+// scaleFRR sets the FRR of stats read from the database according to scaling
+func scaleFRR(stats []api.FundingStats, scaling FRRScaling) []api.FundingStats {
+	for i := range stats {
+		stats[i].FRR = scaling.frr(stats[i].FRRRaw)
+	}
+	return stats
+}
+
+// TimeFormat selects how timestamp fields of responses are serialized
+type TimeFormat string
+
+const (
+	TimeFormatMS      TimeFormat = "ms"      // Unix milliseconds, as stored
+	TimeFormatRFC3339 TimeFormat = "rfc3339" // UTC RFC 3339 string with milliseconds
+	TimeFormatUnix    TimeFormat = "unix"    // Unix seconds, with a fraction for milliseconds
+)
+
+// rfc3339Millis is RFC 3339 with a fixed millisecond fraction
+const rfc3339Millis = "2006-01-02T15:04:05.000Z07:00"
+
+// timestamp is a unix millisecond timestamp serialized according to its TimeFormat
+type timestamp struct {
+	ms     int64
+	format TimeFormat
+}
+
+func newTimestamp(ms int64, format TimeFormat) timestamp {
+	return timestamp{ms: ms, format: format}
+}
+
+// MarshalJSON writes the timestamp as unix milliseconds, an RFC 3339 string or unix seconds
+func (t timestamp) MarshalJSON() ([]byte, error) {
+	switch t.format {
+	case TimeFormatRFC3339:
+		return []byte(`"` + time.UnixMilli(t.ms).UTC().Format(rfc3339Millis) + `"`), nil
+	case TimeFormatUnix:
+		return []byte(strconv.FormatFloat(float64(t.ms)/1000, 'f', -1, 64)), nil
+	default:
+		return []byte(strconv.FormatInt(t.ms, 10)), nil
+	}
+}
+
+// parseTimeFormat reads the optional time_format query parameter, defaulting to ms.
+// It writes a 400 response and returns false when the parameter is invalid.
+func parseTimeFormat(w http.ResponseWriter, r *http.Request) (TimeFormat, bool) {
+	switch format := TimeFormat(r.URL.Query().Get("time_format")); format {
+	case "":
+		return TimeFormatMS, true
+	case TimeFormatMS, TimeFormatRFC3339, TimeFormatUnix:
+		return format, true
+	default:
+		http.Error(w, "Invalid time_format parameter, must be ms, rfc3339 or unix", http.StatusBadRequest)
+		return "", false
+	}
+}
+
+// fundingStatsResponse presents FundingStats with the FRR in explicit units.
+// The embedded FRR is scaled according to the server's FRRScaling, the annual rate as a fraction
+// by default, and FRRRaw is the unscaled value, so frr_daily = frr_raw * 365 and frr_apr (FRRAPR, the
+// annual rate as a fraction) annualizes frr_daily.
+type fundingStatsResponse struct {
+	api.FundingStats
+	MTS       timestamp `json:"mts"`
+	FRRDaily  float64   `json:"frr_daily"`   // Daily rate as a fraction
+	FRRAPRPct float64   `json:"frr_apr_pct"` // Annual rate in percent, rounded to the requested decimals
+}
+
+// newFundingStatsResponses adds the FRR presentation fields to stats read from the database
+func newFundingStatsResponses(stats []api.FundingStats, decimals int, scaling FRRScaling, timeFormat TimeFormat) []fundingStatsResponse {
+	responses := make([]fundingStatsResponse, len(stats))
+	for i, stat := range stats {
+		// Stats published before being read back carry no FRRAPR yet
+		stat.FRRAPR = rates.StatsFRRToAPR(stat.FRRRaw)
+		stat.FRR = scaling.frr(stat.FRRRaw)
+		responses[i] = fundingStatsResponse{
+			FundingStats: stat,
+			MTS:          newTimestamp(stat.MTS, timeFormat),
+			FRRDaily:     rates.StatsFRRToDaily(stat.FRRRaw),
+			FRRAPRPct:    rates.Round(rates.ToPercent(stat.FRRAPR), decimals),
+		}
+	}
+	return responses
+}
+
+// timedFundingStats presents FundingStats with the timestamp in the requested TimeFormat
+type timedFundingStats struct {
+	api.FundingStats
+	MTS timestamp `json:"mts"`
+}
+
+// newTimedFundingStats formats the timestamps of stats
+func newTimedFundingStats(stats []api.FundingStats, timeFormat TimeFormat) []timedFundingStats {
+	responses := make([]timedFundingStats, len(stats))
+	for i, stat := range stats {
+		responses[i] = timedFundingStats{FundingStats: stat, MTS: newTimestamp(stat.MTS, timeFormat)}
+	}
+	return responses
+}
+
+// fundingTradeResponse presents a FundingTrade with the timestamp in the requested TimeFormat
+type fundingTradeResponse struct {
+	api.FundingTrade
+	MTS timestamp `json:"mts"`
+}
+
+// newFundingTradeResponses formats the timestamps of trades
+func newFundingTradeResponses(trades []api.FundingTrade, timeFormat TimeFormat) []fundingTradeResponse {
+	responses := make([]fundingTradeResponse, len(trades))
+	for i, trade := range trades {
+		responses[i] = fundingTradeResponse{FundingTrade: trade, MTS: newTimestamp(trade.MTS, timeFormat)}
+	}
+	return responses
+}
+
+// tickerWithBookResponse presents a funding ticker joined with its book with the timestamps in the
+// requested TimeFormat
+type tickerWithBookResponse struct {
+	service.TickerWithBook
+	Timestamp     timestamp  `json:"timestamp"`
+	BookTimestamp *timestamp `json:"book_timestamp"`
+}
+
+// newTickerWithBookResponses formats the timestamps of history
+func newTickerWithBookResponses(history []service.TickerWithBook, timeFormat TimeFormat) []tickerWithBookResponse {
+	responses := make([]tickerWithBookResponse, len(history))
+	for i, entry := range history {
+		responses[i] = tickerWithBookResponse{
+			TickerWithBook: entry,
+			Timestamp:      newTimestamp(entry.Timestamp, timeFormat),
+		}
+		if entry.BookTimestamp != nil {
+			bookTimestamp := newTimestamp(*entry.BookTimestamp, timeFormat)
+			responses[i].BookTimestamp = &bookTimestamp
+		}
+	}
+	return responses
+}
+
+// parseDecimals reads the optional decimals query parameter for rounded percentage fields.
+// It writes a 400 response and returns false when the parameter is invalid.
+func parseDecimals(w http.ResponseWriter, r *http.Request) (int, bool) {
+	decimalsStr := r.URL.Query().Get("decimals")
+	if decimalsStr == "" {
+		return defaultDecimals, true
+	}
+
+	decimals, err := strconv.Atoi(decimalsStr)
+	if err != nil || decimals < 0 || decimals > maxDecimals {
+		http.Error(w, "Invalid decimals parameter", http.StatusBadRequest)
+		return 0, false
+	}
+	return decimals, true
+}
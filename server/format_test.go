@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/rates"
+)
+
+func TestFundingStatsFRRPresentationFields(t *testing.T) {
+	d := newTestDatabase(t)
+	// Bitfinex reports the stats FRR as 1/365th of the daily rate
+	const daily = 0.000123
+	raw := daily / rates.StatsFRRDays
+	if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: 1000, FRR: raw, FRRRaw: raw, FundingAmount: 100}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+
+	var stats []map[string]interface{}
+	decodeJSON(t, get(t, NewAPIServer(d), "/api/funding-stats/USD?decimals=2"), &stats)
+	if len(stats) != 1 {
+		t.Fatalf("got %d stats, want 1", len(stats))
+	}
+
+	// Simple annualization over 365 days: 0.000123 * 365 = 0.044895, 4.4895% rounded to 4.49
+	for field, want := range map[string]float64{
+		"frr_raw":     raw,
+		"frr_daily":   daily,
+		"frr_apr":     0.044895,
+		"frr":         0.044895, // The default apr scaling
+		"frr_apr_pct": 4.49,
+	} {
+		got, ok := stats[0][field].(float64)
+		if !ok || math.Abs(got-want) > 1e-12 {
+			t.Errorf("%s = %v, want %v", field, stats[0][field], want)
+		}
+	}
+
+	// The stored value stays the raw FRR
+	var stored float64
+	if err := d.GetDB().QueryRow(`SELECT frr FROM funding_stats`).Scan(&stored); err != nil {
+		t.Fatalf("failed to read stored FRR: %v", err)
+	}
+	if stored != raw {
+		t.Errorf("stored FRR = %v, want the raw %v", stored, raw)
+	}
+}
+
+func TestFRRScalingModes(t *testing.T) {
+	// Annualize over 360 days, so apr and legacy differ
+	prev := rates.CurrentAnnualization()
+	if err := rates.SetAnnualization(360, false); err != nil {
+		t.Fatalf("SetAnnualization: %v", err)
+	}
+	defer rates.SetAnnualization(prev.Days, prev.Compound)
+
+	d := newTestDatabase(t)
+	// Daily FRR 0.0002, reported by Bitfinex as 0.0002/365
+	raw := 0.0002 / rates.StatsFRRDays
+	if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: 1000, FRR: raw, FRRRaw: raw, FundingAmount: 100}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+
+	for _, tt := range []struct {
+		scaling FRRScaling
+		want    float64
+	}{
+		{"", 0.072},                   // Defaults to apr
+		{FRRScalingAPR, 0.072},        // 0.0002 * 360
+		{FRRScalingLegacy, 0.073},     // raw * 365 * 365, ignoring the annualization
+		{FRRScalingRaw, 0.0002 / 365}, // As returned by Bitfinex
+	} {
+		s := NewAPIServerWithConfig(d, Config{FRRScaling: tt.scaling})
+		var stats []api.FundingStats
+		decodeJSON(t, get(t, s, "/api/funding-stats/USD"), &stats)
+		if len(stats) != 1 {
+			t.Fatalf("scaling %q: got %d stats, want 1", tt.scaling, len(stats))
+		}
+		if math.Abs(stats[0].FRR-tt.want) > 1e-12 {
+			t.Errorf("scaling %q: frr = %v, want %v", tt.scaling, stats[0].FRR, tt.want)
+		}
+		// The other FRR fields do not depend on the scaling
+		if stats[0].FRRRaw != raw || math.Abs(stats[0].FRRAPR-0.072) > 1e-12 {
+			t.Errorf("scaling %q: frr_raw %v frr_apr %v, want %v and 0.072", tt.scaling, stats[0].FRRRaw, stats[0].FRRAPR, raw)
+		}
+	}
+
+	for _, name := range []string{"", "apr", "legacy", "raw"} {
+		if _, err := ParseFRRScaling(name); err != nil {
+			t.Errorf("ParseFRRScaling(%q): %v", name, err)
+		}
+	}
+	if _, err := ParseFRRScaling("daily"); err == nil {
+		t.Error("ParseFRRScaling accepted daily, want an error")
+	}
+}
+
+func TestTimeFormats(t *testing.T) {
+	d, conn := newTestDatabaseConn(t)
+	const mts = 1700000000123
+	if _, err := d.SaveFundingStats("fUSD", api.FundingStats{MTS: mts, FRR: 0.0000005, FRRRaw: 0.0000005}); err != nil {
+		t.Fatalf("SaveFundingStats: %v", err)
+	}
+	trade := api.FundingTrade{ID: 1, MTS: mts, Amount: 100, Rate: 0.0002, Period: 2}
+	if _, err := d.SaveWSFundingTrades([]db.WSFundingTradeRecord{{Currency: "fUSD", Trade: trade, MsgType: "ftu"}}); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+	if _, err := d.SaveFundingTicker("fUSD", api.FundingTicker{FRR: 0.0000005, Bid: 0.0002, Ask: 0.0003}); err != nil {
+		t.Fatalf("SaveFundingTicker: %v", err)
+	}
+	// Tickers are stamped when saved
+	if _, err := conn.Exec(`UPDATE funding_ticker SET timestamp = ?`, mts); err != nil {
+		t.Fatalf("failed to set the ticker timestamp: %v", err)
+	}
+	s := NewAPIServer(d)
+
+	paths := map[string]string{
+		"/api/funding-stats/USD":     "mts",
+		"/api/ws-funding-trades/USD": "mts",
+		"/api/ticker-with-book/USD/history?start=1700000000000&end=1700000001000": "timestamp",
+	}
+	for _, tt := range []struct {
+		format string
+		want   string
+	}{
+		{"", "1700000000123"},
+		{"ms", "1700000000123"},
+		{"rfc3339", `"2023-11-14T22:13:20.123Z"`},
+		{"unix", "1700000000.123"},
+	} {
+		for path, field := range paths {
+			separator := "?"
+			if strings.Contains(path, "?") {
+				separator = "&"
+			}
+			var rows []map[string]json.RawMessage
+			decodeJSON(t, get(t, s, path+separator+"time_format="+tt.format), &rows)
+			if len(rows) != 1 {
+				t.Fatalf("%s returned %d rows, want 1", path, len(rows))
+			}
+			if got := string(rows[0][field]); got != tt.want {
+				t.Errorf("%s time_format=%q: %s = %s, want %s", path, tt.format, field, got, tt.want)
+			}
+		}
+	}
+
+	if rec := get(t, s, "/api/funding-stats/USD?time_format=iso"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid time_format status = %d, want 400", rec.Code)
+	}
+}
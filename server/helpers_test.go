@@ -0,0 +1,69 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDatabase opens a Database on a new SQLite file with all tables created
+func newTestDatabase(t *testing.T) *db.Database {
+	t.Helper()
+
+	d, _ := newTestDatabaseConn(t)
+	return d
+}
+
+// newTestDatabaseConn is newTestDatabase also returning the connection, for seeding rows directly
+func newTestDatabaseConn(t *testing.T) (*db.Database, *sql.DB) {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.CreateTables(conn); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	return db.NewDatabase(conn), conn
+}
+
+// get serves a GET request for target and returns the recorded response
+func get(t *testing.T, s *APIServer, target string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+// decodeJSON decodes the body of a successful response into v
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+}
+
+// countRows returns the number of rows of table
+func countRows(t *testing.T, d *db.Database, table string) int {
+	t.Helper()
+
+	var count int
+	if err := d.GetDB().QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatalf("failed to count %s: %v", table, err)
+	}
+	return count
+}
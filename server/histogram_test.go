@@ -0,0 +1,69 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/service"
+)
+
+func TestTradeHistogramBinsSeededWindow(t *testing.T) {
+	d := newTestDatabase(t)
+	var records []db.WSFundingTradeRecord
+	for i, trade := range []struct {
+		currency string
+		mts      int64
+		amount   float64
+		rate     float64
+	}{
+		{"fUSD", 1000, 10, 0.0001},   // 3.65% APR, first bin
+		{"fUSD", 2000, -20, 0.00025}, // 9.125% APR, second bin
+		{"fUSD", 3000, 30, 0.00025},
+		{"fUSD", 4000, -40, 0.0005}, // 18.25% APR, the maximum closes the last bin
+		{"fUSD", 9000, 50, 0.01},    // After the window
+		{"fUST", 2000, 60, 0.002},   // Other currency
+	} {
+		records = append(records, db.WSFundingTradeRecord{
+			Currency: trade.currency,
+			Trade:    api.FundingTrade{ID: int64(i + 1), MTS: trade.mts, Amount: trade.amount, Rate: trade.rate, Period: 2},
+			MsgType:  "ftu",
+		})
+	}
+	if _, err := d.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+	s := NewAPIServer(d)
+
+	var histogram service.TradeHistogram
+	decodeJSON(t, get(t, s, "/api/trade-histogram/USD?bins=4&start=0&end=5000"), &histogram)
+
+	if histogram.Currency != "fUSD" || histogram.Start != 0 || histogram.End != 5000 {
+		t.Errorf("histogram window = %s %d-%d, want fUSD 0-5000", histogram.Currency, histogram.Start, histogram.End)
+	}
+	if histogram.TotalTrades != 4 {
+		t.Errorf("total trades = %d, want the 4 fUSD trades in the window", histogram.TotalTrades)
+	}
+	wantCounts := []int{1, 2, 0, 1}
+	wantAmounts := []float64{10, 50, 0, 40}
+	if len(histogram.Counts) != len(wantCounts) || len(histogram.Edges) != len(wantCounts)+1 {
+		t.Fatalf("got %d counts and %d edges, want 4 bins with 5 edges", len(histogram.Counts), len(histogram.Edges))
+	}
+	for i := range wantCounts {
+		if histogram.Counts[i] != wantCounts[i] || histogram.Amounts[i] != wantAmounts[i] {
+			t.Errorf("counts = %v, amounts = %v, want %v and %v", histogram.Counts, histogram.Amounts, wantCounts, wantAmounts)
+			break
+		}
+	}
+	if math.Abs(histogram.Edges[0]-3.65) > 1e-9 || math.Abs(histogram.Edges[4]-18.25) > 1e-9 {
+		t.Errorf("edges = %v, want 3.65 to 18.25", histogram.Edges)
+	}
+
+	for _, query := range []string{"bins=0", "bins=x"} {
+		if rec := get(t, s, "/api/trade-histogram/USD?"+query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s status = %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxIngestBodyBytes limits the size of an ingest request body
+	maxIngestBodyBytes = 8 << 20
+	// maxIngestRows limits the number of trades in one ingest request
+	maxIngestRows = 10000
+	// ingestMsgType is stored as the message type of ingested trades; like Bitfinex "ftu" updates
+	// they describe executed trades
+	ingestMsgType = "ftu"
+)
+
+// IngestRejection describes why a row of an ingest request was not stored
+type IngestRejection struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// IngestResult reports how many rows of an ingest request were stored and why the others were not
+type IngestResult struct {
+	Accepted int               `json:"accepted"`
+	Rejected []IngestRejection `json:"rejected"`
+}
+
+// validateFundingTrade returns why trade cannot be ingested, or an empty string if it is valid.
+// Timestamps up to now are accepted; now is passed in so a whole request is checked against one instant.
+func validateFundingTrade(trade api.FundingTrade, now time.Time) string {
+	var reasons []string
+	if trade.ID <= 0 {
+		reasons = append(reasons, fmt.Sprintf("id must be positive, got %d", trade.ID))
+	}
+	if trade.MTS <= 0 {
+		reasons = append(reasons, fmt.Sprintf("mts must be a positive millisecond timestamp, got %d", trade.MTS))
+	} else if nowMS := now.UnixMilli(); trade.MTS > nowMS {
+		reasons = append(reasons, fmt.Sprintf("mts %d is in the future (now %d)", trade.MTS, nowMS))
+	}
+	if trade.Amount == 0 {
+		reasons = append(reasons, "amount must not be zero")
+	}
+	if trade.Period <= 0 {
+		reasons = append(reasons, fmt.Sprintf("period must be positive, got %d", trade.Period))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// decodeIngestRow strictly decodes one row of an ingest request; unknown fields and
+// missing required fields are reported as errors
+func decodeIngestRow(raw json.RawMessage) (api.FundingTrade, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return api.FundingTrade{}, fmt.Errorf("row is not a JSON object")
+	}
+	for _, name := range []string{"id", "mts", "amount", "rate", "period"} {
+		if _, ok := fields[name]; !ok {
+			return api.FundingTrade{}, fmt.Errorf("missing field %q", name)
+		}
+	}
+
+	var trade api.FundingTrade
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&trade); err != nil {
+		return api.FundingTrade{}, fmt.Errorf("invalid row: %v", err)
+	}
+	return trade, nil
+}
+
+// handleIngestFundingTrades processes requests to bulk load funding trades of a currency, e.g. from
+// an upstream producer backfilling a gap. The body is a JSON array of trades shaped like
+// {"id", "mts", "amount", "rate", "period"}. Valid rows are stored, invalid rows are reported by index
+// with the reason; trades that were already stored are accepted without being stored twice.
+func (s *APIServer) handleIngestFundingTrades(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	var rows []json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBodyBytes)).Decode(&rows); err != nil {
+		http.Error(w, fmt.Sprintf("Request body must be a JSON array of trades: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(rows) > maxIngestRows {
+		http.Error(w, fmt.Sprintf("Too many trades, at most %d per request", maxIngestRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	result := IngestResult{Rejected: []IngestRejection{}}
+	records := make([]db.WSFundingTradeRecord, 0, len(rows))
+	now := time.Now()
+	for i, raw := range rows {
+		trade, err := decodeIngestRow(raw)
+		if err != nil {
+			result.Rejected = append(result.Rejected, IngestRejection{Index: i, Reason: err.Error()})
+			continue
+		}
+		if reason := validateFundingTrade(trade, now); reason != "" {
+			result.Rejected = append(result.Rejected, IngestRejection{Index: i, Reason: reason})
+			continue
+		}
+		records = append(records, db.WSFundingTradeRecord{Currency: currency, Trade: trade, MsgType: ingestMsgType})
+	}
+
+	if _, err := s.database.SaveWSFundingTrades(records); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store trades: %v", err), http.StatusInternalServerError)
+		return
+	}
+	result.Accepted = len(records)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIngestFundingTradesReportsEachRejection(t *testing.T) {
+	d := newTestDatabase(t)
+	s := NewAPIServerWithConfig(d, Config{AdminToken: "secret"})
+
+	future := time.Now().Add(time.Hour).UnixMilli()
+	rows := []string{
+		`{"id": 1, "mts": 1700000000000, "amount": 100, "rate": 0.0002, "period": 2}`,
+		`{"id": 0, "mts": 1700000000000, "amount": 100, "rate": 0.0002, "period": 2}`,
+		fmt.Sprintf(`{"id": 3, "mts": %d, "amount": 100, "rate": 0.0002, "period": 2}`, future),
+		`{"id": 4, "mts": 1700000000000, "amount": 0, "rate": 0.0002, "period": 2}`,
+		`{"id": 5, "mts": 1700000000000, "amount": 100, "rate": 0.0002, "period": 0}`,
+		`{"id": 6, "mts": 1700000000000, "amount": 100, "rate": 0.0002, "period": -2}`,
+		`{"id": 7, "mts": 1700000000000, "amount": 100, "rate": 0.0002}`,
+		`{"id": 8, "mts": 1700000000000, "amount": 100, "rate": 0.0002, "period": 2, "side": "lend"}`,
+		`[9, 1700000000000, 100, 0.0002, 2]`,
+		`{"id": 10, "mts": 0, "amount": 0, "rate": 0.0002, "period": 0}`,
+		`{"id": 11, "mts": 1700000001000, "amount": -50, "rate": 0.0003, "period": 30}`,
+		`{"id": 1, "mts": 1700000000000, "amount": 100, "rate": 0.0002, "period": 2}`, // Already stored
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/ingest/funding-trades/USD", strings.NewReader("["+strings.Join(rows, ",")+"]"))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	var result IngestResult
+	decodeJSON(t, rec, &result)
+
+	wantReasons := map[int]string{
+		1: "id must be positive",
+		2: "is in the future",
+		3: "amount must not be zero",
+		4: "period must be positive, got 0",
+		5: "period must be positive, got -2",
+		6: `missing field "period"`,
+		7: "unknown field",
+		8: "row is not a JSON object",
+		9: "mts must be a positive millisecond timestamp, got 0; amount must not be zero; period must be positive",
+	}
+	if result.Accepted != 3 {
+		t.Errorf("accepted = %d, want 3", result.Accepted)
+	}
+	if len(result.Rejected) != len(wantReasons) {
+		t.Fatalf("rejected = %+v, want %d rows", result.Rejected, len(wantReasons))
+	}
+	for _, rejection := range result.Rejected {
+		want, ok := wantReasons[rejection.Index]
+		if !ok {
+			t.Errorf("row %d rejected with %q, want it accepted", rejection.Index, rejection.Reason)
+			continue
+		}
+		if !strings.Contains(rejection.Reason, want) {
+			t.Errorf("row %d reason = %q, want it to mention %q", rejection.Index, rejection.Reason, want)
+		}
+	}
+
+	// Valid rows are stored once
+	if n := countRows(t, d, "ws_funding_trades"); n != 2 {
+		t.Errorf("ws_funding_trades has %d rows, want 2", n)
+	}
+
+	// A body that is not an array is rejected as a whole
+	req = httptest.NewRequest(http.MethodPost, "/api/admin/ingest/funding-trades/USD", strings.NewReader(`{"id": 1}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("object body status = %d, want 400", rec.Code)
+	}
+}
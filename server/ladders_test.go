@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestLatestFundingBooksLaddersPerCurrency(t *testing.T) {
+	d := newTestDatabase(t)
+	// An older fUSD snapshot that must not be returned
+	if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, 1000, api.FundingBook{Rate: 0.0009, Period: 2, Count: 1, Amount: 1}); err != nil {
+		t.Fatalf("SaveFundingBookAt: %v", err)
+	}
+	for _, book := range []api.FundingBook{
+		{Rate: 0.0001, Period: 2, Count: 1, Amount: -100},
+		{Rate: 0.0003, Period: 2, Count: 2, Amount: -300},
+		{Rate: 0.0002, Period: 2, Count: 1, Amount: -200},
+		{Rate: 0.0005, Period: 30, Count: 1, Amount: 500},
+		{Rate: 0.0004, Period: 30, Count: 3, Amount: 400},
+		{Rate: 0.0006, Period: 30, Count: 1, Amount: 600},
+	} {
+		if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, 2000, book); err != nil {
+			t.Fatalf("SaveFundingBookAt: %v", err)
+		}
+	}
+
+	s := NewAPIServer(d)
+	rec := get(t, s, "/api/funding-books-latest?currencies=USD,fUST&levels=2")
+	var ladders map[string]FundingLadder
+	decodeJSON(t, rec, &ladders)
+
+	if len(ladders) != 2 {
+		t.Fatalf("ladders = %+v, want fUSD and fUST", ladders)
+	}
+	usd := ladders["fUSD"]
+	if len(usd.Bids) != 2 || usd.Bids[0].Rate != 0.0003 || usd.Bids[1].Rate != 0.0002 {
+		t.Errorf("fUSD bids = %+v, want the best 2 from 0.0003 down", usd.Bids)
+	}
+	if len(usd.Asks) != 2 || usd.Asks[0].Rate != 0.0004 || usd.Asks[1].Rate != 0.0005 {
+		t.Errorf("fUSD asks = %+v, want the best 2 from 0.0004 up", usd.Asks)
+	}
+
+	// A currency without a book gets empty sides rather than failing the request
+	if !strings.Contains(rec.Body.String(), `"fUST":{"bids":[],"asks":[]}`) {
+		t.Errorf("response %s lacks an empty fUST ladder", rec.Body.String())
+	}
+
+	for _, target := range []string{
+		"/api/funding-books-latest",
+		"/api/funding-books-latest?currencies=USD&levels=0",
+	} {
+		if rec := get(t, s, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s status = %d, want 400", target, rec.Code)
+		}
+	}
+}
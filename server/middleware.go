@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gary0122g/BitfinexFundingData/requestid"
+)
+
+// maxRequestIDLength bounds client-supplied request IDs so they stay readable in logs
+const maxRequestIDLength = 64
+
+// requestIDMiddleware tags each request with an ID, reusing the client's X-Request-ID when valid.
+// The ID is stored in the request context, echoed in the response and prefixed to request logs.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !validRequestID(id) {
+			id = requestid.New()
+		}
+
+		ctx := requestid.NewContext(r.Context(), id)
+		w.Header().Set(requestid.Header, id)
+		requestid.Logf(ctx, "%s %s", r.Method, r.URL.RequestURI())
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether a client-supplied request ID is non-empty, short and printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/requestid"
+)
+
+func TestRequestIDInHandlerAndDatabaseLogs(t *testing.T) {
+	d, conn := newTestDatabaseConn(t)
+	// Make the database query fail so the DB layer logs
+	if _, err := conn.Exec(`DROP TABLE funding_stats`); err != nil {
+		t.Fatalf("failed to drop funding_stats: %v", err)
+	}
+	s := NewAPIServer(d)
+
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(prev)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/frr-resampled/USD", nil)
+	req.Header.Set(requestid.Header, "corr-123")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 from the failing query", rec.Code)
+	}
+	if got := rec.Header().Get(requestid.Header); got != "corr-123" {
+		t.Errorf("%s header = %q, want the client's corr-123", requestid.Header, got)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		"[request corr-123] GET /api/frr-resampled/USD",
+		"[request corr-123] database query failed",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestRequestIDReplacesInvalidClientID(t *testing.T) {
+	s := NewAPIServer(newTestDatabase(t))
+
+	for _, id := range []string{"", "has space", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/api/frr-resampled/USD", nil)
+		req.Header.Set(requestid.Header, id)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+
+		got := rec.Header().Get(requestid.Header)
+		if got == "" || got == id || !validRequestID(got) {
+			t.Errorf("client ID %q answered with %q, want a generated ID", id, got)
+		}
+	}
+}
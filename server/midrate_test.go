@@ -0,0 +1,50 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestMidRateOfTwoSidedBook(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, offer := range []api.RawFundingBook{
+		{OfferID: 1, Period: 2, Rate: 0.0001, Amount: -100},
+		{OfferID: 2, Period: 2, Rate: 0.0002, Amount: -50}, // Best bid
+		{OfferID: 3, Period: 2, Rate: 0.0004, Amount: 200}, // Best ask
+		{OfferID: 4, Period: 30, Rate: 0.0005, Amount: 300},
+	} {
+		if _, err := d.SaveRawFundingBookAt("fUSD", 1000, offer); err != nil {
+			t.Fatalf("SaveRawFundingBookAt: %v", err)
+		}
+	}
+	// fUST only has asks
+	if _, err := d.SaveRawFundingBookAt("fUST", 1000, api.RawFundingBook{OfferID: 5, Period: 2, Rate: 0.0003, Amount: 10}); err != nil {
+		t.Fatalf("SaveRawFundingBookAt: %v", err)
+	}
+
+	mid, bestBid, bestAsk, err := d.GetFundingBookMidRate("fUSD")
+	if err != nil {
+		t.Fatalf("GetFundingBookMidRate: %v", err)
+	}
+	if math.Abs(mid-0.0003) > 1e-15 || bestBid != 0.0002 || bestAsk != 0.0004 {
+		t.Errorf("mid %v best bid %v best ask %v, want 0.0003 between 0.0002 and 0.0004", mid, bestBid, bestAsk)
+	}
+
+	s := NewAPIServer(d)
+	var got MidRate
+	decodeJSON(t, get(t, s, "/api/mid-rate/USD"), &got)
+	if got.Currency != "fUSD" || math.Abs(got.Mid-0.0003) > 1e-15 || got.BestBid != 0.0002 || got.BestAsk != 0.0004 {
+		t.Errorf("mid rate = %+v, want 0.0003 between 0.0002 and 0.0004", got)
+	}
+
+	// A one-sided book and a missing book are reported with their own status
+	if rec := get(t, s, "/api/mid-rate/UST"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("one-sided book status = %d, want 422", rec.Code)
+	}
+	if rec := get(t, s, "/api/mid-rate/EUR"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing book status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestNetFundingFlowSumsSignedAmounts(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, trade := range []api.FundingTrade{
+		{ID: 1, MTS: 1000, Amount: 500, Rate: 0.0001, Period: 2},
+		{ID: 2, MTS: 1500, Amount: -200, Rate: 0.0002, Period: 2},
+		{ID: 3, MTS: 2500, Amount: -450, Rate: 0.0002, Period: 30},
+		{ID: 4, MTS: 2600, Amount: 100, Rate: 0.0001, Period: 2},
+		{ID: 5, MTS: 9000, Amount: 1000, Rate: 0.0001, Period: 2}, // Outside the range
+	} {
+		// Executed and updated messages of the same trade count once
+		for _, msgType := range []string{"fte", "ftu"} {
+			if _, err := d.SaveWSFundingTrade("fUSD", trade, msgType); err != nil {
+				t.Fatalf("SaveWSFundingTrade: %v", err)
+			}
+		}
+	}
+	if _, err := d.SaveWSFundingTrade("fUST", api.FundingTrade{ID: 6, MTS: 1200, Amount: 777, Rate: 0.0001, Period: 2}, "ftu"); err != nil {
+		t.Fatalf("SaveWSFundingTrade: %v", err)
+	}
+
+	net, err := d.GetNetFundingFlow("fUSD", 1000, 3000)
+	if err != nil {
+		t.Fatalf("GetNetFundingFlow: %v", err)
+	}
+	if net != -50 {
+		t.Errorf("GetNetFundingFlow = %v, want -50", net)
+	}
+
+	s := NewAPIServer(d)
+	var flow NetFundingFlow
+	decodeJSON(t, get(t, s, "/api/net-flow/USD?start=1000&end=3000"), &flow)
+	if flow.Currency != "fUSD" || flow.NetAmount != -50 || flow.Buckets != nil {
+		t.Errorf("net flow = %+v, want -50 for fUSD without buckets", flow)
+	}
+
+	decodeJSON(t, get(t, s, "/api/net-flow/USD?start=1000&end=3000&granularity=1s"), &flow)
+	want := []db.NetFlowPoint{
+		{MTS: 1000, NetAmount: 300, Trades: 2},
+		{MTS: 2000, NetAmount: -350, Trades: 2},
+	}
+	if flow.NetAmount != -50 || len(flow.Buckets) != len(want) {
+		t.Fatalf("bucketed net flow = %+v, want -50 in %d buckets", flow, len(want))
+	}
+	for i, w := range want {
+		if flow.Buckets[i] != w {
+			t.Errorf("bucket %d = %+v, want %+v", i, flow.Buckets[i], w)
+		}
+	}
+
+	for _, target := range []string{
+		"/api/net-flow/USD?start=3000&end=1000",
+		"/api/net-flow/USD?granularity=soon",
+	} {
+		if rec := get(t, s, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s status = %d, want 400", target, rec.Code)
+		}
+	}
+}
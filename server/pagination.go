@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxResponseItems is the default cap on the number of items serialized in a single response
+const defaultMaxResponseItems = 10000
+
+// defaultPageLimit is the number of items a paged endpoint returns when no limit is requested
+const defaultPageLimit = 100
+
+// parseLimit returns the limit query parameter capped to the maximum response size. A missing or
+// invalid limit uses defaultPageLimit.
+func (s *APIServer) parseLimit(r *http.Request) int {
+	limit := defaultPageLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+	limit, _ = s.clampLimit(limit)
+	return limit
+}
+
+// parseBeforeCursor returns the before query parameter, the MTS a page continues before, or math.MaxInt64
+// for the first page
+func parseBeforeCursor(r *http.Request) (int64, error) {
+	beforeStr := r.URL.Query().Get("before")
+	if beforeStr == "" {
+		return math.MaxInt64, nil
+	}
+	return strconv.ParseInt(beforeStr, 10, 64)
+}
+
+// clampLimit caps a requested item count to the configured maximum response size.
+// It reports whether the requested limit was reduced.
+func (s *APIServer) clampLimit(limit int) (int, bool) {
+	if limit > s.maxResponseItems {
+		return s.maxResponseItems, true
+	}
+	return limit, false
+}
+
+// nextPage trims items, read with one item beyond limit, to limit. When the extra item shows that more
+// items exist, it links the page continuing before the cursor of the last returned item, so every
+// paged endpoint announces a next page exactly when there is one.
+func nextPage[T any](w http.ResponseWriter, r *http.Request, items []T, limit int, cursor func(T) string) []T {
+	if len(items) <= limit {
+		return items
+	}
+	items = items[:limit]
+	setNextLink(w, r, cursor(items[len(items)-1]))
+	return items
+}
+
+// setNextLink adds a Link header pointing to the page that continues before the given cursor,
+// and the cursor itself as X-Next-Cursor
+func setNextLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	setNextLinkParam(w, r, "before", cursor)
+}
+
+// setNextLinkParam adds a Link header pointing to the page that sets param to the given cursor,
+// and the cursor itself as X-Next-Cursor
+func setNextLinkParam(w http.ResponseWriter, r *http.Request, param, cursor string) {
+	next := *r.URL
+	query := next.Query()
+	query.Set(param, cursor)
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	setNextCursor(w, cursor)
+}
+
+// setNextCursor adds an X-Next-Cursor header with the before value of the next page
+func setNextCursor(w http.ResponseWriter, cursor string) {
+	w.Header().Set("X-Next-Cursor", cursor)
+}
+
+// setTotalCount adds an X-Total-Count header with the number of items across all pages
+func setTotalCount(w http.ResponseWriter, total int64) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+}
+
+// formatTradeCursor returns the before cursor continuing after the trade with mts and id
+func formatTradeCursor(mts, id int64) string {
+	return strconv.FormatInt(mts, 10) + "_" + strconv.FormatInt(id, 10)
+}
+
+// parseTradeCursor parses a before cursor of formatTradeCursor. A plain MTS is accepted as well and
+// continues before that millisecond.
+func parseTradeCursor(cursor string) (mts, id int64, err error) {
+	mtsStr, idStr, found := strings.Cut(cursor, "_")
+	if mts, err = strconv.ParseInt(mtsStr, 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return mts, math.MinInt64, nil
+	}
+	if id, err = strconv.ParseInt(idStr, 10, 64); err != nil {
+		return 0, 0, err
+	}
+	return mts, id, nil
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestWSFundingTradesPagesKeepTradesSharingAMillisecond(t *testing.T) {
+	d := newTestDatabase(t)
+
+	// Five trades in one millisecond and one earlier, the first two stored as both "fte" and "ftu"
+	var records []db.WSFundingTradeRecord
+	for id := int64(1); id <= 5; id++ {
+		trade := api.FundingTrade{ID: id, MTS: 1700000000000, Amount: 100, Rate: 0.0001, Period: 2}
+		records = append(records, db.WSFundingTradeRecord{Currency: "fUSD", Trade: trade, MsgType: "ftu"})
+		if id <= 2 {
+			records = append(records, db.WSFundingTradeRecord{Currency: "fUSD", Trade: trade, MsgType: "fte"})
+		}
+	}
+	earlier := api.FundingTrade{ID: 6, MTS: 1699999999000, Amount: 100, Rate: 0.0001, Period: 2}
+	records = append(records, db.WSFundingTradeRecord{Currency: "fUSD", Trade: earlier, MsgType: "ftu"})
+	if _, err := d.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+
+	s := NewAPIServerWithConfig(d, Config{MaxResponseItems: 2})
+
+	seen := make(map[int64]int)
+	target := "/api/ws-funding-trades/USD"
+	for pages := 0; target != ""; pages++ {
+		if pages > 10 {
+			t.Fatal("paging did not end")
+		}
+		rec := get(t, s, target)
+		var trades []api.FundingTrade
+		decodeJSON(t, rec, &trades)
+		if got := rec.Header().Get("X-Total-Count"); got != "6" {
+			t.Fatalf("X-Total-Count = %s, want 6", got)
+		}
+		for _, trade := range trades {
+			seen[trade.ID]++
+		}
+
+		target = ""
+		if cursor := rec.Header().Get("X-Next-Cursor"); cursor != "" {
+			target = "/api/ws-funding-trades/USD?before=" + url.QueryEscape(cursor)
+		}
+	}
+
+	for id := int64(1); id <= 6; id++ {
+		if seen[id] != 1 {
+			t.Errorf("trade %d returned %d times, want once", id, seen[id])
+		}
+	}
+}
+
+func TestParseTradeCursor(t *testing.T) {
+	mts, id, err := parseTradeCursor(formatTradeCursor(1700000000000, 42))
+	if err != nil || mts != 1700000000000 || id != 42 {
+		t.Fatalf("round trip = %d, %d, %v", mts, id, err)
+	}
+
+	// A plain MTS continues before that millisecond
+	mts, id, err = parseTradeCursor("1700000000000")
+	if err != nil || mts != 1700000000000 || id >= 0 {
+		t.Fatalf("plain MTS = %d, %d, %v", mts, id, err)
+	}
+
+	if _, _, err := parseTradeCursor("1700000000000_x"); err == nil {
+		t.Fatal("expected an error for a malformed trade ID")
+	}
+}
+
+func TestSeriesLinksNextPageWheneverMoreRowsExist(t *testing.T) {
+	d, conn := newTestDatabaseConn(t)
+	for _, ts := range []int64{1000, 2000, 3000} {
+		if _, err := conn.Exec(`INSERT INTO funding_ticker (currency, timestamp, frr, frr_amount_available) VALUES ('fUSD', ?, 0.0001, 10)`, ts); err != nil {
+			t.Fatalf("failed to seed ticker: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		maxItems   int
+		target     string
+		wantPoints int
+		wantCursor string
+	}{
+		{"below limit", 0, "/api/frr-available-series/USD?limit=5", 3, ""},
+		{"exactly limit", 0, "/api/frr-available-series/USD?limit=3", 3, ""},
+		{"limit reached", 0, "/api/frr-available-series/USD?limit=2", 2, "2000"},
+		{"response cap reached", 2, "/api/frr-available-series/USD", 2, "2000"},
+		{"last page", 0, "/api/frr-available-series/USD?limit=2&before=2000", 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAPIServerWithConfig(d, Config{MaxResponseItems: tt.maxItems})
+			rec := get(t, s, tt.target)
+			var points []db.FRRAmountAvailablePoint
+			decodeJSON(t, rec, &points)
+
+			if len(points) != tt.wantPoints {
+				t.Errorf("got %d points, want %d", len(points), tt.wantPoints)
+			}
+			if got := rec.Header().Get("X-Next-Cursor"); got != tt.wantCursor {
+				t.Errorf("X-Next-Cursor = %q, want %q", got, tt.wantCursor)
+			}
+			link := rec.Header().Get("Link")
+			switch {
+			case tt.wantCursor == "" && link != "":
+				t.Errorf("Link = %q, want none on the last page", link)
+			case tt.wantCursor != "" && !strings.Contains(link, "before="+tt.wantCursor):
+				t.Errorf("Link = %q, want a next link before %s", link, tt.wantCursor)
+			}
+		})
+	}
+}
+
+func TestFundingCalendarPagesByWholeSnapshot(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, mts := range []int64{1000, 2000, 3000} {
+		for i, period := range []int{2, 30} {
+			offer := api.RawFundingBook{OfferID: int(mts) + i, Period: period, Rate: 0.0001, Amount: 100}
+			if _, err := d.SaveRawFundingBookAt("fUSD", mts, offer); err != nil {
+				t.Fatalf("SaveRawFundingBookAt: %v", err)
+			}
+		}
+	}
+
+	// Three points per page would split a snapshot of two periods
+	s := NewAPIServerWithConfig(d, Config{MaxResponseItems: 3})
+
+	seen := make(map[string]int)
+	var pageSizes []int
+	target := "/api/funding-calendar/USD?start=0&end=10000"
+	for pages := 0; target != ""; pages++ {
+		if pages > 10 {
+			t.Fatal("paging did not end")
+		}
+		rec := get(t, s, target)
+		var calendar FundingCalendar
+		decodeJSON(t, rec, &calendar)
+
+		points := 0
+		for period, series := range calendar.Series {
+			for _, p := range series {
+				seen[fmt.Sprintf("%d/%d", p.MTS, period)]++
+				points++
+			}
+		}
+		pageSizes = append(pageSizes, points)
+
+		target = ""
+		if cursor := rec.Header().Get("X-Next-Cursor"); cursor != "" {
+			if !strings.Contains(rec.Header().Get("Link"), "start="+cursor) {
+				t.Errorf("Link = %q, want a next link starting at %s", rec.Header().Get("Link"), cursor)
+			}
+			target = "/api/funding-calendar/USD?end=10000&start=" + cursor
+		}
+	}
+
+	if fmt.Sprint(pageSizes) != "[2 2 2]" {
+		t.Errorf("page sizes = %v, want one whole snapshot of 2 periods per page", pageSizes)
+	}
+	if len(seen) != 6 {
+		t.Errorf("got %d distinct points, want 6: %v", len(seen), seen)
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("point %s returned %d times, want once", key, n)
+		}
+	}
+}
+
+func TestParseLimitAndBeforeCursor(t *testing.T) {
+	s := NewAPIServerWithConfig(newTestDatabase(t), Config{MaxResponseItems: 150})
+
+	for query, want := range map[string]int{
+		"":          defaultPageLimit,
+		"limit=20":  20,
+		"limit=500": 150,
+		"limit=0":   defaultPageLimit,
+		"limit=abc": defaultPageLimit,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		if got := s.parseLimit(r); got != want {
+			t.Errorf("parseLimit(%q) = %d, want %d", query, got, want)
+		}
+	}
+
+	before, err := parseBeforeCursor(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil || before != math.MaxInt64 {
+		t.Errorf("parseBeforeCursor without before = %d, %v, want math.MaxInt64", before, err)
+	}
+	before, err = parseBeforeCursor(httptest.NewRequest(http.MethodGet, "/?before=1700000000000", nil))
+	if err != nil || before != 1700000000000 {
+		t.Errorf("parseBeforeCursor = %d, %v, want 1700000000000", before, err)
+	}
+	if _, err := parseBeforeCursor(httptest.NewRequest(http.MethodGet, "/?before=x", nil)); err == nil {
+		t.Error("expected an error for a malformed before cursor")
+	}
+
+	if rec := get(t, s, "/api/utilization-series/USD?before=x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed before status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/requestid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// replayPageSize is the number of stored trades a replay reads at a time
+	replayPageSize = 500
+	// maxReplaySpeed caps the replay speed multiplier
+	maxReplaySpeed = 1e6
+)
+
+// handleReplayFundingTrades replays the stored WebSocket funding trades of a currency between start and end
+// as Server-Sent Events, oldest first, spacing them by their original gaps divided by speed. Each trade is
+// a funding-trade event; an end event carrying the number of replayed trades closes a complete replay.
+// The replay stops when the client disconnects.
+func (s *APIServer) handleReplayFundingTrades(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	end := time.Now().UnixMilli()
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		parsedEnd, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid end parameter", http.StatusBadRequest)
+			return
+		}
+		end = parsedEnd
+	}
+
+	start := end - time.Hour.Milliseconds() // Default to the last hour
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		parsedStart, err := strconv.ParseInt(startStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid start parameter", http.StatusBadRequest)
+			return
+		}
+		start = parsedStart
+	}
+	if start > end {
+		http.Error(w, "start must not be after end", http.StatusBadRequest)
+		return
+	}
+
+	speed := 1.0
+	if speedStr := r.URL.Query().Get("speed"); speedStr != "" {
+		parsedSpeed, err := strconv.ParseFloat(speedStr, 64)
+		if err != nil || math.IsNaN(parsedSpeed) || parsedSpeed <= 0 || parsedSpeed > maxReplaySpeed {
+			http.Error(w, "Invalid speed parameter, must be greater than 0 and at most 1000000", http.StatusBadRequest)
+			return
+		}
+		speed = parsedSpeed
+	}
+
+	timeFormat, ok := parseTimeFormat(w, r)
+	if !ok {
+		return
+	}
+
+	rc, ok := startSSE(w)
+	if !ok {
+		return
+	}
+	write := sseWriter(w, rc, s.statsHub.evictTimeout)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	// waitUntil sleeps until due while keeping the stream open, reporting false once the client is gone
+	waitUntil := func(due time.Time) bool {
+		timer := time.NewTimer(time.Until(due))
+		defer timer.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return false
+			case <-keepAlive.C:
+				if err := write(": keep-alive\n\n"); err != nil {
+					return false
+				}
+			case <-timer.C:
+				return true
+			}
+		}
+	}
+
+	// Trades are due relative to the first one, so write and read time does not add up over the replay
+	began := time.Now()
+	first := int64(-1)
+	replayed := 0
+	afterMTS, afterID := start, int64(math.MinInt64)
+	for {
+		trades, err := s.database.GetWSFundingTradesFromWithContext(r.Context(), currency, afterMTS, afterID, end, replayPageSize)
+		if err != nil {
+			requestid.Logf(r.Context(), "Stopped %s funding trade replay: %v", currency, err)
+			return
+		}
+
+		for _, trade := range trades {
+			if first < 0 {
+				first = trade.MTS
+			}
+			offset := time.Duration(float64(trade.MTS-first) / speed * float64(time.Millisecond))
+			if !waitUntil(began.Add(offset)) {
+				return
+			}
+
+			data, err := json.Marshal(newFundingTradeResponses([]api.FundingTrade{trade}, timeFormat)[0])
+			if err != nil {
+				return
+			}
+			if err := write("event: funding-trade\nid: %d\ndata: %s\n\n", trade.ID, data); err != nil {
+				return
+			}
+			replayed++
+		}
+
+		if len(trades) < replayPageSize {
+			break
+		}
+		last := trades[len(trades)-1]
+		afterMTS, afterID = last.MTS, last.ID
+	}
+
+	write("event: end\ndata: {\"trades\":%d}\n\n", replayed)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestReplayFundingTradesInOrderAndScaled(t *testing.T) {
+	d := newTestDatabase(t)
+
+	// Three trades a second apart, saved out of order
+	var records []db.WSFundingTradeRecord
+	for _, id := range []int64{3, 1, 2} {
+		trade := api.FundingTrade{ID: id, MTS: 1700000000000 + (id-1)*1000, Amount: 100, Rate: 0.0001, Period: 2}
+		records = append(records, db.WSFundingTradeRecord{Currency: "fUSD", Trade: trade, MsgType: "ftu"})
+	}
+	if _, err := d.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+
+	srv := httptest.NewServer(NewAPIServer(d).router)
+	defer srv.Close()
+
+	// At speed 10 the trades are 100ms apart
+	resp, err := http.Get(srv.URL + "/ws/replay/funding-trades/USD?start=1700000000000&end=1700000002000&speed=10")
+	if err != nil {
+		t.Fatalf("GET replay: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	var ids []string
+	var arrived []time.Time
+	ended := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && !ended {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+			arrived = append(arrived, time.Now())
+		case line == "event: end":
+			ended = true
+		}
+	}
+	if !ended {
+		t.Fatalf("stream ended without an end event: %v", scanner.Err())
+	}
+
+	if got := strings.Join(ids, ","); got != "1,2,3" {
+		t.Fatalf("replayed ids %s, want 1,2,3", got)
+	}
+	if elapsed := arrived[2].Sub(arrived[0]); elapsed < 150*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("replay of 2s at speed 10 took %s, want about 200ms", elapsed)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestFRRAmountAvailableSeries(t *testing.T) {
+	d, conn := newTestDatabaseConn(t)
+
+	// Tickers of fUSD, one without an FRR amount, and one of another currency
+	seed := []struct {
+		currency  string
+		timestamp int64
+		amount    interface{}
+	}{
+		{"fUSD", 1000, 10.5},
+		{"fUSD", 2000, nil},
+		{"fUSD", 3000, 30.25},
+		{"fBTC", 4000, 99.0},
+	}
+	for _, row := range seed {
+		if _, err := conn.Exec(`INSERT INTO funding_ticker (currency, timestamp, frr, frr_amount_available) VALUES (?, ?, 0.0001, ?)`,
+			row.currency, row.timestamp, row.amount); err != nil {
+			t.Fatalf("failed to seed ticker: %v", err)
+		}
+	}
+
+	s := NewAPIServer(d)
+
+	var points []db.FRRAmountAvailablePoint
+	decodeJSON(t, get(t, s, "/api/frr-available-series/USD"), &points)
+	if len(points) != 3 {
+		t.Fatalf("got %d points, want 3: %+v", len(points), points)
+	}
+
+	want := []struct {
+		timestamp int64
+		amount    *float64
+	}{
+		{3000, floatPtr(30.25)},
+		{2000, nil},
+		{1000, floatPtr(10.5)},
+	}
+	for i, w := range want {
+		got := points[i]
+		if got.Timestamp != w.timestamp {
+			t.Errorf("point %d timestamp = %d, want %d", i, got.Timestamp, w.timestamp)
+		}
+		switch {
+		case w.amount == nil && got.FRRAmountAvailable != nil:
+			t.Errorf("point %d amount = %v, want null", i, *got.FRRAmountAvailable)
+		case w.amount != nil && (got.FRRAmountAvailable == nil || *got.FRRAmountAvailable != *w.amount):
+			t.Errorf("point %d amount = %v, want %v", i, got.FRRAmountAvailable, *w.amount)
+		}
+	}
+
+	decodeJSON(t, get(t, s, "/api/frr-available-series/USD?limit=1&before=3000"), &points)
+	if len(points) != 1 || points[0].Timestamp != 2000 {
+		t.Fatalf("limit=1&before=3000 returned %+v, want the 2000 point", points)
+	}
+}
+
+func TestBookDepthSeriesReportsTruncation(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, mts := range []int64{1000, 2000, 3000} {
+		level := api.FundingBook{Rate: 0.0001, Period: 2, Count: 1, Amount: float64(mts)}
+		if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, mts, level); err != nil {
+			t.Fatalf("SaveFundingBookAt: %v", err)
+		}
+	}
+
+	// The response cap cuts the series like a smaller limit would
+	s := NewAPIServerWithConfig(d, Config{MaxResponseItems: 2})
+
+	rec := get(t, s, "/api/book-depth-series/USD?limit=100")
+	var points []db.BookDepthPoint
+	decodeJSON(t, rec, &points)
+	if len(points) != 2 || points[0].MTS != 2000 || points[1].MTS != 3000 {
+		t.Fatalf("first page = %+v, want the 2000 and 3000 snapshots oldest first", points)
+	}
+	if cursor := rec.Header().Get("X-Next-Cursor"); cursor != "2000" {
+		t.Fatalf("X-Next-Cursor = %q, want 2000", cursor)
+	}
+	if rec.Header().Get("Link") == "" {
+		t.Error("missing Link header on a truncated series")
+	}
+
+	rec = get(t, s, "/api/book-depth-series/USD?before=2000")
+	decodeJSON(t, rec, &points)
+	if len(points) != 1 || points[0].MTS != 1000 || points[0].TotalAsk != 1000 {
+		t.Fatalf("second page = %+v, want the 1000 snapshot", points)
+	}
+	if cursor := rec.Header().Get("X-Next-Cursor"); cursor != "" {
+		t.Errorf("X-Next-Cursor = %q on the last page, want none", cursor)
+	}
+}
+
+// floatPtr returns a pointer to v
+func floatPtr(v float64) *float64 {
+	return &v
+}
@@ -1,29 +1,146 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"math"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/buildinfo"
 	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/scheduler"
 	"github.com/gary0122g/BitfinexFundingData/service"
+	"github.com/gary0122g/BitfinexFundingData/static"
 	"github.com/gorilla/mux"
 )
 
+// Config holds optional settings for the API server
+type Config struct {
+	StaticDir string               // Serve static files from this directory instead of the embedded assets (for development)
+	Scheduler *scheduler.Scheduler // Scheduler whose task history is exposed, optional
+
+	// TradeBuffer buffers streamed trades; its saves are held while the database is vacuumed. Optional.
+	TradeBuffer *db.TradeBuffer
+
+	// AdminToken is the bearer token required by admin endpoints; admin endpoints are disabled when empty
+	AdminToken string
+
+	// MaxResponseItems caps the number of items in list responses; larger results are
+	// truncated and a Link header to the next page is returned. 0 uses the default.
+	MaxResponseItems int
+
+	// Connection timeouts of the HTTP server, guarding against slow clients holding
+	// connections open. 0 uses the defaults below.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	// FRRScaling selects the value of the frr field of funding stats responses. Empty uses apr.
+	FRRScaling FRRScaling
+
+	// StreamEvictTimeout is how long a stream client may fail to keep up, with a full event queue or
+	// a blocked write, before it is disconnected. 0 uses the default; negative never evicts.
+	StreamEvictTimeout time.Duration
+
+	// FRRRegime sets when /api/frr-regime reports a rising or falling FRR. The zero value uses
+	// service.DefaultRegimeThresholds.
+	FRRRegime service.RegimeThresholds
+
+	// WSTradeCurrencies are the currencies whose WebSocket trades are streamed, reported by
+	// /api/feed-status even before their first trade is stored
+	WSTradeCurrencies []string
+
+	// WSFeedStaleAfter is how long a currency may go without a stored WebSocket trade during WSFeedHours
+	// before its feed is reported as degraded. 0 disables the check.
+	WSFeedStaleAfter time.Duration
+	WSFeedHours      FeedHours
+}
+
+// Default HTTP server timeouts
+const (
+	defaultReadTimeout  = 15 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+	defaultIdleTimeout  = 60 * time.Second
+)
+
 // APIServer handles API requests
 type APIServer struct {
-	database *db.Database
-	router   *mux.Router
+	database  *db.Database
+	router    *mux.Router
+	staticFS  fs.FS
+	scheduler *scheduler.Scheduler
+	trades    *db.TradeBuffer
+
+	adminToken       string
+	maxResponseItems int
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+
+	frrScaling FRRScaling
+	frrRegime  service.RegimeThresholds
+
+	ready int32 // Reported by /readyz, accessed atomically
+
+	statsHub *statsHub    // Newly saved funding stats for /api/stream/funding-stats
+	feeds    *feedMonitor // Newest stored WebSocket trades for /api/feed-status
 }
 
 // NewAPIServer creates a new API server
 func NewAPIServer(database *db.Database) *APIServer {
+	return NewAPIServerWithConfig(database, Config{})
+}
+
+// NewAPIServerWithConfig creates a new API server using the given configuration
+func NewAPIServerWithConfig(database *db.Database, config Config) *APIServer {
 	server := &APIServer{
-		database: database,
-		router:   mux.NewRouter(),
+		database:  database,
+		router:    mux.NewRouter(),
+		staticFS:  static.FS,
+		scheduler: config.Scheduler,
+		trades:    config.TradeBuffer,
+
+		adminToken:       config.AdminToken,
+		maxResponseItems: defaultMaxResponseItems,
+
+		readTimeout:  durationOrDefault(config.ReadTimeout, defaultReadTimeout),
+		writeTimeout: durationOrDefault(config.WriteTimeout, defaultWriteTimeout),
+		idleTimeout:  durationOrDefault(config.IdleTimeout, defaultIdleTimeout),
+
+		frrScaling: FRRScalingAPR,
+		frrRegime:  service.DefaultRegimeThresholds,
+
+		ready: 1,
+
+		statsHub: newStatsHub(durationOrDefault(config.StreamEvictTimeout, defaultStreamEvictTimeout)),
+		feeds:    newFeedMonitor(config.WSFeedStaleAfter, config.WSFeedHours, config.WSTradeCurrencies),
+	}
+	if config.StreamEvictTimeout < 0 {
+		server.statsHub.evictTimeout = 0
+	}
+	if config.StaticDir != "" {
+		server.staticFS = os.DirFS(config.StaticDir)
+	}
+	if config.MaxResponseItems > 0 {
+		server.maxResponseItems = config.MaxResponseItems
+	}
+	if config.FRRScaling != "" {
+		server.frrScaling = config.FRRScaling
+	}
+	if config.FRRRegime != (service.RegimeThresholds{}) {
+		server.frrRegime = config.FRRRegime
 	}
 	server.routes()
 	return server
@@ -31,8 +148,10 @@ func NewAPIServer(database *db.Database) *APIServer {
 
 // routes sets up API routes
 func (s *APIServer) routes() {
+	s.router.Use(requestIDMiddleware)
+
 	// Static file service with no-cache headers for development
-	staticHandler := http.StripPrefix("/static/", http.FileServer(http.Dir("./static")))
+	staticHandler := http.StripPrefix("/static/", http.FileServer(http.FS(s.staticFS)))
 	s.router.PathPrefix("/static/").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		w.Header().Set("Pragma", "no-cache")
@@ -43,18 +162,42 @@ func (s *APIServer) routes() {
 	// Homepage
 	s.router.HandleFunc("/", s.handleHome).Methods("GET")
 
+	// Readiness probe
+	s.router.HandleFunc("/readyz", s.handleReadyz).Methods("GET")
+
+	// Replay of stored WebSocket funding trades as Server-Sent Events
+	s.router.HandleFunc("/ws/replay/funding-trades/{currency}", s.handleReplayFundingTrades).Methods("GET")
+
 	// API endpoints
 	api := s.router.PathPrefix("/api").Subrouter()
 
 	// FundingStats API
 	api.HandleFunc("/funding-stats/{currency}", s.handleGetFundingStats).Methods("GET")
+	api.HandleFunc("/stream/funding-stats/{currency}", s.handleStreamFundingStats).Methods("GET")
+	api.HandleFunc("/frr-resampled/{currency}", s.handleGetFundingStatsResampled).Methods("GET")
+	api.HandleFunc("/frr-compare", s.handleGetFRRComparison).Methods("GET")
+	api.HandleFunc("/frr-correlation", s.handleGetFRRCorrelation).Methods("GET")
+	api.HandleFunc("/below-threshold-ratio/{currency}", s.handleGetBelowThresholdRatio).Methods("GET")
+	api.HandleFunc("/utilization-series/{currency}", s.handleGetUtilizationSeries).Methods("GET")
+	api.HandleFunc("/frr-regime/{currency}", s.handleGetFRRRegime).Methods("GET")
+	api.HandleFunc("/stats-summary/{currency}", s.handleGetStatsSummary).Methods("GET")
 
 	// FundingTicker API
 	api.HandleFunc("/funding-ticker/{currency}", s.handleGetFundingTicker).Methods("GET")
+	api.HandleFunc("/funding-ticker/{currency}/history", s.handleGetFundingTickerHistory).Methods("GET")
+	api.HandleFunc("/funding-ticker-delta/{currency}", s.handleGetFundingTickerDelta).Methods("GET")
+	api.HandleFunc("/frr-available-series/{currency}", s.handleGetFRRAmountAvailableSeries).Methods("GET")
+	api.HandleFunc("/ticker-with-book/{currency}/history", s.handleGetTickerWithBookHistory).Methods("GET")
 
 	// FundingBook API
 	api.HandleFunc("/funding-book/{currency}", s.handleGetFundingBook).Methods("GET")
+	api.HandleFunc("/funding-book/{currency}/at/{mts}", s.handleGetFundingBookAt).Methods("GET")
+	api.HandleFunc("/book-depth-series/{currency}", s.handleGetBookDepthSeries).Methods("GET")
+	api.HandleFunc("/funding-books-latest", s.handleGetLatestFundingBooks).Methods("GET")
 	api.HandleFunc("/raw-funding-book/{currency}", s.handleGetRawFundingBook).Methods("GET")
+	api.HandleFunc("/mid-rate/{currency}", s.handleGetMidRate).Methods("GET")
+	api.HandleFunc("/funding-book-agg/{currency}", s.handleGetBucketedFundingBook).Methods("GET")
+	api.HandleFunc("/funding-calendar/{currency}", s.handleGetFundingCalendar).Methods("GET")
 
 	// Funding Trades Comparison API
 	api.HandleFunc("/funding-trades-comparison/{currency}", s.handleGetFundingTradesComparison).Methods("GET")
@@ -62,22 +205,111 @@ func (s *APIServer) routes() {
 	// Funding Trades Distribution API
 	api.HandleFunc("/funding-trades-distribution/{currency}", s.handleGetFundingTradesDistribution).Methods("GET")
 
+	// Net Funding Flow API
+	api.HandleFunc("/net-flow/{currency}", s.handleGetNetFundingFlow).Methods("GET")
+
 	// All WebSocket Funding Trades API
 	api.HandleFunc("/ws-funding-trades/{currency}", s.handleGetAllWSFundingTrades).Methods("GET")
+	api.HandleFunc("/feed-status", s.handleGetFeedStatus).Methods("GET")
 
 	// Rate Distribution API
 	api.HandleFunc("/rate-distribution/{currency}", s.handleGetRateDistribution).Methods("GET")
+	api.HandleFunc("/rate-distribution/{currency}/variants", s.handleGetRateDistributionVariants).Methods("GET")
+	api.HandleFunc("/rate-distribution/{currency}/history", s.handleGetRateDistributionHistory).Methods("GET")
+	api.HandleFunc("/rate-distribution/{currency}/chart", s.handleGetRateDistributionChart).Methods("GET")
+	api.HandleFunc("/rate-distribution/{currency}/bin/{index}", s.handleGetRateDistributionBin).Methods("GET")
+
+	// Windowed Trade Histogram API
+	api.HandleFunc("/trade-histogram/{currency}", s.handleGetTradeHistogram).Methods("GET")
+
+	// Build Information API
+	api.HandleFunc("/version", s.handleGetVersion).Methods("GET")
+
+	// Stored Data Coverage API
+	api.HandleFunc("/coverage/{currency}", s.handleGetCoverage).Methods("GET")
+
+	// Task Execution History API
+	api.HandleFunc("/tasks/{name}/history", s.handleGetTaskHistory).Methods("GET")
+	api.HandleFunc("/tasks/{name}/status", s.handleGetTaskStatus).Methods("GET")
+	api.HandleFunc("/scheduler/maintenance", s.handleGetMaintenanceStatus).Methods("GET")
+
+	// Admin API
+	api.HandleFunc("/collect/{currency}", s.requireAdmin(s.handleCollect)).Methods("POST")
+	api.HandleFunc("/admin/vacuum", s.requireAdmin(s.handleVacuum)).Methods("POST")
+	api.HandleFunc("/admin/tasks/{name}/enable", s.requireAdmin(s.handleEnableTask)).Methods("POST")
+	api.HandleFunc("/admin/ingest/funding-trades/{currency}", s.requireAdmin(s.handleIngestFundingTrades)).Methods("POST")
 }
 
 // Start launches the API server
 func (s *APIServer) Start(addr string) error {
 	fmt.Printf("API server listening on %s\n", addr)
-	return http.ListenAndServe(addr, s.router)
+	return s.httpServer(addr).ListenAndServe()
+}
+
+// StartTLS starts the API server serving HTTPS with the given certificate and key files
+func (s *APIServer) StartTLS(addr, certFile, keyFile string) error {
+	fmt.Printf("API server listening on %s (TLS)\n", addr)
+	return s.httpServer(addr).ListenAndServeTLS(certFile, keyFile)
+}
+
+// SetReady sets whether /readyz reports the server as ready, e.g. false while initial data is loading.
+// A new server is ready.
+func (s *APIServer) SetReady(ready bool) {
+	var value int32
+	if ready {
+		value = 1
+	}
+	atomic.StoreInt32(&s.ready, value)
+}
+
+// handleReadyz reports whether initial data is loaded, responding 503 until it is. A server whose
+// WebSocket trade feeds went silent stays ready but reports itself as degraded together with the currencies.
+func (s *APIServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{"status": "ready"}
+	code := http.StatusOK
+	if atomic.LoadInt32(&s.ready) == 0 {
+		response["status"] = "loading"
+		code = http.StatusServiceUnavailable
+	} else if degraded := s.feeds.degraded(); len(degraded) > 0 {
+		response["status"] = "degraded"
+		response["degraded_feeds"] = degraded
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// httpServer builds the http.Server for addr with the configured timeouts
+func (s *APIServer) httpServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           s.router,
+		ReadHeaderTimeout: s.readTimeout,
+		ReadTimeout:       s.readTimeout,
+		WriteTimeout:      s.writeTimeout,
+		IdleTimeout:       s.idleTimeout,
+	}
+}
+
+// durationOrDefault returns d, or def when d is not positive
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
 }
 
 // handleHome processes homepage requests
 func (s *APIServer) handleHome(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "./static/index.html")
+	content, err := fs.ReadFile(s.staticFS, "index.html")
+	if err != nil {
+		http.Error(w, "Failed to load index page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(content)
 }
 
 // handleGetFundingStats processes requests for funding statistics data
@@ -88,211 +320,1528 @@ func (s *APIServer) handleGetFundingStats(w http.ResponseWriter, r *http.Request
 		currency = "f" + currency
 	}
 
-	// Get query parameters
-	limitStr := r.URL.Query().Get("limit")
-	limit := 100 // Default limit
-	if limitStr != "" {
-		parsedLimit, err := strconv.Atoi(limitStr)
-		if err == nil && parsedLimit > 0 {
-			limit = parsedLimit
+	limit := s.parseLimit(r)
+	before, err := parseBeforeCursor(r)
+	if err != nil {
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+		return
+	}
+
+	// period selects stats of a single offer period, 0 for the stats over all periods
+	period := 0
+	if periodStr := r.URL.Query().Get("period"); periodStr != "" {
+		parsedPeriod, err := strconv.Atoi(periodStr)
+		if err != nil || parsedPeriod < 0 {
+			http.Error(w, "Invalid period parameter", http.StatusBadRequest)
+			return
 		}
+		period = parsedPeriod
 	}
 
-	// Get data from database
-	stats, err := s.database.GetFundingStats(currency, limit)
+	decimals, ok := parseDecimals(w, r)
+	if !ok {
+		return
+	}
+	timeFormat, ok := parseTimeFormat(w, r)
+	if !ok {
+		return
+	}
+
+	// Get data from database, one extra row tells whether another page exists
+	stats, err := s.database.GetFundingStatsBeforeForPeriodWithContext(r.Context(), currency, period, before, limit+1)
 	if err != nil {
 		http.Error(w, "Failed to retrieve funding statistics: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	total, err := s.database.CountFundingStatsWithContext(r.Context(), currency, period)
+	if err != nil {
+		http.Error(w, "Failed to count funding statistics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setTotalCount(w, total)
+
+	stats = nextPage(w, r, stats, limit, func(stat api.FundingStats) string {
+		return strconv.FormatInt(stat.MTS, 10)
+	})
 
 	// Return JSON response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
+	writeResponse(w, r, newFundingStatsResponses(stats, decimals, s.frrScaling, timeFormat))
 }
 
-// handleGetFundingTicker processes requests for funding ticker data
-func (s *APIServer) handleGetFundingTicker(w http.ResponseWriter, r *http.Request) {
+// handleGetBelowThresholdRatio processes requests for the stored below-threshold funding ratio time series
+func (s *APIServer) handleGetBelowThresholdRatio(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	currency := vars["currency"]
 	if !strings.HasPrefix(currency, "f") {
 		currency = "f" + currency
 	}
 
-	// Get data from database
-	ticker, err := s.database.GetLatestFundingTicker(currency)
+	limit := s.parseLimit(r)
+	before, err := parseBeforeCursor(r)
 	if err != nil {
-		http.Error(w, "Failed to retrieve funding ticker data: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
 		return
 	}
 
-	// Return JSON response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ticker)
+	// One extra point tells whether another page exists
+	points, err := s.database.GetBelowThresholdRatiosWithContext(r.Context(), currency, before, limit+1)
+	if err != nil {
+		http.Error(w, "Failed to retrieve below-threshold ratios: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	points = nextPage(w, r, points, limit, func(p db.BelowThresholdRatioPoint) string {
+		return strconv.FormatInt(p.MTS, 10)
+	})
+
+	writeResponse(w, r, points)
 }
 
-// handleGetFundingBook processes requests for funding book data
-func (s *APIServer) handleGetFundingBook(w http.ResponseWriter, r *http.Request) {
+// handleGetFRRAmountAvailableSeries processes requests for the funding offered at FRR of recent stored
+// funding tickers, newest first
+func (s *APIServer) handleGetFRRAmountAvailableSeries(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	currency := vars["currency"]
 	if !strings.HasPrefix(currency, "f") {
 		currency = "f" + currency
 	}
 
-	// Get data from database
-	books, err := s.database.GetLatestFundingBook(currency)
+	limit := s.parseLimit(r)
+	before, err := parseBeforeCursor(r)
 	if err != nil {
-		http.Error(w, "Failed to retrieve funding book data: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
 		return
 	}
 
-	// Return JSON response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(books)
+	// One extra point tells whether another page exists
+	points, err := s.database.GetFRRAmountAvailableSeriesWithContext(r.Context(), currency, before, limit+1)
+	if err != nil {
+		http.Error(w, "Failed to retrieve FRR amount available series: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	points = nextPage(w, r, points, limit, func(p db.FRRAmountAvailablePoint) string {
+		return strconv.FormatInt(p.Timestamp, 10)
+	})
+
+	writeResponse(w, r, points)
 }
 
-// handleGetRawFundingBook processes requests for raw funding book data
-func (s *APIServer) handleGetRawFundingBook(w http.ResponseWriter, r *http.Request) {
+// handleGetUtilizationSeries processes requests for the funding utilization (used / total funding amount)
+// of recent stats rows, newest first
+func (s *APIServer) handleGetUtilizationSeries(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	currency := vars["currency"]
 	if !strings.HasPrefix(currency, "f") {
 		currency = "f" + currency
 	}
 
-	// Get data from database
-	rawBooks, err := s.database.GetLatestRawFundingBook(currency)
+	limit := s.parseLimit(r)
+	before, err := parseBeforeCursor(r)
 	if err != nil {
-		http.Error(w, "Failed to retrieve raw funding book data: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
 		return
 	}
 
-	// Return JSON response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(rawBooks)
+	// One extra row tells whether another page exists
+	stats, err := s.database.GetFundingStatsBeforeWithContext(r.Context(), currency, before, limit+1)
+	if err != nil {
+		http.Error(w, "Failed to retrieve funding statistics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stats = nextPage(w, r, stats, limit, func(stat api.FundingStats) string {
+		return strconv.FormatInt(stat.MTS, 10)
+	})
+
+	writeResponse(w, r, db.NewUtilizationPoints(stats))
 }
 
-// handleGetFundingTradesComparison processes requests for funding trades comparison data
-func (s *APIServer) handleGetFundingTradesComparison(w http.ResponseWriter, r *http.Request) {
+// handleGetBookDepthSeries processes requests for the total bid/ask depth of recent funding book snapshots
+func (s *APIServer) handleGetBookDepthSeries(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	currency := vars["currency"]
 	if !strings.HasPrefix(currency, "f") {
 		currency = "f" + currency
 	}
 
-	// Get query parameters
-	limitStr := r.URL.Query().Get("limit")
-	limit := 100 // Default limit
-	if limitStr != "" {
-		parsedLimit, err := strconv.Atoi(limitStr)
-		if err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		}
-	}
-
-	// Get funding stats data
-	stats, err := s.database.GetFundingStats(currency, limit)
+	limit := s.parseLimit(r)
+	before, err := parseBeforeCursor(r)
 	if err != nil {
-		http.Error(w, "Failed to retrieve funding statistics: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
 		return
 	}
 
-	// Get historical funding trades data
-	startTime := time.Now().Add(-24 * time.Hour) // Last 24 hours
-	endTime := time.Now()
-	trades, err := s.database.GetHistoricalWSFundingTrades(currency, startTime, endTime, limit)
+	// One extra snapshot tells whether another page exists
+	points, err := s.database.GetFundingBookSummaryHistoryBeforeWithContext(r.Context(), currency, before, limit+1)
 	if err != nil {
-		http.Error(w, "Failed to retrieve funding trades: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to retrieve book depth series: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Combine and format the data
-	response := map[string]interface{}{
-		"stats":  stats,
-		"trades": trades,
+	if len(points) > limit {
+		// Points are oldest first, so the extra snapshot is the first one and the next page continues
+		// before the oldest snapshot returned
+		points = points[1:]
+		setNextLink(w, r, strconv.FormatInt(points[0].MTS, 10))
 	}
 
-	// Return JSON response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeResponse(w, r, points)
 }
 
-// handleGetFundingTradesDistribution processes requests for funding trades distribution data
-func (s *APIServer) handleGetFundingTradesDistribution(w http.ResponseWriter, r *http.Request) {
+// handleGetFundingStatsResampled processes requests for funding statistics resampled to a fixed interval
+func (s *APIServer) handleGetFundingStatsResampled(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	currency := vars["currency"]
 	if !strings.HasPrefix(currency, "f") {
 		currency = "f" + currency
 	}
 
-	limit := 10000 // Default to 24 hours
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		parsedLimit, err := strconv.Atoi(limitStr)
-		if err != nil {
-			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
-			return
-		}
-		limit = parsedLimit
+	start, end, interval, ok := s.parseResampleParams(w, r)
+	if !ok {
+		return
+	}
+
+	decimals, ok := parseDecimals(w, r)
+	if !ok {
+		return
+	}
+	timeFormat, ok := parseTimeFormat(w, r)
+	if !ok {
+		return
 	}
 
-	distributions, err := s.database.GetFundingTradesDistribution(currency, limit)
+	// Get data from database
+	stats, err := s.database.GetFundingStatsResampledWithContext(r.Context(), currency, start, end, interval)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to retrieve resampled funding statistics: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(distributions)
+	// Return JSON response
+	writeResponse(w, r, newFundingStatsResponses(stats, decimals, s.frrScaling, timeFormat))
 }
 
-// handleGetAllWSFundingTrades processes requests for all WebSocket funding trades data
-func (s *APIServer) handleGetAllWSFundingTrades(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	currency := vars["currency"]
-	if !strings.HasPrefix(currency, "f") {
-		currency = "f" + currency
+// parseResampleParams reads the start, end (ms) and interval query parameters shared by resampling endpoints,
+// defaulting to the last 7 days in 1h buckets. It writes a 400 response and returns false when they are invalid.
+func (s *APIServer) parseResampleParams(w http.ResponseWriter, r *http.Request) (int64, int64, time.Duration, bool) {
+	interval := 1 * time.Hour // Default bucket size
+	if intervalStr := r.URL.Query().Get("interval"); intervalStr != "" {
+		parsedInterval, err := time.ParseDuration(intervalStr)
+		if err != nil || parsedInterval < time.Millisecond {
+			http.Error(w, "Invalid interval parameter", http.StatusBadRequest)
+			return 0, 0, 0, false
+		}
+		interval = parsedInterval
 	}
 
-	// 使用一個很早的開始時間來獲取所有數據
-	startTime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
-	endTime := time.Now()
+	end := time.Now().UnixMilli()
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		parsedEnd, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid end parameter", http.StatusBadRequest)
+			return 0, 0, 0, false
+		}
+		end = parsedEnd
+	}
+
+	start := end - (7 * 24 * time.Hour).Milliseconds() // Default to the last 7 days
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		parsedStart, err := strconv.ParseInt(startStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid start parameter", http.StatusBadRequest)
+			return 0, 0, 0, false
+		}
+		start = parsedStart
+	}
+
+	if start > end {
+		http.Error(w, "start must not be after end", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+	if (end-start)/interval.Milliseconds() >= int64(s.maxResponseItems) {
+		http.Error(w, "Too many buckets, use a larger interval or a shorter range", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	return start, end, interval, true
+}
+
+// maxCompareCurrencies caps the number of currencies in one FRR comparison
+const maxCompareCurrencies = 10
+
+// FRRComparison holds resampled FRR series for several currencies aligned on shared buckets.
+// Series values are indexed like Buckets and are null where a currency has no data in that bucket.
+type FRRComparison struct {
+	Interval string                `json:"interval"`
+	Buckets  []int64               `json:"buckets"`
+	Series   map[string][]*float64 `json:"series"`
+}
+
+// parseCurrencyList splits a comma separated currency list, adding the "f" prefix and dropping duplicates
+func parseCurrencyList(raw string) []string {
+	var currencies []string
+	for _, currency := range strings.Split(raw, ",") {
+		currency = strings.TrimSpace(currency)
+		if currency == "" {
+			continue
+		}
+		if !strings.HasPrefix(currency, "f") {
+			currency = "f" + currency
+		}
+		if !containsString(currencies, currency) {
+			currencies = append(currencies, currency)
+		}
+	}
+	return currencies
+}
+
+// handleGetFRRComparison processes requests for time-aligned resampled FRR of several currencies
+func (s *APIServer) handleGetFRRComparison(w http.ResponseWriter, r *http.Request) {
+	currencies := parseCurrencyList(r.URL.Query().Get("currencies"))
+	if len(currencies) == 0 {
+		http.Error(w, "currencies parameter is required", http.StatusBadRequest)
+		return
+	}
+	if len(currencies) > maxCompareCurrencies {
+		http.Error(w, fmt.Sprintf("At most %d currencies can be compared", maxCompareCurrencies), http.StatusBadRequest)
+		return
+	}
+
+	start, end, interval, ok := s.parseResampleParams(w, r)
+	if !ok {
+		return
+	}
 
-	// 使用一個很大的 limit 值
-	trades, err := s.database.GetHistoricalWSFundingTrades(currency, startTime, endTime, 10000)
+	frrByBucket, err := s.resampleFRR(r.Context(), currencies, start, end, interval)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve funding trades: %v", err), http.StatusInternalServerError)
+		http.Error(w, "Failed to retrieve resampled funding statistics: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	bucketSet := make(map[int64]bool)
+	for _, series := range frrByBucket {
+		for bucket := range series {
+			bucketSet[bucket] = true
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(trades)
+	comparison := FRRComparison{
+		Interval: interval.String(),
+		Buckets:  make([]int64, 0, len(bucketSet)),
+		Series:   make(map[string][]*float64, len(currencies)),
+	}
+	for bucket := range bucketSet {
+		comparison.Buckets = append(comparison.Buckets, bucket)
+	}
+	sort.Slice(comparison.Buckets, func(i, j int) bool { return comparison.Buckets[i] < comparison.Buckets[j] })
+
+	for _, currency := range currencies {
+		series := make([]*float64, len(comparison.Buckets))
+		for i, bucket := range comparison.Buckets {
+			if frr, ok := frrByBucket[currency][bucket]; ok {
+				frr := s.frrScaling.frr(frr)
+				series[i] = &frr
+			}
+		}
+		comparison.Series[currency] = series
+	}
+
+	writeResponse(w, r, comparison)
 }
 
-// handleGetRateDistribution processes requests for precomputed rate distribution data
-func (s *APIServer) handleGetRateDistribution(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	currency := vars["currency"]
-	if !strings.HasPrefix(currency, "f") {
-		currency = "f" + currency
+// resampleFRR returns the unscaled FRR of each currency between start and end keyed by bucket start,
+// using the same bucketing as the resampling query
+func (s *APIServer) resampleFRR(ctx context.Context, currencies []string, start, end int64, interval time.Duration) (map[string]map[int64]float64, error) {
+	intervalMs := interval.Milliseconds()
+	frrByBucket := make(map[string]map[int64]float64, len(currencies))
+	for _, currency := range currencies {
+		stats, err := s.database.GetFundingStatsResampledWithContext(ctx, currency, start, end, interval)
+		if err != nil {
+			return nil, err
+		}
+
+		frrByBucket[currency] = make(map[int64]float64, len(stats))
+		for _, stat := range stats {
+			// A bucket whose last row has no FRR stays empty
+			if stat.FRRMissing {
+				continue
+			}
+			frrByBucket[currency][stat.MTS/intervalMs*intervalMs] = stat.FRRRaw
+		}
 	}
+	return frrByBucket, nil
+}
 
-	// 獲取分箱數量參數
-	binCountStr := r.URL.Query().Get("bins")
-	binCount := 20 // 預設值
-	if binCountStr != "" {
-		if parsed, err := strconv.Atoi(binCountStr); err == nil && parsed > 0 {
-			binCount = parsed
+// FRRCorrelation is the correlation matrix of the resampled FRR of several currencies
+type FRRCorrelation struct {
+	*service.CorrelationMatrix
+	Interval string `json:"interval"`
+	Window   string `json:"window"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+}
+
+// handleGetFRRCorrelation processes requests for the pairwise Pearson correlation of the FRR of several
+// currencies, resampled to interval buckets over the window before end
+func (s *APIServer) handleGetFRRCorrelation(w http.ResponseWriter, r *http.Request) {
+	currencies := parseCurrencyList(r.URL.Query().Get("currencies"))
+	if len(currencies) < 2 {
+		http.Error(w, "currencies parameter must list at least 2 currencies", http.StatusBadRequest)
+		return
+	}
+	if len(currencies) > maxCompareCurrencies {
+		http.Error(w, fmt.Sprintf("At most %d currencies can be correlated", maxCompareCurrencies), http.StatusBadRequest)
+		return
+	}
+
+	window := 7 * 24 * time.Hour // Default to the last 7 days
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		parsed, err := parseWindow(windowStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid window parameter, e.g. 7d or 12h", http.StatusBadRequest)
+			return
 		}
+		window = parsed
 	}
 
-	distributionService := service.NewDistributionService(s.database)
+	interval := 1 * time.Hour // Default bucket size
+	if intervalStr := r.URL.Query().Get("interval"); intervalStr != "" {
+		parsed, err := time.ParseDuration(intervalStr)
+		if err != nil || parsed < time.Millisecond {
+			http.Error(w, "Invalid interval parameter", http.StatusBadRequest)
+			return
+		}
+		interval = parsed
+	}
+	if window/interval >= time.Duration(s.maxResponseItems) {
+		http.Error(w, "Too many buckets, use a larger interval or a shorter window", http.StatusBadRequest)
+		return
+	}
+
+	end := time.Now().UnixMilli()
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		parsed, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid end parameter", http.StatusBadRequest)
+			return
+		}
+		end = parsed
+	}
+	start := end - window.Milliseconds()
 
-	distribution, err := distributionService.GetDistribution(currency, binCount)
+	frrByBucket, err := s.resampleFRR(r.Context(), currencies, start, end, interval)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get rate distribution: %v", err), http.StatusInternalServerError)
+		http.Error(w, "Failed to retrieve resampled funding statistics: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "public, max-age=300") // 快取5分鐘
+	writeResponse(w, r, FRRCorrelation{
+		CorrelationMatrix: service.NewCorrelationMatrix(currencies, frrByBucket, service.MinCorrelationSamples),
+		Interval:          interval.String(),
+		Window:            window.String(),
+		Start:             start,
+		End:               end,
+	})
+}
+
+// parseWindow parses a duration that may also be given in whole days, e.g. 7d
+func parseWindow(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", raw)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultTimeRange is the span of a time range query without a start, ending at end
+const defaultTimeRange = 24 * time.Hour
+
+// parseTimeRange returns the start and end query parameters in milliseconds. end defaults to now and start
+// to defaultTimeRange before end; a start after end is an error.
+func parseTimeRange(r *http.Request) (start, end int64, err error) {
+	end = time.Now().UnixMilli()
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil {
+			return 0, 0, errors.New("Invalid end parameter")
+		}
+	}
+
+	start = end - defaultTimeRange.Milliseconds()
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		if start, err = strconv.ParseInt(startStr, 10, 64); err != nil {
+			return 0, 0, errors.New("Invalid start parameter")
+		}
+	}
+	if start > end {
+		return 0, 0, errors.New("start must not be after end")
+	}
+	return start, end, nil
+}
+
+// parseMaxAge reads the optional max_age query parameter used by latest-data endpoints.
+// It writes a 400 response and returns false when the parameter is invalid; 0 means no limit.
+func parseMaxAge(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	maxAgeStr := r.URL.Query().Get("max_age")
+	if maxAgeStr == "" {
+		return 0, true
+	}
+
+	maxAge, err := time.ParseDuration(maxAgeStr)
+	if err != nil || maxAge <= 0 {
+		http.Error(w, "Invalid max_age parameter", http.StatusBadRequest)
+		return 0, false
+	}
+	return maxAge, true
+}
+
+// writeLatestError writes the error of a latest-data read, using 503 when the data is stale
+func writeLatestError(w http.ResponseWriter, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, db.ErrStale) {
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, message+": "+err.Error(), status)
+}
+
+// handleGetFundingTicker processes requests for funding ticker data
+func (s *APIServer) handleGetFundingTicker(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	maxAge, ok := parseMaxAge(w, r)
+	if !ok {
+		return
+	}
+
+	// Get data from database
+	ticker, err := s.database.GetLatestFundingTickerWithMaxAge(r.Context(), currency, maxAge)
+	if err != nil {
+		writeLatestError(w, "Failed to retrieve funding ticker data", err)
+		return
+	}
+
+	// Return JSON response
+	writeResponse(w, r, ticker)
+}
+
+// handleGetFundingTickerDelta processes requests comparing the latest funding ticker with an earlier one
+func (s *APIServer) handleGetFundingTickerDelta(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	// Get query parameters
+	since := 1 * time.Hour // Default comparison window
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		parsedSince, err := time.ParseDuration(sinceStr)
+		if err != nil || parsedSince <= 0 {
+			http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		since = parsedSince
+	}
+
+	// Get data from database
+	delta, err := s.database.GetFundingTickerDeltaWithContext(r.Context(), currency, since)
+	if err != nil {
+		http.Error(w, "Failed to retrieve funding ticker delta: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return JSON response
+	writeResponse(w, r, delta)
+}
+
+// handleGetTickerWithBookHistory processes requests for funding ticker history joined with book spread and levels
+func (s *APIServer) handleGetTickerWithBookHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	startTime, endTime := time.UnixMilli(start), time.UnixMilli(end)
+
+	maxGap := 5 * time.Minute // Snapshots older than this are not joined
+	if maxGapStr := r.URL.Query().Get("max_gap"); maxGapStr != "" {
+		parsedMaxGap, err := time.ParseDuration(maxGapStr)
+		if err != nil || parsedMaxGap < 0 {
+			http.Error(w, "Invalid max_gap parameter", http.StatusBadRequest)
+			return
+		}
+		maxGap = parsedMaxGap
+	}
+
+	limit := 1000
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+	limit, _ = s.clampLimit(limit)
+
+	timeFormat, ok := parseTimeFormat(w, r)
+	if !ok {
+		return
+	}
+
+	tickerBookService := service.NewTickerBookService(s.database)
+	history, err := tickerBookService.GetTickerWithBookHistory(r.Context(), currency, startTime, endTime, limit, maxGap)
+	if err != nil {
+		http.Error(w, "Failed to retrieve ticker with book history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, r, newTickerWithBookResponses(history, timeFormat))
+}
+
+// handleGetFundingTickerHistory processes requests for stored funding tickers between start and end,
+// newest first unless sort=asc
+func (s *APIServer) handleGetFundingTickerHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	startTime, endTime := time.UnixMilli(start), time.UnixMilli(end)
+
+	ascending := false
+	switch r.URL.Query().Get("sort") {
+	case "", "desc":
+	case "asc":
+		ascending = true
+	default:
+		http.Error(w, "Invalid sort parameter, must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	limit := 1000
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+	limit, _ = s.clampLimit(limit)
+
+	tickers, err := s.database.GetHistoricalFundingTickersOrderedWithContext(r.Context(), currency, startTime, endTime, limit, ascending)
+	if err != nil {
+		http.Error(w, "Failed to retrieve funding ticker history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tickers == nil {
+		tickers = []api.FundingTicker{}
+	}
+
+	writeResponse(w, r, tickers)
+}
+
+// handleGetFundingBook processes requests for funding book data
+func (s *APIServer) handleGetFundingBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	maxAge, ok := parseMaxAge(w, r)
+	if !ok {
+		return
+	}
+
+	precision := api.BookPrecision(strings.ToUpper(r.URL.Query().Get("precision")))
+	if precision == "" {
+		precision = api.PrecisionP0
+	}
+
+	// Get data from database
+	books, err := s.database.GetLatestFundingBookByPrecisionWithMaxAge(r.Context(), currency, precision, maxAge)
+	if err != nil {
+		writeLatestError(w, "Failed to retrieve funding book data", err)
+		return
+	}
+
+	// Return JSON response
+	writeResponse(w, r, books)
+}
+
+// handleGetRawFundingBook processes requests for raw funding book data
+func (s *APIServer) handleGetRawFundingBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	maxAge, ok := parseMaxAge(w, r)
+	if !ok {
+		return
+	}
+
+	// Get data from database
+	rawBooks, err := s.database.GetLatestRawFundingBookWithMaxAge(r.Context(), currency, maxAge)
+	if err != nil {
+		writeLatestError(w, "Failed to retrieve raw funding book data", err)
+		return
+	}
+
+	// Return JSON response
+	writeResponse(w, r, rawBooks)
+}
+
+// maxLadderLevels caps the levels per side of the bulk latest book ladders
+const maxLadderLevels = 100
+
+// FundingLadder holds the best levels of each side of a funding book
+type FundingLadder struct {
+	Bids []api.FundingBook `json:"bids"` // Highest rate first
+	Asks []api.FundingBook `json:"asks"` // Lowest rate first
+}
+
+// newFundingLadder keeps the first levels bids and asks of a book ordered bids first, best rate first
+func newFundingLadder(books []api.FundingBook, levels int) FundingLadder {
+	ladder := FundingLadder{Bids: []api.FundingBook{}, Asks: []api.FundingBook{}}
+	for _, book := range books {
+		if book.Amount < 0 && len(ladder.Bids) < levels {
+			ladder.Bids = append(ladder.Bids, book)
+		} else if book.Amount > 0 && len(ladder.Asks) < levels {
+			ladder.Asks = append(ladder.Asks, book)
+		}
+	}
+	return ladder
+}
+
+// FundingBookAt is the side-grouped funding book stored at or latest before a requested timestamp
+type FundingBookAt struct {
+	Currency  string `json:"currency"`
+	Precision string `json:"precision"`
+	Requested int64  `json:"requested"` // The requested MTS
+	Timestamp int64  `json:"timestamp"` // MTS the returned book was stored at
+	Exact     bool   `json:"exact"`     // Whether the book was stored at exactly the requested MTS
+	FundingLadder
+}
+
+// handleGetFundingBookAt processes requests for the funding book stored at a timestamp, or the latest one before it
+func (s *APIServer) handleGetFundingBookAt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	mts, err := strconv.ParseInt(vars["mts"], 10, 64)
+	if err != nil || mts <= 0 {
+		http.Error(w, "Invalid mts, must be a unix timestamp in milliseconds", http.StatusBadRequest)
+		return
+	}
+
+	precision := api.BookPrecision(strings.ToUpper(r.URL.Query().Get("precision")))
+	if precision == "" {
+		precision = api.PrecisionP0
+	}
+
+	snapshot, err := s.database.GetFundingBookAtTimestampWithContext(r.Context(), currency, precision, mts)
+	if errors.Is(err, db.ErrNoFundingBook) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to retrieve funding book data: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, r, FundingBookAt{
+		Currency:      currency,
+		Precision:     string(precision),
+		Requested:     mts,
+		Timestamp:     snapshot.Timestamp,
+		Exact:         snapshot.Timestamp == mts,
+		FundingLadder: newFundingLadder(snapshot.Books, len(snapshot.Books)),
+	})
+}
+
+// handleGetLatestFundingBooks processes requests for the top levels of the latest book of several currencies.
+// A currency without a stored book gets an empty ladder.
+func (s *APIServer) handleGetLatestFundingBooks(w http.ResponseWriter, r *http.Request) {
+	currencies := parseCurrencyList(r.URL.Query().Get("currencies"))
+	if len(currencies) == 0 {
+		http.Error(w, "currencies parameter is required", http.StatusBadRequest)
+		return
+	}
+	if len(currencies) > maxCompareCurrencies {
+		http.Error(w, fmt.Sprintf("At most %d currencies can be requested", maxCompareCurrencies), http.StatusBadRequest)
+		return
+	}
+
+	levels := 5 // Default levels per side
+	if levelsStr := r.URL.Query().Get("levels"); levelsStr != "" {
+		parsedLevels, err := strconv.Atoi(levelsStr)
+		if err != nil || parsedLevels <= 0 || parsedLevels > maxLadderLevels {
+			http.Error(w, fmt.Sprintf("levels must be between 1 and %d", maxLadderLevels), http.StatusBadRequest)
+			return
+		}
+		levels = parsedLevels
+	}
+
+	precision := api.BookPrecision(strings.ToUpper(r.URL.Query().Get("precision")))
+	if precision == "" {
+		precision = api.PrecisionP0
+	}
+
+	// Read the books in parallel, each goroutine writing only its own slot
+	ladders := make([]FundingLadder, len(currencies))
+	errs := make([]error, len(currencies))
+	var wg sync.WaitGroup
+	for i, currency := range currencies {
+		wg.Add(1)
+		go func(i int, currency string) {
+			defer wg.Done()
+			books, err := s.database.GetLatestFundingBookByPrecisionWithContext(r.Context(), currency, precision)
+			if err != nil && !errors.Is(err, db.ErrNoFundingBook) {
+				errs[i] = err
+				return
+			}
+			ladders[i] = newFundingLadder(books, levels)
+		}(i, currency)
+	}
+	wg.Wait()
+
+	result := make(map[string]FundingLadder, len(currencies))
+	for i, currency := range currencies {
+		if errs[i] != nil {
+			http.Error(w, "Failed to retrieve funding book data: "+errs[i].Error(), http.StatusInternalServerError)
+			return
+		}
+		result[currency] = ladders[i]
+	}
+
+	writeResponse(w, r, result)
+}
+
+// MidRate is the mid between the best bid and best ask of the latest funding book
+type MidRate struct {
+	Currency string  `json:"currency"`
+	Mid      float64 `json:"mid"`
+	BestBid  float64 `json:"best_bid"`
+	BestAsk  float64 `json:"best_ask"`
+}
+
+// handleGetMidRate processes requests for the mid rate of the latest raw funding book
+func (s *APIServer) handleGetMidRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	mid, bestBid, bestAsk, err := s.database.GetFundingBookMidRateWithContext(r.Context(), currency)
+	switch {
+	case errors.Is(err, db.ErrNoFundingBook):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, db.ErrOneSidedBook):
+		http.Error(w, "No mid rate: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, "Failed to retrieve funding book data: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, r, MidRate{
+		Currency: currency,
+		Mid:      mid,
+		BestBid:  bestBid,
+		BestAsk:  bestAsk,
+	})
+}
+
+// handleGetFundingTradesComparison processes requests for funding trades comparison data
+func (s *APIServer) handleGetFundingTradesComparison(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	// Get query parameters
+	limitStr := r.URL.Query().Get("limit")
+	limit := 100 // Default limit
+	if limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	timeFormat, ok := parseTimeFormat(w, r)
+	if !ok {
+		return
+	}
+
+	// Get funding stats data
+	stats, err := s.database.GetFundingStatsWithContext(r.Context(), currency, limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve funding statistics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Get historical funding trades data
+	startTime := time.Now().Add(-24 * time.Hour) // Last 24 hours
+	endTime := time.Now()
+	trades, err := s.database.GetHistoricalWSFundingTradesWithContext(r.Context(), currency, startTime, endTime, limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve funding trades: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Combine and format the data
+	response := map[string]interface{}{
+		"stats":  newTimedFundingStats(scaleFRR(stats, s.frrScaling), timeFormat),
+		"trades": newFundingTradeResponses(trades, timeFormat),
+	}
+
+	// Return JSON response
+	writeResponse(w, r, response)
+}
+
+// handleGetFundingTradesDistribution processes requests for funding trades distribution data
+func (s *APIServer) handleGetFundingTradesDistribution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	limit := 10000 // Default to 24 hours
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = parsedLimit
+	}
+	limit, _ = s.clampLimit(limit)
+
+	side, err := db.ParseTradeSide(r.URL.Query().Get("side"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before := r.URL.Query().Get("before")
+	// One extra hour tells whether another page exists
+	distributions, err := s.database.GetFundingTradesDistributionBySideWithContext(r.Context(), currency, side, before, limit+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	distributions = nextPage(w, r, distributions, limit, func(d db.FundingTradeDistribution) string {
+		return d.Hour
+	})
+
+	writeResponse(w, r, distributions)
+}
+
+// handleGetAllWSFundingTrades processes requests for all WebSocket funding trades data
+func (s *APIServer) handleGetAllWSFundingTrades(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	// 以 (timestamp, trade_id) 作為分頁游標，同一毫秒內的交易不會在頁面邊界遺失
+	beforeMTS, beforeID := int64(math.MaxInt64), int64(math.MaxInt64)
+	if before := r.URL.Query().Get("before"); before != "" {
+		var err error
+		if beforeMTS, beforeID, err = parseTradeCursor(before); err != nil {
+			http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	timeFormat, ok := parseTimeFormat(w, r)
+	if !ok {
+		return
+	}
+
+	// 使用回應大小上限作為 limit 值，多取一筆用來判斷是否還有下一頁
+	limit := s.maxResponseItems
+	trades, err := s.database.GetWSFundingTradesBeforeWithContext(r.Context(), currency, beforeMTS, beforeID, limit+1)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve funding trades: %v", err), http.StatusInternalServerError)
+		return
+	}
+	total, err := s.database.CountWSFundingTradesWithContext(r.Context(), currency)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count funding trades: %v", err), http.StatusInternalServerError)
+		return
+	}
+	setTotalCount(w, total)
+
+	trades = nextPage(w, r, trades, limit, func(trade api.FundingTrade) string {
+		return formatTradeCursor(trade.MTS, trade.ID)
+	})
+
+	writeResponse(w, r, newFundingTradeResponses(trades, timeFormat))
+}
+
+// handleGetRateDistribution processes requests for precomputed rate distribution data
+func (s *APIServer) handleGetRateDistribution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	// 獲取分箱數量參數
+	binCountStr := r.URL.Query().Get("bins")
+	binCount := 20 // 預設值
+	if binCountStr != "" {
+		if parsed, err := strconv.Atoi(binCountStr); err == nil && parsed > 0 {
+			binCount = parsed
+		}
+	}
+	binCount, _ = s.clampLimit(binCount)
+
+	distributionService := service.NewDistributionService(s.database)
+
+	distribution, err := distributionService.GetDistributionWithContext(r.Context(), currency, binCount)
+	if err != nil {
+		if r.Context().Err() != nil {
+			// Client went away, initialization was aborted
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get rate distribution: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300") // 快取5分鐘
+
+	writeResponse(w, r, distribution)
+}
+
+// handleGetRateDistributionChart processes requests for a stored rate distribution as chart-ready
+// arrays with axis ticks at round APR values
+func (s *APIServer) handleGetRateDistributionChart(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	binCount := 20 // Same default as /api/rate-distribution
+	if binCountStr := r.URL.Query().Get("bins"); binCountStr != "" {
+		if parsed, err := strconv.Atoi(binCountStr); err == nil && parsed > 0 {
+			binCount = parsed
+		}
+	}
+	binCount, _ = s.clampLimit(binCount)
+
+	ticks := service.DefaultChartTicks
+	if ticksStr := r.URL.Query().Get("ticks"); ticksStr != "" {
+		parsed, err := strconv.Atoi(ticksStr)
+		if err != nil || parsed < 2 || parsed > 50 {
+			http.Error(w, "Invalid ticks parameter, must be between 2 and 50", http.StatusBadRequest)
+			return
+		}
+		ticks = parsed
+	}
+
+	distributionService := service.NewDistributionService(s.database)
+
+	distribution, err := distributionService.GetDistributionWithContext(r.Context(), currency, binCount)
+	if err != nil {
+		if r.Context().Err() != nil {
+			// Client went away, initialization was aborted
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get rate distribution: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeResponse(w, r, service.NewRateDistributionChart(distribution, ticks))
+}
+
+// handleGetRateDistributionVariants processes requests listing the stored bin counts of a currency's rate distribution
+func (s *APIServer) handleGetRateDistributionVariants(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	variants, err := s.database.GetRateDistributionVariantsWithContext(r.Context(), currency)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get rate distribution variants: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, r, variants)
+}
+
+// handleGetRateDistributionHistory processes requests for the saved snapshots of a rate distribution,
+// newest first. Snapshots are only saved when the collector keeps distribution history.
+func (s *APIServer) handleGetRateDistributionHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	binCount := 20 // Same default as /api/rate-distribution
+	if binCountStr := r.URL.Query().Get("bins"); binCountStr != "" {
+		if parsed, err := strconv.Atoi(binCountStr); err == nil && parsed > 0 {
+			binCount = parsed
+		}
+	}
+
+	limit := s.parseLimit(r)
+	before, err := parseBeforeCursor(r)
+	if err != nil {
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+		return
+	}
+
+	// One extra snapshot tells whether another page exists
+	snapshots, err := s.database.GetRateDistributionHistoryWithContext(r.Context(), currency, binCount, before, limit+1)
+	if err != nil {
+		http.Error(w, "Failed to retrieve rate distribution history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	snapshots = nextPage(w, r, snapshots, limit, func(snapshot db.RateDistributionSnapshot) string {
+		return strconv.FormatInt(snapshot.CreatedAt, 10)
+	})
+
+	writeResponse(w, r, snapshots)
+}
+
+// handleGetRateDistributionBin processes requests for the trades that fall in one bin of a stored rate distribution
+func (s *APIServer) handleGetRateDistributionBin(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	binIndex, err := strconv.Atoi(vars["index"])
+	if err != nil || binIndex < 0 {
+		http.Error(w, "Invalid bin index", http.StatusBadRequest)
+		return
+	}
+
+	binCount := 20
+	if binCountStr := r.URL.Query().Get("bins"); binCountStr != "" {
+		if parsed, err := strconv.Atoi(binCountStr); err == nil && parsed > 0 {
+			binCount = parsed
+		}
+	}
+	binCount, _ = s.clampLimit(binCount)
+
+	if binIndex >= binCount {
+		http.Error(w, fmt.Sprintf("Bin index must be below %d", binCount), http.StatusBadRequest)
+		return
+	}
+
+	distributionService := service.NewDistributionService(s.database)
+
+	trades, err := distributionService.GetTradesInBin(currency, binIndex, binCount)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get trades in bin: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, r, trades)
+}
+
+// handleGetTradeHistogram processes requests for a rate histogram of trades within a time window
+func (s *APIServer) handleGetTradeHistogram(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	binCount := 20 // Default bin count
+	if binCountStr := r.URL.Query().Get("bins"); binCountStr != "" {
+		parsed, err := strconv.Atoi(binCountStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid bins parameter", http.StatusBadRequest)
+			return
+		}
+		binCount = parsed
+	}
+	binCount, _ = s.clampLimit(binCount)
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	startTime, endTime := time.UnixMilli(start), time.UnixMilli(end)
+
+	histogramService := service.NewHistogramService(s.database)
+
+	histogram, err := histogramService.GetTradeHistogram(currency, startTime, endTime, binCount)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get trade histogram: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, r, histogram)
+}
+
+// handleGetFRRRegime processes requests for the trend of the FRR over the latest funding stats,
+// classified as rising, falling or stable
+func (s *APIServer) handleGetFRRRegime(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	window := 24 // Default to the latest 24 stats, a day of hourly collection
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		parsed, err := strconv.Atoi(windowStr)
+		if err != nil || parsed < 2 {
+			http.Error(w, "Invalid window parameter, must be an integer of at least 2", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+	window, _ = s.clampLimit(window)
+
+	regimeService := service.NewRegimeService(s.database, s.frrRegime)
+
+	regime, err := regimeService.GetFRRRegime(r.Context(), currency, window)
+	if errors.Is(err, service.ErrNotEnoughStats) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get FRR regime: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, r, regime)
+}
+
+// handleGetTaskHistory processes requests for the recent executions of a scheduled task
+func (s *APIServer) handleGetTaskHistory(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "Task history is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	history, ok := s.scheduler.GetTaskHistory(name)
+	if !ok {
+		http.Error(w, "No executions recorded for task: "+name, http.StatusNotFound)
+		return
+	}
+
+	writeResponse(w, r, history)
+}
+
+// handleGetTaskStatus processes requests for the status of a periodic task, including whether it was
+// disabled after consecutive failures
+func (s *APIServer) handleGetTaskStatus(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "Task status is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	status, ok := s.scheduler.GetTaskStatus(name)
+	if !ok {
+		http.Error(w, "No periodic task registered: "+name, http.StatusNotFound)
+		return
+	}
+
+	writeResponse(w, r, status)
+}
+
+// handleGetMaintenanceStatus processes requests for whether periodic tasks are held back by Bitfinex maintenance
+func (s *APIServer) handleGetMaintenanceStatus(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "Maintenance status is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	writeResponse(w, r, s.scheduler.GetMaintenanceStatus())
+}
+
+// handleGetVersion processes requests for the version, commit and build date of the running binary
+func (s *APIServer) handleGetVersion(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, buildinfo.Get())
+}
+
+// NetFundingFlow is the net funding flow of a currency over a time range, optionally split into buckets
+type NetFundingFlow struct {
+	Currency  string            `json:"currency"`
+	Start     int64             `json:"start"`
+	End       int64             `json:"end"`
+	NetAmount float64           `json:"net_amount"`
+	Buckets   []db.NetFlowPoint `json:"buckets,omitempty"`
+}
+
+// StatsSummary is the FRR and utilization summary of a currency's funding stats between Start and End.
+// FRR values follow the configured FRR scaling; Empty is set and every value is zero when no stats were stored.
+type StatsSummary struct {
+	Currency       string  `json:"currency"`
+	Start          int64   `json:"start"`
+	End            int64   `json:"end"`
+	Empty          bool    `json:"empty"`
+	Count          int64   `json:"count"`
+	LatestMTS      int64   `json:"latest_mts"`
+	LatestFRR      float64 `json:"latest_frr"`
+	MinFRR         float64 `json:"min_frr"`
+	MaxFRR         float64 `json:"max_frr"`
+	AvgFRR         float64 `json:"avg_frr"` // Scaled average of the unscaled FRR
+	AvgUtilization float64 `json:"avg_utilization"`
+}
+
+// handleGetStatsSummary processes requests for the latest, min, max and average FRR and the average
+// utilization of the funding stats between start and end, defaulting to the last day
+func (s *APIServer) handleGetStatsSummary(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	agg, err := s.database.GetFundingStatsBetweenWithAggregatesWithContext(r.Context(), currency, start, end)
+	if err != nil {
+		http.Error(w, "Failed to retrieve funding stats summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summary := StatsSummary{
+		Currency:       currency,
+		Start:          start,
+		End:            end,
+		Empty:          agg.Empty,
+		Count:          agg.Count,
+		LatestMTS:      agg.LatestMTS,
+		AvgUtilization: agg.AvgUtilization,
+	}
+	if !agg.Empty {
+		summary.LatestFRR = s.frrScaling.frr(agg.LatestFRR)
+		summary.MinFRR = s.frrScaling.frr(agg.MinFRR)
+		summary.MaxFRR = s.frrScaling.frr(agg.MaxFRR)
+		summary.AvgFRR = s.frrScaling.frr(agg.AvgFRR)
+	}
+
+	writeResponse(w, r, summary)
+}
+
+// handleGetNetFundingFlow processes requests for the net funding flow (sum of signed trade amounts)
+// between start and end, per granularity bucket when given
+func (s *APIServer) handleGetNetFundingFlow(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flow := NetFundingFlow{Currency: currency, Start: start, End: end}
+
+	if granularityStr := r.URL.Query().Get("granularity"); granularityStr != "" {
+		granularity, err := time.ParseDuration(granularityStr)
+		if err != nil || granularity < time.Millisecond {
+			http.Error(w, "Invalid granularity parameter", http.StatusBadRequest)
+			return
+		}
+		if (end-start)/granularity.Milliseconds() >= int64(s.maxResponseItems) {
+			http.Error(w, "Too many buckets, use a larger granularity or a shorter range", http.StatusBadRequest)
+			return
+		}
+
+		buckets, err := s.database.GetNetFundingFlowSeriesWithContext(r.Context(), currency, start, end, granularity)
+		if err != nil {
+			http.Error(w, "Failed to retrieve net funding flow: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, bucket := range buckets {
+			flow.NetAmount += bucket.NetAmount
+		}
+		flow.Buckets = buckets
+	} else {
+		netAmount, err := s.database.GetNetFundingFlowWithContext(r.Context(), currency, start, end)
+		if err != nil {
+			http.Error(w, "Failed to retrieve net funding flow: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		flow.NetAmount = netAmount
+	}
+
+	writeResponse(w, r, flow)
+}
+
+// handleGetBucketedFundingBook processes requests for the latest raw funding book aggregated into
+// custom rate buckets, e.g. ?bucket=0.0001
+func (s *APIServer) handleGetBucketedFundingBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	bucketStr := r.URL.Query().Get("bucket")
+	if bucketStr == "" {
+		http.Error(w, "Missing bucket parameter", http.StatusBadRequest)
+		return
+	}
+	bucket, err := strconv.ParseFloat(bucketStr, 64)
+	if err != nil || bucket <= 0 || math.IsInf(bucket, 0) {
+		http.Error(w, "Invalid bucket parameter", http.StatusBadRequest)
+		return
+	}
+
+	offers, err := s.database.GetLatestRawFundingBookWithContext(r.Context(), currency)
+	if err != nil {
+		http.Error(w, "Failed to retrieve raw funding book: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	book, err := service.AggregateRawFundingBook(offers, bucket)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	book.Currency = currency
+
+	writeResponse(w, r, book)
+}
+
+// FundingCalendarPoint is the amount offered at one period in one raw book snapshot
+type FundingCalendarPoint struct {
+	MTS    int64   `json:"mts"`
+	Amount float64 `json:"amount"`
+	Offers int     `json:"offers"`
+}
+
+// FundingCalendar holds, per offer period in days, the offered amount of each raw book snapshot
+type FundingCalendar struct {
+	Currency string                         `json:"currency"`
+	Start    int64                          `json:"start"`
+	End      int64                          `json:"end"`
+	Periods  []int                          `json:"periods"`
+	Series   map[int][]FundingCalendarPoint `json:"series"`
+}
+
+// handleGetFundingCalendar processes requests for the amount offered per period over time between start and end
+func (s *APIServer) handleGetFundingCalendar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// One extra point tells whether another page exists
+	limit := s.maxResponseItems
+	points, err := s.database.GetRawFundingBookPeriodAmountsWithContext(r.Context(), currency, start, end, limit+1)
+	if err != nil {
+		http.Error(w, "Failed to retrieve funding calendar: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(points) > limit {
+		// Points are oldest first, so the next page starts at the first snapshot not returned. A page
+		// ends with the last whole snapshot unless a single snapshot fills it.
+		next := points[limit].MTS
+		points = points[:limit]
+		if whole := sort.Search(len(points), func(i int) bool { return points[i].MTS >= next }); whole > 0 {
+			points = points[:whole]
+		} else {
+			next++
+		}
+		setNextLinkParam(w, r, "start", strconv.FormatInt(next, 10))
+	}
+
+	calendar := FundingCalendar{
+		Currency: currency,
+		Start:    start,
+		End:      end,
+		Periods:  []int{},
+		Series:   make(map[int][]FundingCalendarPoint),
+	}
+	for _, p := range points {
+		if _, ok := calendar.Series[p.Period]; !ok {
+			calendar.Periods = append(calendar.Periods, p.Period)
+		}
+		calendar.Series[p.Period] = append(calendar.Series[p.Period], FundingCalendarPoint{
+			MTS:    p.MTS,
+			Amount: p.Amount,
+			Offers: p.Offers,
+		})
+	}
+	sort.Ints(calendar.Periods)
+
+	writeResponse(w, r, calendar)
+}
+
+// handleGetCoverage processes requests for the time coverage of the data stored for a currency
+func (s *APIServer) handleGetCoverage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	coverage, err := s.database.GetDataCoverageWithContext(r.Context(), currency)
+	if err != nil {
+		http.Error(w, "Failed to retrieve data coverage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	json.NewEncoder(w).Encode(distribution)
+	writeResponse(w, r, coverage)
 }
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestLatestReadsWithMaxAgeReportStaleData(t *testing.T) {
+	d, conn := newTestDatabaseConn(t)
+
+	// Collection stopped two hours ago
+	old := time.Now().Add(-2 * time.Hour).UnixMilli()
+	if _, err := conn.Exec(`INSERT INTO funding_ticker (currency, timestamp, frr, bid, bid_period, bid_size, ask, ask_period, ask_size,
+		daily_change, daily_change_percent, last_price, volume, high, low, frr_amount_available) VALUES ('fUSD', ?, 0.0001, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)`, old); err != nil {
+		t.Fatalf("failed to seed ticker: %v", err)
+	}
+	if _, err := d.SaveFundingBookAt("fUSD", api.PrecisionP0, old, api.FundingBook{Rate: 0.0001, Period: 2, Count: 1, Amount: 50}); err != nil {
+		t.Fatalf("SaveFundingBookAt: %v", err)
+	}
+
+	_, err := d.GetLatestFundingTickerWithMaxAge(context.Background(), "fUSD", time.Hour)
+	if !errors.Is(err, db.ErrStale) {
+		t.Errorf("GetLatestFundingTickerWithMaxAge = %v, want ErrStale", err)
+	}
+	if _, err := d.GetLatestFundingTickerWithMaxAge(context.Background(), "fUSD", 3*time.Hour); err != nil {
+		t.Errorf("GetLatestFundingTickerWithMaxAge within the max age: %v", err)
+	}
+
+	s := NewAPIServer(d)
+	for target, want := range map[string]int{
+		"/api/funding-ticker/USD?max_age=1h": http.StatusServiceUnavailable,
+		"/api/funding-ticker/USD?max_age=3h": http.StatusOK,
+		"/api/funding-ticker/USD":            http.StatusOK, // No max age, stale data is returned
+		"/api/funding-book/USD?max_age=1h":   http.StatusServiceUnavailable,
+		"/api/funding-book/USD?max_age=3h":   http.StatusOK,
+		"/api/funding-ticker/USD?max_age=x":  http.StatusBadRequest,
+		"/api/funding-ticker/USD?max_age=0s": http.StatusBadRequest,
+	} {
+		if rec := get(t, s, target); rec.Code != want {
+			t.Errorf("%s status = %d, want %d: %s", target, rec.Code, want, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedIndexServedRegardlessOfWorkingDirectory(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd: %v", err)
+	}
+	// A directory without static/ next to it, like a systemd unit's working directory
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("Chdir: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	s := NewAPIServer(newTestDatabase(t))
+
+	for _, target := range []string{"/", "/static/"} {
+		rec := get(t, s, target)
+		if rec.Code != 200 {
+			t.Fatalf("GET %s status = %d, want 200", target, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "<title>Bitfinex") {
+			t.Errorf("GET %s did not serve the embedded index", target)
+		}
+	}
+}
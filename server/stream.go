@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// streamBuffer is the number of events queued per subscriber before new events are dropped for it
+	streamBuffer = 16
+	// streamKeepAlive is the interval of SSE comments keeping idle streams open through proxies
+	streamKeepAlive = 30 * time.Second
+	// defaultStreamEvictTimeout is how long a subscriber may fall behind before it is disconnected
+	defaultStreamEvictTimeout = time.Minute
+)
+
+// subscriber is a stream client of a statsHub
+type subscriber struct {
+	events    chan api.FundingStats
+	evicted   chan struct{} // Closed when the hub disconnects the subscriber
+	fullSince time.Time     // First event missed since the queue last had room, zero while keeping up
+}
+
+// statsHub fans out newly saved funding stats to the stream subscribers of their currency.
+// A subscriber whose queue stays full for evictTimeout is evicted, so a client that stopped
+// reading does not hold its queue and handler forever; 0 never evicts.
+type statsHub struct {
+	evictTimeout time.Duration
+
+	mu   sync.Mutex
+	subs map[string]map[*subscriber]struct{}
+}
+
+func newStatsHub(evictTimeout time.Duration) *statsHub {
+	return &statsHub{
+		evictTimeout: evictTimeout,
+		subs:         make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+// subscribe registers a subscriber of currency and returns it together with a function removing it
+func (h *statsHub) subscribe(currency string) (*subscriber, func()) {
+	sub := &subscriber{
+		events:  make(chan api.FundingStats, streamBuffer),
+		evicted: make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	if h.subs[currency] == nil {
+		h.subs[currency] = make(map[*subscriber]struct{})
+	}
+	h.subs[currency][sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub, func() {
+		h.mu.Lock()
+		h.remove(currency, sub)
+		h.mu.Unlock()
+	}
+}
+
+// remove unregisters sub; h.mu must be held
+func (h *statsHub) remove(currency string, sub *subscriber) {
+	delete(h.subs[currency], sub)
+	if len(h.subs[currency]) == 0 {
+		delete(h.subs, currency)
+	}
+}
+
+// publish sends stats to every subscriber of currency without blocking; a subscriber whose
+// queue is full misses the event rather than stalling the collector, and is evicted once it
+// has been missing events for evictTimeout
+func (h *statsHub) publish(currency string, stats api.FundingStats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for sub := range h.subs[currency] {
+		select {
+		case sub.events <- stats:
+			sub.fullSince = time.Time{}
+			continue
+		default:
+		}
+
+		if sub.fullSince.IsZero() {
+			sub.fullSince = now
+		}
+		if h.evictTimeout > 0 && now.Sub(sub.fullSince) >= h.evictTimeout {
+			h.remove(currency, sub)
+			close(sub.evicted)
+			log.Printf("Evicted %s funding stats stream subscriber, its queue of %d events has been full for %v",
+				currency, streamBuffer, now.Sub(sub.fullSince).Round(time.Second))
+		}
+	}
+}
+
+// PublishFundingStats notifies stream clients of currency about a newly saved FundingStats row.
+// The FRR is presented from stats.FRRRaw like stats read from the database.
+func (s *APIServer) PublishFundingStats(currency string, stats api.FundingStats) {
+	s.statsHub.publish(currency, stats)
+}
+
+// startSSE disables the server write deadline and sends the Server-Sent Events headers, returning the
+// controller of w or false when w cannot stream
+func startSSE(w http.ResponseWriter) (*http.ResponseController, bool) {
+	// The server write timeout would otherwise end every stream
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	return rc, rc.Flush() == nil
+}
+
+// sseWriter returns a function writing and flushing one formatted chunk of an event stream, each write
+// bounded by timeout unless it is 0
+func sseWriter(w http.ResponseWriter, rc *http.ResponseController, timeout time.Duration) func(format string, args ...interface{}) error {
+	return func(format string, args ...interface{}) error {
+		if timeout > 0 {
+			if err := rc.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+}
+
+// handleStreamFundingStats streams newly saved funding stats of a currency as Server-Sent Events
+func (s *APIServer) handleStreamFundingStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currency := vars["currency"]
+	if !strings.HasPrefix(currency, "f") {
+		currency = "f" + currency
+	}
+
+	decimals, ok := parseDecimals(w, r)
+	if !ok {
+		return
+	}
+	timeFormat, ok := parseTimeFormat(w, r)
+	if !ok {
+		return
+	}
+
+	sub, unsubscribe := s.statsHub.subscribe(currency)
+	defer unsubscribe()
+
+	rc, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	// Each write gets the eviction timeout as deadline, so a client that stopped reading cannot
+	// block the handler forever even while no events are published
+	write := sseWriter(w, rc, s.statsHub.evictTimeout)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.evicted:
+			return
+		case <-keepAlive.C:
+			if err := write(": keep-alive\n\n"); err != nil {
+				return
+			}
+		case stats := <-sub.events:
+			data, err := json.Marshal(newFundingStatsResponses([]api.FundingStats{stats}, decimals, s.frrScaling, timeFormat)[0])
+			if err != nil {
+				return
+			}
+			if err := write("event: funding-stats\nid: %d\ndata: %s\n\n", stats.MTS, data); err != nil {
+				return
+			}
+		}
+	}
+}
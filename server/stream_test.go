@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+// subscribers returns the number of stream subscribers of currency
+func subscribers(s *APIServer, currency string) int {
+	s.statsHub.mu.Lock()
+	defer s.statsHub.mu.Unlock()
+	return len(s.statsHub.subs[currency])
+}
+
+// waitForSubscribers waits until currency has want stream subscribers
+func waitForSubscribers(t *testing.T, s *APIServer, currency string, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for subscribers(s, currency) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s has %d stream subscribers, want %d", currency, subscribers(s, currency), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// readEvent reads the lines of the next SSE event, skipping keep-alive comments
+func readEvent(t *testing.T, reader *bufio.Reader) []string {
+	t.Helper()
+
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(lines) > 0 {
+				return lines
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestStreamFundingStatsSendsPublishedStats(t *testing.T) {
+	s := NewAPIServer(newTestDatabase(t))
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/stream/funding-stats/USD", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	if got := resp.Header.Get("X-Accel-Buffering"); got != "no" {
+		t.Errorf("X-Accel-Buffering = %q, want no", got)
+	}
+	waitForSubscribers(t, s, "fUSD", 1)
+
+	// Stats of another currency are not sent to the fUSD stream
+	s.PublishFundingStats("fUST", api.FundingStats{MTS: 1700000000000, FRRRaw: 0.0000009, FundingAmount: 1})
+	s.PublishFundingStats("fUSD", api.FundingStats{MTS: 1700000060000, FRRRaw: 0.0000004, FundingAmount: 2500})
+
+	lines := readEvent(t, bufio.NewReader(resp.Body))
+	if len(lines) != 3 || lines[0] != "event: funding-stats" || lines[1] != "id: 1700000060000" || !strings.HasPrefix(lines[2], "data: ") {
+		t.Fatalf("event = %q, want a funding-stats event with id 1700000060000", lines)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &data); err != nil {
+		t.Fatalf("failed to decode event data: %v", err)
+	}
+	if data["mts"] != float64(1700000060000) || data["funding_amount"] != float64(2500) || data["frr_raw"] != 0.0000004 {
+		t.Errorf("event data = %v, want the published fUSD stats", data)
+	}
+
+	// Disconnecting removes the subscriber
+	cancel()
+	waitForSubscribers(t, s, "fUSD", 0)
+}
+
+func TestStatsHubEvictsSubscriberThatStopsReading(t *testing.T) {
+	hub := newStatsHub(50 * time.Millisecond)
+	stuck, _ := hub.subscribe("fUSD")
+	active, unsubscribe := hub.subscribe("fUSD")
+	defer unsubscribe()
+
+	// Fill the queue of the subscriber that never reads, while the other keeps up
+	publish := func(mts int64) {
+		t.Helper()
+		hub.publish("fUSD", api.FundingStats{MTS: mts})
+		select {
+		case got := <-active.events:
+			if got.MTS != mts {
+				t.Fatalf("active subscriber got MTS %d, want %d", got.MTS, mts)
+			}
+		default:
+			t.Fatalf("active subscriber did not receive MTS %d", mts)
+		}
+	}
+	for i := 0; i <= streamBuffer; i++ {
+		publish(int64(i))
+	}
+	select {
+	case <-stuck.evicted:
+		t.Fatal("subscriber evicted as soon as its queue filled up")
+	default:
+	}
+
+	// Once its queue has been full for the timeout the next event evicts it
+	time.Sleep(60 * time.Millisecond)
+	publish(100)
+	select {
+	case <-stuck.evicted:
+	default:
+		t.Fatal("subscriber with a full queue was not evicted after the timeout")
+	}
+	hub.mu.Lock()
+	remaining := len(hub.subs["fUSD"])
+	hub.mu.Unlock()
+	if remaining != 1 {
+		t.Errorf("%d subscribers after eviction, want 1", remaining)
+	}
+	if len(stuck.events) != streamBuffer {
+		t.Errorf("evicted subscriber queued %d events, want its buffer of %d", len(stuck.events), streamBuffer)
+	}
+
+	// The other subscriber keeps receiving
+	publish(101)
+}
+
+func TestStatsHubWithoutTimeoutNeverEvicts(t *testing.T) {
+	s := NewAPIServerWithConfig(newTestDatabase(t), Config{StreamEvictTimeout: -1})
+	stuck, unsubscribe := s.statsHub.subscribe("fUSD")
+	defer unsubscribe()
+
+	for i := 0; i <= streamBuffer; i++ {
+		s.PublishFundingStats("fUSD", api.FundingStats{MTS: int64(i)})
+	}
+	time.Sleep(10 * time.Millisecond)
+	s.PublishFundingStats("fUSD", api.FundingStats{MTS: 100})
+
+	select {
+	case <-stuck.evicted:
+		t.Fatal("subscriber evicted with eviction disabled")
+	default:
+	}
+	if got := subscribers(s, "fUSD"); got != 1 {
+		t.Errorf("%d subscribers, want 1", got)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestFundingTickerDelta(t *testing.T) {
+	d, conn := newTestDatabaseConn(t)
+
+	now := time.Now()
+	seed := []struct {
+		ago       time.Duration
+		frr       float64
+		lastPrice float64
+		volume    float64
+	}{
+		{3 * time.Hour, 0.00010, 0.00020, 1000},
+		{2 * time.Hour, 0.00015, 0.00025, 1500}, // Latest ticker at least an hour old
+		{30 * time.Minute, 0.00030, 0.00040, 9000},
+		{0, 0.00020, 0.00030, 4000},
+	}
+	for _, row := range seed {
+		if _, err := conn.Exec(`INSERT INTO funding_ticker (currency, timestamp, frr, bid, bid_period, bid_size, ask, ask_period, ask_size,
+			daily_change, daily_change_percent, last_price, volume, high, low, frr_amount_available) VALUES ('fUSD', ?, ?, 0, 0, 0, 0, 0, 0, 0, 0, ?, ?, 0, 0, 0)`,
+			now.Add(-row.ago).UnixMilli(), row.frr, row.lastPrice, row.volume); err != nil {
+			t.Fatalf("failed to seed ticker: %v", err)
+		}
+	}
+
+	s := NewAPIServer(d)
+
+	var delta db.FundingTickerDelta
+	decodeJSON(t, get(t, s, "/api/funding-ticker-delta/USD?since=1h"), &delta)
+	if delta.Current.FRR != 0.00020 || delta.Previous.FRR != 0.00015 {
+		t.Fatalf("compared FRR %v with %v, want the latest ticker with the one from 2h ago", delta.Current.FRR, delta.Previous.FRR)
+	}
+	for name, got := range map[string][2]float64{
+		"frr":        {delta.FRRDelta, 0.00005},
+		"last_price": {delta.LastPriceDelta, 0.00005},
+		"volume":     {delta.VolumeDelta, 2500},
+	} {
+		if math.Abs(got[0]-got[1]) > 1e-12 {
+			t.Errorf("%s delta = %v, want %v", name, got[0], got[1])
+		}
+	}
+
+	decodeJSON(t, get(t, s, "/api/funding-ticker-delta/USD?since=150m"), &delta)
+	if delta.Previous.FRR != 0.00010 || math.Abs(delta.VolumeDelta-3000) > 1e-9 {
+		t.Errorf("since=150m compared with %+v (volume delta %v), want the ticker from 3h ago", delta.Previous, delta.VolumeDelta)
+	}
+
+	if rec := get(t, s, "/api/funding-ticker-delta/USD?since=-1h"); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative since status = %d, want 400", rec.Code)
+	}
+	if rec := get(t, s, "/api/funding-ticker-delta/USD?since=24h"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("since without an older ticker status = %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestFundingTickerHistoryOrdering(t *testing.T) {
+	d, conn := newTestDatabaseConn(t)
+	// Seeded out of order; frr_amount_available identifies each row
+	for _, ts := range []int64{3000, 1000, 4000, 2000} {
+		if _, err := conn.Exec(`INSERT INTO funding_ticker (currency, timestamp, frr, bid, bid_period, bid_size, ask, ask_period, ask_size,
+			daily_change, daily_change_percent, last_price, volume, high, low, frr_amount_available) VALUES ('fUSD', ?, 0.0001, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, ?)`, ts, ts); err != nil {
+			t.Fatalf("failed to seed ticker: %v", err)
+		}
+	}
+
+	s := NewAPIServer(d)
+	tests := []struct {
+		query string
+		want  []float64
+	}{
+		{"", []float64{4000, 3000, 2000, 1000}},
+		{"&sort=desc", []float64{4000, 3000, 2000, 1000}},
+		{"&sort=asc", []float64{1000, 2000, 3000, 4000}},
+		{"&sort=asc&limit=2", []float64{1000, 2000}}, // Starts at start
+		{"&limit=2", []float64{4000, 3000}},
+	}
+	for _, tt := range tests {
+		var tickers []api.FundingTicker
+		decodeJSON(t, get(t, s, "/api/funding-ticker/USD/history?start=0&end=5000"+tt.query), &tickers)
+
+		got := make([]float64, len(tickers))
+		for i, ticker := range tickers {
+			got[i] = ticker.FRRAmountAvailable
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("query %q returned rows %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if rec := get(t, s, "/api/funding-ticker/USD/history?sort=up"); rec.Code != http.StatusBadRequest {
+		t.Errorf("sort=up status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSlowResponseCutOffAtWriteTimeout(t *testing.T) {
+	s := NewAPIServerWithConfig(newTestDatabase(t), Config{WriteTimeout: 100 * time.Millisecond})
+
+	// A handler taking longer than the write timeout to respond
+	s.router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("too late"))
+	})
+	s.router.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := s.httpServer(ln.Addr().String())
+	if srv.WriteTimeout != 100*time.Millisecond || srv.ReadTimeout != defaultReadTimeout || srv.IdleTimeout != defaultIdleTimeout {
+		t.Errorf("timeouts = read %s write %s idle %s, want the configured write timeout and default others",
+			srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	base := "http://" + ln.Addr().String()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(base + "/fast")
+	if err != nil {
+		t.Fatalf("fast request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("fast response = %d %q, want 200 \"ok\"", resp.StatusCode, body)
+	}
+
+	// The server drops the connection instead of delivering the late response
+	start := time.Now()
+	resp, err = client.Get(base + "/slow")
+	if err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		t.Fatalf("slow request got %d %q, want the connection cut off", resp.StatusCode, body)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("slow request failed after %s, want it cut off shortly after the handler returned", elapsed)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	start, end, err := parseTimeRange(httptest.NewRequest(http.MethodGet, "/?start=1000&end=5000", nil))
+	if err != nil || start != 1000 || end != 5000 {
+		t.Errorf("explicit range = %d, %d, %v, want 1000, 5000", start, end, err)
+	}
+
+	start, end, err = parseTimeRange(httptest.NewRequest(http.MethodGet, "/?end=100000000", nil))
+	if err != nil || end != 100000000 || start != end-defaultTimeRange.Milliseconds() {
+		t.Errorf("range without start = %d, %d, %v, want the day before end", start, end, err)
+	}
+
+	before := time.Now().UnixMilli()
+	_, end, err = parseTimeRange(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil || end < before || end > time.Now().UnixMilli() {
+		t.Errorf("range without end = %d, %v, want now", end, err)
+	}
+
+	for _, query := range []string{"start=x", "end=x", "start=5000&end=1000"} {
+		if _, _, err := parseTimeRange(httptest.NewRequest(http.MethodGet, "/?"+query, nil)); err == nil {
+			t.Errorf("parseTimeRange(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestTimeRangeEndpointsRejectStartAfterEnd(t *testing.T) {
+	s := NewAPIServer(newTestDatabase(t))
+
+	for _, path := range []string{
+		"/api/stats-summary/USD",
+		"/api/net-flow/USD",
+		"/api/funding-calendar/USD",
+		"/api/ticker-with-book/USD/history",
+		"/api/funding-ticker/USD/history",
+		"/api/trade-histogram/USD",
+	} {
+		if rec := get(t, s, path+"?start=5000&end=1000"); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s status = %d, want 400", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+func TestFundingTradesDistributionBySide(t *testing.T) {
+	d := newTestDatabase(t)
+	// All within one minute, so within one hour in every time zone
+	for _, trade := range []api.FundingTrade{
+		{ID: 1, MTS: 1700000000000, Amount: 100, Rate: 0.0001, Period: 2},
+		{ID: 2, MTS: 1700000001000, Amount: -200, Rate: 0.0002, Period: 2},
+		{ID: 3, MTS: 1700000002000, Amount: 300, Rate: 0.0003, Period: 30},
+		{ID: 4, MTS: 1700000003000, Amount: -600, Rate: 0.0006, Period: 2},
+	} {
+		if _, err := d.SaveWSFundingTrade("fUSD", trade, "ftu"); err != nil {
+			t.Fatalf("SaveWSFundingTrade: %v", err)
+		}
+	}
+
+	s := NewAPIServer(d)
+	tests := []struct {
+		side  string
+		count int
+		total float64
+		min   float64 // Percent
+		max   float64
+		avg   float64
+	}{
+		{"", 4, -400, 0.01, 0.06, 0.03},
+		{"all", 4, -400, 0.01, 0.06, 0.03},
+		{"lend", 2, 400, 0.01, 0.03, 0.02},
+		{"take", 2, -800, 0.02, 0.06, 0.04},
+	}
+	for _, tt := range tests {
+		var distributions []db.FundingTradeDistribution
+		decodeJSON(t, get(t, s, "/api/funding-trades-distribution/USD?side="+tt.side), &distributions)
+		if len(distributions) != 1 {
+			t.Fatalf("side %q: got %d hours %+v, want 1", tt.side, len(distributions), distributions)
+		}
+		got := distributions[0]
+		if got.TradeCount != tt.count || got.TotalAmount != tt.total {
+			t.Errorf("side %q: %d trades totalling %v, want %d totalling %v", tt.side, got.TradeCount, got.TotalAmount, tt.count, tt.total)
+		}
+		for name, pair := range map[string][2]float64{"min": {got.MinRate, tt.min}, "max": {got.MaxRate, tt.max}, "avg": {got.AvgRate, tt.avg}} {
+			if math.Abs(pair[0]-pair[1]) > 1e-12 {
+				t.Errorf("side %q: %s rate = %v, want %v", tt.side, name, pair[0], pair[1])
+			}
+		}
+	}
+
+	if rec := get(t, s, "/api/funding-trades-distribution/USD?side=borrow"); rec.Code != http.StatusBadRequest {
+		t.Errorf("side=borrow status = %d, want 400", rec.Code)
+	}
+}
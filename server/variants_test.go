@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/service"
+)
+
+func TestRateDistributionVariantsListsEachBinCount(t *testing.T) {
+	d := newTestDatabase(t)
+	var records []db.WSFundingTradeRecord
+	for i := 0; i < 30; i++ {
+		trade := api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: 0.0001 + float64(i)*0.000002, Period: 2}
+		records = append(records, db.WSFundingTradeRecord{Currency: "fUSD", Trade: trade, MsgType: "ftu"})
+	}
+	records = append(records, db.WSFundingTradeRecord{Currency: "fUST", Trade: api.FundingTrade{ID: 99, MTS: 1000, Amount: 10, Rate: 0.0002, Period: 2}, MsgType: "ftu"})
+	if _, err := d.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+
+	ds := service.NewDistributionService(d)
+	for _, seed := range []struct {
+		currency string
+		bins     int
+	}{{"fUSD", 20}, {"fUSD", 10}, {"fUST", 5}} {
+		if err := ds.InitializeDistribution(seed.currency, seed.bins); err != nil {
+			t.Fatalf("InitializeDistribution(%s, %d): %v", seed.currency, seed.bins, err)
+		}
+	}
+
+	var variants []db.RateDistributionVariant
+	decodeJSON(t, get(t, NewAPIServer(d), "/api/rate-distribution/USD/variants"), &variants)
+
+	if len(variants) != 2 {
+		t.Fatalf("got %d variants %+v, want the 2 fUSD bin counts", len(variants), variants)
+	}
+	for i, bins := range []int{10, 20} {
+		v := variants[i]
+		if v.BinCount != bins || v.TotalTrades != 30 || v.UpdatedAt == 0 {
+			t.Errorf("variant %d = %+v, want %d bins over 30 trades with an update time", i, v, bins)
+		}
+	}
+
+	// A currency without stored distributions lists none
+	var none []db.RateDistributionVariant
+	decodeJSON(t, get(t, NewAPIServer(d), "/api/rate-distribution/BTC/variants"), &none)
+	if len(none) != 0 {
+		t.Errorf("fBTC variants = %+v, want none", none)
+	}
+}
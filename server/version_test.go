@@ -0,0 +1,31 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/buildinfo"
+)
+
+func TestVersionEndpointReturnsBuildInfo(t *testing.T) {
+	s := NewAPIServer(newTestDatabase(t))
+
+	// Without ldflags the defaults are reported
+	var info buildinfo.Info
+	decodeJSON(t, get(t, s, "/api/version"), &info)
+	if info != (buildinfo.Info{Version: "dev", Commit: "unknown", BuildDate: "unknown"}) {
+		t.Errorf("default build info = %+v, want dev version with unknown commit and build date", info)
+	}
+
+	// Values injected with -ldflags -X end up in the package variables
+	prevVersion, prevCommit, prevBuildDate := buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate
+	defer func() {
+		buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate = prevVersion, prevCommit, prevBuildDate
+	}()
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate = "v1.2.0", "abc1234", "2024-05-01T12:00:00Z"
+
+	want := buildinfo.Info{Version: "v1.2.0", Commit: "abc1234", BuildDate: "2024-05-01T12:00:00Z"}
+	decodeJSON(t, get(t, s, "/api/version"), &info)
+	if info != want {
+		t.Errorf("injected build info = %+v, want %+v", info, want)
+	}
+}
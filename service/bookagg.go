@@ -0,0 +1,78 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+// bucketEpsilon absorbs floating point error when a rate lies exactly on a bucket edge
+const bucketEpsilon = 1e-9
+
+// RateBucket is the sum of the offers of one book side whose rate falls in [Rate, Rate+bucket width)
+type RateBucket struct {
+	Rate   float64 `json:"rate"`   // Lower edge of the bucket
+	Amount float64 `json:"amount"` // > 0 for asks, < 0 for bids
+	Count  int     `json:"count"`  // Number of offers
+}
+
+// BucketedFundingBook is a raw funding book aggregated into custom rate buckets
+type BucketedFundingBook struct {
+	Currency string       `json:"currency"`
+	Bucket   float64      `json:"bucket"`
+	Bids     []RateBucket `json:"bids"` // Highest rate first
+	Asks     []RateBucket `json:"asks"` // Lowest rate first
+}
+
+// AggregateRawFundingBook groups raw offers into rate buckets of the given width per side,
+// summing amounts and counting offers
+func AggregateRawFundingBook(offers []api.RawFundingBook, bucket float64) (*BucketedFundingBook, error) {
+	if bucket <= 0 || math.IsNaN(bucket) || math.IsInf(bucket, 0) {
+		return nil, fmt.Errorf("invalid bucket width: %v", bucket)
+	}
+
+	bids := make(map[int64]*RateBucket)
+	asks := make(map[int64]*RateBucket)
+	for _, offer := range offers {
+		index := int64(math.Floor(offer.Rate/bucket + bucketEpsilon))
+
+		// In RawFundingBook, amount > 0 indicates asks, < 0 indicates bids
+		side := asks
+		if offer.Amount < 0 {
+			side = bids
+		}
+		b, ok := side[index]
+		if !ok {
+			// Rounded to the stored rate precision so edges print as e.g. 0.0003 rather than 0.00030000000000000003
+			b = &RateBucket{Rate: db.UnscaleRate(db.ScaleRate(float64(index) * bucket))}
+			side[index] = b
+		}
+		b.Amount += offer.Amount
+		b.Count++
+	}
+
+	book := &BucketedFundingBook{
+		Bucket: bucket,
+		Bids:   sortedBuckets(bids, true),
+		Asks:   sortedBuckets(asks, false),
+	}
+	return book, nil
+}
+
+// sortedBuckets returns the buckets ordered by rate, descending for bids
+func sortedBuckets(buckets map[int64]*RateBucket, descending bool) []RateBucket {
+	sorted := make([]RateBucket, 0, len(buckets))
+	for _, b := range buckets {
+		sorted = append(sorted, *b)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if descending {
+			return sorted[i].Rate > sorted[j].Rate
+		}
+		return sorted[i].Rate < sorted[j].Rate
+	})
+	return sorted
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestAggregateRawFundingBookGroupsByBucketWidth(t *testing.T) {
+	offers := []api.RawFundingBook{
+		{OfferID: 1, Period: 2, Rate: 0.00012, Amount: -100},
+		{OfferID: 2, Period: 2, Rate: 0.00019, Amount: -50},
+		{OfferID: 3, Period: 7, Rate: 0.00021, Amount: -25},
+		{OfferID: 4, Period: 30, Rate: 0.0003, Amount: 200}, // Exactly on an edge
+		{OfferID: 5, Period: 2, Rate: 0.00035, Amount: 300},
+		{OfferID: 6, Period: 2, Rate: 0.00051, Amount: 400},
+	}
+
+	book, err := AggregateRawFundingBook(offers, 0.0001)
+	if err != nil {
+		t.Fatalf("AggregateRawFundingBook: %v", err)
+	}
+	if book.Bucket != 0.0001 {
+		t.Errorf("bucket = %v, want 0.0001", book.Bucket)
+	}
+
+	wantBids := []RateBucket{
+		{Rate: 0.0002, Amount: -25, Count: 1},
+		{Rate: 0.0001, Amount: -150, Count: 2},
+	}
+	wantAsks := []RateBucket{
+		{Rate: 0.0003, Amount: 500, Count: 2},
+		{Rate: 0.0005, Amount: 400, Count: 1},
+	}
+	if len(book.Bids) != len(wantBids) || len(book.Asks) != len(wantAsks) {
+		t.Fatalf("bids %+v asks %+v, want %d and %d buckets", book.Bids, book.Asks, len(wantBids), len(wantAsks))
+	}
+	for i, want := range wantBids {
+		if book.Bids[i] != want {
+			t.Errorf("bid bucket %d = %+v, want %+v", i, book.Bids[i], want)
+		}
+	}
+	for i, want := range wantAsks {
+		if book.Asks[i] != want {
+			t.Errorf("ask bucket %d = %+v, want %+v", i, book.Asks[i], want)
+		}
+	}
+
+	// A wider bucket merges the asks
+	book, err = AggregateRawFundingBook(offers, 0.001)
+	if err != nil {
+		t.Fatalf("AggregateRawFundingBook: %v", err)
+	}
+	if len(book.Asks) != 1 || book.Asks[0] != (RateBucket{Rate: 0, Amount: 900, Count: 3}) {
+		t.Errorf("asks with a 0.001 bucket = %+v, want one bucket of 900 from 3 offers", book.Asks)
+	}
+
+	if _, err := AggregateRawFundingBook(offers, 0); err == nil {
+		t.Error("zero bucket width accepted, want an error")
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/scheduler"
+)
+
+// TestConcurrentWriters interleaves ShouldRun and Execute of one periodic task that writes funding stats
+// with streamed trade writers on the same database; run it with -race
+func TestConcurrentWriters(t *testing.T) {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer conn.Close()
+	database := db.NewDatabase(conn)
+
+	var inFlight, maxInFlight, nextMTS int64
+	task := scheduler.NewScheduler(1, 1).NewPeriodicTask("stats", 0, func(ctx context.Context) error {
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		stats := api.FundingStats{MTS: 1700000000000 + atomic.AddInt64(&nextMTS, 1), FRRRaw: 0.0000005}
+		_, err := database.SaveFundingStats("fUSD", stats)
+		time.Sleep(time.Millisecond)
+		return err
+	}, 0)
+
+	var executed, trades int64
+	errs := make(chan error, 64)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if !task.ShouldRun() {
+					continue
+				}
+				switch err := task.Execute(context.Background()); {
+				case err == nil:
+					atomic.AddInt64(&executed, 1)
+				case !errors.Is(err, scheduler.ErrTaskRunning):
+					errs <- err
+				}
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				trade := api.FundingTrade{ID: int64(writer*1000 + j), MTS: 1700000000000 + int64(j), Amount: 100, Rate: 0.0001, Period: 2}
+				if _, err := database.SaveWSFundingTrade("fUSD", trade, "ftu"); err != nil {
+					errs <- err
+					return
+				}
+				atomic.AddInt64(&trades, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent write failed: %v", err)
+	}
+	if maxInFlight != 1 {
+		t.Errorf("up to %d executions of one task ran at once, want 1", maxInFlight)
+	}
+	if executed == 0 {
+		t.Fatal("the task never executed")
+	}
+
+	stats, err := database.GetFundingStats("fUSD", 1000)
+	if err != nil {
+		t.Fatalf("GetFundingStats: %v", err)
+	}
+	if int64(len(stats)) != executed {
+		t.Errorf("%d funding stats rows, want one per execution (%d)", len(stats), executed)
+	}
+	total, err := database.CountWSFundingTradesWithContext(context.Background(), "fUSD")
+	if err != nil {
+		t.Fatalf("CountWSFundingTrades: %v", err)
+	}
+	if total != trades || trades != 100 {
+		t.Errorf("%d trades stored of %d saved, want all 100", total, trades)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import "math"
+
+// MinCorrelationSamples is the minimum number of shared buckets a pair of series needs for a correlation
+const MinCorrelationSamples = 3
+
+// CorrelationMatrix holds the pairwise Pearson correlation of several series resampled to shared buckets.
+// Matrix and Samples are indexed like Currencies.
+type CorrelationMatrix struct {
+	Currencies []string     `json:"currencies"`
+	Matrix     [][]*float64 `json:"matrix"`  // null where a pair shares too few buckets or a series is constant
+	Samples    [][]int      `json:"samples"` // Number of buckets where both series have a value
+	Points     []int        `json:"points"`  // Number of buckets with a value per series
+}
+
+// NewCorrelationMatrix correlates each pair of series, keyed by bucket start, over the buckets both have a
+// value in. Missing series are treated as empty; pairs with fewer than minSamples shared buckets get no value.
+func NewCorrelationMatrix(currencies []string, series map[string]map[int64]float64, minSamples int) *CorrelationMatrix {
+	if minSamples < 2 {
+		minSamples = 2
+	}
+
+	n := len(currencies)
+	matrix := &CorrelationMatrix{
+		Currencies: currencies,
+		Matrix:     make([][]*float64, n),
+		Samples:    make([][]int, n),
+		Points:     make([]int, n),
+	}
+	for i := range currencies {
+		matrix.Matrix[i] = make([]*float64, n)
+		matrix.Samples[i] = make([]int, n)
+		matrix.Points[i] = len(series[currencies[i]])
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			xs, ys := alignSeries(series[currencies[i]], series[currencies[j]])
+			matrix.Samples[i][j] = len(xs)
+			matrix.Samples[j][i] = len(xs)
+			if len(xs) < minSamples {
+				continue
+			}
+
+			r, ok := pearson(xs, ys)
+			if !ok {
+				continue
+			}
+			matrix.Matrix[i][j] = &r
+			matrix.Matrix[j][i] = &r
+		}
+	}
+
+	return matrix
+}
+
+// alignSeries returns the values of a and b at the buckets both have a value in
+func alignSeries(a, b map[int64]float64) (xs, ys []float64) {
+	for bucket, x := range a {
+		if y, ok := b[bucket]; ok {
+			xs = append(xs, x)
+			ys = append(ys, y)
+		}
+	}
+	return xs, ys
+}
+
+// pearson returns the Pearson correlation coefficient of xs and ys, which is undefined when either is constant
+func pearson(xs, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	// Rounding in the means leaves sxx or syy slightly above zero for equal values, so compare them directly
+	constantX, constantY := true, true
+	var sxx, sxy, syy float64
+	for i := range xs {
+		constantX = constantX && xs[i] == xs[0]
+		constantY = constantY && ys[i] == ys[0]
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if constantX || constantY || sxx == 0 || syy == 0 {
+		return 0, false
+	}
+
+	// Rounding can push a perfect correlation slightly beyond ±1
+	return math.Max(-1, math.Min(1, sxy/math.Sqrt(sxx*syy))), true
+}
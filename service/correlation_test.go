@@ -0,0 +1,75 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+// bucketSeries keys values by hourly bucket starts
+func bucketSeries(values ...float64) map[int64]float64 {
+	series := make(map[int64]float64, len(values))
+	for i, v := range values {
+		series[int64(i)*3600000] = v
+	}
+	return series
+}
+
+func TestCorrelationMatrixOfSyntheticSeries(t *testing.T) {
+	base := []float64{1, 2, 3, 4, 5, 6}
+	scaled := make([]float64, len(base))
+	inverted := make([]float64, len(base))
+	for i, v := range base {
+		scaled[i] = 2*v + 1
+		inverted[i] = -v
+	}
+	series := map[string]map[int64]float64{
+		"fUSD": bucketSeries(base...),
+		"fUST": bucketSeries(scaled...),
+		"fEUR": bucketSeries(inverted...),
+		"fGBP": bucketSeries(1, 0, -1, -1, 0, 1), // Uncorrelated with base
+		"fJPY": bucketSeries(0.1, 0.1, 0.1, 0.1, 0.1, 0.1),
+		"fBTC": bucketSeries(1, 2), // Too short
+	}
+	// A series shifted by half a bucket shares no bucket with the others
+	series["fETH"] = map[int64]float64{1800000: 1, 5400000: 2, 9000000: 3}
+	currencies := []string{"fUSD", "fUST", "fEUR", "fGBP", "fJPY", "fBTC", "fETH", "fXRP"}
+
+	matrix := NewCorrelationMatrix(currencies, series, MinCorrelationSamples)
+
+	want := func(i, j int, expected float64) {
+		t.Helper()
+		got := matrix.Matrix[i][j]
+		if got == nil {
+			t.Errorf("%s/%s correlation = null, want %v", currencies[i], currencies[j], expected)
+			return
+		}
+		if math.Abs(*got-expected) > 1e-9 {
+			t.Errorf("%s/%s correlation = %v, want %v", currencies[i], currencies[j], *got, expected)
+		}
+		if other := matrix.Matrix[j][i]; other == nil || *other != *got {
+			t.Errorf("matrix is not symmetric at %s/%s", currencies[i], currencies[j])
+		}
+	}
+	want(0, 0, 1)
+	want(0, 1, 1)
+	want(0, 2, -1)
+	want(1, 2, -1)
+	want(0, 3, 0)
+	if matrix.Samples[0][1] != 6 || matrix.Points[0] != 6 {
+		t.Errorf("fUSD/fUST samples %d and fUSD points %d, want 6", matrix.Samples[0][1], matrix.Points[0])
+	}
+
+	// Constant, short, unaligned and missing series have no correlation
+	for _, j := range []int{4, 5, 6, 7} {
+		if got := matrix.Matrix[0][j]; got != nil {
+			t.Errorf("fUSD/%s correlation = %v, want null", currencies[j], *got)
+		}
+	}
+	if got := matrix.Matrix[4][4]; got != nil {
+		t.Errorf("fJPY/fJPY correlation = %v, want null for a constant series", *got)
+	}
+	if matrix.Samples[0][5] != 2 || matrix.Samples[0][6] != 0 || matrix.Samples[0][7] != 0 || matrix.Points[7] != 0 {
+		t.Errorf("samples %v and points %v, want 2 shared with fBTC and none with fETH or the missing fXRP",
+			matrix.Samples[0], matrix.Points)
+	}
+}
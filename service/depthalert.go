@@ -0,0 +1,96 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+// DepthDropDetector flags sudden drops in funding book lend depth, which can precede a rate spike.
+// Each observation is compared to the average of the trailing window of previous observations;
+// an alert fires once when the drop exceeds DropPercent and re-arms after depth recovers.
+type DepthDropDetector struct {
+	Window      int     // Number of previous observations averaged
+	DropPercent float64 // Drop below the trailing average, in percent, that fires an alert
+
+	mu       sync.Mutex
+	history  map[string][]float64
+	alerting map[string]bool
+}
+
+// DepthDrop describes a detected drop in lend depth
+type DepthDrop struct {
+	Currency      string  `json:"currency"`
+	Depth         float64 `json:"depth"`
+	TrailingAvg   float64 `json:"trailing_avg"`
+	DropPercent   float64 `json:"drop_percent"`
+	ThresholdDrop float64 `json:"threshold_drop"`
+}
+
+// NewDepthDropDetector creates a detector averaging window observations that alerts on drops of dropPercent or more
+func NewDepthDropDetector(window int, dropPercent float64) *DepthDropDetector {
+	return &DepthDropDetector{
+		Window:      window,
+		DropPercent: dropPercent,
+		history:     make(map[string][]float64),
+		alerting:    make(map[string]bool),
+	}
+}
+
+// LendDepth returns the total amount offered for lending (asks) in an aggregated funding book
+func LendDepth(books []api.FundingBook) float64 {
+	depth := 0.0
+	for _, book := range books {
+		if book.Amount > 0 {
+			depth += book.Amount
+		}
+	}
+	return depth
+}
+
+// Observe records the latest lend depth of currency and returns the drop when it newly crosses the threshold.
+// No alert is reported until the trailing window is full.
+func (d *DepthDropDetector) Observe(currency string, depth float64) (DepthDrop, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	history := d.history[currency]
+	defer func() {
+		history = append(history, depth)
+		if len(history) > d.Window {
+			history = history[len(history)-d.Window:]
+		}
+		d.history[currency] = history
+	}()
+
+	if d.Window <= 0 || d.DropPercent <= 0 || len(history) < d.Window {
+		return DepthDrop{}, false
+	}
+
+	sum := 0.0
+	for _, v := range history {
+		sum += v
+	}
+	avg := sum / float64(len(history))
+	if avg <= 0 {
+		return DepthDrop{}, false
+	}
+
+	dropPercent := (avg - depth) / avg * 100
+	if dropPercent < d.DropPercent {
+		d.alerting[currency] = false
+		return DepthDrop{}, false
+	}
+	if d.alerting[currency] {
+		return DepthDrop{}, false
+	}
+
+	d.alerting[currency] = true
+	return DepthDrop{
+		Currency:      currency,
+		Depth:         depth,
+		TrailingAvg:   avg,
+		DropPercent:   dropPercent,
+		ThresholdDrop: d.DropPercent,
+	}, true
+}
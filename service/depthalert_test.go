@@ -0,0 +1,58 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestDepthDropDetectorAlertsOncePerDrop(t *testing.T) {
+	d := NewDepthDropDetector(3, 20)
+
+	steps := []struct {
+		depth float64
+		alert bool
+	}{
+		{100, false}, // Window not yet full
+		{100, false},
+		{100, false},
+		{70, true},  // 30% below the trailing average of 100
+		{60, false}, // Still dropped, already alerted
+		{100, false},
+		{100, false}, // Recovered, re-armed
+		{50, true},
+	}
+	for i, step := range steps {
+		drop, ok := d.Observe("fUSD", step.depth)
+		if ok != step.alert {
+			t.Fatalf("step %d: depth %v alert = %v, want %v", i, step.depth, ok, step.alert)
+		}
+		if i == 3 {
+			want := DepthDrop{Currency: "fUSD", Depth: 70, TrailingAvg: 100, DropPercent: 30, ThresholdDrop: 20}
+			if drop != want {
+				t.Errorf("drop = %+v, want %+v", drop, want)
+			}
+		}
+	}
+
+	// Currencies are tracked separately
+	for _, depth := range []float64{100, 100, 100} {
+		if _, ok := d.Observe("fUST", depth); ok {
+			t.Fatal("alert while filling the window of another currency")
+		}
+	}
+	if _, ok := d.Observe("fUST", 85); ok {
+		t.Error("alert for a 15% drop, want none below the 20% threshold")
+	}
+}
+
+func TestLendDepthSumsAsks(t *testing.T) {
+	books := []api.FundingBook{
+		{Rate: 0.0001, Amount: -500}, // Bid
+		{Rate: 0.0002, Amount: 300},
+		{Rate: 0.0003, Amount: 200},
+	}
+	if got := LendDepth(books); got != 500 {
+		t.Errorf("LendDepth = %v, want 500", got)
+	}
+}
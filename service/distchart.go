@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/rates"
+)
+
+// DefaultChartTicks 是圖表每個軸預設的刻度數量目標
+const DefaultChartTicks = 6
+
+// RateDistributionChart 是可直接繪圖的利率分布：箱子中心、次數、PDF 以及取整的座標軸刻度
+type RateDistributionChart struct {
+	Currency    string    `json:"currency"`
+	Unit        string    `json:"unit"`
+	Scale       string    `json:"scale"`
+	BinWidth    float64   `json:"bin_width"`
+	BinCenters  []float64 `json:"bin_centers"` // 每個箱子的中心，單位為 Unit
+	Counts      []int     `json:"counts"`
+	PDF         []float64 `json:"pdf"` // 每個箱子佔全部交易的比例，總和為 1（無交易時全為 0）
+	XMin        float64   `json:"x_min"`
+	XMax        float64   `json:"x_max"`
+	XTicks      []float64 `json:"x_ticks"` // 落在 [XMin, XMax] 的整齊 APR 值
+	XTickLabels []string  `json:"x_tick_labels"`
+	YMax        float64   `json:"y_max"`
+	YTicks      []float64 `json:"y_ticks"` // PDF 軸的刻度，從 0 到 YMax
+	YTickLabels []string  `json:"y_tick_labels"`
+	TotalTrades int       `json:"total_trades"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+// NewRateDistributionChart 由已儲存的分布計算圖表資料，每個軸約有 ticks 個刻度
+func NewRateDistributionChart(dist *RateDistribution, ticks int) *RateDistributionChart {
+	if ticks < 2 {
+		ticks = DefaultChartTicks
+	}
+
+	chart := &RateDistributionChart{
+		Currency:    dist.Currency,
+		Unit:        dist.Unit,
+		Scale:       dist.Scale,
+		BinWidth:    dist.BinWidth,
+		BinCenters:  make([]float64, len(dist.Distribution)),
+		Counts:      dist.Distribution,
+		PDF:         dist.PDF,
+		TotalTrades: dist.TotalTrades,
+		LastUpdated: dist.LastUpdated,
+	}
+	for i := range chart.BinCenters {
+		chart.BinCenters[i] = dist.MinRate + (float64(i)+0.5)*dist.BinWidth
+	}
+	if len(chart.PDF) != len(chart.Counts) {
+		chart.PDF = make([]float64, len(chart.Counts))
+		total := 0
+		for _, count := range chart.Counts {
+			total += count
+		}
+		for i, count := range chart.Counts {
+			if total > 0 {
+				chart.PDF[i] = float64(count) / float64(total)
+			}
+		}
+	}
+
+	// X 軸：涵蓋整個分布範圍的整齊 APR 刻度
+	var xDecimals int
+	chart.XMin, chart.XMax, chart.XTicks, xDecimals = niceAxis(dist.MinRate, dist.MaxRate, ticks)
+	chart.XTickLabels = make([]string, len(chart.XTicks))
+	for i, tick := range chart.XTicks {
+		chart.XTickLabels[i] = fmt.Sprintf("%.*f%%", xDecimals, tick)
+	}
+
+	// Y 軸：從 0 到 PDF 最大值，標籤為交易比例的百分比
+	maxPDF := 0.0
+	for _, p := range chart.PDF {
+		maxPDF = math.Max(maxPDF, p)
+	}
+	if maxPDF == 0 {
+		maxPDF = 1
+	}
+	var yDecimals int
+	_, chart.YMax, chart.YTicks, yDecimals = niceAxis(0, maxPDF, ticks)
+	chart.YTickLabels = make([]string, len(chart.YTicks))
+	for i, tick := range chart.YTicks {
+		chart.YTickLabels[i] = fmt.Sprintf("%.*f%%", max(yDecimals-2, 0), tick*100)
+	}
+
+	return chart
+}
+
+// niceAxis 將 [lo, hi] 擴展到整齊的座標軸範圍，回傳範圍、間距為 1、2 或 5 乘以 10 的冪次的刻度，
+// 以及顯示刻度所需的小數位數
+func niceAxis(lo, hi float64, ticks int) (axisMin, axisMax float64, tickValues []float64, decimals int) {
+	if hi < lo {
+		lo, hi = hi, lo
+	}
+	span := hi - lo
+	if span == 0 {
+		// 單一數值時以其大小（或 1）作為範圍
+		span = math.Max(math.Abs(lo), 1)
+		lo -= span / 2
+		hi += span / 2
+	}
+
+	step := niceNum(niceNum(span, false)/float64(ticks-1), true)
+	axisMin = math.Floor(lo/step) * step
+	axisMax = math.Ceil(hi/step) * step
+	decimals = max(0, -int(math.Floor(math.Log10(step))))
+
+	// 以索引計算刻度避免浮點累加誤差，並依小數位數取整
+	for i := 0; ; i++ {
+		tick := axisMin + float64(i)*step
+		if tick > axisMax+step/2 {
+			break
+		}
+		tickValues = append(tickValues, rates.Round(tick, decimals))
+	}
+	return rates.Round(axisMin, decimals), rates.Round(axisMax, decimals), tickValues, decimals
+}
+
+// niceNum 回傳接近 x 的整齊數值（1、2、5 或 10 乘以 10 的冪次）；round 為 false 時回傳不小於 x 的值
+func niceNum(x float64, round bool) float64 {
+	exponent := math.Floor(math.Log10(x))
+	fraction := x / math.Pow(10, exponent)
+
+	var nice float64
+	switch {
+	case round && fraction < 1.5, !round && fraction <= 1:
+		nice = 1
+	case round && fraction < 3, !round && fraction <= 2:
+		nice = 2
+	case round && fraction < 7, !round && fraction <= 5:
+		nice = 5
+	default:
+		nice = 10
+	}
+	return nice * math.Pow(10, exponent)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestRateDistributionChartCentersAndTicks(t *testing.T) {
+	dist := &RateDistribution{
+		Currency:     "fUSD",
+		Unit:         "apr_percent",
+		MinRate:      5,
+		MaxRate:      15,
+		BinWidth:     2.5,
+		Distribution: []int{1, 3, 4, 2},
+		TotalTrades:  10,
+	}
+
+	chart := NewRateDistributionChart(dist, 6)
+
+	if want := []float64{6.25, 8.75, 11.25, 13.75}; !reflect.DeepEqual(chart.BinCenters, want) {
+		t.Errorf("bin centers = %v, want %v", chart.BinCenters, want)
+	}
+	// Without a stored PDF it is derived from the counts
+	for i, want := range []float64{0.1, 0.3, 0.4, 0.2} {
+		if math.Abs(chart.PDF[i]-want) > 1e-12 {
+			t.Errorf("pdf = %v, want [0.1 0.3 0.4 0.2]", chart.PDF)
+			break
+		}
+	}
+
+	// A span of 10 over about 6 ticks is stepped by 2 and widened to round values
+	if chart.XMin != 4 || chart.XMax != 16 {
+		t.Errorf("x axis = [%v, %v], want [4, 16]", chart.XMin, chart.XMax)
+	}
+	if want := []float64{4, 6, 8, 10, 12, 14, 16}; !reflect.DeepEqual(chart.XTicks, want) {
+		t.Errorf("x ticks = %v, want %v", chart.XTicks, want)
+	}
+	if want := []string{"4%", "6%", "8%", "10%", "12%", "14%", "16%"}; !reflect.DeepEqual(chart.XTickLabels, want) {
+		t.Errorf("x tick labels = %v, want %v", chart.XTickLabels, want)
+	}
+
+	if chart.YMax != 0.4 {
+		t.Errorf("y max = %v, want 0.4", chart.YMax)
+	}
+	if want := []float64{0, 0.1, 0.2, 0.3, 0.4}; !reflect.DeepEqual(chart.YTicks, want) {
+		t.Errorf("y ticks = %v, want %v", chart.YTicks, want)
+	}
+	if want := []string{"0%", "10%", "20%", "30%", "40%"}; !reflect.DeepEqual(chart.YTickLabels, want) {
+		t.Errorf("y tick labels = %v, want %v", chart.YTickLabels, want)
+	}
+}
+
+func TestRateDistributionChartFromSeededDistribution(t *testing.T) {
+	database := newTestDatabase(t)
+	for i := 0; i < 50; i++ {
+		saveTestTrades(t, database, "fUSD", api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: 0.0001 + float64(i)*0.000002, Period: 2})
+	}
+
+	ds := NewDistributionService(database)
+	if err := ds.InitializeDistribution("fUSD", 10); err != nil {
+		t.Fatalf("InitializeDistribution: %v", err)
+	}
+	dist, err := ds.GetDistribution("fUSD", 10)
+	if err != nil {
+		t.Fatalf("GetDistribution: %v", err)
+	}
+
+	chart := NewRateDistributionChart(dist, DefaultChartTicks)
+
+	if len(chart.BinCenters) != 10 || len(chart.Counts) != 10 || len(chart.PDF) != 10 {
+		t.Fatalf("%d centers, %d counts and %d pdf values, want 10 each", len(chart.BinCenters), len(chart.Counts), len(chart.PDF))
+	}
+	for i, center := range chart.BinCenters {
+		if math.Abs(center-(dist.BinEdges[i]+dist.BinEdges[i+1])/2) > 1e-9 {
+			t.Errorf("bin %d center = %v, want the middle of [%v, %v]", i, center, dist.BinEdges[i], dist.BinEdges[i+1])
+		}
+	}
+
+	// The ticks span the whole distribution and each has a label
+	if len(chart.XTicks) < 2 || len(chart.XTickLabels) != len(chart.XTicks) {
+		t.Fatalf("x ticks %v with labels %v, want at least two labelled ticks", chart.XTicks, chart.XTickLabels)
+	}
+	if chart.XTicks[0] != chart.XMin || chart.XTicks[len(chart.XTicks)-1] != chart.XMax {
+		t.Errorf("x ticks %v do not run from %v to %v", chart.XTicks, chart.XMin, chart.XMax)
+	}
+	if chart.XMin > dist.MinRate || chart.XMax < dist.MaxRate {
+		t.Errorf("x axis [%v, %v] does not cover the distribution [%v, %v]", chart.XMin, chart.XMax, dist.MinRate, dist.MaxRate)
+	}
+	if len(chart.YTicks) < 2 || len(chart.YTickLabels) != len(chart.YTicks) || chart.YTicks[0] != 0 {
+		t.Errorf("y ticks %v with labels %v, want labelled ticks from 0", chart.YTicks, chart.YTickLabels)
+	}
+	if chart.TotalTrades != 50 {
+		t.Errorf("total trades = %d, want 50", chart.TotalTrades)
+	}
+}
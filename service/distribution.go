@@ -1,29 +1,47 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/gary0122g/BitfinexFundingData/api"
 	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/rates"
 )
 
+// distributionUnit is the unit of MinRate, MaxRate, BinWidth and the labels
+const distributionUnit = "APR%"
+
+// distributionScale describes how stored daily rates are converted into distributionUnit
+func distributionScale() string {
+	return "(" + rates.CurrentAnnualization().Formula() + ")*100"
+}
+
 type RateDistribution struct {
 	Currency        string    `json:"currency"`
+	Unit            string    `json:"unit"`
+	Scale           string    `json:"scale"`
 	BinCount        int       `json:"bin_count"`
 	MinRate         float64   `json:"min_rate"`
 	MaxRate         float64   `json:"max_rate"`
 	BinWidth        float64   `json:"bin_width"`
 	Distribution    []int     `json:"distribution"`
 	PDF             []float64 `json:"pdf"`
+	BinEdges        []float64 `json:"bin_edges"`  // BinCount+1 edges in Unit, bin i spans BinEdges[i] to BinEdges[i+1]
+	Cumulative      []float64 `json:"cumulative"` // Share of trades at or below each bin's upper edge
 	Labels          []string  `json:"labels"`
 	TotalTrades     int       `json:"total_trades"`
 	LastProcessedID int64     `json:"last_processed_id"`
 	LastUpdated     time.Time `json:"last_updated"`
+
+	binned int // 落在箱子內的交易數（即 Distribution 的總和），不含超出範圍而被忽略的交易
 }
 
 type DistributionService struct {
-	database *db.Database
+	database    *db.Database
+	KeepHistory bool // 每次保存分布時另存快照到 rate_distribution_history，預設關閉以節省空間
 }
 
 func NewDistributionService(database *db.Database) *DistributionService {
@@ -32,6 +50,11 @@ func NewDistributionService(database *db.Database) *DistributionService {
 
 // InitializeDistribution 初始化利率分布（處理所有歷史數據）
 func (ds *DistributionService) InitializeDistribution(currency string, binCount int) error {
+	return ds.InitializeDistributionWithContext(context.Background(), currency, binCount)
+}
+
+// InitializeDistributionWithContext 初始化利率分布，逐筆讀取交易而不一次載入全部；ctx 取消時中止並回傳 ctx 的錯誤
+func (ds *DistributionService) InitializeDistributionWithContext(ctx context.Context, currency string, binCount int) error {
 	// 檢查是否已經存在分布
 	existing, err := ds.getDistribution(currency, binCount)
 	if err == nil && existing != nil {
@@ -42,32 +65,37 @@ func (ds *DistributionService) InitializeDistribution(currency string, binCount
 
 	fmt.Printf("No existing distribution found for %s, initializing...\n", currency)
 
-	// 獲取所有交易數據來計算初始分布
-	trades, err := ds.database.GetAllWSFundingTrades(currency)
+	// 先取得交易數量與利率範圍，用來決定箱子邊界
+	tradeRange, err := ds.database.GetWSFundingTradeRangeWithContext(ctx, currency)
 	if err != nil {
-		return fmt.Errorf("failed to get trades: %v", err)
+		return fmt.Errorf("failed to get trade range: %w", err)
 	}
 
-	if len(trades) == 0 {
+	if tradeRange.Count == 0 {
 		return fmt.Errorf("no trades found for currency %s", currency)
 	}
 
 	// 添加日誌來顯示處理的記錄數量
-	fmt.Printf("Initializing distribution for %s with %d trades\n", currency, len(trades))
-
-	// 轉換為 APR 百分比
-	rates := make([]float64, len(trades))
-	for i, trade := range trades {
-		rates[i] = trade.Rate * 365 * 100
+	fmt.Printf("Initializing distribution for %s with %d trades\n", currency, tradeRange.Count)
+
+	// 轉換為 APR 百分比後逐筆分配到箱子中
+	distribution := ds.newDistribution(rates.DailyToAPRPercent(tradeRange.MinRate), rates.DailyToAPRPercent(tradeRange.MaxRate), binCount)
+	// 只處理到 MaxID 為止的交易，之後寫入的交易留給 UpdateDistribution，避免重複計入
+	processed := 0
+	err = ds.database.ForEachWSFundingTradeWithContext(ctx, currency, tradeRange.MaxID, func(trade api.FundingTrade) error {
+		ds.addRateToDistribution(distribution, rates.DailyToAPRPercent(trade.Rate))
+		processed++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read trades: %w", err)
 	}
 
-	// 計算分布
-	distribution := ds.calculateDistribution(rates, binCount)
+	ds.calculatePDF(distribution)
+	ds.calculateCDF(distribution)
 	distribution.Currency = currency
-	distribution.TotalTrades = len(trades)
-	if len(trades) > 0 {
-		distribution.LastProcessedID = trades[len(trades)-1].ID
-	}
+	distribution.TotalTrades = processed
+	distribution.LastProcessedID = tradeRange.MaxID
 
 	// 保存到資料庫
 	return ds.saveDistribution(distribution)
@@ -99,7 +127,7 @@ func (ds *DistributionService) UpdateDistribution(currency string, binCount int)
 
 	// 更新分布
 	for _, trade := range newTrades {
-		rate := trade.Rate * 365 * 100
+		rate := rates.DailyToAPRPercent(trade.Rate)
 		ds.addRateToDistribution(currentDist, rate)
 	}
 
@@ -107,31 +135,16 @@ func (ds *DistributionService) UpdateDistribution(currency string, binCount int)
 	currentDist.LastProcessedID = newTrades[len(newTrades)-1].ID
 	currentDist.LastUpdated = time.Now()
 
-	// 重新計算PDF
+	// 重新計算PDF與累積分布
 	ds.calculatePDF(currentDist)
+	ds.calculateCDF(currentDist)
 
 	// 保存更新後的分布
 	return ds.saveDistribution(currentDist)
 }
 
-// calculateDistribution 計算利率分布
-func (ds *DistributionService) calculateDistribution(rates []float64, binCount int) *RateDistribution {
-	if len(rates) == 0 {
-		return nil
-	}
-
-	// 找出最大最小值
-	minRate := rates[0]
-	maxRate := rates[0]
-	for _, rate := range rates {
-		if rate < minRate {
-			minRate = rate
-		}
-		if rate > maxRate {
-			maxRate = rate
-		}
-	}
-
+// newDistribution 建立涵蓋 minRate 到 maxRate（各擴展5%）的空分布
+func (ds *DistributionService) newDistribution(minRate, maxRate float64, binCount int) *RateDistribution {
 	// 擴展範圍以防止邊界問題
 	rangeExtension := (maxRate - minRate) * 0.05 // 擴展5%
 	minRate -= rangeExtension
@@ -143,6 +156,8 @@ func (ds *DistributionService) calculateDistribution(rates []float64, binCount i
 	}
 
 	distribution := &RateDistribution{
+		Unit:         distributionUnit,
+		Scale:        distributionScale(),
 		BinCount:     binCount,
 		MinRate:      minRate,
 		MaxRate:      maxRate,
@@ -153,22 +168,20 @@ func (ds *DistributionService) calculateDistribution(rates []float64, binCount i
 	}
 
 	// 生成標籤
-	for i := 0; i < binCount; i++ {
-		binStart := minRate + float64(i)*binWidth
-		distribution.Labels[i] = fmt.Sprintf("%.2f%%", binStart)
-	}
-
-	// 分配數據到箱子中
-	for _, rate := range rates {
-		ds.addRateToDistribution(distribution, rate)
-	}
-
-	// 計算PDF
-	ds.calculatePDF(distribution)
+	ds.generateLabels(distribution)
 
 	return distribution
 }
 
+// generateLabels 生成每個箱子的標籤，包含上下界（例如 "5.00%–5.10%"）
+func (ds *DistributionService) generateLabels(dist *RateDistribution) {
+	for i := range dist.Labels {
+		binStart := dist.MinRate + float64(i)*dist.BinWidth
+		binEnd := binStart + dist.BinWidth
+		dist.Labels[i] = fmt.Sprintf("%.2f%%–%.2f%%", binStart, binEnd)
+	}
+}
+
 // addRateToDistribution 將單個利率添加到分布中
 func (ds *DistributionService) addRateToDistribution(dist *RateDistribution, rate float64) {
 	if rate < dist.MinRate || rate > dist.MaxRate {
@@ -185,36 +198,59 @@ func (ds *DistributionService) addRateToDistribution(dist *RateDistribution, rat
 	}
 
 	dist.Distribution[binIndex]++
+	dist.binned++
 }
 
-// calculatePDF 計算機率密度函數
+// calculatePDF 計算機率密度函數，以累計的 binned 正規化而不重新加總箱子
 func (ds *DistributionService) calculatePDF(dist *RateDistribution) {
-	total := 0
-	for _, count := range dist.Distribution {
-		total += count
-	}
-
 	dist.PDF = make([]float64, len(dist.Distribution))
-	if total > 0 {
+	if dist.binned > 0 {
 		for i, count := range dist.Distribution {
-			dist.PDF[i] = float64(count) / float64(total)
+			dist.PDF[i] = float64(count) / float64(dist.binned)
 		}
 	}
 }
 
-// saveDistribution 保存分布到資料庫
+// calculateCDF 計算箱子邊界與累積分布，最後一個累積值為 1.0（無交易時全為 0）
+func (ds *DistributionService) calculateCDF(dist *RateDistribution) {
+	dist.BinEdges = make([]float64, len(dist.Distribution)+1)
+	for i := range dist.BinEdges {
+		dist.BinEdges[i] = dist.MinRate + float64(i)*dist.BinWidth
+	}
+
+	dist.Cumulative = make([]float64, len(dist.Distribution))
+	if dist.binned == 0 {
+		return
+	}
+
+	running := 0
+	for i, count := range dist.Distribution {
+		running += count
+		dist.Cumulative[i] = float64(running) / float64(dist.binned)
+	}
+}
+
+// saveDistribution 保存分布到資料庫；KeepHistory 時在同一交易中另存一份快照到 rate_distribution_history
 func (ds *DistributionService) saveDistribution(dist *RateDistribution) error {
 	distributionJSON, err := json.Marshal(dist.Distribution)
 	if err != nil {
 		return err
 	}
 
+	tx, err := ds.database.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixMilli()
 	query := `
 	INSERT OR REPLACE INTO rate_distribution 
-	(currency, bin_count, min_rate, max_rate, bin_width, distribution, total_trades, last_processed_trade_id, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	(currency, bin_count, min_rate, max_rate, bin_width, distribution, total_trades, last_processed_trade_id, annualization, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err = ds.database.GetDB().Exec(query,
+	annualization := rates.CurrentAnnualization().Formula()
+	_, err = tx.Exec(query,
 		dist.Currency,
 		dist.BinCount,
 		dist.MinRate,
@@ -223,26 +259,55 @@ func (ds *DistributionService) saveDistribution(dist *RateDistribution) error {
 		string(distributionJSON),
 		dist.TotalTrades,
 		dist.LastProcessedID,
-		time.Now().UnixMilli())
+		annualization,
+		now)
+	if err != nil {
+		return err
+	}
+
+	if ds.KeepHistory {
+		historyQuery := `
+		INSERT INTO rate_distribution_history
+		(currency, bin_count, min_rate, max_rate, bin_width, distribution, total_trades, last_processed_trade_id, annualization, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+		_, err = tx.Exec(historyQuery,
+			dist.Currency,
+			dist.BinCount,
+			dist.MinRate,
+			dist.MaxRate,
+			dist.BinWidth,
+			string(distributionJSON),
+			dist.TotalTrades,
+			dist.LastProcessedID,
+			annualization,
+			now)
+		if err != nil {
+			return err
+		}
+	}
 
-	return err
+	return tx.Commit()
 }
 
-// getDistribution 從資料庫獲取分布
+// getDistribution 從資料庫獲取分布；箱子以 APR 儲存，以其他年化方式建立的分布視為不存在，
+// 由呼叫端以目前的年化方式重新初始化並覆蓋
 func (ds *DistributionService) getDistribution(currency string, binCount int) (*RateDistribution, error) {
 	query := `
 	SELECT min_rate, max_rate, bin_width, distribution, total_trades, last_processed_trade_id, updated_at
 	FROM rate_distribution 
-	WHERE currency = ? AND bin_count = ?`
+	WHERE currency = ? AND bin_count = ? AND annualization = ?`
 
 	var distributionJSON string
 	var updatedAt int64
 	dist := &RateDistribution{
 		Currency: currency,
+		Unit:     distributionUnit,
+		Scale:    distributionScale(),
 		BinCount: binCount,
 	}
 
-	err := ds.database.GetDB().QueryRow(query, currency, binCount).Scan(
+	err := ds.database.GetDB().QueryRow(query, currency, binCount, rates.CurrentAnnualization().Formula()).Scan(
 		&dist.MinRate,
 		&dist.MaxRate,
 		&dist.BinWidth,
@@ -260,22 +325,30 @@ func (ds *DistributionService) getDistribution(currency string, binCount int) (*
 		return nil, err
 	}
 
+	// 載入時加總一次，之後由 addRateToDistribution 增量維護
+	for _, count := range dist.Distribution {
+		dist.binned += count
+	}
+
 	dist.LastUpdated = time.Unix(updatedAt/1000, 0)
 
 	// 生成標籤和PDF
 	dist.Labels = make([]string, binCount)
-	for i := 0; i < binCount; i++ {
-		binStart := dist.MinRate + float64(i)*dist.BinWidth
-		dist.Labels[i] = fmt.Sprintf("%.2f%%", binStart)
-	}
+	ds.generateLabels(dist)
 
 	ds.calculatePDF(dist)
+	ds.calculateCDF(dist)
 
 	return dist, nil
 }
 
 // GetDistribution 公開方法獲取分布，如果不存在則自動初始化
 func (ds *DistributionService) GetDistribution(currency string, binCount int) (*RateDistribution, error) {
+	return ds.GetDistributionWithContext(context.Background(), currency, binCount)
+}
+
+// GetDistributionWithContext 獲取分布，如果不存在則自動初始化；ctx 取消時中止初始化
+func (ds *DistributionService) GetDistributionWithContext(ctx context.Context, currency string, binCount int) (*RateDistribution, error) {
 	// 先嘗試獲取現有分布
 	dist, err := ds.getDistribution(currency, binCount)
 	if err == nil {
@@ -283,11 +356,34 @@ func (ds *DistributionService) GetDistribution(currency string, binCount int) (*
 	}
 
 	// 如果不存在，則初始化
-	err = ds.InitializeDistribution(currency, binCount)
+	err = ds.InitializeDistributionWithContext(ctx, currency, binCount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize distribution: %v", err)
+		return nil, fmt.Errorf("failed to initialize distribution: %w", err)
 	}
 
 	// 再次獲取
 	return ds.getDistribution(currency, binCount)
 }
+
+// GetTradesInBin 返回落在已儲存分布中指定箱子利率範圍內的交易，箱子邊界與 addRateToDistribution 一致
+func (ds *DistributionService) GetTradesInBin(currency string, binIndex, binCount int) ([]api.FundingTrade, error) {
+	dist, err := ds.getDistribution(currency, binCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get distribution: %v", err)
+	}
+
+	if binIndex < 0 || binIndex >= dist.BinCount {
+		return nil, fmt.Errorf("bin index %d out of range [0, %d)", binIndex, dist.BinCount)
+	}
+
+	binStart := dist.MinRate + float64(binIndex)*dist.BinWidth
+	binEnd := binStart + dist.BinWidth
+
+	// 最後一個箱子包含上界
+	lastBin := binIndex == dist.BinCount-1
+	if lastBin {
+		binEnd = dist.MaxRate
+	}
+
+	return ds.database.GetWSFundingTradesInAPRRange(currency, binStart, binEnd, lastBin)
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/rates"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDatabase opens a Database on a new SQLite file with all tables created
+func newTestDatabase(t *testing.T) *db.Database {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.CreateTables(conn); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	return db.NewDatabase(conn)
+}
+
+// saveTestTrades stores trades of currency as ftu updates
+func saveTestTrades(t *testing.T, database *db.Database, currency string, trades ...api.FundingTrade) {
+	t.Helper()
+
+	records := make([]db.WSFundingTradeRecord, len(trades))
+	for i, trade := range trades {
+		records[i] = db.WSFundingTradeRecord{Currency: currency, Trade: trade, MsgType: "ftu"}
+	}
+	if _, err := database.SaveWSFundingTrades(records); err != nil {
+		t.Fatalf("SaveWSFundingTrades: %v", err)
+	}
+}
+
+func TestInitializeDistributionCountsBinnedTrades(t *testing.T) {
+	database := newTestDatabase(t)
+	for i := 0; i < 50; i++ {
+		saveTestTrades(t, database, "fUSD", api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: 0.0001 + float64(i)*0.000002, Period: 2})
+	}
+
+	ds := NewDistributionService(database)
+	if err := ds.InitializeDistribution("fUSD", 10); err != nil {
+		t.Fatalf("InitializeDistribution: %v", err)
+	}
+	dist, err := ds.GetDistribution("fUSD", 10)
+	if err != nil {
+		t.Fatalf("GetDistribution: %v", err)
+	}
+
+	binned := 0
+	for _, count := range dist.Distribution {
+		binned += count
+	}
+	if dist.TotalTrades != 50 || binned != 50 {
+		t.Errorf("TotalTrades = %d with %d binned trades, want 50 and 50", dist.TotalTrades, binned)
+	}
+	if dist.LastProcessedID != 50 {
+		t.Errorf("LastProcessedID = %d, want 50", dist.LastProcessedID)
+	}
+}
+
+func TestDistributionRebuiltWhenAnnualizationChanges(t *testing.T) {
+	t.Cleanup(func() { rates.SetAnnualization(rates.DefaultAnnualizationDays, false) })
+
+	database := newTestDatabase(t)
+	for i := 0; i < 20; i++ {
+		saveTestTrades(t, database, "fUSD", api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: 0.0001 + float64(i)*0.000005, Period: 2})
+	}
+
+	ds := NewDistributionService(database)
+	dist365, err := ds.GetDistribution("fUSD", 10)
+	if err != nil {
+		t.Fatalf("GetDistribution: %v", err)
+	}
+
+	if err := rates.SetAnnualization(360, false); err != nil {
+		t.Fatalf("SetAnnualization: %v", err)
+	}
+	dist360, err := ds.GetDistribution("fUSD", 10)
+	if err != nil {
+		t.Fatalf("GetDistribution: %v", err)
+	}
+
+	// The bins were rebuilt in the new annualization instead of serving the 365-day APR bins
+	if want := dist365.MaxRate * 360 / 365; math.Abs(dist360.MaxRate-want) > 1e-9 {
+		t.Errorf("MaxRate after switching to 360 days = %v, want %v", dist360.MaxRate, want)
+	}
+	if dist360.TotalTrades != 20 {
+		t.Errorf("TotalTrades = %d, want 20", dist360.TotalTrades)
+	}
+	if dist360.Scale != "(daily_rate*360)*100" {
+		t.Errorf("Scale = %q, want (daily_rate*360)*100", dist360.Scale)
+	}
+}
+
+func TestDistributionEdgesAndCumulative(t *testing.T) {
+	database := newTestDatabase(t)
+	for i := 0; i < 30; i++ {
+		saveTestTrades(t, database, "fUSD", api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: 0.0001 + float64(i%7)*0.00001, Period: 2})
+	}
+
+	dist, err := NewDistributionService(database).GetDistribution("fUSD", 8)
+	if err != nil {
+		t.Fatalf("GetDistribution: %v", err)
+	}
+
+	if len(dist.BinEdges) != dist.BinCount+1 {
+		t.Fatalf("%d bin edges, want %d", len(dist.BinEdges), dist.BinCount+1)
+	}
+	for i := 1; i < len(dist.BinEdges); i++ {
+		if dist.BinEdges[i] <= dist.BinEdges[i-1] {
+			t.Fatalf("bin edges not increasing at %d: %v", i, dist.BinEdges)
+		}
+	}
+	if math.Abs(dist.BinEdges[0]-dist.MinRate) > 1e-9 || math.Abs(dist.BinEdges[dist.BinCount]-dist.MaxRate) > 1e-9 {
+		t.Errorf("bin edges span %v to %v, want %v to %v", dist.BinEdges[0], dist.BinEdges[dist.BinCount], dist.MinRate, dist.MaxRate)
+	}
+
+	if len(dist.Cumulative) != dist.BinCount {
+		t.Fatalf("%d cumulative values, want %d", len(dist.Cumulative), dist.BinCount)
+	}
+	for i := 1; i < len(dist.Cumulative); i++ {
+		if dist.Cumulative[i] < dist.Cumulative[i-1] {
+			t.Fatalf("cumulative decreases at %d: %v", i, dist.Cumulative)
+		}
+	}
+	if last := dist.Cumulative[len(dist.Cumulative)-1]; math.Abs(last-1) > 1e-12 {
+		t.Errorf("cumulative ends at %v, want 1.0", last)
+	}
+}
+
+func TestCalculatePDFUsesRunningTotal(t *testing.T) {
+	ds := NewDistributionService(nil)
+	dist := ds.newDistribution(0, 100, 20)
+
+	// Rates outside the extended range are ignored and must not count towards the total
+	for i := 0; i < 1000; i++ {
+		ds.addRateToDistribution(dist, float64(i%101))
+	}
+	ds.addRateToDistribution(dist, -50)
+	ds.addRateToDistribution(dist, 500)
+
+	sum := 0
+	for _, count := range dist.Distribution {
+		sum += count
+	}
+	if dist.binned != sum || sum != 1000 {
+		t.Fatalf("binned = %d, bins sum to %d, want both 1000", dist.binned, sum)
+	}
+
+	ds.calculatePDF(dist)
+	total := 0.0
+	for i, p := range dist.PDF {
+		if want := float64(dist.Distribution[i]) / float64(sum); math.Abs(p-want) > 1e-12 {
+			t.Errorf("PDF[%d] = %v, want %v", i, p, want)
+		}
+		total += p
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("PDF sums to %v, want 1", total)
+	}
+}
+
+func BenchmarkCalculatePDF(b *testing.B) {
+	ds := NewDistributionService(nil)
+	dist := ds.newDistribution(0, 100, 1000)
+	for i := 0; i < 1000000; i++ {
+		ds.addRateToDistribution(dist, float64(i%100000)/1000)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ds.calculatePDF(dist)
+	}
+}
+
+func TestUpdateDistributionAppendsHistory(t *testing.T) {
+	database := newTestDatabase(t)
+	trades := make([]api.FundingTrade, 20)
+	for i := range trades {
+		trades[i] = api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: 0.0001 + float64(i)*0.000002, Period: 2}
+	}
+	saveTestTrades(t, database, "fUSD", trades...)
+
+	ds := NewDistributionService(database)
+	ds.KeepHistory = true
+	if err := ds.UpdateDistribution("fUSD", 10); err != nil {
+		t.Fatalf("UpdateDistribution: %v", err)
+	}
+
+	// Enough new trades for the incremental update to run
+	trades = make([]api.FundingTrade, 10000)
+	for i := range trades {
+		trades[i] = api.FundingTrade{ID: int64(21 + i), MTS: int64(2000 + i), Amount: 10, Rate: 0.0001 + float64(i%20)*0.000002, Period: 2}
+	}
+	saveTestTrades(t, database, "fUSD", trades...)
+	if err := ds.UpdateDistribution("fUSD", 10); err != nil {
+		t.Fatalf("UpdateDistribution: %v", err)
+	}
+
+	history, err := database.GetRateDistributionHistory("fUSD", 10, math.MaxInt64, 10)
+	if err != nil {
+		t.Fatalf("GetRateDistributionHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("%d history rows, want one per save (2)", len(history))
+	}
+	if history[0].TotalTrades != 10020 || history[1].TotalTrades != 20 {
+		t.Errorf("history total trades = %d, %d, want 10020, 20 newest first", history[0].TotalTrades, history[1].TotalTrades)
+	}
+
+	var current, total int
+	if err := database.GetDB().QueryRow(`SELECT COUNT(*), MAX(total_trades) FROM rate_distribution WHERE currency = 'fUSD'`).Scan(&current, &total); err != nil {
+		t.Fatalf("failed to read the current distribution: %v", err)
+	}
+	if current != 1 || total != 10020 {
+		t.Errorf("%d current rows with %d trades, want 1 row updated to 10020", current, total)
+	}
+}
+
+func TestInitializeDistributionStopsWhenCanceled(t *testing.T) {
+	database := newTestDatabase(t)
+	for i := 0; i < 20; i++ {
+		saveTestTrades(t, database, "fUSD", api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: 0.0001, Period: 2})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ds := NewDistributionService(database)
+	if err := ds.InitializeDistributionWithContext(ctx, "fUSD", 10); !errors.Is(err, context.Canceled) {
+		t.Fatalf("InitializeDistributionWithContext = %v, want context.Canceled", err)
+	}
+
+	var stored int
+	if err := database.GetDB().QueryRow(`SELECT COUNT(*) FROM rate_distribution`).Scan(&stored); err != nil {
+		t.Fatalf("failed to count distributions: %v", err)
+	}
+	if stored != 0 {
+		t.Errorf("%d distributions stored after cancellation, want 0", stored)
+	}
+}
+
+func TestDistributionLabelsIncludeBothBounds(t *testing.T) {
+	ds := NewDistributionService(nil)
+	dist := ds.newDistribution(5, 15, 4) // Extended by 5% to 4.5 to 15.5
+
+	want := []string{"4.50%–7.25%", "7.25%–10.00%", "10.00%–12.75%", "12.75%–15.50%"}
+	if len(dist.Labels) != len(want) {
+		t.Fatalf("%d labels, want %d: %v", len(dist.Labels), len(want), dist.Labels)
+	}
+	for i := range want {
+		if dist.Labels[i] != want[i] {
+			t.Errorf("label %d = %q, want %q", i, dist.Labels[i], want[i])
+		}
+	}
+
+	// The upper bound of the last label is MaxRate
+	last := dist.Labels[len(dist.Labels)-1]
+	if _, upper, _ := strings.Cut(last, "–"); upper != fmt.Sprintf("%.2f%%", dist.MaxRate) {
+		t.Errorf("last label %q does not end at MaxRate %.2f", last, dist.MaxRate)
+	}
+
+	data, err := json.Marshal(dist)
+	if err != nil {
+		t.Fatalf("failed to marshal distribution: %v", err)
+	}
+	var decoded struct {
+		Unit  string `json:"unit"`
+		Scale string `json:"scale"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode distribution: %v", err)
+	}
+	if decoded.Unit != "APR%" {
+		t.Errorf("unit = %q, want APR%%", decoded.Unit)
+	}
+	if decoded.Scale != "(daily_rate*365)*100" {
+		t.Errorf("scale = %q, want the default annualization in percent", decoded.Scale)
+	}
+}
+
+func TestGetTradesInBinReturnsOnlyTheBinsTrades(t *testing.T) {
+	database := newTestDatabase(t)
+	// 4 bins of 3.65% APR from 3.65% to 18.25%
+	for i, rate := range []float64{0.0001, 0.00015, 0.00025, 0.00035, 0.00045, 0.0005} {
+		saveTestTrades(t, database, "fUSD", api.FundingTrade{ID: int64(i + 1), MTS: int64(1000 + i), Amount: 10, Rate: rate, Period: 2})
+	}
+	saveTestTrades(t, database, "fUST", api.FundingTrade{ID: 99, MTS: 1000, Amount: 10, Rate: 0.0001, Period: 2})
+
+	ds := NewDistributionService(database)
+	if err := ds.InitializeDistribution("fUSD", 4); err != nil {
+		t.Fatalf("InitializeDistribution: %v", err)
+	}
+	dist, err := ds.GetDistribution("fUSD", 4)
+	if err != nil {
+		t.Fatalf("GetDistribution: %v", err)
+	}
+
+	for binIndex, wantIDs := range [][]int64{
+		{1, 2},
+		{3},
+		{4},
+		{5, 6}, // The last bin includes the maximum rate
+	} {
+		trades, err := ds.GetTradesInBin("fUSD", binIndex, 4)
+		if err != nil {
+			t.Fatalf("GetTradesInBin(%d): %v", binIndex, err)
+		}
+		var ids []int64
+		for _, trade := range trades {
+			ids = append(ids, trade.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(wantIDs) {
+			t.Errorf("bin %d trades = %v, want %v", binIndex, ids, wantIDs)
+		}
+		if len(trades) != dist.Distribution[binIndex] {
+			t.Errorf("bin %d returned %d trades, but the distribution counts %d", binIndex, len(trades), dist.Distribution[binIndex])
+		}
+	}
+
+	for _, binIndex := range []int{-1, 4} {
+		if _, err := ds.GetTradesInBin("fUSD", binIndex, 4); err == nil {
+			t.Errorf("GetTradesInBin(%d) succeeded, want an out of range error", binIndex)
+		}
+	}
+}
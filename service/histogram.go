@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/rates"
+)
+
+// maxHistogramTrades limits how many trades are loaded to build a single histogram
+const maxHistogramTrades = 1000000
+
+// TradeHistogram is a rate histogram of the funding trades executed within a time window
+type TradeHistogram struct {
+	Currency    string    `json:"currency"`
+	Unit        string    `json:"unit"`
+	Start       int64     `json:"start"`
+	End         int64     `json:"end"`
+	Edges       []float64 `json:"edges"`   // Bin edges, len(Counts)+1 values
+	Counts      []int     `json:"counts"`  // Number of trades per bin
+	Amounts     []float64 `json:"amounts"` // Sum of absolute trade amounts per bin
+	TotalTrades int       `json:"total_trades"`
+}
+
+// HistogramService builds trade histograms from any db.Storage
+type HistogramService struct {
+	database db.Storage
+}
+
+func NewHistogramService(database db.Storage) *HistogramService {
+	return &HistogramService{database: database}
+}
+
+// GetTradeHistogram bins the funding trades between startTime and endTime by APR rate
+func (hs *HistogramService) GetTradeHistogram(currency string, startTime, endTime time.Time, binCount int) (*TradeHistogram, error) {
+	if binCount <= 0 {
+		return nil, fmt.Errorf("invalid bin count: %d", binCount)
+	}
+
+	trades, err := hs.database.GetHistoricalWSFundingTrades(currency, startTime, endTime, maxHistogramTrades)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trades: %v", err)
+	}
+
+	histogram := BuildTradeHistogram(trades, binCount)
+	histogram.Currency = currency
+	histogram.Start = startTime.UnixMilli()
+	histogram.End = endTime.UnixMilli()
+
+	return histogram, nil
+}
+
+// BuildTradeHistogram bins trades into binCount equal-width bins spanning their APR rate range
+func BuildTradeHistogram(trades []api.FundingTrade, binCount int) *TradeHistogram {
+	histogram := &TradeHistogram{
+		Unit:        distributionUnit,
+		Edges:       make([]float64, binCount+1),
+		Counts:      make([]int, binCount),
+		Amounts:     make([]float64, binCount),
+		TotalTrades: len(trades),
+	}
+	if len(trades) == 0 {
+		return histogram
+	}
+
+	aprs := make([]float64, len(trades))
+	minRate, maxRate := math.Inf(1), math.Inf(-1)
+	for i, trade := range trades {
+		aprs[i] = rates.DailyToAPRPercent(trade.Rate)
+		minRate = math.Min(minRate, aprs[i])
+		maxRate = math.Max(maxRate, aprs[i])
+	}
+
+	binWidth := (maxRate - minRate) / float64(binCount)
+	if binWidth == 0 {
+		binWidth = 1 // All trades share one rate
+	}
+
+	for i := range histogram.Edges {
+		histogram.Edges[i] = minRate + float64(i)*binWidth
+	}
+
+	for i, rate := range aprs {
+		binIndex := int((rate - minRate) / binWidth)
+		if binIndex >= binCount {
+			binIndex = binCount - 1 // The maximum rate belongs to the last bin
+		}
+		histogram.Counts[binIndex]++
+		histogram.Amounts[binIndex] += math.Abs(trades[i].Amount)
+	}
+
+	return histogram
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db/dbtest"
+)
+
+func TestTradeHistogramFromMockStorage(t *testing.T) {
+	storage := dbtest.NewMockStorage()
+	for id, rate := range []float64{0.0001, 0.0002, 0.0003, 0.0003} {
+		trade := api.FundingTrade{ID: int64(id + 1), MTS: 1700000000000 + int64(id), Amount: -50, Rate: rate, Period: 2}
+		if _, err := storage.SaveWSFundingTrade("fUSD", trade, "ftu"); err != nil {
+			t.Fatalf("SaveWSFundingTrade: %v", err)
+		}
+	}
+	// A trade outside the window is not binned
+	if _, err := storage.SaveWSFundingTrade("fUSD", api.FundingTrade{ID: 9, MTS: 1600000000000, Amount: 1, Rate: 0.01}, "ftu"); err != nil {
+		t.Fatalf("SaveWSFundingTrade: %v", err)
+	}
+
+	start, end := time.UnixMilli(1700000000000), time.UnixMilli(1700000001000)
+	histogram, err := NewHistogramService(storage).GetTradeHistogram("fUSD", start, end, 2)
+	if err != nil {
+		t.Fatalf("GetTradeHistogram: %v", err)
+	}
+
+	if histogram.TotalTrades != 4 || histogram.Counts[0] != 1 || histogram.Counts[1] != 3 {
+		t.Errorf("counts = %v of %d trades, want [1 3] of 4", histogram.Counts, histogram.TotalTrades)
+	}
+	if histogram.Amounts[1] != 150 {
+		t.Errorf("amounts = %v, want absolute amounts summed to 150 in the upper bin", histogram.Amounts)
+	}
+	if histogram.Start != start.UnixMilli() || histogram.End != end.UnixMilli() || histogram.Currency != "fUSD" {
+		t.Errorf("histogram window = %s %d-%d, want fUSD %d-%d", histogram.Currency, histogram.Start, histogram.End, start.UnixMilli(), end.UnixMilli())
+	}
+	if n := storage.CallCount("GetHistoricalWSFundingTrades"); n != 1 {
+		t.Errorf("GetHistoricalWSFundingTrades called %d times, want once", n)
+	}
+
+	storage.SetError("GetHistoricalWSFundingTrades", errors.New("disk I/O error"))
+	if _, err := NewHistogramService(storage).GetTradeHistogram("fUSD", start, end, 2); err == nil {
+		t.Error("expected the storage error to be returned")
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+// bookLevelKey identifies a price level of an aggregated funding book
+type bookLevelKey struct {
+	rate   float64
+	period int
+	isBid  bool
+}
+
+// LiveFundingBook maintains an aggregated funding book from a WebSocket snapshot and its updates
+type LiveFundingBook struct {
+	mu     sync.Mutex
+	levels map[bookLevelKey]api.FundingBook
+}
+
+func NewLiveFundingBook() *LiveFundingBook {
+	return &LiveFundingBook{levels: make(map[bookLevelKey]api.FundingBook)}
+}
+
+// Apply replaces the book with a snapshot or applies updates; levels updated with a count of 0 are removed
+func (b *LiveFundingBook) Apply(books []api.FundingBook, snapshot bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if snapshot {
+		b.levels = make(map[bookLevelKey]api.FundingBook, len(books))
+	}
+	for _, book := range books {
+		// Amount > 0 for asks, < 0 for bids; deletions carry the sign of the removed level
+		key := bookLevelKey{rate: book.Rate, period: book.Period, isBid: book.Amount < 0}
+		if book.Count == 0 {
+			delete(b.levels, key)
+			continue
+		}
+		b.levels[key] = book
+	}
+}
+
+// Levels returns the current price levels, bids by rate descending followed by asks by rate ascending
+func (b *LiveFundingBook) Levels() []api.FundingBook {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	levels := make([]api.FundingBook, 0, len(b.levels))
+	for _, book := range b.levels {
+		levels = append(levels, book)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		iBid, jBid := levels[i].Amount < 0, levels[j].Amount < 0
+		if iBid != jBid {
+			return iBid
+		}
+		if levels[i].Rate != levels[j].Rate {
+			if iBid {
+				return levels[i].Rate > levels[j].Rate
+			}
+			return levels[i].Rate < levels[j].Rate
+		}
+		return levels[i].Period < levels[j].Period
+	})
+	return levels
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+	"github.com/gary0122g/BitfinexFundingData/db"
+	"github.com/gary0122g/BitfinexFundingData/rates"
+)
+
+// ErrNotEnoughStats is returned when too few funding stats are stored to fit a trend
+var ErrNotEnoughStats = errors.New("not enough funding stats")
+
+// FRRRegime classifies the trend of the FRR
+type FRRRegime string
+
+const (
+	RegimeRising  FRRRegime = "rising"
+	RegimeFalling FRRRegime = "falling"
+	RegimeStable  FRRRegime = "stable"
+)
+
+// RegimeThresholds decide when an FRR trend counts as rising or falling rather than stable
+type RegimeThresholds struct {
+	SlopePerDay   float64 // Minimum absolute slope, in APR percentage points per day
+	MinConfidence float64 // Minimum R² of the linear fit, between 0 and 1
+}
+
+// DefaultRegimeThresholds treat a trend of half a percentage point of APR per day that explains
+// at least half of the variance as rising or falling
+var DefaultRegimeThresholds = RegimeThresholds{
+	SlopePerDay:   0.5,
+	MinConfidence: 0.5,
+}
+
+// FRRRegimeResult is the classified FRR trend over the latest funding stats
+type FRRRegimeResult struct {
+	Currency   string    `json:"currency"`
+	Regime     FRRRegime `json:"regime"`
+	Slope      float64   `json:"slope"`      // Fitted FRR change in APR percentage points per day
+	Confidence float64   `json:"confidence"` // R² of the linear fit; 1 for a constant FRR
+	Samples    int       `json:"samples"`
+	Start      int64     `json:"start"`   // MTS of the oldest stats in the window
+	End        int64     `json:"end"`     // MTS of the newest stats in the window
+	Latest     float64   `json:"latest"`  // Newest FRR in APR percent
+	Formula    string    `json:"formula"` // Annualization of the FRR values
+}
+
+type RegimeService struct {
+	database   *db.Database
+	thresholds RegimeThresholds
+}
+
+func NewRegimeService(database *db.Database, thresholds RegimeThresholds) *RegimeService {
+	return &RegimeService{database: database, thresholds: thresholds}
+}
+
+// GetFRRRegime classifies the FRR trend over the latest window funding stats of currency
+func (rs *RegimeService) GetFRRRegime(ctx context.Context, currency string, window int) (*FRRRegimeResult, error) {
+	if window < 2 {
+		return nil, fmt.Errorf("invalid window: %d, at least 2 stats are needed", window)
+	}
+
+	stats, err := rs.database.GetFundingStatsWithContext(ctx, currency, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get funding stats: %v", err)
+	}
+
+	result, err := ClassifyFRRRegime(stats, rs.thresholds)
+	if err != nil {
+		return nil, fmt.Errorf("%w for currency %s", err, currency)
+	}
+	result.Currency = currency
+	return result, nil
+}
+
+// ClassifyFRRRegime fits a least-squares line to the APR of the FRR over time and classifies its
+// slope. Stats may be in any order. A trend is stable unless its slope reaches
+// thresholds.SlopePerDay and its R² reaches thresholds.MinConfidence.
+func ClassifyFRRRegime(stats []api.FundingStats, thresholds RegimeThresholds) (*FRRRegimeResult, error) {
+	// Rows without an FRR carry no trend
+	withFRR := make([]api.FundingStats, 0, len(stats))
+	for _, s := range stats {
+		if !s.FRRMissing {
+			withFRR = append(withFRR, s)
+		}
+	}
+	stats = withFRR
+
+	if len(stats) < 2 {
+		return nil, ErrNotEnoughStats
+	}
+
+	result := &FRRRegimeResult{
+		Samples: len(stats),
+		Start:   stats[0].MTS,
+		End:     stats[0].MTS,
+		Formula: rates.CurrentAnnualization().Formula(),
+	}
+
+	// x is days since the oldest stats, y the APR in percent
+	xs := make([]float64, len(stats))
+	ys := make([]float64, len(stats))
+	for _, s := range stats {
+		if s.MTS < result.Start {
+			result.Start = s.MTS
+		}
+		if s.MTS >= result.End {
+			result.End = s.MTS
+			result.Latest = rates.ToPercent(rates.StatsFRRToAPR(s.FRRRaw))
+		}
+	}
+	for i, s := range stats {
+		xs[i] = float64(s.MTS-result.Start) / float64(24*60*60*1000)
+		ys[i] = rates.ToPercent(rates.StatsFRRToAPR(s.FRRRaw))
+	}
+	if result.Start == result.End {
+		return nil, fmt.Errorf("%w: all stats have the same timestamp", ErrNotEnoughStats)
+	}
+
+	result.Slope, result.Confidence = fitLine(xs, ys)
+
+	result.Regime = RegimeStable
+	if math.Abs(result.Slope) >= thresholds.SlopePerDay && result.Confidence >= thresholds.MinConfidence {
+		if result.Slope > 0 {
+			result.Regime = RegimeRising
+		} else {
+			result.Regime = RegimeFalling
+		}
+	}
+
+	return result, nil
+}
+
+// fitLine returns the slope of the least-squares line through the points and its coefficient of
+// determination R². Points on a horizontal line are fitted perfectly, so R² is 1 for them.
+func fitLine(xs, ys []float64) (slope, r2 float64) {
+	n := float64(len(xs))
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	// Rounding in the mean leaves syy slightly above zero for equal values, so compare them directly
+	constant := true
+	var sxx, sxy, syy float64
+	for i := range xs {
+		if ys[i] != ys[0] {
+			constant = false
+		}
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+
+	if constant {
+		return 0, 1
+	}
+	slope = sxy / sxx
+	if syy == 0 {
+		return slope, 1
+	}
+	return slope, sxy * sxy / (sxx * syy)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+// hourlyStats returns newest-first stats an hour apart whose FRR moves by step per hour
+func hourlyStats(n int, start, step float64) []api.FundingStats {
+	const hour = int64(60 * 60 * 1000)
+	stats := make([]api.FundingStats, n)
+	for i := range stats {
+		frr := start + step*float64(n-1-i)
+		stats[i] = api.FundingStats{MTS: 1700000000000 + hour*int64(n-1-i), FRR: frr, FRRRaw: frr}
+	}
+	return stats
+}
+
+func TestClassifyFRRRegime(t *testing.T) {
+	// 1e-7 of unscaled FRR per hour is 1e-7 * 365 * 365 * 100 * 24 APR percentage points per day
+	const step = 1e-7
+	perDay := step * 365 * 365 * 100 * 24
+
+	tests := []struct {
+		name      string
+		stats     []api.FundingStats
+		want      FRRRegime
+		wantSlope float64
+	}{
+		{"rising", hourlyStats(24, 1e-6, step), RegimeRising, perDay},
+		{"falling", hourlyStats(24, 5e-6, -step), RegimeFalling, -perDay},
+		{"flat", hourlyStats(24, 2e-6, 0), RegimeStable, 0},
+		{"below slope threshold", hourlyStats(24, 2e-6, 1e-10), RegimeStable, perDay / 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ClassifyFRRRegime(tt.stats, DefaultRegimeThresholds)
+			if err != nil {
+				t.Fatalf("ClassifyFRRRegime: %v", err)
+			}
+			if result.Regime != tt.want {
+				t.Errorf("regime = %s, want %s", result.Regime, tt.want)
+			}
+			if math.Abs(result.Slope-tt.wantSlope) > 1e-9*math.Max(1, math.Abs(tt.wantSlope)) {
+				t.Errorf("slope = %v, want %v", result.Slope, tt.wantSlope)
+			}
+			// Points exactly on a line, including a horizontal one, are fitted perfectly
+			if math.Abs(result.Confidence-1) > 1e-9 {
+				t.Errorf("confidence = %v, want 1", result.Confidence)
+			}
+			if result.Samples != 24 || result.End-result.Start != 23*60*60*1000 {
+				t.Errorf("samples %d from %d to %d, want 24 over 23 hours", result.Samples, result.Start, result.End)
+			}
+		})
+	}
+}
+
+func TestClassifyFRRRegimeNoisySeriesIsStable(t *testing.T) {
+	// A steep overall slope that explains little of the variance is not a trend
+	stats := hourlyStats(24, 2e-6, 0)
+	for i := range stats {
+		if i%2 == 0 {
+			stats[i].FRRRaw += 2e-6
+		}
+	}
+	stats[0].FRRRaw += 1e-6
+
+	result, err := ClassifyFRRRegime(stats, RegimeThresholds{SlopePerDay: 0.5, MinConfidence: 0.9})
+	if err != nil {
+		t.Fatalf("ClassifyFRRRegime: %v", err)
+	}
+	if result.Regime != RegimeStable || result.Confidence >= 0.9 {
+		t.Errorf("result = %+v, want stable with low confidence", result)
+	}
+}
+
+func TestClassifyFRRRegimeNeedsTwoTimestamps(t *testing.T) {
+	if _, err := ClassifyFRRRegime(hourlyStats(1, 1e-6, 0), DefaultRegimeThresholds); !errors.Is(err, ErrNotEnoughStats) {
+		t.Errorf("one stats: err = %v, want ErrNotEnoughStats", err)
+	}
+
+	stats := hourlyStats(2, 1e-6, 1e-7)
+	stats[1].MTS = stats[0].MTS
+	if _, err := ClassifyFRRRegime(stats, DefaultRegimeThresholds); !errors.Is(err, ErrNotEnoughStats) {
+		t.Errorf("same timestamp: err = %v, want ErrNotEnoughStats", err)
+	}
+}
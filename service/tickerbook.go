@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/db"
+)
+
+// TickerWithBook is a funding ticker joined with the latest book snapshot taken at or before it.
+// Book fields are nil when no snapshot was taken within the allowed gap.
+type TickerWithBook struct {
+	db.TimestampedFundingTicker
+	BookTimestamp *int64   `json:"book_timestamp"`
+	Spread        *float64 `json:"spread"` // Best ask rate minus best bid rate, nil if a side is empty
+	BidLevels     *int     `json:"bid_levels"`
+	AskLevels     *int     `json:"ask_levels"`
+}
+
+type TickerBookService struct {
+	database *db.Database
+}
+
+func NewTickerBookService(database *db.Database) *TickerBookService {
+	return &TickerBookService{database: database}
+}
+
+// GetTickerWithBookHistory returns the funding tickers between startTime and endTime, oldest first, each
+// joined with the most recent funding book snapshot taken at most maxGap before it (as-of join)
+func (ts *TickerBookService) GetTickerWithBookHistory(ctx context.Context, currency string, startTime, endTime time.Time, limit int, maxGap time.Duration) ([]TickerWithBook, error) {
+	tickers, err := ts.database.GetTimestampedFundingTickersWithContext(ctx, currency, startTime, endTime, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tickers: %v", err)
+	}
+	if len(tickers) == 0 {
+		return []TickerWithBook{}, nil
+	}
+
+	// Snapshots shortly before the first ticker can still be joined to it
+	first := tickers[0].Timestamp - maxGap.Milliseconds()
+	last := tickers[len(tickers)-1].Timestamp
+	snapshots, err := ts.database.GetFundingBookSnapshotSummariesWithContext(ctx, currency, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book snapshots: %v", err)
+	}
+
+	return JoinTickersWithBook(tickers, snapshots, maxGap), nil
+}
+
+// JoinTickersWithBook joins each ticker with the latest snapshot at or before its timestamp and at most
+// maxGap older. Both inputs must be sorted oldest first.
+func JoinTickersWithBook(tickers []db.TimestampedFundingTicker, snapshots []db.BookSnapshotSummary, maxGap time.Duration) []TickerWithBook {
+	joined := make([]TickerWithBook, len(tickers))
+	next := 0 // Index of the first snapshot after the current ticker
+	for i, ticker := range tickers {
+		joined[i] = TickerWithBook{TimestampedFundingTicker: ticker}
+
+		for next < len(snapshots) && snapshots[next].MTS <= ticker.Timestamp {
+			next++
+		}
+		if next == 0 {
+			continue
+		}
+
+		snapshot := snapshots[next-1]
+		if ticker.Timestamp-snapshot.MTS > maxGap.Milliseconds() {
+			continue
+		}
+
+		bookTimestamp := snapshot.MTS
+		bidLevels := snapshot.BidLevels
+		askLevels := snapshot.AskLevels
+		joined[i].BookTimestamp = &bookTimestamp
+		joined[i].BidLevels = &bidLevels
+		joined[i].AskLevels = &askLevels
+		if snapshot.BestBid != nil && snapshot.BestAsk != nil {
+			spread := *snapshot.BestAsk - *snapshot.BestBid
+			joined[i].Spread = &spread
+		}
+	}
+
+	return joined
+}
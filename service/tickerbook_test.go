@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gary0122g/BitfinexFundingData/api"
+)
+
+func TestGetTickerWithBookHistoryJoinsAsOf(t *testing.T) {
+	database := newTestDatabase(t)
+	for _, mts := range []int64{10000, 20000, 30000, 40000} {
+		if _, err := database.GetDB().Exec(`INSERT INTO funding_ticker (currency, timestamp, frr, bid, bid_period, bid_size, ask, ask_period, ask_size,
+			daily_change, daily_change_percent, last_price, volume, high, low, frr_amount_available) VALUES ('fUSD', ?, 0.0001, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)`, mts); err != nil {
+			t.Fatalf("failed to seed ticker: %v", err)
+		}
+	}
+	for _, level := range []struct {
+		mts       int64
+		precision api.BookPrecision
+		book      api.FundingBook
+	}{
+		// Both sides, joined to the ticker 1s later
+		{9000, api.PrecisionP0, api.FundingBook{Rate: 0.0001, Period: 2, Count: 1, Amount: -100}},
+		{9000, api.PrecisionP0, api.FundingBook{Rate: 0.00012, Period: 2, Count: 1, Amount: -100}},
+		{9000, api.PrecisionP0, api.FundingBook{Rate: 0.0003, Period: 2, Count: 1, Amount: 100}},
+		// Asks only, joined to the ticker exactly maxGap later
+		{25000, api.PrecisionP0, api.FundingBook{Rate: 0.0004, Period: 2, Count: 1, Amount: 100}},
+		// Other precisions are not joined
+		{30000, api.PrecisionP1, api.FundingBook{Rate: 0.0005, Period: 2, Count: 1, Amount: 100}},
+	} {
+		if _, err := database.SaveFundingBookAt("fUSD", level.precision, level.mts, level.book); err != nil {
+			t.Fatalf("SaveFundingBookAt: %v", err)
+		}
+	}
+
+	history, err := NewTickerBookService(database).GetTickerWithBookHistory(context.Background(), "fUSD", time.UnixMilli(0), time.UnixMilli(50000), 100, 5*time.Second)
+	if err != nil {
+		t.Fatalf("GetTickerWithBookHistory: %v", err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("got %d points, want one per ticker", len(history))
+	}
+
+	first := history[0]
+	if first.BookTimestamp == nil || *first.BookTimestamp != 9000 || *first.BidLevels != 2 || *first.AskLevels != 1 ||
+		first.Spread == nil || math.Abs(*first.Spread-0.00018) > 1e-12 {
+		t.Errorf("ticker at 10000 joined book %v with spread %v, want the 9000 snapshot with 2 bids, 1 ask and spread 0.00018", first.BookTimestamp, first.Spread)
+	}
+
+	// The 9000 snapshot is 11s older than the ticker at 20000, beyond maxGap
+	if history[1].BookTimestamp != nil || history[1].Spread != nil || history[1].BidLevels != nil {
+		t.Errorf("ticker at 20000 joined %+v, want no snapshot within maxGap", history[1])
+	}
+
+	third := history[2]
+	if third.BookTimestamp == nil || *third.BookTimestamp != 25000 || *third.BidLevels != 0 || *third.AskLevels != 1 || third.Spread != nil {
+		t.Errorf("ticker at 30000 joined %+v, want the 25000 P0 snapshot without a spread", third)
+	}
+
+	if history[3].BookTimestamp != nil {
+		t.Errorf("ticker at 40000 joined the snapshot at %d, want none within maxGap", *history[3].BookTimestamp)
+	}
+}
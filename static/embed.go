@@ -0,0 +1,8 @@
+package static
+
+import "embed"
+
+// FS contains the web interface assets embedded into the binary
+//
+//go:embed index.html js views
+var FS embed.FS
@@ -309,7 +309,8 @@ function processDataInChunks(rates) {
     // 生成標籤
     for (let i = 0; i < binCount; i++) {
         const binStart = minRate + i * binWidth;
-        labels[i] = `${binStart.toFixed(2)}%`;
+        const binEnd = binStart + binWidth;
+        labels[i] = `${binStart.toFixed(2)}%–${binEnd.toFixed(2)}%`;
     }
 
     // 分批處理數據填充分箱
@@ -2,6 +2,7 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -56,6 +57,9 @@ func NewGetRawFundingBookTask(client *api.Client, symbol string, resultChan chan
 }
 
 func (t *GetRawFundingBookTask) Execute(ctx context.Context) error {
+	ctx, cancel := t.BindContext(ctx)
+	defer cancel()
+
 	// Create cancelable request using context
 	result, err := t.Client.GetRawFundingBookWithContext(ctx, t.Symbol)
 
@@ -95,6 +99,9 @@ func NewGetFundingBookTask(client *api.Client, symbol string, precision api.Book
 }
 
 func (t *GetFundingBookTask) Execute(ctx context.Context) error {
+	ctx, cancel := t.BindContext(ctx)
+	defer cancel()
+
 	result, err := t.Client.GetFundingBookWithContext(ctx, t.Symbol, t.Precision)
 
 	t.ResultChan <- FundingBookResult{
@@ -113,6 +120,7 @@ type GetFundingStatsTask struct {
 	Start      int64 // Added: start timestamp
 	End        int64 // Added: end timestamp
 	Limit      int
+	Period     int // Offer period in days of the stats, 0 for the stats over all periods
 	ResultChan chan<- FundingStatsResult
 	Storage    db.Storage // Optional
 }
@@ -164,6 +172,9 @@ func NewGetFundingStatsTaskWithTimeRange(
 }
 
 func (t *GetFundingStatsTask) Execute(ctx context.Context) error {
+	ctx, cancel := t.BindContext(ctx)
+	defer cancel()
+
 	var err error
 	var stats []api.FundingStats
 
@@ -176,9 +187,9 @@ func (t *GetFundingStatsTask) Execute(ctx context.Context) error {
 		default:
 			// Use different API call based on whether time range is provided
 			if t.Start > 0 || t.End > 0 {
-				stats, err = t.Client.GetFundingStatsWithTimeRangeWithContext(ctx, t.Symbol, t.Start, t.End, t.Limit)
+				stats, err = t.Client.GetFundingStatsWithTimeRangeWithContext(ctx, t.Symbol, t.Start, t.End, t.Limit, t.Period)
 			} else {
-				stats, err = t.Client.GetFundingStatsWithContext(ctx, t.Symbol, t.Limit)
+				stats, err = t.Client.GetFundingStatsWithContext(ctx, t.Symbol, t.Limit, t.Period)
 			}
 
 			if err == nil {
@@ -186,6 +197,12 @@ func (t *GetFundingStatsTask) Execute(ctx context.Context) error {
 				return nil
 			}
 
+			// Retrying is pointless while the endpoint's circuit is open
+			if errors.Is(err, api.ErrCircuitOpen) {
+				t.ResultChan <- FundingStatsResult{Error: err}
+				return err
+			}
+
 			// If not the last attempt, wait before retrying
 			if attempt < t.RetryPolicy.MaxRetries {
 				backoffDuration := time.Duration(math.Pow(2, float64(attempt))) *
@@ -232,6 +249,9 @@ func NewGetFundingTickerTask(client *api.Client, symbol string, resultChan chan<
 }
 
 func (t *GetFundingTickerTask) Execute(ctx context.Context) error {
+	ctx, cancel := t.BindContext(ctx)
+	defer cancel()
+
 	// Create cancelable request using context
 	result, err := t.Client.GetFundingTickerWithContext(ctx, t.Symbol)
 